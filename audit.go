@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+const auditUsage = "audit [--group <group>] [--parallel N] [--rate N] [--format csv|json] [--output <file>]"
+
+// defaultAuditRate is how many hosts audit starts checking per second.
+const defaultAuditRate = 5
+
+// Host key states in the audit report, against the previous audit.
+const (
+	keyNew       = "new"
+	keyUnchanged = "unchanged"
+	keyChanged   = "changed"
+)
+
+// auditRow is one host's line in the audit report.
+type auditRow struct {
+	Host      string    `json:"host"`
+	Address   string    `json:"address"`
+	Reachable bool      `json:"reachable"`
+	Auth      string    `json:"auth"` // "ok", "failed" or "" when not tried
+	HostKey   string    `json:"host_key"`
+	KeyStatus string    `json:"key_status"` // new, unchanged or changed
+	Version   string    `json:"server_version"`
+	ElapsedMS int64     `json:"elapsed_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// auditSeen is what the previous audit saw of a host.
+type auditSeen struct {
+	HostKey string    `json:"host_key"`
+	Version string    `json:"server_version"`
+	At      time.Time `json:"at"`
+}
+
+// runAudit implements "sshm audit": log in to every host (or every host
+// in a group) without prompting and report whether it was reachable,
+// whether the login worked, its host key and whether that changed since
+// the last audit, and its SSH server version.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	group := fs.String("group", "", "only audit the hosts under `group`")
+	parallel := fs.Int("parallel", defaultGroupParallel, "hosts to check at once")
+	rate := fs.Int("rate", defaultAuditRate, "hosts to start checking per second (0 for no limit)")
+	format := fs.String("format", "csv", "report format, csv or json")
+	output := fs.String("output", "", "write the report to `file` instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+
+	switch {
+	case fs.NArg() > 0:
+		return usageErrorf("usage: sshm %s", auditUsage)
+	case *parallel < 1:
+		return usageErrorf("--parallel must be at least 1")
+	case *rate < 0:
+		return usageErrorf("--rate must not be negative")
+	case *format != "csv" && *format != "json":
+		return usageErrorf("--format must be csv or json")
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	hosts := cfg.Hosts
+	prefix := ""
+	if *group != "" {
+		node := cfg.FindHost(*group)
+		switch {
+		case node == nil:
+			return usageErrorf("group %q not found", *group)
+		case len(node.Children) == 0:
+			return usageErrorf("%q is a host, not a group", *group)
+		}
+		hosts, prefix = node.Children, strings.TrimSuffix(*group, "/")+"/"
+	}
+	refs := allLeaves(hosts, prefix)
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	seen := loadAuditSeen()
+	saw := make(map[string]auditSeen)
+	rows := auditHosts(refs, *parallel, *rate)
+	for i := range rows {
+		row := &rows[i]
+		prev, ok := seen[row.Host]
+		switch {
+		case row.HostKey == "":
+		case !ok || prev.HostKey == "":
+			row.KeyStatus = keyNew
+		case prev.HostKey == row.HostKey:
+			row.KeyStatus = keyUnchanged
+		default:
+			row.KeyStatus = keyChanged
+		}
+		if row.HostKey != "" {
+			saw[row.Host] = auditSeen{HostKey: row.HostKey, Version: row.Version, At: row.CheckedAt}
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rows)
+	} else {
+		err = writeAuditCSV(out, rows)
+	}
+	if err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	if err := saveAuditSeen(saw); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: save audit state: %v\n", err)
+	}
+
+	if !quiet {
+		var reachable, loggedIn, changed int
+		for _, row := range rows {
+			if row.Reachable {
+				reachable++
+			}
+			if row.Auth == "ok" {
+				loggedIn++
+			}
+			if row.KeyStatus == keyChanged {
+				changed++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Audited %d hosts: %d reachable, %d logged in, %d host keys changed\n",
+			len(rows), reachable, loggedIn, changed)
+	}
+	return nil
+}
+
+// auditHosts checks refs, parallel at a time and starting at most rate
+// per second, and returns their rows in the same order.
+func auditHosts(refs []config.HostRef, parallel, rate int) []auditRow {
+	rows := make([]auditRow, len(refs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallel, len(refs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rows[i] = auditHost(refs[i])
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for i := range refs {
+		if tick != nil && i > 0 {
+			<-tick
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return rows
+}
+
+// auditHost probes one host for the report.
+func auditHost(ref config.HostRef) auditRow {
+	host := ref.Host
+	row := auditRow{
+		Host:      ref.Path,
+		Address:   host.User + "@" + net.JoinHostPort(host.Host, strconv.Itoa(host.Port)),
+		CheckedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	p := ssh.ProbeHost(host)
+	row.Reachable = p.Reachable
+	row.Version = p.Version
+	row.ElapsedMS = p.Elapsed.Milliseconds()
+	if p.Fingerprint != "" {
+		row.HostKey = p.KeyType + " " + p.Fingerprint
+	}
+	switch {
+	case p.Err == nil:
+		row.Auth = "ok"
+	case ssh.IsAuthError(p.Err):
+		row.Auth = "failed"
+	}
+	if p.Err != nil {
+		row.Error = p.Err.Error()
+	}
+	return row
+}
+
+// writeAuditCSV writes the report with a header line.
+func writeAuditCSV(w io.Writer, rows []auditRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"host", "address", "reachable", "auth", "host_key", "key_status",
+		"server_version", "elapsed_ms", "error", "checked_at",
+	})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Host, r.Address, strconv.FormatBool(r.Reachable), r.Auth, r.HostKey, r.KeyStatus,
+			r.Version, strconv.FormatInt(r.ElapsedMS, 10), r.Error, r.CheckedAt.Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// auditStateFile is where what audits saw is kept in the state directory.
+const auditStateFile = "audit.json"
+
+// loadAuditSeen reads what the previous audits saw, by host path. A
+// missing or corrupt file counts as no previous audit.
+func loadAuditSeen() map[string]auditSeen {
+	path, err := state.Path(auditStateFile)
+	if err != nil {
+		return make(map[string]auditSeen)
+	}
+	data, _ := os.ReadFile(path)
+	return parseAuditSeen(data)
+}
+
+func parseAuditSeen(data []byte) map[string]auditSeen {
+	seen := make(map[string]auditSeen)
+	_ = json.Unmarshal(data, &seen)
+	return seen
+}
+
+// saveAuditSeen records what this audit saw, keeping what audits of
+// other hosts, possibly running at the same time, saw.
+func saveAuditSeen(saw map[string]auditSeen) error {
+	return state.Update(auditStateFile, func(data []byte) ([]byte, error) {
+		seen := parseAuditSeen(data)
+		for host, s := range saw {
+			seen[host] = s
+		}
+		return json.MarshalIndent(seen, "", "  ")
+	})
+}
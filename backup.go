@@ -0,0 +1,453 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/secrets"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+const backupUsage = "backup create|restore [--force] <file>"
+
+// Entries of a backup bundle: the config file, known_hosts, and the state
+// directory's files under backupState.
+const (
+	backupConfig     = "config.yaml"
+	backupKnownHosts = "known_hosts"
+	backupState      = "state/"
+)
+
+// runBackup implements "sshm backup": bundle the config, the state
+// (history, favorites, caches) and known_hosts into one file encrypted
+// with a passphrase (age format), or restore such a bundle on another
+// machine.
+func runBackup(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("usage: sshm %s", backupUsage)
+	}
+	fs := flag.NewFlagSet("backup "+args[0], flag.ContinueOnError)
+	force := fs.Bool("force", false, "overwrite existing files")
+	if err := fs.Parse(args[1:]); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: sshm %s", backupUsage)
+	}
+	switch args[0] {
+	case "create":
+		return runBackupCreate(fs.Arg(0), *force)
+	case "restore":
+		return runBackupRestore(fs.Arg(0), *force)
+	}
+	return usageErrorf("unknown backup command %q (want create or restore)", args[0])
+}
+
+// runBackupCreate writes a bundle to file.
+func runBackupCreate(file string, force bool) error {
+	files, err := backupFiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := files[backupConfig]; !ok {
+		return withCode(exitConfig, errors.New("no config file to back up"))
+	}
+
+	passphrase := os.Getenv(secrets.PassphraseEnv)
+	if passphrase == "" {
+		if passphrase, err = askSecret("New backup passphrase: "); err != nil {
+			return err
+		}
+		again, err := askSecret("Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		if passphrase != again {
+			return usageErrorf("passphrases do not match")
+		}
+	}
+	if passphrase == "" {
+		return usageErrorf("empty passphrase")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(file, flags, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return usageErrorf("%s exists; use --force to overwrite it", file)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(f, recipient, files); err != nil {
+		f.Close()
+		os.Remove(file)
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(file)
+		return err
+	}
+
+	infof("Backed up %s to %s\n", describeBundle(files), file)
+	return nil
+}
+
+// backupFiles collects what goes into a bundle, by entry name: the user's
+// config file, known_hosts when there is one, and the regular files of the
+// state directory. Session recordings, the daemon's log and sockets stay
+// behind.
+func backupFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	if path, ok := userConfigPath(); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, withCode(exitConfig, err)
+		}
+		files[backupConfig] = data
+	}
+
+	if path, err := ssh.KnownHostsPath(); err == nil {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			files[backupKnownHosts] = data
+		}
+	}
+
+	dir, err := state.Dir()
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "logs" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || rel == "daemon.log" || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[backupState+rel] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read state directory: %w", err)
+	}
+	return files, nil
+}
+
+// userConfigPath returns the user's config file, the first of
+// config.DefaultConfigPaths that exists other than the system-wide one.
+func userConfigPath() (string, bool) {
+	paths, err := config.DefaultConfigPaths()
+	if err != nil {
+		return "", false
+	}
+	for _, p := range paths {
+		if p == config.SystemConfigPath {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// writeBundle writes files to w as a gzipped tar, encrypted for recipient.
+func writeBundle(w io.Writer, recipient age.Recipient, files map[string][]byte) error {
+	enc, err := age.Encrypt(w, recipient)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(enc)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// runBackupRestore unpacks the bundle in file. The config and state files
+// it holds must not exist yet unless force is set; known_hosts entries are
+// added to the existing ones.
+func runBackupRestore(file string, force bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	passphrase := os.Getenv(secrets.PassphraseEnv)
+	if passphrase == "" {
+		if passphrase, err = askSecret("Backup passphrase: "); err != nil {
+			return err
+		}
+	}
+	files, err := readBundle(f, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// Where each entry goes; known_hosts is merged, not placed
+	targets := make(map[string]string)
+	if _, ok := files[backupConfig]; ok {
+		target, ok := userConfigPath()
+		if !ok {
+			if target, err = config.DefaultConfigPath(); err != nil {
+				return err
+			}
+		}
+		targets[backupConfig] = target
+	}
+	for name := range files {
+		if rel, ok := strings.CutPrefix(name, backupState); ok {
+			target, err := state.Path(filepath.FromSlash(rel))
+			if err != nil {
+				return err
+			}
+			targets[name] = target
+		}
+	}
+
+	if !force {
+		var existing []string
+		for _, target := range targets {
+			if _, err := os.Stat(target); err == nil {
+				existing = append(existing, target)
+			}
+		}
+		if len(existing) > 0 {
+			sort.Strings(existing)
+			return usageErrorf("would overwrite %s; use --force", strings.Join(existing, ", "))
+		}
+	}
+
+	for name, target := range targets {
+		rel, ok := strings.CutPrefix(name, backupState)
+		if !ok {
+			if err := writePrivate(target, files[name]); err != nil {
+				return err
+			}
+			continue
+		}
+		// Locked like any other write of the state
+		err := state.Update(filepath.FromSlash(rel), func([]byte) ([]byte, error) {
+			return files[name], nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	added, err := mergeKnownHosts(files[backupKnownHosts])
+	if err != nil {
+		return fmt.Errorf("known_hosts: %w", err)
+	}
+
+	infof("Restored %s from %s", describeBundle(files), file)
+	if _, ok := files[backupKnownHosts]; ok {
+		infof(" (%d new known_hosts entries)", added)
+	}
+	infof("\n")
+	return nil
+}
+
+// readBundle decrypts and unpacks a bundle.
+func readBundle(r io.Reader, passphrase string) (map[string][]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := age.Decrypt(r, identity)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, withCode(exitAuth, secrets.ErrWrongPassphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not an sshm backup: %w", err)
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, fmt.Errorf("not an sshm backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !validBackupEntry(hdr.Name) {
+			return nil, fmt.Errorf("read backup: unexpected entry %q", hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read backup: %w", err)
+		}
+		files[hdr.Name] = data
+	}
+}
+
+// validBackupEntry reports whether name is one of the entries a bundle
+// holds. Entries name where they are restored to, so none may point
+// outside the state directory.
+func validBackupEntry(name string) bool {
+	if name == backupConfig || name == backupKnownHosts {
+		return true
+	}
+	rel, ok := strings.CutPrefix(name, backupState)
+	return ok && path.Clean(rel) == rel && filepath.IsLocal(filepath.FromSlash(rel))
+}
+
+// writePrivate replaces the file at path with data readable only by the
+// user, creating its directory if needed.
+func writePrivate(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// mergeKnownHosts adds the lines of data missing from known_hosts and
+// returns how many it added.
+func mergeKnownHosts(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	path, err := ssh.KnownHostsPath()
+	if err != nil {
+		return 0, err
+	}
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(current), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	var add bytes.Buffer
+	if len(current) > 0 && !bytes.HasSuffix(current, []byte("\n")) {
+		add.WriteByte('\n')
+	}
+	added := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || have[line] {
+			continue
+		}
+		have[line] = true
+		add.WriteString(line + "\n")
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(add.Bytes()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return added, f.Close()
+}
+
+// describeBundle sums up what a bundle holds, e.g. "the config, 4 state
+// files and known_hosts".
+func describeBundle(files map[string][]byte) string {
+	var parts []string
+	if _, ok := files[backupConfig]; ok {
+		parts = append(parts, "the config")
+	}
+	stateFiles := 0
+	for name := range files {
+		if strings.HasPrefix(name, backupState) {
+			stateFiles++
+		}
+	}
+	switch stateFiles {
+	case 0:
+	case 1:
+		parts = append(parts, "1 state file")
+	default:
+		parts = append(parts, fmt.Sprintf("%d state files", stateFiles))
+	}
+	if _, ok := files[backupKnownHosts]; ok {
+		parts = append(parts, "known_hosts")
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
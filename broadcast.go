@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/ai-help-me/sshm/pkg/tui"
+)
+
+// runBroadcast applies the action chosen in the TUI to the marked hosts:
+// "exec" runs command on them, defaultGroupParallel at a time, as exec
+// --group does; "ssh" opens a session on each in turn, moving on when it
+// ends. It returns how it went on each host, and an error listing the
+// hosts it failed on.
+func runBroadcast(refs []config.HostRef, action, command string, termMgr *terminal.Manager) ([]tui.BroadcastResult, error) {
+	var errs []error
+	what := "command"
+	switch action {
+	case "exec":
+		errs = execEach(refs, command, defaultGroupParallel)
+
+	case "ssh":
+		what = "session"
+		errs = make([]error, len(refs))
+		for i, ref := range refs {
+			infof("[%d/%d] %s\n", i+1, len(refs), ref.Path)
+			errs[i] = connectToHost(ref, "ssh", termMgr)
+			if errs[i] != nil {
+				fmt.Fprintf(os.Stderr, "Connection error: %v\n", errs[i])
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", action)
+	}
+
+	results := make([]tui.BroadcastResult, len(refs))
+	for i, ref := range refs {
+		results[i] = tui.BroadcastResult{Path: ref.Path, Err: errs[i]}
+	}
+	return results, hostsFailure(what, refs, errs)
+}
+
+// waitForEnter holds the output of a broadcast action on screen until
+// Enter is pressed, before the TUI takes the screen back.
+func waitForEnter() {
+	fmt.Fprintf(os.Stderr, "Press Enter to return to the host list ")
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+}
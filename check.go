@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+const checkUsage = "check [--parallel N] [group|host]"
+
+// runCheck implements "sshm check": log in to every host (or the hosts
+// under a group, or a single host) at once without prompting and print
+// which are reachable, how long the login took and whether it worked.
+// Unlike audit it keeps nothing and is meant for a quick look, e.g. after
+// a network change.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	parallel := fs.Int("parallel", defaultGroupParallel, "hosts to check at once")
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	switch {
+	case fs.NArg() > 1:
+		return usageErrorf("usage: sshm %s", checkUsage)
+	case *parallel < 1:
+		return usageErrorf("--parallel must be at least 1")
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	refs, err := checkTargets(cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return usageErrorf("no hosts to check")
+	}
+
+	rows := auditHosts(refs, *parallel, 0)
+	table := [][]string{{"HOST", "ADDRESS", "STATE", "TIME", "AUTH"}}
+	for _, row := range rows {
+		reach, auth := "reachable", row.Auth
+		if !row.Reachable {
+			reach = "unreachable"
+		}
+		if auth == "" {
+			auth = "-"
+		}
+		elapsed := (time.Duration(row.ElapsedMS) * time.Millisecond).String()
+		table = append(table, []string{row.Host, row.Address, reach, elapsed, auth})
+	}
+	printTable(table)
+
+	// Why each failing host failed, below the table as status does
+	failed := 0
+	code := exitOK
+	for _, row := range rows {
+		if row.Error == "" {
+			continue
+		}
+		fmt.Printf("%s: %s\n", row.Host, row.Error)
+		failed++
+		c := exitError
+		switch {
+		case !row.Reachable:
+			c = exitNetwork
+		case row.Auth == "failed":
+			c = exitAuth
+		}
+		if code == exitOK || c == code {
+			code = c
+		} else {
+			code = exitError
+		}
+	}
+	if failed > 0 {
+		return withCode(code, fmt.Errorf("%d of %d hosts failed the check", failed, len(rows)))
+	}
+	infof("All %d hosts reachable and logged in\n", len(rows))
+	return nil
+}
+
+// checkTargets returns the hosts named by arg: all of them when it is
+// empty, the hosts under it when it is a group, or the host itself.
+func checkTargets(cfg *config.Config, arg string) ([]config.HostRef, error) {
+	if arg == "" {
+		return allLeaves(cfg.Hosts, ""), nil
+	}
+	if node := cfg.FindHost(arg); node != nil && len(node.Children) > 0 {
+		return allLeaves(node.Children, strings.TrimSuffix(arg, "/")+"/"), nil
+	}
+	ref, err := resolveHost(cfg, arg)
+	if err != nil {
+		return nil, err
+	}
+	return []config.HostRef{ref}, nil
+}
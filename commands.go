@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/state"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// quiet suppresses sshm's own informational output (-q). Errors are
+// still written to stderr.
+var quiet bool
+
+// logFormat records every SSH session in this format (--log), whatever
+// the hosts' session-log says.
+var logFormat string
+
+// parseGlobalFlags consumes the flags that come before the subcommand
+// name and returns the remaining arguments.
+func parseGlobalFlags(args []string) ([]string, error) {
+	for len(args) > 0 {
+		switch args[0] {
+		case "-q", "--quiet":
+			quiet = true
+		case "--events-fd":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("--events-fd needs a file descriptor")
+			}
+			if err := openEvents(args[1]); err != nil {
+				return nil, err
+			}
+			args = args[1:]
+		case "--log":
+			logFormat = config.SessionLogText
+		case "-v", "--verbose":
+			verbosity++
+		case "-vv":
+			verbosity += 2
+		case "--debug-log":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("--debug-log needs a file")
+			}
+			debugLog = args[1]
+			args = args[1:]
+		case "--":
+			return args[1:], nil
+		default:
+			if format, ok := strings.CutPrefix(args[0], "--log="); ok {
+				if format != config.SessionLogText && format != config.SessionLogAsciinema {
+					return nil, fmt.Errorf("--log must be %s or %s", config.SessionLogText, config.SessionLogAsciinema)
+				}
+				logFormat = format
+				break
+			}
+			if file, ok := strings.CutPrefix(args[0], "--debug-log="); ok {
+				debugLog = file
+				break
+			}
+			if fd, ok := strings.CutPrefix(args[0], "--events-fd="); ok {
+				if err := openEvents(fd); err != nil {
+					return nil, err
+				}
+				break
+			}
+			if strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+				return nil, fmt.Errorf("unknown flag: %s", args[0])
+			}
+			return args, nil
+		}
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// infof prints informational output unless -q is set.
+func infof(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// subcommand is a non-interactive sshm command (sshm <name> ...).
+type subcommand struct {
+	usage string
+	run   func(args []string) error
+}
+
+// subcommands are dispatched from main when arguments are given.
+var subcommands = map[string]subcommand{
+	"audit": {
+		usage: auditUsage,
+		run:   runAudit,
+	},
+	"backup": {
+		usage: backupUsage,
+		run:   runBackup,
+	},
+	"check": {
+		usage: checkUsage,
+		run:   runCheck,
+	},
+	"config": {
+		usage: configUsage,
+		run:   runConfig,
+	},
+	"connect": {
+		usage: connectUsage,
+		run:   runConnect,
+	},
+	"daemon": {
+		usage: daemonUsage,
+		run:   runDaemon,
+	},
+	"exec": {
+		usage: execUsage,
+		run:   runExec,
+	},
+	"edit": {
+		usage: editUsage,
+		run:   runEdit,
+	},
+	"history": {
+		usage: historyUsage,
+		run:   runHistory,
+	},
+	"migrate": {
+		usage: migrateUsage,
+		run:   runMigrate,
+	},
+	"sftp": {
+		usage: sftpUsage,
+		run:   runSFTPCommand,
+	},
+	"stats": {
+		usage: statsUsage,
+		run:   runStats,
+	},
+	"status": {
+		usage: statusUsage,
+		run:   runStatus,
+	},
+	"tunnel": {
+		usage: tunnelUsage,
+		run:   runTunnel,
+	},
+}
+
+// runSubcommand runs sshm <name> args... and returns the process exit code.
+func runSubcommand(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return exitOK
+	}
+
+	cmd, ok := subcommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+		printUsage()
+		return exitUsage
+	}
+	if w := stateWarning(); w != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	err := cmd.run(args[1:])
+	var status remoteExit
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case !errors.Is(err, errCancelled) && !errors.As(err, &status):
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return exitCode(err)
+}
+
+// stateWarning explains why state is kept in a temp directory, or not
+// kept at all, and returns "" when the state directory is usable.
+func stateWarning() string {
+	if _, err := state.Dir(); err != nil {
+		return fmt.Sprintf("%v; caches, history and logs are not kept", err)
+	}
+	return state.Warning()
+}
+
+// printUsage lists the available subcommands.
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  sshm [-q]            open the host selector\n")
+	for _, name := range sortedSubcommands() {
+		fmt.Fprintf(os.Stderr, "  sshm [-q] %s\n", subcommands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\n  -q, --quiet          suppress informational output; errors still go to stderr\n")
+	fmt.Fprintf(os.Stderr, "  --log[=text|asciinema]\n")
+	fmt.Fprintf(os.Stderr, "                       record SSH sessions' output under the state directory's logs/\n")
+	fmt.Fprintf(os.Stderr, "  -v, -vv              log handshakes, host keys and auth attempts; -vv adds\n")
+	fmt.Fprintf(os.Stderr, "                       channel opens, keepalives and SFTP packet counts\n")
+	fmt.Fprintf(os.Stderr, "  --debug-log <file>   append -v output (-v implied) to file instead of stderr\n")
+	fmt.Fprintf(os.Stderr, "  --events-fd <fd>     write JSON events (connect-start, auth-ok, session-end,\n")
+	fmt.Fprintf(os.Stderr, "                       transfer-progress) to an open file descriptor\n")
+}
+
+// sortedSubcommands returns the subcommand names in alphabetical order.
+func sortedSubcommands() []string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveHost finds the host a subcommand targets, either by path
+// ("prod/web1") or, when unambiguous, by bare name.
+func resolveHost(cfg *config.Config, name string) (config.HostRef, error) {
+	var refs []config.HostRef
+	for _, ref := range allLeaves(cfg.Hosts, "") {
+		if ref.Path == name || (!strings.Contains(name, "/") && ref.Host.Name == name) {
+			refs = append(refs, ref)
+		}
+	}
+
+	switch {
+	case len(refs) == 1:
+		return refs[0], nil
+	case len(refs) > 1:
+		// An exact path wins over bare name matches deeper in the tree
+		for _, ref := range refs {
+			if ref.Path == name {
+				return ref, nil
+			}
+		}
+		paths := make([]string, len(refs))
+		for i, ref := range refs {
+			paths[i] = ref.Path
+		}
+		return config.HostRef{}, usageErrorf("host %q is ambiguous: %s", name, strings.Join(paths, ", "))
+	case cfg.FindHost(name) != nil:
+		return config.HostRef{}, usageErrorf("%q is a group, not a host", name)
+	}
+	return config.HostRef{}, usageErrorf("host %q not found", name)
+}
+
+// allLeaves returns every leaf host, including shared ones, with its path.
+func allLeaves(hosts []*config.Host, prefix string) []config.HostRef {
+	var refs []config.HostRef
+	for _, h := range hosts {
+		if len(h.Children) > 0 {
+			refs = append(refs, allLeaves(h.Children, prefix+h.Name+"/")...)
+			continue
+		}
+		refs = append(refs, config.HostRef{Path: prefix + h.Name, Host: h})
+	}
+	return refs
+}
+
+// dialHost connects to host, through its jump chain if it has one. The
+// returned func closes the connection.
+func dialHost(host *config.Host) (*gossh.Client, func(), error) {
+	conn, err := connect(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn.SSHClient(), func() { conn.Close() }, nil
+}
+
+// connect establishes a connection to host, through its jump chain if it
+// has one.
+func connect(host *config.Host) (ssh.Connector, error) {
+	if len(host.Jump) > 0 {
+		jumpChain := ssh.NewJumpChainWithTarget(host)
+		if _, err := jumpChain.Connect(); err != nil {
+			jumpChain.Close()
+			return nil, fmt.Errorf("jump chain: %w", err)
+		}
+		return jumpChain, nil
+	}
+
+	sshClient, err := ssh.NewClient(host)
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	if err := sshClient.Dial(); err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return sshClient, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/secrets"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"golang.org/x/term"
+)
+
+const configUsage = "config encrypt|decrypt|path"
+
+// passphraseTries is how many times a wrong passphrase may be re-entered.
+const passphraseTries = 3
+
+// runConfig implements "sshm config": encrypt or decrypt the passwords
+// and key passphrases stored in the config with a master passphrase, or
+// show which config files are in use.
+func runConfig(args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("usage: sshm %s", configUsage)
+	}
+	switch args[0] {
+	case "encrypt":
+		return runConfigEncrypt()
+	case "decrypt":
+		return runConfigDecrypt()
+	case "path":
+		return runConfigPath()
+	}
+	return usageErrorf("unknown config command %q (want encrypt, decrypt or path)", args[0])
+}
+
+// runConfigPath prints the config file loaded and the shared inventories
+// layered beneath it, one per line, then (unless -q) the files looked for
+// in order of precedence.
+func runConfigPath() error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+
+	if cfg.FromFile() {
+		fmt.Println(cfg.Path)
+	}
+	for _, src := range cfg.Sources {
+		fmt.Printf("%s (shared)\n", src.Location)
+	}
+
+	paths, _ := config.DefaultConfigPaths()
+	infof("\nSearched, first found is loaded:\n")
+	for _, p := range paths {
+		mark := " "
+		if p == cfg.Path && cfg.FromFile() {
+			mark = "*"
+		}
+		if _, err := os.Stat(p); err != nil {
+			infof("  %s %s (not found)\n", mark, p)
+		} else {
+			infof("  %s %s\n", mark, p)
+		}
+	}
+	if !cfg.FromFile() {
+		infof("\nNo personal config; edits are saved to %s\n", cfg.Path)
+	}
+	return nil
+}
+
+// runConfigEncrypt encrypts every cleartext password and key passphrase.
+// Values that are already encrypted must open with the same passphrase.
+func runConfigEncrypt() error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+
+	var plain, sealed []*string
+	for _, p := range secretFields(cfg.Hosts) {
+		if secrets.IsEncrypted(*p) {
+			sealed = append(sealed, p)
+		} else {
+			plain = append(plain, p)
+		}
+	}
+	if len(plain) == 0 {
+		infof("No cleartext secrets in %s\n", cfg.Path)
+		return nil
+	}
+
+	key, err := configKey(sealed)
+	if err != nil {
+		return err
+	}
+	for _, p := range plain {
+		if *p, err = key.Encrypt(*p); err != nil {
+			return err
+		}
+	}
+	if err := config.Save(cfg, ""); err != nil {
+		return withCode(exitConfig, err)
+	}
+	infof("Encrypted %d secrets in %s\n", len(plain), cfg.Path)
+	return nil
+}
+
+// runConfigDecrypt writes every encrypted value back in cleartext.
+func runConfigDecrypt() error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+
+	var sealed []*string
+	for _, p := range secretFields(cfg.Hosts) {
+		if secrets.IsEncrypted(*p) {
+			sealed = append(sealed, p)
+		}
+	}
+	if len(sealed) == 0 {
+		infof("No encrypted secrets in %s\n", cfg.Path)
+		return nil
+	}
+
+	passphrase, err := unlockPassphrase(*sealed[0])
+	if err != nil {
+		return err
+	}
+	for _, p := range sealed {
+		if *p, err = secrets.Decrypt(*p, passphrase); err != nil {
+			return withCode(exitConfig, fmt.Errorf("decrypt: %w", err))
+		}
+	}
+	if err := config.Save(cfg, ""); err != nil {
+		return withCode(exitConfig, err)
+	}
+	infof("Decrypted %d secrets in %s\n", len(sealed), cfg.Path)
+	return nil
+}
+
+// secretFields returns the non-empty passwords and key passphrases of the
+// personal hosts, jump hops included. Keychain references are left out, and
+// shared hosts are never written back.
+func secretFields(hosts []*config.Host) []*string {
+	var fields []*string
+	seen := make(map[*config.Host]bool)
+	var walk func(hosts []*config.Host)
+	walk = func(hosts []*config.Host) {
+		for _, h := range hosts {
+			if h.Shared || seen[h] {
+				continue
+			}
+			seen[h] = true
+			for _, p := range []*string{&h.Password, &h.KeyPassphrase} {
+				if *p != "" && !secrets.IsKeychainRef(*p) {
+					fields = append(fields, p)
+				}
+			}
+			walk(h.Jump)
+			walk(h.Children)
+		}
+	}
+	walk(hosts)
+	return fields
+}
+
+// configKey returns the key new passwords are encrypted with: the one the
+// existing encrypted passwords use, or a new one from a passphrase chosen
+// now.
+func configKey(sealed []*string) (*secrets.Key, error) {
+	if len(sealed) > 0 {
+		passphrase, err := unlockPassphrase(*sealed[0])
+		if err != nil {
+			return nil, err
+		}
+		return secrets.KeyFor(*sealed[0], passphrase)
+	}
+
+	passphrase := secrets.Unlocked()
+	if passphrase == "" {
+		var err error
+		if passphrase, err = askSecret("New config passphrase: "); err != nil {
+			return nil, err
+		}
+		again, err := askSecret("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if passphrase != again {
+			return nil, usageErrorf("passphrases do not match")
+		}
+		if passphrase == "" {
+			return nil, usageErrorf("empty passphrase")
+		}
+	}
+	key, err := secrets.NewKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	secrets.Remember(passphrase)
+	return key, nil
+}
+
+// unlockPassphrase returns the master passphrase that opens value.
+func unlockPassphrase(value string) (string, error) {
+	if passphrase := secrets.Unlocked(); passphrase != "" {
+		if _, err := secrets.Decrypt(value, passphrase); err == nil {
+			return passphrase, nil
+		}
+	}
+	for i := 0; i < passphraseTries; i++ {
+		passphrase, err := askSecret("Config passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		_, err = secrets.Decrypt(value, passphrase)
+		if err == nil {
+			secrets.Remember(passphrase)
+			return passphrase, nil
+		}
+		if !errors.Is(err, secrets.ErrWrongPassphrase) {
+			return "", withCode(exitConfig, err)
+		}
+		fmt.Fprintln(os.Stderr, "Wrong passphrase, try again.")
+	}
+	return "", withCode(exitAuth, secrets.ErrWrongPassphrase)
+}
+
+// askSecret reads a passphrase from the terminal without echo.
+func askSecret(prompt string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", withCode(exitUsage, fmt.Errorf("no terminal to ask for the passphrase; set %s", secrets.PassphraseEnv))
+	}
+	return terminal.New().Prompt(prompt, false)
+}
+
+// offerSavePassword asks whether to store a password typed at the login
+// prompt in the host's config entry, encrypted. Failures are reported but
+// do not affect the session.
+func offerSavePassword(host *config.Host, password string) {
+	if password == "" || host.Shared || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Save the password for %s to the config (encrypted)? [y/N] ", host.Name)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		return
+	}
+	if err := savePassword(host, password); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: save password: %v\n", err)
+	}
+}
+
+// savePassword encrypts password into the host's entry of the config file.
+// The config is reloaded so only this field changes.
+func savePassword(host *config.Host, password string) error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+
+	var entry *config.Host
+	for _, ref := range allLeaves(cfg.Hosts, "") {
+		h := ref.Host
+		if !h.Shared && h.Name == host.Name && h.Host == host.Host && h.User == host.User && h.Port == host.Port {
+			entry = h
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("%s not found in %s", host.Name, cfg.Path)
+	}
+
+	var sealed []*string
+	for _, p := range secretFields(cfg.Hosts) {
+		if secrets.IsEncrypted(*p) {
+			sealed = append(sealed, p)
+		}
+	}
+	key, err := configKey(sealed)
+	if err != nil {
+		return err
+	}
+	if entry.Password, err = key.Encrypt(password); err != nil {
+		return err
+	}
+	if err := config.Save(cfg, ""); err != nil {
+		return err
+	}
+	infof("Saved the password for %s to %s\n", host.Name, cfg.Path)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+)
+
+const (
+	connectUsage = "connect <host>"
+	sftpUsage    = "sftp <host>"
+)
+
+// runConnect implements "sshm connect": open an SSH shell on the named
+// host without the TUI.
+func runConnect(args []string) error {
+	return connectByName("connect", "ssh", args)
+}
+
+// runSFTPCommand implements "sshm sftp": open the SFTP shell on the named
+// host without the TUI.
+func runSFTPCommand(args []string) error {
+	return connectByName("sftp", "sftp", args)
+}
+
+// connectByName resolves a host path ("prod/web1") or unique host name and
+// connects to it in the given mode.
+func connectByName(name, mode string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: sshm %s <host>", name)
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	ref, err := resolveHost(cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	useSettings(cfg)
+
+	termMgr := terminal.New()
+	defer termMgr.Cleanup()
+	ssh.SetPrompter(termMgr.Prompt)
+
+	return connectToHost(ref, mode, termMgr)
+}
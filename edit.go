@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+const editUsage = "edit --group <path> --set key=value [--set ...] [--yes]"
+
+// setFlags collects repeated --set key=value flags.
+type setFlags [][2]string
+
+func (s *setFlags) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *setFlags) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("want key=value, got %q", v)
+	}
+	*s = append(*s, [2]string{strings.TrimSpace(key), value})
+	return nil
+}
+
+// runEdit implements "sshm edit": set fields on every host in a group,
+// showing the changes and asking for confirmation before saving.
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	group := fs.String("group", "", "group path to edit, e.g. prod or prod/eu (empty for all hosts)")
+	yes := fs.Bool("yes", false, "save without asking")
+	var sets setFlags
+	fs.Var(&sets, "set", "field to set as key=value (repeatable); fields: "+strings.Join(config.BulkFields, ", "))
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if len(sets) == 0 {
+		return usageErrorf("usage: sshm %s", editUsage)
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	leaves, err := cfg.GroupLeaves(*group)
+	if err != nil {
+		return withCode(exitUsage, err)
+	}
+	changes, err := config.PlanEdit(leaves, sets)
+	if err != nil {
+		return withCode(exitUsage, err)
+	}
+	if len(changes) == 0 {
+		infof("Nothing to change in %d host(s)\n", len(leaves))
+		return nil
+	}
+
+	// The preview is what the user confirms, so only -q with --yes hides it
+	if !*yes || !quiet {
+		printChanges(changes)
+	}
+
+	if !*yes {
+		fmt.Printf("\nApply %d change(s) to %s? [y/N] ", len(changes), cfg.Path)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Aborted")
+			return errCancelled
+		}
+	}
+
+	if err := config.ApplyEdit(changes); err != nil {
+		return err
+	}
+	if err := config.Save(cfg, ""); err != nil {
+		return err
+	}
+	infof("Saved %s\n", cfg.Path)
+	return nil
+}
+
+// printChanges prints the edit preview as a diff grouped by host.
+func printChanges(changes []config.FieldChange) {
+	last := ""
+	for _, c := range changes {
+		if c.Path != last {
+			fmt.Printf("%s\n", c.Path)
+			last = c.Path
+		}
+		fmt.Printf("  - %s: %s\n", c.Key, c.Old)
+		fmt.Printf("  + %s: %s\n", c.Key, c.New)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/events"
+)
+
+// openEvents handles --events-fd.
+func openEvents(arg string) error {
+	fd, err := strconv.Atoi(arg)
+	if err != nil || fd < 0 {
+		return fmt.Errorf("invalid --events-fd %q", arg)
+	}
+	return events.Open(fd)
+}
+
+// hostEvent returns an event of the given type about a session on host.
+func hostEvent(typ string, host *config.Host, mode string) events.Event {
+	return events.Event{
+		Type:    typ,
+		Host:    host.Name,
+		Address: host.User + "@" + net.JoinHostPort(host.Host, strconv.Itoa(host.Port)),
+		Mode:    mode,
+	}
+}
+
+// emitSessionEnd reports how a session on host ended, with the exit code
+// sshm exits with.
+func emitSessionEnd(host *config.Host, mode string, err error) {
+	e := hostEvent(events.SessionEnd, host, mode)
+	code := exitCode(err)
+	e.ExitCode = &code
+	if err != nil {
+		e.Error = err.Error()
+	}
+	events.Emit(e)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/events"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const execUsage = "exec {<host> [-t|-T] [--output <file> [--tee]] | --group <group> [--parallel N]} -- <command>"
+
+// defaultGroupParallel is how many hosts exec --group runs on at once.
+const defaultGroupParallel = 10
+
+// runExec implements "sshm exec": run one command on a host and stream its
+// output. A PTY is only allocated when both stdin and stdout are terminals,
+// so the output can be piped (sshm exec web1 -- journalctl -u app | less).
+func runExec(args []string) (err error) {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	forceTTY := fs.Bool("t", false, "force PTY allocation")
+	noTTY := fs.Bool("T", false, "disable PTY allocation")
+	output := fs.String("output", "", "write the command's stdout to `file`")
+	tee := fs.Bool("tee", false, "with --output, also copy stdout to the terminal")
+	group := fs.String("group", "", "run on every host under `group`")
+	parallel := fs.Int("parallel", defaultGroupParallel, "with --group, hosts to run on at once")
+
+	// Flags may come before or after the host
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if *group != "" {
+		command := strings.Join(fs.Args(), " ")
+		switch {
+		case command == "":
+			return usageErrorf("usage: sshm %s", execUsage)
+		case *forceTTY || *output != "":
+			return usageErrorf("--group cannot be combined with -t or --output")
+		case *parallel < 1:
+			return usageErrorf("--parallel must be at least 1")
+		}
+		cfg, err := config.Load("")
+		if err != nil {
+			return withCode(exitConfig, err)
+		}
+		return execGroup(cfg, *group, command, *parallel)
+	}
+	if fs.NArg() == 0 {
+		return usageErrorf("usage: sshm %s", execUsage)
+	}
+	name := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return withCode(exitUsage, err)
+	}
+	command := strings.Join(fs.Args(), " ")
+
+	switch {
+	case command == "":
+		return usageErrorf("usage: sshm %s", execUsage)
+	case *forceTTY && *noTTY:
+		return usageErrorf("-t and -T cannot be combined")
+	case *tee && *output == "":
+		return usageErrorf("--tee needs --output")
+	case *group != "":
+		return usageErrorf("--group cannot be combined with a host")
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	ref, err := resolveHost(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	// Captured output must not pick up terminal control sequences, and a
+	// piped stdout needs plain output, so only allocate a PTY for a fully
+	// interactive invocation unless -t asks for one.
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	tty := *forceTTY || (!*noTTY && interactive && *output == "")
+
+	// Challenge-response prompts need the terminal, when there is one
+	ssh.SetPrompter(terminal.New().Prompt)
+
+	events.Emit(hostEvent(events.ConnectStart, ref.Host, "exec"))
+	defer func() { emitSessionEnd(ref.Host, "exec", err) }()
+
+	client, closeConn, err := dialHost(ref.Host)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	events.Emit(hostEvent(events.AuthOK, ref.Host, "exec"))
+	defer forwardGPG(client, ref.Host)()
+
+	var stdout io.Writer = os.Stdout
+	var capture *os.File
+	if *output != "" {
+		capture, err = os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("create output: %w", err)
+		}
+		defer capture.Close()
+
+		stdout = capture
+		if *tee {
+			stdout = io.MultiWriter(capture, os.Stdout)
+		}
+	}
+
+	// Forward stdin only when it can be read without competing with the
+	// terminal, i.e. it is redirected or the command owns the terminal.
+	var stdin io.Reader
+	if tty || !term.IsTerminal(int(os.Stdin.Fd())) {
+		stdin = os.Stdin
+	}
+
+	if err := execCommand(client, ref.Host, command, stdin, stdout, os.Stderr, tty); err != nil {
+		return err
+	}
+
+	if capture != nil {
+		if err := capture.Sync(); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+		if err := capture.Close(); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+	}
+	return nil
+}
+
+// execCommand runs command on host in a new session, copying its output
+// to stdout and stderr. stdin, when not nil, is copied to the command.
+func execCommand(client *gossh.Client, host *config.Host, command string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	defer session.Close()
+	forwardAgent(client, session, host)
+
+	// A failed local write stops the command rather than leaving it
+	// blocked on a full channel window.
+	out := &stopOnErrorWriter{w: stdout, stop: func() { session.Close() }}
+	session.Stdout = out
+	session.Stderr = stderr
+
+	if tty {
+		if err := ssh.RequestPTY(ssh.WrapSession(session), ssh.DefaultSessionConfig(host)); err != nil {
+			return err
+		}
+	}
+
+	if stdin != nil {
+		stdinPipe, err := session.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("stdin pipe: %w", err)
+		}
+		go func() {
+			_, _ = io.Copy(stdinPipe, stdin)
+			stdinPipe.Close()
+		}()
+	}
+
+	if err := ssh.StartCommand(session, command); err != nil {
+		return err
+	}
+
+	if tty && term.IsTerminal(int(os.Stdin.Fd())) {
+		termMgr := terminal.New()
+		if err := termMgr.EnterRaw(session); err != nil {
+			return fmt.Errorf("enter raw mode: %w", err)
+		}
+		defer termMgr.Resync()
+		defer termMgr.Restore()
+	}
+
+	err = session.Wait()
+	if werr := out.Err(); werr != nil {
+		return fmt.Errorf("write output: %w", werr)
+	}
+
+	var exitErr *gossh.ExitError
+	var missingErr *gossh.ExitMissingError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr):
+		return remoteExit(exitErr.ExitStatus())
+	case errors.As(err, &missingErr):
+		return withCode(exitRemote, fmt.Errorf("remote command exited without a status"))
+	}
+	return withCode(exitNetwork, fmt.Errorf("session: %w", err))
+}
+
+// stopOnErrorWriter remembers the first write error and calls stop once.
+type stopOnErrorWriter struct {
+	w    io.Writer
+	stop func()
+
+	mu  sync.Mutex
+	err error
+}
+
+func (s *stopOnErrorWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.err = err
+		s.stop()
+	}
+	return n, err
+}
+
+// Err returns the first write error, if any.
+func (s *stopOnErrorWriter) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// execGroup runs command on every host under group, parallel hosts at a
+// time, prefixing each line of output with the host's path. Hosts run
+// without a PTY or stdin, and only authenticate without prompting. When
+// any fail, it lists them after the output and fails too.
+func execGroup(cfg *config.Config, group, command string, parallel int) error {
+	node := cfg.FindHost(group)
+	switch {
+	case node == nil:
+		return usageErrorf("group %q not found", group)
+	case len(node.Children) == 0:
+		return usageErrorf("%q is a host, not a group", group)
+	}
+	refs := allLeaves(node.Children, strings.TrimSuffix(group, "/")+"/")
+	return hostsFailure("command", refs, execEach(refs, command, parallel))
+}
+
+// execEach runs command on every host in refs, parallel hosts at a time,
+// prefixing each line of output with the host's path. Hosts run without a
+// PTY or stdin. It returns each host's error.
+func execEach(refs []config.HostRef, command string, parallel int) []error {
+	width := 0
+	for _, ref := range refs {
+		width = max(width, len(ref.Path))
+	}
+
+	var outMu sync.Mutex // One line at a time on stdout and stderr
+	errs := make([]error, len(refs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallel, len(refs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				ref := refs[i]
+				prefix := fmt.Sprintf("%-*s | ", width, ref.Path)
+				stdout := &prefixWriter{w: os.Stdout, prefix: prefix, mu: &outMu}
+				stderr := &prefixWriter{w: os.Stderr, prefix: prefix, mu: &outMu}
+				errs[i] = execOnHost(ref.Host, command, stdout, stderr)
+				stdout.Flush()
+				stderr.Flush()
+			}
+		}()
+	}
+	for i := range refs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return errs
+}
+
+// hostsFailure lists the hosts in refs whose errs entry is set and
+// returns an error saying what failed on them, or nil when none failed.
+// The exit code is the failures' own when they agree, e.g. every host's
+// command exiting 1.
+func hostsFailure(what string, refs []config.HostRef, errs []error) error {
+	var failed []string
+	code := exitOK
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("  %s: %v", refs[i].Path, err))
+		if c := exitCode(err); code == exitOK || c == code {
+			code = c
+		} else {
+			code = exitError
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Failed on %d of %d hosts:\n%s\n", len(failed), len(refs), strings.Join(failed, "\n"))
+	return withCode(code, fmt.Errorf("%s failed on %d of %d hosts", what, len(failed), len(refs)))
+}
+
+// execOnHost connects to host and runs command there for execEach.
+func execOnHost(host *config.Host, command string, stdout, stderr io.Writer) (err error) {
+	events.Emit(hostEvent(events.ConnectStart, host, "exec"))
+	defer func() { emitSessionEnd(host, "exec", err) }()
+
+	client, closeConn, err := dialHost(host)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	events.Emit(hostEvent(events.AuthOK, host, "exec"))
+
+	return execCommand(client, host, command, nil, stdout, stderr, false)
+}
+
+// prefixWriter writes each line with prefix in front of it, holding mu
+// while it does so lines from concurrent writers don't interleave. A
+// partial line waits for the rest of it or Flush.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+
+	buf []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	end := bytes.LastIndexByte(p.buf, '\n')
+	if end < 0 {
+		return len(b), nil
+	}
+	lines := p.buf[:end+1]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, lines[:i+1]); err != nil {
+			return 0, err
+		}
+		lines = lines[i+1:]
+	}
+	p.buf = append(p.buf[:0], p.buf[end+1:]...)
+	return len(b), nil
+}
+
+// Flush writes what is left of an unterminated last line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	_, err := p.Write([]byte{'\n'})
+	return err
+}
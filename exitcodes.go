@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ai-help-me/sshm/pkg/ssh"
+)
+
+// Exit codes. sshm's own failures use a reserved band at the top of the
+// range so they never collide with the exit status of a remote command.
+const (
+	exitOK       = 0
+	exitError    = 1   // unclassified failure
+	exitUsage    = 2   // bad flags or arguments
+	exitCancel   = 130 // interrupted or declined by the user
+	exitConfig   = 250 // config missing or invalid
+	exitAuth     = 251 // authentication failed
+	exitNetwork  = 252 // host unreachable or connection dropped
+	exitRemote   = 253 // remote command failed without an exit status
+	exitTransfer = 254 // file transfer failed
+)
+
+// errCancelled is returned when the user declines or interrupts an
+// operation. It has already been reported, so it is not printed again.
+var errCancelled = errors.New("cancelled")
+
+// remoteExit is a remote command's exit status, passed on as sshm's own
+// like ssh(1) does. The command has reported its failure itself, so it is
+// not printed.
+type remoteExit int
+
+func (e remoteExit) Error() string {
+	return fmt.Sprintf("remote command exited with status %d", int(e))
+}
+
+// codedError attaches an exit code to an error.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e codedError) Error() string { return e.err.Error() }
+func (e codedError) Unwrap() error { return e.err }
+
+// withCode tags err with an exit code. A nil err stays nil.
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return codedError{code: code, err: err}
+}
+
+// usageErrorf returns an error that exits with exitUsage.
+func usageErrorf(format string, args ...interface{}) error {
+	return withCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+// exitCode maps an error to the process exit code.
+func exitCode(err error) int {
+	var coded codedError
+	var status remoteExit
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &status):
+		return int(status)
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, errCancelled), errors.Is(err, context.Canceled):
+		return exitCancel
+	case ssh.IsAuthError(err):
+		return exitAuth
+	case ssh.IsNetworkError(err):
+		return exitNetwork
+	}
+	return exitError
+}
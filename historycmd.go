@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/history"
+)
+
+const (
+	historyUsage = "history [-n N] [host]"
+	statsUsage   = "stats [--since <duration>]"
+)
+
+// runHistory implements "sshm history": list the latest connections, or
+// those to one host, with how long each session lasted and how much of it
+// was active and idle.
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "show the latest `N` connections (0 for all kept)")
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	switch {
+	case fs.NArg() > 1:
+		return usageErrorf("usage: sshm %s", historyUsage)
+	case *limit < 0:
+		return usageErrorf("-n must not be negative")
+	}
+
+	var conns []history.Connection
+	for _, c := range history.Load().Connections {
+		if fs.NArg() == 1 && c.Path != fs.Arg(0) {
+			continue
+		}
+		conns = append(conns, c)
+		if len(conns) == *limit {
+			break
+		}
+	}
+	if len(conns) == 0 {
+		infof("No connections recorded\n")
+		return nil
+	}
+
+	rows := [][]string{{"WHEN", "HOST", "MODE", "DURATION", "ACTIVE", "IDLE"}}
+	for _, c := range conns {
+		duration, active, idle := "-", "-", "-"
+		if c.Duration > 0 {
+			duration, active, idle = formatSpan(c.Duration), formatSpan(c.Active()), formatSpan(c.Idle)
+		}
+		rows = append(rows, []string{c.At.Local().Format("2006-01-02 15:04"), c.Path, c.Mode, duration, active, idle})
+	}
+	printTable(rows)
+	return nil
+}
+
+// hostStats sums up the sessions on one host.
+type hostStats struct {
+	path           string
+	sessions       int
+	duration, idle time.Duration
+	last           time.Time
+}
+
+// runStats implements "sshm stats": total the time spent in sessions on
+// each host, active and idle, most active first.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	since := fs.Duration("since", 0, "only count sessions started in the last `duration`, e.g. 168h")
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	switch {
+	case fs.NArg() > 0:
+		return usageErrorf("usage: sshm %s", statsUsage)
+	case *since < 0:
+		return usageErrorf("--since must not be negative")
+	}
+
+	byPath := make(map[string]*hostStats)
+	var total hostStats
+	for _, c := range history.Load().Connections {
+		if *since > 0 && time.Since(c.At) > *since {
+			continue
+		}
+		st := byPath[c.Path]
+		if st == nil {
+			st = &hostStats{path: c.Path}
+			byPath[c.Path] = st
+		}
+		for _, s := range []*hostStats{st, &total} {
+			s.sessions++
+			s.duration += c.Duration
+			s.idle += c.Idle
+			if c.At.After(s.last) {
+				s.last = c.At
+			}
+		}
+	}
+	if total.sessions == 0 {
+		infof("No connections recorded\n")
+		return nil
+	}
+
+	stats := make([]*hostStats, 0, len(byPath))
+	for _, st := range byPath {
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		ai, aj := stats[i].duration-stats[i].idle, stats[j].duration-stats[j].idle
+		if ai != aj {
+			return ai > aj
+		}
+		return stats[i].path < stats[j].path
+	})
+
+	rows := [][]string{{"HOST", "SESSIONS", "TOTAL", "ACTIVE", "IDLE", "LAST"}}
+	for _, st := range append(stats, &total) {
+		path, last := st.path, st.last.Local().Format("2006-01-02 15:04")
+		if st == &total {
+			path = "(all)"
+		}
+		rows = append(rows, []string{
+			path, fmt.Sprint(st.sessions), formatSpan(st.duration),
+			formatSpan(st.duration - st.idle), formatSpan(st.idle), last,
+		})
+	}
+	printTable(rows)
+	return nil
+}
+
+// formatSpan writes a duration to the second, e.g. "1h2m3s".
+func formatSpan(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
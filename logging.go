@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	// verbosity is how many -v were given (-vv counts two): 1 logs
+	// connection details, 2 also channel opens, keepalives and SFTP
+	// packet counts
+	verbosity int
+
+	// debugLog is where -v output goes instead of stderr (--debug-log);
+	// it implies -v
+	debugLog string
+)
+
+// setupLogging routes the log/slog output of pkg/ssh, pkg/sftp and
+// pkg/config according to -v and --debug-log; without either it is
+// dropped.
+func setupLogging() error {
+	if debugLog != "" {
+		verbosity = max(verbosity, 1)
+	}
+	if verbosity == 0 {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		return nil
+	}
+	level := slog.LevelInfo
+	if verbosity > 1 {
+		level = slog.LevelDebug
+	}
+
+	var w io.Writer = os.Stderr
+	if debugLog != "" {
+		f, err := os.OpenFile(debugLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("--debug-log: %w", err)
+		}
+		w = f
+	} else if term.IsTerminal(int(os.Stderr.Fd())) {
+		// Sessions put the terminal in raw mode, where a bare newline
+		// doesn't return the cursor
+		w = &crlfWriter{w: os.Stderr}
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// crlfWriter writes to w with CRLF line endings.
+type crlfWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
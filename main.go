@@ -1,124 +1,301 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/daemon"
+	"github.com/ai-help-me/sshm/pkg/events"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/history"
+	"github.com/ai-help-me/sshm/pkg/scp"
 	"github.com/ai-help-me/sshm/pkg/sftp"
 	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/supervise"
 	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/ai-help-me/sshm/pkg/theme"
 	"github.com/ai-help-me/sshm/pkg/tui"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/cancelreader"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 )
 
 func main() {
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		os.Exit(exitUsage)
+	}
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// Subcommands (sshm migrate ...) run without the TUI
+	if len(args) > 0 {
+		os.Exit(runSubcommand(args))
+	}
+
+	// Without a terminal (cron, CI) there is no selector to show, so the
+	// host has to be named
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintf(os.Stderr, "Error: not a terminal; name a host instead of using the selector\n")
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
 	// 1. Load config
 	cfg, err := config.Load("")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Create ~/.sshm.yaml with your host configurations.\n")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Create ~/.sshm.yaml (or $XDG_CONFIG_HOME/sshm/config.yaml) with your host configurations.\n")
+		os.Exit(exitConfig)
 	}
 
 	// Check if there are any hosts
 	if len(cfg.Hosts) == 0 {
 		fmt.Fprintf(os.Stderr, "No hosts found in config\n")
-		os.Exit(1)
+		os.Exit(exitConfig)
 	}
 
+	if w := stateWarning(); w != "" {
+		cfg.Warnings = append(cfg.Warnings, w)
+	}
+
+	useSettings(cfg)
+	startAutostartTunnels(cfg)
+
 	// 2. Create terminal manager (saves original terminal state)
 	termMgr := terminal.New()
 	defer termMgr.Cleanup()
+	ssh.SetPrompter(termMgr.Prompt)
 
 	// Add panic recovery to ensure terminal is restored
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Fprintf(os.Stderr, "Panic recovered: %v\n", r)
 			termMgr.Restore()
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 	}()
 
-	// 3. Run TUI (in cooked mode)
+	// 3. Run TUI (in cooked mode). With return-to-list it comes back after
+	// each session, where it was left
 	tuiModel := tui.NewModel(cfg)
-	tuiProgram := tea.NewProgram(tuiModel, tea.WithAltScreen())
-	finalModel, err := tuiProgram.Run()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
-		os.Exit(1)
-	}
+	var failed error // The last connection, when it failed
+	for {
+		tuiProgram := tea.NewProgram(tuiModel, tea.WithAltScreen())
+		finalModel, err := tuiProgram.Run()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+			os.Exit(exitError)
+		}
 
-	// CRITICAL: Reset terminal after TUI exits
-	fmt.Print("\033[?25h") // Show cursor
-	fmt.Print("\033[0m")   // Reset all attributes
+		// CRITICAL: Reset terminal after TUI exits
+		termMgr.Resync()
 
-	model, ok := finalModel.(tui.Model)
-	if !ok {
-		fmt.Fprintf(os.Stderr, "Failed to get final model\n")
-		os.Exit(1)
-	}
+		model, ok := finalModel.(tui.Model)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Failed to get final model\n")
+			os.Exit(exitError)
+		}
 
-	// Check if user quit
-	if model.Quitted || model.Selected == nil {
+		// Check if user quit
+		if model.Quitted || (model.Selected == nil && len(model.Broadcast) == 0) {
+			ssh.CancelPrewarm()
+			if failed != nil {
+				termMgr.Cleanup()
+				os.Exit(exitCode(failed))
+			}
+			return
+		}
+		failed = nil
+
+		// Hosts marked in the TUI all get the chosen action
+		if len(model.Broadcast) > 0 {
+			results, err := runBroadcast(model.Broadcast, model.Action, model.Command, termMgr)
+			if cfg.ReturnToList {
+				waitForEnter()
+				tuiModel = model.ReopenBroadcast(results)
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				termMgr.Cleanup()
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+
+		// 4. Connect based on user selection
+		ref := config.HostRef{Path: model.SelectedPath(), Host: model.Selected}
+		mode := model.Action
+
+		err = connectToHost(ref, mode, termMgr)
+		if err != nil && !errors.Is(err, errCancelled) {
+			// Shown in the TUI, where it can be retried, rather than
+			// printed after it closes
+			failed = err
+			tuiModel = model.ReopenFailed(err)
+			continue
+		}
+		if cfg.ReturnToList {
+			tuiModel = model.Reopen(err)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Connection error: %v\n", err)
+			termMgr.Cleanup()
+			os.Exit(exitCode(err))
+		}
 		return
 	}
+}
 
-	// 4. Connect based on user selection
-	host := model.Selected
-	mode := model.Action
+func connectToHost(ref config.HostRef, mode string, termMgr *terminal.Manager) (err error) {
+	host := ref.Host
+	events.Emit(hostEvent(events.ConnectStart, host, mode))
+	defer func() { emitSessionEnd(host, mode, err) }()
 
-	if err := connectToHost(host, mode, termMgr); err != nil {
-		fmt.Fprintf(os.Stderr, "Connection error: %v\n", err)
-		os.Exit(1)
+	if u, ok := ssh.CachedUnreachable(host); ok {
+		if err := confirmRetry(host, u); err != nil {
+			return err
+		}
 	}
-}
-
-func connectToHost(host *config.Host, mode string, termMgr *terminal.Manager) error {
-	if host.Jump != nil && len(host.Jump) > 0 {
-		jumpChain := ssh.NewJumpChainWithTarget(host)
-		defer jumpChain.Close()
 
-		_, err := jumpChain.Connect()
-		if err != nil {
-			return fmt.Errorf("jump chain: %w", err)
+	// Share the connection the daemon keeps for the host, if pooled
+	var conn ssh.Connector
+	pooled := pooledClient(ref)
+	if pooled != nil {
+		ssh.CancelPrewarm()
+		conn = pooled
+	} else if conn, err = connectWarm(host); err != nil {
+		ssh.RecordReachability(host, err)
+		return err
+	}
+	defer conn.Close()
+	ssh.RecordReachability(host, nil)
+	if pooled == nil {
+		// Through the daemon the server seen is its mux
+		ssh.RecordServerInfo(host, conn.SSHClient())
+	}
+	events.Emit(hostEvent(events.AuthOK, host, mode))
+	track := history.Start(ref.Path, mode)
+	defer track.End()
+	offerSavePassword(host, conn.PromptedPassword())
+	if mode == "ssh" {
+		defer startSessionTunnels(ref, conn.SSHClient).stop()
+	}
+
+	workDir := ssh.NewWorkDir()
+	for {
+		err := runSession(conn, mode, termMgr, host, workDir, track)
+		lost := lostConnection(host, err)
+		if mode != "ssh" || lost == nil {
+			return err
 		}
 
-		return runSessionWithJump(jumpChain, mode, termMgr, host)
+		fmt.Fprintf(os.Stderr, "Connection lost: %v\n", lost)
+		if err := reconnect(conn.Reconnect); err != nil {
+			return fmt.Errorf("reconnect: %w", err)
+		}
 	}
+}
 
-	sshClient, err := ssh.NewClient(host)
-	if err != nil {
-		return fmt.Errorf("create client: %w", err)
+// connectWarm connects to host like connect, but takes over the
+// connection pre-dialed while it was highlighted if there is one.
+func connectWarm(host *config.Host) (ssh.Connector, error) {
+	warmClient, warmChain := ssh.TakeWarm(host)
+	switch {
+	case warmChain != nil:
+		return warmChain, nil
+	case warmClient != nil:
+		return warmClient, nil
+	}
+	return connect(host)
+}
+
+// lostConnection returns why err ended the session when the connection is
+// worth re-establishing, or nil: a failed jump hop always is, a dropped
+// direct connection when the host has auto-reconnect.
+func lostConnection(host *config.Host, err error) error {
+	var hopErr *ssh.HopError
+	if errors.As(err, &hopErr) {
+		return hopErr
 	}
-	defer sshClient.Close()
+	var lostErr *ssh.ConnectionLostError
+	if host.AutoReconnect && errors.As(err, &lostErr) {
+		return lostErr
+	}
+	return nil
+}
 
-	if err := sshClient.Dial(); err != nil {
-		return fmt.Errorf("dial: %w", err)
+// pooledClient connects through the connection the daemon keeps open for
+// ref when control-persist is set, having the daemon dial it if needed.
+// It returns nil for the caller to dial itself when the host can't be
+// pooled: the daemon can't prompt for a password or an unknown host key,
+// and it doesn't relay agent forwarding or remote port forwards.
+func pooledClient(ref config.HostRef) *ssh.Client {
+	host := ref.Host
+	if controlPersist <= 0 || host.AgentForwarding || host.ForwardGPG {
+		return nil
+	}
+	for _, t := range host.Tunnels {
+		if t.Kind == config.TunnelRemote {
+			return nil
+		}
 	}
 
-	return runSession(sshClient, mode, termMgr, host)
+	if err := daemon.Ensure(); err != nil {
+		return nil
+	}
+	resp, err := daemon.Call(daemon.Request{Op: daemon.OpMaster, Host: ref.Path, Persist: controlPersist})
+	if err != nil {
+		return nil
+	}
+	client, err := ssh.DialMux(resp.Socket, host)
+	if err != nil {
+		return nil
+	}
+	return client
 }
 
-func runSession(client *ssh.Client, mode string, termMgr *terminal.Manager, host *config.Host) error {
-	switch mode {
-	case "sftp":
-		return runSFTP(client, termMgr, host)
-	case "ssh":
-		return runSSH(client, termMgr)
-	default:
-		return fmt.Errorf("unknown mode: %s", mode)
+// confirmRetry reports a host that could not be reached moments ago and
+// asks whether to try again, instead of waiting out another timeout.
+// Without a terminal to ask on, it fails straight away.
+func confirmRetry(host *config.Host, u *ssh.Unreachable) error {
+	cached := fmt.Errorf("%s was unreachable %s ago: %s", host.Name, time.Since(u.At).Round(time.Second), u.Reason)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return withCode(exitNetwork, cached)
+	}
+
+	fmt.Fprintf(os.Stderr, "%v\nRetry anyway? [y/N] ", cached)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
 	}
+	return errCancelled
 }
 
-func runSessionWithJump(jumpChain *ssh.JumpChain, mode string, termMgr *terminal.Manager, host *config.Host) error {
+// runSession runs the session mode asks for on an established connection,
+// telling track when it is active.
+func runSession(client ssh.Connector, mode string, termMgr *terminal.Manager, host *config.Host, workDir *ssh.WorkDir, track *history.Session) error {
 	switch mode {
 	case "sftp":
-		return runSFTPWithJump(jumpChain, termMgr, host)
+		return runSFTP(client, termMgr, host, track)
 	case "ssh":
-		return runSSHWithJump(jumpChain, termMgr)
+		return runSSH(client, termMgr, host, workDir, track)
 	default:
 		return fmt.Errorf("unknown mode: %s", mode)
 	}
@@ -131,18 +308,28 @@ func runSessionWithJump(jumpChain *ssh.JumpChain, mode string, termMgr *terminal
 // 3. Start goroutine to copy stdin -> session stdin
 // 4. Enter raw mode
 // 5. session.Wait()
-func runSSH(client *ssh.Client, termMgr *terminal.Manager) error {
+//
+// workDir follows the shell's directory; a session re-established after a
+// dropped connection starts back in it.
+func runSSH(client ssh.Connector, termMgr *terminal.Manager, host *config.Host, workDir *ssh.WorkDir, track *history.Session) error {
 	// 1. Create session
-	session, err := client.Session()
+	conn, err := client.Session()
 	if err != nil {
 		return fmt.Errorf("create session: %w", err)
 	}
+	defer forwardGPG(client.SSHClient(), host)()
+	forwardAgent(client.SSHClient(), conn, host)
+	session := ssh.WrapSession(conn)
 
-	// 2. Request PTY
-	sessionConfig := ssh.DefaultSessionConfig()
-	if err := ssh.RequestPTY(session, sessionConfig); err != nil {
-		session.Close()
-		return fmt.Errorf("request pty: %w", err)
+	// 2. Request PTY, unless input is piped in (cron, CI): like ssh(1),
+	// the remote shell then reads it as a script
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	if interactive {
+		sessionConfig := ssh.DefaultSessionConfig(host)
+		if err := ssh.RequestPTY(session, sessionConfig); err != nil {
+			session.Close()
+			return fmt.Errorf("request pty: %w", err)
+		}
 	}
 
 	// 3. Get stdin pipe FIRST (before setting up IO)
@@ -152,9 +339,24 @@ func runSSH(client *ssh.Client, termMgr *terminal.Manager) error {
 		return fmt.Errorf("stdin pipe: %w", err)
 	}
 
-	// 4. Connect stdout/stderr directly
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
+	// 4. Connect stdout/stderr directly; a second shell (~N) holds them back
+	shells := newShellSwitch(client.SSHClient(), termMgr, host)
+	defer shells.close()
+	callbacks := newCallbackShells(stdinPipe, host, interactive)
+	stdout, stderr := sessionOutput(os.Stdout, host), io.Writer(os.Stderr)
+	if log := openSessionLog(host); log != nil {
+		defer closeSessionLog(log)
+		stdout, stderr = io.MultiWriter(stdout, log), io.MultiWriter(stderr, log)
+	}
+	// Input and output are what keeps the session from counting as idle
+	stdout, stderr = track.Writer(stdout), track.Writer(stderr)
+	session.SetOutput(shells.hold(workDir.Watch(callbacks.Watch(stdout))), shells.hold(stderr))
+
+	// The window shows where the session is until it ends, when the title
+	// from before comes back; it is set before the shell starts writing
+	if interactive {
+		defer termMgr.PushTitle(host.User + "@" + host.Host)()
+	}
 
 	// 5. Start shell (before entering raw mode)
 	if err := ssh.StartShell(session); err != nil {
@@ -162,25 +364,44 @@ func runSSH(client *ssh.Client, termMgr *terminal.Manager) error {
 		session.Close()
 		return fmt.Errorf("start shell: %w", err)
 	}
+	restoreWorkDir(stdinPipe, workDir)
+	callbacks.Start()
+	defer callbacks.Stop()
 
-	// 6. Create a done channel to signal when session ends
+	// 6. Input forwarding and the wait for the session run as one group,
+	// stopped and waited for before returning
+	tasks := supervise.New(context.Background())
+	defer tasks.Stop()
 	sessionDone := make(chan error, 1)
 
 	// 7. Start stdin forwarding goroutine IMMEDIATELY
+	// Input goes through the escape menu and anti-idle keeper first
+	idle := ssh.NewAntiIdle(client.SSHClient(), stdinPipe, host.AntiIdle, host.AntiIdleString)
+	idle.Start()
+	defer idle.Stop()
+	input := ssh.NewInputBuffer(shells.route(idle), os.Stdout, time.Duration(host.InputCoalesce), host.LocalEcho && interactive)
+	escape := newEscapeMenu(host, idle, shells, input)
+	closed := handleHungSession(escape, input, client, termMgr, host)
+
 	stdinDone := make(chan struct{})
-	go func() {
+	tasks.Go(func(ctx context.Context) {
 		defer close(stdinDone)
+		stdin := newStdinReader()
+		defer stdin.Close()
+		// Stopping the group breaks the pending read of local stdin
+		stop := context.AfterFunc(ctx, func() { stdin.Cancel() })
+		defer stop()
 		// Copy from local stdin to remote stdin
-		_, _ = io.Copy(stdinPipe, os.Stdin)
-		// When stdin ends, close the pipe
+		_, _ = io.Copy(track.Writer(escape), stdin)
+		// When stdin ends, send what is held back and close the pipe
+		_ = input.Flush()
 		stdinPipe.Close()
-	}()
+	})
 
 	// 8. Start session wait goroutine
-	go func() {
-		err := session.Wait()
-		sessionDone <- err
-	}()
+	tasks.Go(func(context.Context) {
+		sessionDone <- session.Wait()
+	})
 
 	// 9. NOW enter raw mode (after goroutines are started)
 	if err := termMgr.EnterRaw(session); err != nil {
@@ -195,23 +416,18 @@ func runSSH(client *ssh.Client, termMgr *terminal.Manager) error {
 	var waitErr error
 	select {
 	case waitErr = <-sessionDone:
-		// CRITICAL: Restore terminal FIRST to break io.Copy's os.Stdin.Read() block
-		// This must happen before closing stdinPipe, otherwise io.Copy stays blocked
 		if restoreErr := termMgr.Restore(); restoreErr != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to restore terminal: %v\n", restoreErr)
 		}
-		// Now close stdinPipe - this should allow io.Copy to exit since terminal is restored
-		stdinPipe.Close()
-		// Don't block forever - stdin goroutine should exit now that terminal is restored
-		select {
-		case <-stdinDone:
-		case <-time.After(100 * time.Millisecond):
-		}
+		// Stop forwarding input: the pending read is canceled, so the
+		// stdin goroutine is done before the menu takes the terminal back
+		tasks.Stop()
 	case <-stdinDone:
-		// Stdin closed, give session a moment to finish
+		// Stdin closed, give session a moment to finish; a piped script
+		// may run for as long as it needs
 		select {
 		case waitErr = <-sessionDone:
-		case <-time.After(500 * time.Millisecond):
+		case <-stdinTimeout(interactive):
 			// Timeout - force close session
 			session.Close()
 			waitErr = <-sessionDone
@@ -230,119 +446,197 @@ func runSSH(client *ssh.Client, termMgr *terminal.Manager) error {
 		}
 	}
 
+	// Whatever ran remotely may have left modes set or the cursor hidden
+	termMgr.Resync()
+
 	// 12. Print newline
 	fmt.Println()
 
-	// Ignore exit errors
-	_ = waitErr
+	// A session cut off by a dropped connection or a dead hop is reported
+	// so it can be re-established; exit errors, and a connection closed
+	// with ~., are ignored
+	var exitErr *gossh.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) && !closed() {
+		if brokenErr := client.Broken(time.Second); brokenErr != nil {
+			return brokenErr
+		}
+	}
 	return nil
 }
 
-func runSSHWithJump(jumpChain *ssh.JumpChain, termMgr *terminal.Manager) error {
-	// 1. Create session
-	session, err := jumpChain.Session()
-	if err != nil {
-		return fmt.Errorf("create session: %w", err)
-	}
-
-	// 2. Request PTY
-	sessionConfig := ssh.DefaultSessionConfig()
-	if err := ssh.RequestPTY(session, sessionConfig); err != nil {
-		session.Close()
-		return fmt.Errorf("request pty: %w", err)
+// stdinTimeout is how long a session may outlive its input before it is
+// closed: briefly at a terminal, where that means something went wrong,
+// and never (a nil channel) for piped input.
+func stdinTimeout(interactive bool) <-chan time.Time {
+	if !interactive {
+		return nil
 	}
+	return time.After(500 * time.Millisecond)
+}
 
-	// 3. Get stdin pipe
-	stdinPipe, err := session.StdinPipe()
+// newStdinReader returns a reader of os.Stdin whose pending Read can be
+// canceled. Input that can't be waited on, like a regular file, is read
+// as is: it reaches its end on its own.
+func newStdinReader() cancelreader.CancelReader {
+	r, err := cancelreader.NewReader(os.Stdin)
 	if err != nil {
-		session.Close()
-		return fmt.Errorf("stdin pipe: %w", err)
+		return uncancelable{os.Stdin}
 	}
+	return r
+}
 
-	// 4. Connect stdout/stderr
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
+// uncancelable is a cancelreader.CancelReader that can't be canceled.
+type uncancelable struct{ io.Reader }
+
+func (uncancelable) Cancel() bool { return false }
+func (uncancelable) Close() error { return nil }
+
+// reconnectAttempts bounds how often a broken connection is re-established
+// before giving up.
+const reconnectAttempts = 3
+
+// reconnect calls dial until it succeeds, up to reconnectAttempts times,
+// doubling the pause between attempts.
+func reconnect(dial func() error) error {
+	delay := time.Second
+	var err error
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		fmt.Fprintf(os.Stderr, "Reconnecting (attempt %d/%d)...\n", attempt, reconnectAttempts)
+		if err = dial(); err == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Reconnect failed: %v\n", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return err
+}
 
-	// 5. Start shell
-	if err := ssh.StartShell(session); err != nil {
-		stdinPipe.Close()
-		session.Close()
-		return fmt.Errorf("start shell: %w", err)
+// restoreWorkDir types the command returning a re-established shell to the
+// directory the previous one was in, if it is known.
+func restoreWorkDir(stdin io.Writer, workDir *ssh.WorkDir) {
+	if cmd := workDir.Command(); cmd != "" {
+		fmt.Fprintf(stdin, "%s\n", cmd)
 	}
+}
 
-	// 6. Create done channel
-	sessionDone := make(chan error, 1)
+// forwardGPG starts the host's forward-gpg preset on client and returns
+// the function that stops it. Failures are warnings; the session goes on
+// without the agent.
+func forwardGPG(client *gossh.Client, host *config.Host) func() {
+	if !host.ForwardGPG {
+		return func() {}
+	}
+	fwd, err := forward.GPG(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: gpg-agent forwarding: %v\n", err)
+		return func() {}
+	}
+	return func() { fwd.Close() }
+}
 
-	// 7. Start stdin forwarding
-	stdinDone := make(chan struct{})
-	go func() {
-		defer close(stdinDone)
-		_, _ = io.Copy(stdinPipe, os.Stdin)
-		stdinPipe.Close()
-	}()
+// forwardAgent forwards the local ssh-agent to session when host asks for
+// it. Failures are warnings; the session goes on without the agent.
+func forwardAgent(client *gossh.Client, session *gossh.Session, host *config.Host) {
+	if !host.AgentForwarding {
+		return
+	}
+	if err := forward.Agent(client, session); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: agent forwarding: %v\n", err)
+	}
+}
 
-	// 8. Start session wait goroutine
-	go func() {
-		sessionDone <- session.Wait()
-	}()
+// sessionOutput applies per-host output filters to remote shell output.
+func sessionOutput(w io.Writer, host *config.Host) io.Writer {
+	if host.OSC52 == config.OSC52Strip {
+		return ssh.NewOSC52Filter(w)
+	}
+	return w
+}
 
-	// 9. Enter raw mode
-	if err := termMgr.EnterRaw(session); err != nil {
-		stdinPipe.Close()
-		session.Close()
-		return fmt.Errorf("enter raw mode: %w", err)
+// newCallbackShells returns the runner typing host's callback-shells into
+// stdin. Piped input is already the shell's script, so they only run in
+// interactive sessions.
+func newCallbackShells(stdin io.Writer, host *config.Host, interactive bool) *ssh.CallbackShells {
+	if !interactive {
+		return ssh.NewCallbackShells(stdin, nil)
 	}
+	return ssh.NewCallbackShells(stdin, host.CallbackShells)
+}
 
-	// 10. Wait for either session or stdin
-	var waitErr error
-	select {
-	case waitErr = <-sessionDone:
-		// CRITICAL: Restore terminal FIRST to break io.Copy's os.Stdin.Read() block
-		if restoreErr := termMgr.Restore(); restoreErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to restore terminal: %v\n", restoreErr)
+// newEscapeMenu wires the session escape menu (~?) in front of the input
+// buffer and the anti-idle keeper, which in turn forward to the remote
+// stdin. Keystrokes go to a second shell instead while one opened with ~N
+// runs. The host's escape-char replaces ~.
+func newEscapeMenu(host *config.Host, idle *ssh.AntiIdle, shells *shellSwitch, input *ssh.InputBuffer) *ssh.EscapeWriter {
+	escape := ssh.NewEscapeWriter(input, os.Stderr)
+	if host.EscapeChar != "" {
+		// Validated when the config was loaded
+		c, _ := config.ParseEscapeChar(host.EscapeChar)
+		escape.SetChar(c)
+	}
+	escape.Handle('K', "toggle anti-idle keepalive", func() {
+		if idle.Toggle() {
+			escape.Printf("anti-idle enabled (every %s)", idle.Interval())
+		} else {
+			escape.Printf("anti-idle disabled")
 		}
-		stdinPipe.Close()
-		select {
-		case <-stdinDone:
-		case <-time.After(100 * time.Millisecond):
-		}
-	case <-stdinDone:
-		select {
-		case waitErr = <-sessionDone:
-		case <-time.After(500 * time.Millisecond):
-			session.Close()
-			waitErr = <-sessionDone
+	})
+	escape.Handle('E', "toggle local echo (line mode for slow links)", func() {
+		on := !input.LocalEcho()
+		if err := input.SetLocalEcho(on); err != nil {
+			escape.Printf("local echo: %v", err)
+			return
 		}
-		// Restore terminal when stdin closes first
-		if restoreErr := termMgr.Restore(); restoreErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to restore terminal: %v\n", restoreErr)
+		if on {
+			escape.Printf("local echo enabled; lines are sent on Enter")
+		} else {
+			escape.Printf("local echo disabled")
 		}
-	}
+	})
+	escape.Handle('N', "open a second shell on this connection", func() {
+		shells.open(escape)
+	})
+	return escape
+}
 
-	// 11. Restore terminal (if not already restored in select branches above)
-	if !termMgr.InRaw() {
-	} else {
-		if restoreErr := termMgr.Restore(); restoreErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to restore terminal: %v\n", restoreErr)
+// handleHungSession adds the escapes that get out of a session that
+// stopped responding, as over a dead link, without closing the terminal:
+// ~. closes the connection under it, ~^Z suspends sshm to the shell it was
+// started from. closed reports whether ~. was used.
+//
+// ~. closes the connection before anything else and drops the input not
+// sent yet: writing it to a connection that stopped responding may block.
+func handleHungSession(escape *ssh.EscapeWriter, input *ssh.InputBuffer, client ssh.Connector, termMgr *terminal.Manager, host *config.Host) (closed func() bool) {
+	var done atomic.Bool
+	escape.HandleDiscard('.', "close the connection", func() {
+		done.Store(true)
+		client.Close()
+		input.Discard()
+		escape.Printf("closed the connection to %s", host.Name)
+	})
+	escape.Handle(0x1a, "suspend sshm (fg to resume)", func() {
+		escape.Printf("suspended")
+		if err := termMgr.Suspend(); err != nil {
+			escape.Printf("suspend: %v", err)
 		}
-	}
-
-	// 12. Print newline
-	fmt.Println()
-
-	_ = waitErr
-	return nil
+	})
+	return done.Load
 }
 
-func runSFTP(client *ssh.Client, termMgr *terminal.Manager, host *config.Host) error {
-	sshClient := client.GetSSHClient()
+func runSFTP(client ssh.Connector, termMgr *terminal.Manager, host *config.Host, track *history.Session) error {
+	sshClient := client.SSHClient()
 	if sshClient == nil {
 		return fmt.Errorf("not connected")
 	}
 
-	sftpClient, err := sftp.NewClient(sshClient)
+	if host.Protocol == config.ProtocolSCP {
+		return runSCP(sshClient, termMgr, host, track)
+	}
+	sftpClient, err := sftp.NewClient(sshClient, host.SFTPServerPath)
 	if err != nil {
-		return fmt.Errorf("create sftp client: %w", err)
+		fmt.Fprintf(os.Stderr, "Warning: %v; falling back to SCP\n", err)
+		return runSCP(sshClient, termMgr, host, track)
 	}
 	defer sftpClient.Close()
 
@@ -354,7 +648,14 @@ func runSFTP(client *ssh.Client, termMgr *terminal.Manager, host *config.Host) e
 	// Get user and host from config
 	user := host.User
 	hostname := host.Host
-	shell := sftp.NewShell(sftpClient, paths, user, hostname)
+	opts := sftpOptions(host)
+	opts.SSHClient = sshClient
+	opts.Terminal = termMgr
+	opts.Busy = track.SetBusy
+	var closeReconnects func()
+	opts.Reconnect, closeReconnects = sftpReconnect(host)
+	defer closeReconnects()
+	shell := sftp.NewShell(sftpClient, paths, user, hostname, opts)
 	if err := shell.Run(); err != nil {
 		return fmt.Errorf("sftp shell: %w", err)
 	}
@@ -362,30 +663,74 @@ func runSFTP(client *ssh.Client, termMgr *terminal.Manager, host *config.Host) e
 	return nil
 }
 
-func runSFTPWithJump(jumpChain *ssh.JumpChain, termMgr *terminal.Manager, host *config.Host) error {
-	sshClient := jumpChain.GetSSHClient()
-	if sshClient == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	sftpClient, err := sftp.NewClient(sshClient)
+// runSCP runs the SCP shell, for servers without SFTP.
+func runSCP(sshClient *gossh.Client, termMgr *terminal.Manager, host *config.Host, track *history.Session) error {
+	historyFile, _ := sftp.DefaultHistoryFile()
+	shell, err := scp.NewShell(sshClient, host.User, host.Host, scp.ShellOptions{
+		Quiet:       quiet || host.Quiet,
+		Terminal:    termMgr,
+		HistoryFile: historyFile,
+		Busy:        track.SetBusy,
+	})
 	if err != nil {
-		return fmt.Errorf("create sftp client: %w", err)
+		return fmt.Errorf("scp shell: %w", err)
 	}
-	defer sftpClient.Close()
-
-	paths, err := sftp.NewPathState(sftpClient)
-	if err != nil {
-		return fmt.Errorf("create path state: %w", err)
+	if err := shell.Run(); err != nil {
+		return fmt.Errorf("scp shell: %w", err)
 	}
+	return nil
+}
 
-	// Get user and host from config
-	user := host.User
-	hostname := host.Host
-	shell := sftp.NewShell(sftpClient, paths, user, hostname)
-	if err := shell.Run(); err != nil {
-		return fmt.Errorf("sftp shell: %w", err)
+// sftpAliases are the config's SFTP shell aliases, set by useSettings.
+var sftpAliases map[string]string
+
+// controlPersist is the config's control-persist, set by useSettings.
+var controlPersist time.Duration
+
+// useSettings applies the config's global settings: it selects the color
+// palette, which Load has validated, and keeps the SFTP aliases.
+func useSettings(cfg *config.Config) {
+	t, _ := theme.Lookup(cfg.Theme)
+	theme.Set(t)
+	sftpAliases = cfg.SFTPAliases
+	controlPersist = time.Duration(cfg.ControlPersist)
+}
+
+// sftpOptions maps per-host config to SFTP shell options.
+func sftpOptions(host *config.Host) sftp.Options {
+	// Without a home directory, history lasts for the session
+	history, _ := sftp.DefaultHistoryFile()
+	return sftp.Options{
+		DownloadMode: os.FileMode(host.DownloadMode),
+		UploadMode:   os.FileMode(host.UploadMode),
+		MapOwner:     host.MapOwner,
+		MapGroup:     host.MapGroup,
+		HonorIgnore:  host.HonorIgnore,
+		Quiet:        quiet || host.Quiet,
+		HistoryFile:  history,
+		Timeout:      time.Duration(host.SFTPTimeout) * time.Second,
+		ServerPath:   host.SFTPServerPath,
+		Aliases:      sftpAliases,
+		Init:         host.SFTPInit,
+		Parallel:     host.Parallel,
 	}
+}
 
-	return nil
+// sftpReconnect returns the shell's Reconnect, which dials host again, and
+// a func closing the connections it made.
+func sftpReconnect(host *config.Host) (func() (*gossh.Client, error), func()) {
+	var closers []func()
+	reconnect := func() (*gossh.Client, error) {
+		client, closeConn, err := dialHost(host)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, closeConn)
+		return client, nil
+	}
+	return reconnect, func() {
+		for _, c := range closers {
+			c()
+		}
+	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+const migrateUsage = "migrate sshw [--from <file>] [--to <file>] [--force]"
+
+// runMigrate implements "sshm migrate sshw": convert an sshw config into
+// ~/.sshm.yaml and list anything that could not be carried over.
+func runMigrate(args []string) error {
+	if len(args) == 0 || args[0] != "sshw" {
+		return usageErrorf("usage: sshm %s", migrateUsage)
+	}
+
+	fs := flag.NewFlagSet("migrate sshw", flag.ContinueOnError)
+	from := fs.String("from", "", "sshw config to read (default ~/.sshw.yaml, ~/.sshw.yml or ~/.sshw)")
+	to := fs.String("to", "", "sshm config to write (default ~/.sshm.yaml, or $XDG_CONFIG_HOME/sshm/config.yaml when that is set)")
+	force := fs.Bool("force", false, "overwrite an existing sshm config")
+	if err := fs.Parse(args[1:]); err != nil {
+		return withCode(exitUsage, err)
+	}
+
+	src := *from
+	if src == "" {
+		paths, err := config.SSHWConfigPaths()
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				src = p
+				break
+			}
+		}
+		if src == "" {
+			return withCode(exitConfig, fmt.Errorf("no sshw config found (tried: %v)", paths))
+		}
+	}
+
+	dst := *to
+	if dst == "" {
+		p, err := config.DefaultConfigPath()
+		if err != nil {
+			return err
+		}
+		dst = p
+	}
+	if _, err := os.Stat(dst); err == nil && !*force {
+		return usageErrorf("%s already exists (use --force to overwrite)", dst)
+	}
+
+	hosts, notes, err := config.MigrateSSHW(src)
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+
+	if err := config.Save(&config.Config{Hosts: hosts}, dst); err != nil {
+		return err
+	}
+
+	infof("Migrated %d host(s) from %s to %s\n", countHosts(hosts), src, dst)
+	if len(notes) > 0 {
+		// Always reported: these need the user's attention
+		fmt.Fprintf(os.Stderr, "\nNot migrated:\n")
+		for _, n := range notes {
+			fmt.Fprintf(os.Stderr, "  - %s\n", n)
+		}
+	}
+	return nil
+}
+
+// countHosts counts the leaf hosts in a host tree.
+func countHosts(hosts []*config.Host) int {
+	n := 0
+	for _, h := range hosts {
+		if len(h.Children) > 0 {
+			n += countHosts(h.Children)
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BulkFields are the host keys that can be set across a whole group.
+// Per-host identity (name, host) and structured fields are excluded.
+var BulkFields = []string{
+	"user",
+	"port",
+	"keypath",
+	"password",
+	"key-passphrase",
+	"anti-idle",
+	"anti-idle-string",
+	"input-coalesce",
+	"local-echo",
+	"escape-char",
+	"server-alive-interval",
+	"server-alive-count-max",
+	"auto-reconnect",
+	"osc52",
+	"term",
+	"session-log",
+	"download-mode",
+	"upload-mode",
+	"honor-ignore",
+	"quiet",
+	"sftp-timeout",
+	"sftp-server-path",
+	"parallel",
+	"protocol",
+	"strict-host-key-checking",
+	"forward-gpg",
+	"agent-forwarding",
+	"keep-tunnels",
+}
+
+// HostRef is a host together with its slash separated path in the tree.
+type HostRef struct {
+	Path string
+	Host *Host
+}
+
+// FieldChange is one pending edit produced by PlanEdit.
+type FieldChange struct {
+	Path string // host path, e.g. "prod/web1"
+	Key  string // yaml key
+	Old  string // current value, for display
+	New  string // value after the edit, for display
+
+	host  *Host
+	value string
+}
+
+// GroupLeaves returns every leaf host below the group at path
+// ("prod" or "prod/eu"). An empty path means the whole config. Read-only
+// shared hosts are not included.
+func (c *Config) GroupLeaves(path string) ([]HostRef, error) {
+	hosts := c.Hosts
+	prefix := ""
+	if path != "" {
+		group := c.FindHost(path)
+		if group == nil {
+			return nil, fmt.Errorf("group %q not found", path)
+		}
+		if len(group.Children) == 0 {
+			return nil, fmt.Errorf("%q is a host, not a group", path)
+		}
+		hosts = group.Children
+		prefix = path + "/"
+	}
+
+	var refs []HostRef
+	collectLeaves(hosts, prefix, &refs)
+	return refs, nil
+}
+
+// collectLeaves appends the leaves of a host tree in display order.
+func collectLeaves(hosts []*Host, prefix string, refs *[]HostRef) {
+	for _, h := range hosts {
+		if len(h.Children) > 0 {
+			collectLeaves(h.Children, prefix+h.Name+"/", refs)
+			continue
+		}
+		if !h.Shared {
+			*refs = append(*refs, HostRef{Path: prefix + h.Name, Host: h})
+		}
+	}
+}
+
+// PlanEdit computes the changes setting each key=value in sets would make
+// to the given hosts. Values that are already in place are left out.
+func PlanEdit(refs []HostRef, sets [][2]string) ([]FieldChange, error) {
+	var changes []FieldChange
+	for _, ref := range refs {
+		after := ref.Host.Clone()
+		for _, kv := range sets {
+			key, value := kv[0], kv[1]
+
+			old, err := ref.Host.FieldValue(key)
+			if err != nil {
+				return nil, err
+			}
+			if err := after.SetField(key, value); err != nil {
+				return nil, err
+			}
+			updated, _ := after.FieldValue(key)
+			if updated == old || sameKeyPath(key, old, updated) {
+				continue
+			}
+
+			changes = append(changes, FieldChange{
+				Path:  ref.Path,
+				Key:   key,
+				Old:   displayValue(key, old),
+				New:   displayValue(key, updated),
+				host:  ref.Host,
+				value: value,
+			})
+		}
+
+		if err := after.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", ref.Path, err)
+		}
+	}
+	return changes, nil
+}
+
+// ApplyEdit applies changes returned by PlanEdit.
+func ApplyEdit(changes []FieldChange) error {
+	for _, c := range changes {
+		if err := c.host.SetField(c.Key, c.value); err != nil {
+			return fmt.Errorf("%s: %w", c.Path, err)
+		}
+	}
+	return nil
+}
+
+// sameKeyPath treats "~/x" and its expansion as the same key path, since
+// loaded hosts hold expanded paths.
+func sameKeyPath(key, a, b string) bool {
+	if key != "keypath" {
+		return false
+	}
+	ea, err1 := expandPath(a)
+	eb, err2 := expandPath(b)
+	return err1 == nil && err2 == nil && ea == eb
+}
+
+// displayValue formats a value for previews, hiding passwords.
+func displayValue(key, value string) string {
+	if (key == "password" || key == "key-passphrase") && value != "" {
+		return "********"
+	}
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+// SetField sets the field with the given yaml key from its YAML text,
+// e.g. SetField("port", "2222"). String fields take the text as it is, so
+// a password like "#x" or "*x" isn't read as YAML syntax. An empty value
+// resets the field.
+func (h *Host) SetField(key, value string) error {
+	field, err := h.bulkField(key)
+	if err != nil {
+		return err
+	}
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	v := reflect.New(field.Type())
+	if value != "" {
+		if err := yaml.Unmarshal([]byte(value), v.Interface()); err != nil {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+	}
+	field.Set(v.Elem())
+	return nil
+}
+
+// FieldValue returns the field with the given yaml key as YAML text, or
+// as it is for string fields, the form SetField takes.
+func (h *Host) FieldValue(key string) (string, error) {
+	field, err := h.bulkField(key)
+	if err != nil {
+		return "", err
+	}
+	if field.IsZero() {
+		return "", nil
+	}
+	if field.Kind() == reflect.String {
+		return field.String(), nil
+	}
+
+	data, err := yaml.Marshal(field.Interface())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// bulkField returns the struct field for a key listed in BulkFields.
+func (h *Host) bulkField(key string) (reflect.Value, error) {
+	allowed := false
+	for _, k := range BulkFields {
+		if k == key {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return reflect.Value{}, fmt.Errorf("unknown or per-host field %q (settable: %s)",
+			key, strings.Join(BulkFields, ", "))
+	}
+
+	v := reflect.ValueOf(h).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == key {
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown field %q", key)
+}
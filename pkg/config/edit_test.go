@@ -0,0 +1,39 @@
+package config
+
+import "testing"
+
+func TestSetFieldStringVerbatim(t *testing.T) {
+	for _, value := range []string{
+		"#secret", "*alias", "&anchor", "!tag", "a: b", "@x", "`x", "%x", "[x]", "{x}", "yes", "0123", "null", "'quoted'",
+	} {
+		for _, key := range []string{"password", "user", "key-passphrase"} {
+			h := &Host{}
+			if err := h.SetField(key, value); err != nil {
+				t.Errorf("SetField(%s, %q) = %v", key, value, err)
+				continue
+			}
+			got, err := h.FieldValue(key)
+			if err != nil || got != value {
+				t.Errorf("SetField(%s, %q) then FieldValue = %q, %v", key, value, got, err)
+			}
+		}
+	}
+
+	h := &Host{User: "me", Password: "old"}
+	if err := h.SetField("password", ""); err != nil || h.Password != "" {
+		t.Errorf("SetField(password, \"\") left %q, %v", h.Password, err)
+	}
+}
+
+func TestSetFieldParsesOtherKinds(t *testing.T) {
+	h := &Host{}
+	if err := h.SetField("port", "2222"); err != nil || h.Port != 2222 {
+		t.Errorf("SetField(port, 2222) = %d, %v", h.Port, err)
+	}
+	if err := h.SetField("auto-reconnect", "true"); err != nil || !h.AutoReconnect {
+		t.Errorf("SetField(auto-reconnect, true) = %v, %v", h.AutoReconnect, err)
+	}
+	if err := h.SetField("port", "abc"); err == nil {
+		t.Error("SetField(port, abc) succeeded")
+	}
+}
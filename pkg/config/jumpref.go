@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A jump entry may name another host instead of describing the hop
+// inline, so a bastion's address and credentials live in one place:
+//
+//	jump: [bastion-eu]
+//
+// The name is a host path ("prod/bastion") or a name only one host has.
+// References are resolved once the config and shared inventories are
+// loaded: the hop becomes a copy of the host named, preceded by that
+// host's own jump hops, so chains compose. Save writes the names back.
+
+// plainHost is Host without its YAML methods.
+type plainHost Host
+
+// UnmarshalYAML accepts a host mapping or, in a jump list, a host name.
+func (h *Host) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = Host{ref: value.Value}
+		return nil
+	}
+	return value.Decode((*plainHost)(h))
+}
+
+// MarshalYAML writes jump references back as the names they were given.
+func (h *Host) MarshalYAML() (interface{}, error) {
+	if h.ref != "" {
+		return h.ref, nil
+	}
+	if h.declaredJump != nil {
+		c := *h
+		c.Jump = h.declaredJump
+		return (*plainHost)(&c), nil
+	}
+	return (*plainHost)(h), nil
+}
+
+// resolveJumps replaces the references in every jump list with the hosts
+// they name.
+func (c *Config) resolveJumps() error {
+	var errs []string
+	var walk func(hosts []*Host, prefix string)
+	walk = func(hosts []*Host, prefix string) {
+		for _, h := range hosts {
+			if h.ref != "" {
+				errs = append(errs, fmt.Sprintf("%q: only jump entries may name another host", h.ref))
+				continue
+			}
+			path := prefix + h.Name
+			if slices.ContainsFunc(h.Jump, func(hop *Host) bool { return hop.ref != "" }) {
+				jump, err := c.expandJump(h, nil)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+				} else {
+					h.declaredJump = h.Jump
+					h.Jump = jump
+				}
+			}
+			walk(h.Children, path+"/")
+		}
+	}
+	walk(c.Hosts, "")
+	if len(errs) > 0 {
+		return fmt.Errorf("jump: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// expandJump returns h's jump hops with each reference replaced by the
+// host it names, preceded by that host's own hops. via lists the hosts
+// whose hops are being expanded, to catch a chain that leads back to
+// itself.
+func (c *Config) expandJump(h *Host, via []*Host) ([]*Host, error) {
+	via = append(via, h)
+	var hops []*Host
+	for _, hop := range h.Jump {
+		if hop.ref == "" {
+			hops = append(hops, hop)
+			continue
+		}
+		target, err := c.jumpTarget(hop.ref)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(via, target) {
+			names := make([]string, 0, len(via)+1)
+			for _, v := range append(via, target) {
+				names = append(names, v.Name)
+			}
+			return nil, fmt.Errorf("jump cycle %s", strings.Join(names, " -> "))
+		}
+
+		before, err := c.expandJump(target, via)
+		if err != nil {
+			return nil, err
+		}
+		hop := target.Clone()
+		hop.Jump, hop.declaredJump = nil, nil
+		hops = append(append(hops, before...), hop)
+	}
+	return hops, nil
+}
+
+// jumpTarget finds the host a jump entry names: the host at that path,
+// or else the one host with that name.
+func (c *Config) jumpTarget(name string) (*Host, error) {
+	target := c.FindHost(name)
+	if target == nil && !strings.Contains(name, "/") {
+		var found []*Host
+		var walk func(hosts []*Host)
+		walk = func(hosts []*Host) {
+			for _, h := range hosts {
+				if h.Name == name && h.ref == "" {
+					found = append(found, h)
+				}
+				walk(h.Children)
+			}
+		}
+		walk(c.Hosts)
+		if len(found) > 1 {
+			return nil, fmt.Errorf("%q names %d hosts; use its path", name, len(found))
+		}
+		if len(found) == 1 {
+			target = found[0]
+		}
+	}
+
+	switch {
+	case target == nil:
+		return nil, fmt.Errorf("no host %q", name)
+	case len(target.Children) > 0:
+		return nil, fmt.Errorf("%q is a group, not a host", name)
+	}
+	return target, nil
+}
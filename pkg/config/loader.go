@@ -2,13 +2,17 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"github.com/ai-help-me/sshm/pkg/theme"
+	"gopkg.in/yaml.v3"
 )
 
 // Load reads and parses the configuration from the specified path.
-// If path is empty, tries ~/.sshm.yaml first, falls back to ~/.sshw if not found.
+// If path is empty, the first of DefaultConfigPaths that exists is loaded.
 // Expands ~ in the path before reading.
 func Load(path string) (*Config, error) {
 	if path == "" {
@@ -24,7 +28,7 @@ func Load(path string) (*Config, error) {
 	return loadSingleConfig(expandedPath)
 }
 
-// loadDefaultConfigs loads ~/.sshm.yaml if it exists, otherwise falls back to ~/.sshw
+// loadDefaultConfigs loads the first of DefaultConfigPaths that exists.
 func loadDefaultConfigs() (*Config, error) {
 	paths, err := DefaultConfigPaths()
 	if err != nil {
@@ -51,6 +55,18 @@ func loadDefaultConfigs() (*Config, error) {
 		return cfg, nil
 	}
 
+	// A team inventory alone is enough to start; edits go to the default
+	// config path
+	cfg := &Config{}
+	cfg.Path, _ = DefaultConfigPath()
+	cfg.layerShared()
+	if len(cfg.Hosts) > 0 {
+		if err := cfg.resolveJumps(); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+
 	return nil, fmt.Errorf("no config files found (tried: %v)", paths)
 }
 
@@ -62,15 +78,22 @@ func loadSingleConfig(expandedPath string) (*Config, error) {
 		return nil, fmt.Errorf("read config file %s: %w", expandedPath, err)
 	}
 
-	// Try parsing as a list of hosts directly (the expected format)
-	var hosts []*Host
-	if err := yaml.Unmarshal(data, &hosts); err != nil {
-		return nil, fmt.Errorf("parse yaml: %w", err)
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Path = expandedPath
 
-	// Create config from the hosts
-	cfg := &Config{
-		Hosts: hosts,
+	if _, ok := theme.Lookup(cfg.Theme); !ok {
+		return nil, fmt.Errorf("theme must be one of %s", strings.Join(theme.Names(), ", "))
+	}
+	for name, command := range cfg.SFTPAliases {
+		if name == "" || strings.ContainsAny(name, " \t=") {
+			return nil, fmt.Errorf("sftp-aliases: invalid alias name %q", name)
+		}
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("sftp-aliases: alias %q is empty", name)
+		}
 	}
 
 	// Validate all hosts
@@ -80,11 +103,64 @@ func loadSingleConfig(expandedPath string) (*Config, error) {
 		}
 	}
 
+	// Snapshot the validated hosts to detect edits on save
+	var base yaml.Node
+	if err := base.Encode(cfg.Hosts); err == nil {
+		cfg.base = &base
+	}
+
+	cfg.layerShared()
+
+	// Jump references may name shared hosts, and the hops they become get
+	// overrides like any other
+	if err := cfg.resolveJumps(); err != nil {
+		return nil, err
+	}
+
+	// Overrides apply to shared hosts too, so they run after layering
+	if err := cfg.applyHostsOverrides(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("config loaded", "path", expandedPath, "hosts", len(cfg.Hosts), "shared-sources", len(cfg.Sources))
+	return cfg, nil
+}
+
+// parseConfig parses a config file in either of its two forms: a plain list
+// of hosts, or a mapping with a "hosts" list and global settings.
+func parseConfig(data []byte) (*Config, error) {
+	// Keep the node tree so Save can preserve comments and ordering
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse yaml: %w", err)
+	}
+
+	cfg := &Config{doc: &doc}
+	if len(doc.Content) == 0 {
+		return cfg, nil
+	}
+
+	var err error
+	if doc.Content[0].Kind == yaml.MappingNode {
+		err = doc.Decode(cfg)
+	} else {
+		err = doc.Decode(&cfg.Hosts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse yaml: %w", err)
+	}
+
 	return cfg, nil
 }
 
 // Save writes the configuration to the specified path.
+// If path is empty, the file the config was loaded from is used. Comments,
+// anchors and key order of a loaded file are preserved.
 func Save(cfg *Config, path string) error {
+	if path == "" {
+		path = cfg.Path
+	}
+
 	// Expand ~ in path
 	expandedPath, err := expandPath(path)
 	if err != nil {
@@ -92,12 +168,15 @@ func Save(cfg *Config, path string) error {
 	}
 
 	// Marshal to YAML
-	data, err := yaml.Marshal(cfg.Hosts)
+	data, err := marshalConfig(cfg)
 	if err != nil {
 		return fmt.Errorf("marshal yaml: %w", err)
 	}
 
-	// Write file
+	// Write file, creating its directory for a new XDG config
+	if err := os.MkdirAll(filepath.Dir(expandedPath), 0700); err != nil {
+		return fmt.Errorf("create config directory: %w", err)
+	}
 	if err := os.WriteFile(expandedPath, data, 0600); err != nil {
 		return fmt.Errorf("write config file: %w", err)
 	}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// checkResolve reports whether addr can stand in for a hostname: an IP
+// address or another name, without a port.
+func checkResolve(addr string) error {
+	if net.ParseIP(addr) != nil {
+		return nil
+	}
+	if strings.ContainsAny(addr, ":/ ") {
+		return fmt.Errorf("%q must be an IP address or hostname without a port", addr)
+	}
+	return nil
+}
+
+// applyHostsOverrides records the hosts-overrides entry of every host,
+// jump hops and group members included. Names match case-insensitively.
+func (c *Config) applyHostsOverrides() error {
+	if len(c.HostsOverrides) == 0 {
+		return nil
+	}
+
+	overrides := make(map[string]string, len(c.HostsOverrides))
+	var errs []string
+	for name, addr := range c.HostsOverrides {
+		if err := checkResolve(addr); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+		overrides[strings.ToLower(name)] = addr
+	}
+	if len(errs) > 0 {
+		return errors.New("hosts-overrides: " + strings.Join(errs, ", "))
+	}
+
+	var walk func(hosts []*Host)
+	walk = func(hosts []*Host) {
+		for _, h := range hosts {
+			h.override = overrides[strings.ToLower(h.Host)]
+			walk(h.Jump)
+			walk(h.Children)
+		}
+	}
+	walk(c.Hosts)
+	return nil
+}
@@ -0,0 +1,379 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hostKeys are the YAML keys Host knows about. Other keys in a host
+// mapping are left alone on save so hand-written extras survive.
+var hostKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Host{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
+
+// marshalConfig renders cfg.Hosts as YAML. When the config was loaded from
+// a file, only values that changed since loading are merged into the
+// original document, so comments, anchors, key order and values filled in
+// by Validate (default port, expanded keypath) are kept as written.
+func marshalConfig(cfg *Config) ([]byte, error) {
+	hosts := personalHosts(cfg.Hosts)
+	var fresh yaml.Node
+	if err := fresh.Encode(hosts); err != nil {
+		return nil, err
+	}
+
+	doc := cfg.doc
+	if list := hostListNode(doc); list != nil {
+		mergeHostList(list, cfg.base, &fresh)
+	} else {
+		for i, h := range fresh.Content {
+			fresh.Content[i] = trimHost(h)
+		}
+		if doc != nil && len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			// Settings-only file: add the hosts key
+			root := doc.Content[0]
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "hosts"}
+			root.Content = append(root.Content, key, &fresh)
+		} else {
+			doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&fresh}}
+		}
+	}
+
+	clearMergeTags(doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	// The merged document is the new baseline for later saves
+	cfg.doc = doc
+	cfg.base = nil
+	var base yaml.Node
+	if err := base.Encode(hosts); err == nil {
+		cfg.base = &base
+	}
+	return buf.Bytes(), nil
+}
+
+// hostListNode returns the node holding the host list of a loaded file:
+// the root sequence, or the "hosts" value of a root mapping.
+func hostListNode(doc *yaml.Node) *yaml.Node {
+	if doc == nil || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.SequenceNode {
+		return root
+	}
+	if list := mappingValue(root, "hosts"); list != nil && list.Kind == yaml.SequenceNode {
+		return list
+	}
+	return nil
+}
+
+// personalHosts returns the hosts that belong in the personal config file.
+// Shared hosts are left out, except that shared groups holding personal
+// entries are kept as bare groups so those entries stay in place.
+func personalHosts(hosts []*Host) []*Host {
+	var out []*Host
+	for _, h := range hosts {
+		var children []*Host
+		if len(h.Children) > 0 {
+			children = personalHosts(h.Children)
+		}
+
+		if !h.Shared {
+			if len(h.Children) > 0 {
+				c := *h
+				c.Children = children
+				h = &c
+			}
+			out = append(out, h)
+			continue
+		}
+		if len(children) > 0 {
+			out = append(out, &Host{Name: h.Name, Children: children})
+		}
+	}
+	return out
+}
+
+// unchanged reports whether src still equals its value as loaded.
+func unchanged(base, src *yaml.Node) bool {
+	return base != nil && sameValue(base, src)
+}
+
+// mergeHostList merges a sequence of hosts, matching entries by name so
+// reordered, inserted and removed hosts keep their own comments. In a
+// list of unchanged length, an entry whose name is gone is matched by
+// position, so renamed hosts keep theirs too.
+func mergeHostList(dst, base, src *yaml.Node) {
+	if unchanged(base, src) || sameValue(dst, src) {
+		return
+	}
+	if dst.Kind != yaml.SequenceNode || src.Kind != yaml.SequenceNode {
+		replaceNode(dst, src)
+		return
+	}
+
+	names := make(map[string]bool, len(src.Content))
+	for _, s := range src.Content {
+		names[hostName(s)] = true
+	}
+
+	used := make([]bool, len(dst.Content))
+	content := make([]*yaml.Node, 0, len(src.Content))
+	for i, s := range src.Content {
+		name := hostName(s)
+		j := findHostNode(dst.Content, used, name)
+		if j < 0 && len(dst.Content) == len(src.Content) && !used[i] && !names[hostName(dst.Content[i])] {
+			j, name = i, hostName(dst.Content[i])
+		}
+		if j < 0 {
+			content = append(content, trimHost(s))
+			continue
+		}
+		used[j] = true
+
+		var b *yaml.Node
+		if base != nil {
+			if k := findHostNode(base.Content, make([]bool, len(base.Content)), name); k >= 0 {
+				b = base.Content[k]
+			}
+		}
+		mergeHost(dst.Content[j], b, s)
+		content = append(content, dst.Content[j])
+	}
+	dst.Content = content
+}
+
+// findHostNode returns the index of the first unused host named name.
+func findHostNode(nodes []*yaml.Node, used []bool, name string) int {
+	for i, n := range nodes {
+		if !used[i] && hostName(n) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// hostName returns the name of a host mapping, following aliases.
+func hostName(n *yaml.Node) string {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	if v := mappingValue(n, "name"); v != nil {
+		return v.Value
+	}
+	return ""
+}
+
+// trimHost drops zero-valued keys from a newly added host so it is written
+// the way a user would.
+func trimHost(n *yaml.Node) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return n
+	}
+	content := make([]*yaml.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if isZeroScalar(val) {
+			continue
+		}
+		if key.Value == "jump" || key.Value == "children" {
+			for j, c := range val.Content {
+				val.Content[j] = trimHost(c)
+			}
+		}
+		content = append(content, key, val)
+	}
+	n.Content = content
+	return n
+}
+
+// mergeHost merges one host mapping.
+func mergeHost(dst, base, src *yaml.Node) {
+	if unchanged(base, src) || sameValue(dst, src) {
+		return
+	}
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		replaceNode(dst, trimHost(src))
+		return
+	}
+	mergeMapping(dst, base, src, true)
+}
+
+// mergeNode updates dst in place to hold the value of src, keeping dst's
+// comments and styles wherever the value is unchanged.
+func mergeNode(dst, base, src *yaml.Node) {
+	if unchanged(base, src) || sameValue(dst, src) {
+		return
+	}
+	if dst.Kind != src.Kind {
+		replaceNode(dst, src)
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.MappingNode:
+		mergeMapping(dst, base, src, false)
+	case yaml.SequenceNode:
+		for i, s := range src.Content {
+			if i >= len(dst.Content) {
+				dst.Content = append(dst.Content, s)
+				continue
+			}
+			var b *yaml.Node
+			if base != nil && base.Kind == yaml.SequenceNode && i < len(base.Content) {
+				b = base.Content[i]
+			}
+			mergeNode(dst.Content[i], b, s)
+		}
+		dst.Content = dst.Content[:len(src.Content)]
+	default:
+		replaceNode(dst, src)
+	}
+}
+
+// mergeMapping merges the keys of src into dst. Keys that were not part of
+// the loaded value (such as hand-written extras in a host) are kept.
+func mergeMapping(dst, base, src *yaml.Node, host bool) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, val := src.Content[i], src.Content[i+1]
+		b := mappingValue(base, key.Value)
+
+		if d := mappingValue(dst, key.Value); d != nil {
+			if host && (key.Value == "jump" || key.Value == "children") {
+				mergeHostList(d, b, val)
+			} else {
+				mergeNode(d, b, val)
+			}
+			continue
+		}
+		if unchanged(b, val) || inherited(dst, key.Value, val) || (host && isZeroScalar(val)) {
+			continue
+		}
+		dst.Content = append(dst.Content, key, val)
+	}
+
+	// Drop keys whose value was removed
+	content := make([]*yaml.Node, 0, len(dst.Content))
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key := dst.Content[i]
+		known := mappingValue(base, key.Value) != nil || (base == nil && (!host || hostKeys[key.Value]))
+		drop := key.Value != "<<" && mappingValue(src, key.Value) == nil && known
+		if !drop {
+			content = append(content, key, dst.Content[i+1])
+		}
+	}
+	dst.Content = content
+}
+
+// mappingValue returns the value node for key, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// inherited reports whether dst already gets key with this value through a
+// "<<" merge key, so it needn't be written out explicitly.
+func inherited(dst *yaml.Node, key string, val *yaml.Node) bool {
+	merge := mappingValue(dst, "<<")
+	if merge == nil {
+		return false
+	}
+
+	sources := []*yaml.Node{merge}
+	if merge.Kind == yaml.SequenceNode {
+		sources = merge.Content
+	}
+	for _, s := range sources {
+		if s.Kind == yaml.AliasNode && s.Alias != nil {
+			s = s.Alias
+		}
+		if v := mappingValue(s, key); v != nil {
+			return sameValue(v, val)
+		}
+	}
+	return false
+}
+
+// isZeroScalar reports whether n is an empty string, 0, false or null.
+func isZeroScalar(n *yaml.Node) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch n.Tag {
+	case "!!str":
+		return n.Value == ""
+	case "!!int":
+		return n.Value == "0"
+	case "!!bool":
+		return n.Value == "false"
+	case "!!null":
+		return true
+	}
+	return false
+}
+
+// sameValue reports whether two nodes decode to the same value, following
+// aliases and merge keys.
+func sameValue(a, b *yaml.Node) bool {
+	var av, bv interface{}
+	if a.Decode(&av) != nil || b.Decode(&bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// clearMergeTags drops the "!!merge" tag the parser puts on "<<" keys,
+// which the encoder would otherwise write out as "!!merge <<".
+func clearMergeTags(n *yaml.Node) {
+	if n == nil {
+		return
+	}
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if key := n.Content[i]; key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, c := range n.Content {
+		clearMergeTags(c)
+	}
+}
+
+// replaceNode overwrites dst with src but keeps dst's comments and anchor,
+// so aliases pointing at dst see the new value.
+func replaceNode(dst, src *yaml.Node) {
+	head, line, foot, anchor := dst.HeadComment, dst.LineComment, dst.FootComment, dst.Anchor
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+	if dst.Kind != yaml.AliasNode {
+		dst.Anchor = anchor
+	}
+}
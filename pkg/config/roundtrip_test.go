@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const anchoredConfig = `defaults: &defaults
+  user: deploy
+  port: 2222
+  keypath: ~/.ssh/deploy
+hosts:
+  # Production
+  - name: web1
+    host: 10.0.0.1
+    <<: *defaults
+  - name: web2
+    host: 10.0.0.2
+    <<: [*defaults]
+    user: admin
+  - &db
+    name: db
+    host: 10.0.0.3
+    user: postgres
+    port: 22
+  - name: jumpy
+    host: 10.0.0.4
+    user: ops
+    port: 22
+    jump:
+      - *db
+`
+
+// loadTestConfig writes data to a config file and loads it.
+func loadTestConfig(t *testing.T, data string) *Config {
+	t.Helper()
+	t.Setenv("SSHM_SHARED_CONFIG", filepath.Join(t.TempDir(), "none.yaml"))
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadSingleConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRoundTripAnchorsAndMergeKeys(t *testing.T) {
+	cfg := loadTestConfig(t, anchoredConfig)
+
+	out, err := marshalConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != anchoredConfig {
+		t.Errorf("unchanged config saved as\n%s\nwant\n%s", out, anchoredConfig)
+	}
+
+	cfg.Hosts[0].Port = 2200
+	cfg.Hosts[1].User = "root"
+	out, err = marshalConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(out)
+	if strings.Contains(saved, "!!merge") {
+		t.Errorf("saved config has explicit merge tags:\n%s", saved)
+	}
+	for _, want := range []string{"&defaults", "<<: *defaults", "<<: [*defaults]", "&db", "- *db", "# Production"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config lost %q:\n%s", want, saved)
+		}
+	}
+
+	// Reading it back gives the edited values, the rest still inherited
+	again := loadTestConfig(t, saved)
+	web1, web2, jumpy := again.Hosts[0], again.Hosts[1], again.Hosts[3]
+	if web1.Port != 2200 || web1.User != "deploy" {
+		t.Errorf("web1 = %s@:%d, want deploy@:2200", web1.User, web1.Port)
+	}
+	if web2.User != "root" || web2.Port != 2222 {
+		t.Errorf("web2 = %s@:%d, want root@:2222", web2.User, web2.Port)
+	}
+	if len(jumpy.Jump) != 1 || jumpy.Jump[0].Host != "10.0.0.3" {
+		t.Errorf("jumpy jump = %v, want db", jumpy.Jump)
+	}
+}
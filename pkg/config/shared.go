@@ -0,0 +1,442 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/secrets"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultSharedConfig is the team inventory layered beneath the personal
+// config when neither shared-config nor SSHM_SHARED_CONFIG is set.
+const DefaultSharedConfig = "/etc/sshm/hosts.yaml"
+
+// defaultRefresh is how long a fetched inventory is reused before it is
+// downloaded again, unless remote-config sets refresh.
+const defaultRefresh = time.Hour
+
+// sharedFetchTimeout bounds the download so an unreachable server doesn't
+// hold up startup; the cached copy is used instead.
+const sharedFetchTimeout = 10 * time.Second
+
+// sharedSource is one read-only inventory layered beneath the personal hosts.
+type sharedSource struct {
+	location  string        // file path or http(s) URL
+	signature string        // URL of the signature, when pubkey is set
+	refresh   time.Duration // how long a downloaded copy is reused
+	pubkey    string        // authorized_keys line the file must be signed with
+}
+
+// SourceStatus describes a shared inventory after loading.
+type SourceStatus struct {
+	Location  string    // for display: URL credentials and query are hidden
+	UpdatedAt time.Time // when the copy in use was fetched (zero for local files)
+	Stale     bool      // a refresh was due but failed, so an old copy is in use
+	Err       error     // the refresh or load error, if any
+}
+
+// String summarizes the status for display.
+func (s SourceStatus) String() string {
+	switch {
+	case s.Stale:
+		return fmt.Sprintf("shared hosts from %s are stale (updated %s ago): %v",
+			s.Location, time.Since(s.UpdatedAt).Round(time.Minute), s.Err)
+	case s.Err != nil:
+		return fmt.Sprintf("shared config %s: %v", s.Location, s.Err)
+	case !s.UpdatedAt.IsZero():
+		return fmt.Sprintf("shared hosts from %s updated %s ago",
+			s.Location, time.Since(s.UpdatedAt).Round(time.Minute))
+	}
+	return "shared hosts from " + s.Location
+}
+
+// sharedSources returns the shared inventories to layer, in order.
+func (c *Config) sharedSources() ([]sharedSource, error) {
+	var sources []sharedSource
+
+	switch {
+	case c.SharedConfig != "":
+		sources = append(sources, sharedSource{location: c.SharedConfig, refresh: defaultRefresh})
+	case os.Getenv("SSHM_SHARED_CONFIG") != "":
+		sources = append(sources, sharedSource{location: os.Getenv("SSHM_SHARED_CONFIG"), refresh: defaultRefresh})
+	default:
+		if _, err := os.Stat(DefaultSharedConfig); err == nil {
+			sources = append(sources, sharedSource{location: DefaultSharedConfig})
+		}
+	}
+
+	if rc := c.RemoteConfig; rc != nil {
+		if rc.URL == "" || rc.PubKey == "" {
+			return sources, fmt.Errorf("remote-config needs both url and pubkey")
+		}
+		src := sharedSource{
+			location:  rc.URL,
+			signature: rc.Signature,
+			refresh:   time.Duration(rc.Refresh),
+			pubkey:    rc.PubKey,
+		}
+		if src.signature == "" {
+			src.signature = rc.URL + ".sig"
+		}
+		if src.refresh <= 0 {
+			src.refresh = defaultRefresh
+		}
+		sources = append(sources, src)
+	}
+
+	return sources, nil
+}
+
+// layerShared loads the shared inventories and merges them beneath
+// c.Hosts. Problems are recorded in c.Warnings and c.Sources instead of
+// failing the load.
+func (c *Config) layerShared() {
+	sources, err := c.sharedSources()
+	if err != nil {
+		c.Warnings = append(c.Warnings, err.Error())
+	}
+
+	for _, src := range sources {
+		data, status := src.read()
+		c.Sources = append(c.Sources, status)
+		slog.Debug("shared config read", "source", status.Location, "bytes", len(data), "stale", status.Stale, "err", status.Err)
+		if data == nil {
+			c.Warnings = append(c.Warnings, status.String())
+			continue
+		}
+		if status.Stale {
+			c.Warnings = append(c.Warnings, status.String())
+		}
+
+		shared, err := parseConfig(data)
+		if err != nil {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("shared config %s: %v", status.Location, err))
+			continue
+		}
+
+		hosts := make([]*Host, 0, len(shared.Hosts))
+		for _, h := range shared.Hosts {
+			if err := h.Validate(); err != nil {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("shared config %s: skipping %s: %v", status.Location, h.Name, err))
+				continue
+			}
+			hosts = append(hosts, h)
+		}
+
+		if !src.trusted() {
+			for _, d := range dropUntrusted(hosts) {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("shared config %s: ignoring %s on %s, the source is not signed",
+					status.Location, strings.Join(d.keys, ", "), d.host))
+			}
+		}
+		markShared(hosts)
+		c.Hosts = overlayHosts(c.Hosts, hosts)
+		slog.Info("shared config layered", "source", status.Location, "hosts", len(hosts))
+	}
+}
+
+// read returns the inventory contents, or nil with status.Err set.
+func (src sharedSource) read() ([]byte, SourceStatus) {
+	status := SourceStatus{Location: redactLocation(src.location)}
+
+	// Anyone on the path could rewrite an unsigned inventory sent in clear
+	if strings.HasPrefix(src.location, "http://") && src.pubkey == "" {
+		status.Err = fmt.Errorf("plain http needs a signature; use https or remote-config with a pubkey")
+		return nil, status
+	}
+
+	if !src.remote() {
+		path, err := expandPath(src.location)
+		if err == nil {
+			var data []byte
+			if data, err = os.ReadFile(path); err == nil {
+				return data, status
+			}
+		}
+		status.Err = err
+		return nil, status
+	}
+
+	cache, err := sharedCachePath(src.location)
+	if err != nil {
+		status.Err = err
+		return nil, status
+	}
+
+	// Reuse a cached copy until it is due for refresh
+	if info, err := os.Stat(cache); err == nil && time.Since(info.ModTime()) < src.refresh {
+		data, err := src.readCache(cache)
+		if err == nil {
+			status.UpdatedAt = info.ModTime()
+			return data, status
+		}
+	}
+
+	data, sig, fetchErr := src.fetch()
+	if fetchErr == nil {
+		if err := os.MkdirAll(filepath.Dir(cache), 0700); err == nil {
+			_ = os.WriteFile(cache, data, 0600)
+			if sig != nil {
+				_ = os.WriteFile(cache+".sig", sig, 0600)
+			}
+		}
+		status.UpdatedAt = time.Now()
+		return data, status
+	}
+
+	// Fall back to an older copy rather than losing the team hosts
+	status.Err = fetchErr
+	info, err := os.Stat(cache)
+	if err != nil {
+		return nil, status
+	}
+	data, err = src.readCache(cache)
+	if err != nil {
+		return nil, status
+	}
+	status.UpdatedAt = info.ModTime()
+	status.Stale = true
+	return data, status
+}
+
+// remote reports whether the source is downloaded rather than a local file.
+func (src sharedSource) remote() bool {
+	return strings.HasPrefix(src.location, "http://") || strings.HasPrefix(src.location, "https://")
+}
+
+// trusted reports whether hosts from the source may run local commands:
+// it is signed, or a local file, which is as well protected as the
+// personal config.
+func (src sharedSource) trusted() bool {
+	return src.pubkey != "" || !src.remote()
+}
+
+// fetch downloads the inventory and, for signed sources, its signature,
+// and verifies it.
+func (src sharedSource) fetch() (data, sig []byte, err error) {
+	data, err = fetchURL(src.location)
+	if err != nil {
+		return nil, nil, err
+	}
+	if src.pubkey == "" {
+		return data, nil, nil
+	}
+
+	sig, err = fetchURL(src.signature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signature: %w", err)
+	}
+	if err := src.verify(data, sig); err != nil {
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+// readCache reads a cached inventory, re-checking its signature.
+func (src sharedSource) readCache(cache string) ([]byte, error) {
+	data, err := os.ReadFile(cache)
+	if err != nil || src.pubkey == "" {
+		return data, err
+	}
+
+	sig, err := os.ReadFile(cache + ".sig")
+	if err != nil {
+		return nil, err
+	}
+	if err := src.verify(data, sig); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// verify checks data against the source's signing key.
+func (src sharedSource) verify(data, sig []byte) error {
+	pubkey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(src.pubkey))
+	if err != nil {
+		return fmt.Errorf("parse pubkey: %w", err)
+	}
+	return verifySSHSig(data, sig, pubkey)
+}
+
+// fetchURL downloads a shared config.
+func fetchURL(location string) ([]byte, error) {
+	client := &http.Client{Timeout: sharedFetchTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		// The error repeats the URL, query and all
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("fetch %s: %w", redactLocation(location), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", redactLocation(location), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// redactLocation hides the credentials and query string of a shared
+// config URL, which may carry access tokens, for logs and messages.
+// File paths are returned as they are.
+func redactLocation(location string) string {
+	scheme, _, ok := strings.Cut(location, "://")
+	if !ok {
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return scheme + "://***"
+	}
+	redacted := scheme + "://"
+	if u.User != nil {
+		redacted += "***@"
+	}
+	redacted += u.Host + u.EscapedPath()
+	if u.RawQuery != "" || u.ForceQuery {
+		redacted += "?***"
+	}
+	return redacted
+}
+
+// sharedCachePath returns the cache file for a shared config URL.
+func sharedCachePath(location string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("get cache directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(dir, "sshm", "shared-"+hex.EncodeToString(sum[:8])+".yaml"), nil
+}
+
+// markShared flags a host tree as coming from the shared config.
+func markShared(hosts []*Host) {
+	for _, h := range hosts {
+		h.Shared = true
+		markShared(h.Children)
+	}
+}
+
+// droppedSettings names the settings dropUntrusted cleared on a host.
+type droppedSettings struct {
+	host string
+	keys []string
+}
+
+// dropUntrusted clears what a host tree from an unsigned download could
+// use against the local machine, on each host and its jump hops: local
+// commands (proxy-command, tunnel launch), handing over the local agents
+// (agent-forwarding, forward-gpg, remote tunnels) and local secrets read
+// through keychain or encrypted password and key-passphrase values. It
+// returns what was cleared, per host.
+func dropUntrusted(hosts []*Host) []droppedSettings {
+	var dropped []droppedSettings
+	for _, h := range hosts {
+		keys := dropUntrustedHost(h)
+		for _, hop := range h.Jump {
+			for _, k := range dropUntrustedHost(hop) {
+				keys = appendMissing(keys, "jump "+k)
+			}
+		}
+		if len(keys) > 0 {
+			dropped = append(dropped, droppedSettings{host: h.Name, keys: keys})
+		}
+		dropped = append(dropped, dropUntrusted(h.Children)...)
+	}
+	return dropped
+}
+
+// dropUntrustedHost clears the settings dropUntrusted covers on one host
+// and returns their keys.
+func dropUntrustedHost(h *Host) []string {
+	var keys []string
+	if h.ProxyCommand != "" {
+		h.ProxyCommand = ""
+		keys = append(keys, "proxy-command")
+	}
+	if h.AgentForwarding {
+		h.AgentForwarding = false
+		keys = append(keys, "agent-forwarding")
+	}
+	if h.ForwardGPG {
+		h.ForwardGPG = false
+		keys = append(keys, "forward-gpg")
+	}
+	if localSecret(h.Password) {
+		h.Password = ""
+		keys = append(keys, "password")
+	}
+	if localSecret(h.KeyPassphrase) {
+		h.KeyPassphrase = ""
+		keys = append(keys, "key-passphrase")
+	}
+
+	tunnels := h.Tunnels[:0:0]
+	for _, t := range h.Tunnels {
+		if t.Kind == TunnelRemote {
+			keys = appendMissing(keys, "remote tunnels")
+			continue
+		}
+		if t.Launch != "" {
+			t.Launch = ""
+			keys = appendMissing(keys, "tunnel launch")
+		}
+		tunnels = append(tunnels, t)
+	}
+	if h.Tunnels != nil {
+		h.Tunnels = tunnels
+	}
+	return keys
+}
+
+// localSecret reports whether a password value refers to a secret kept
+// on this machine rather than holding the password itself.
+func localSecret(value string) bool {
+	return secrets.IsEncrypted(value) || secrets.IsKeychainRef(value)
+}
+
+// appendMissing appends s to list unless it is already there.
+func appendMissing(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+// overlayHosts merges shared hosts beneath personal ones. A personal entry
+// replaces a shared entry of the same name, except that two groups of the
+// same name are merged level by level.
+func overlayHosts(personal, shared []*Host) []*Host {
+	out := append([]*Host(nil), personal...)
+	for _, s := range shared {
+		var match *Host
+		for _, p := range personal {
+			if p.Name == s.Name {
+				match = p
+				break
+			}
+		}
+
+		switch {
+		case match == nil:
+			out = append(out, s)
+		case len(match.Children) > 0 && len(s.Children) > 0:
+			match.Children = overlayHosts(match.Children, s.Children)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sigNamespace is the namespace remote configs must be signed with:
+//
+//	ssh-keygen -Y sign -f ~/.ssh/team_key -n sshm hosts.yaml
+const sigNamespace = "sshm"
+
+// sshsigMagic prefixes both the signature blob and the signed data.
+const sshsigMagic = "SSHSIG"
+
+// sshsig is the body of an SSH signature (OpenSSH PROTOCOL.sshsig).
+type sshsig struct {
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature []byte
+}
+
+// verifySSHSig checks that armored is a valid "ssh-keygen -Y sign"
+// signature of data made with pubkey in the sshm namespace.
+func verifySSHSig(data, armored []byte, pubkey ssh.PublicKey) error {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return fmt.Errorf("signature is not an armored SSH signature")
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+		return fmt.Errorf("signature has bad magic")
+	}
+
+	var sig sshsig
+	if err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &sig); err != nil {
+		return fmt.Errorf("parse signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return fmt.Errorf("unsupported signature version %d", sig.Version)
+	}
+	if sig.Namespace != sigNamespace {
+		return fmt.Errorf("signature namespace is %q, want %q", sig.Namespace, sigNamespace)
+	}
+
+	signer, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("parse signature key: %w", err)
+	}
+	if !bytes.Equal(signer.Marshal(), pubkey.Marshal()) {
+		return fmt.Errorf("signed by %s, not the configured pubkey", ssh.FingerprintSHA256(signer))
+	}
+
+	var h hash.Hash
+	switch sig.HashAlg {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported signature hash %q", sig.HashAlg)
+	}
+	h.Write(data)
+
+	signed := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Hash      []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlg, h.Sum(nil)})...)
+
+	var s ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &s); err != nil {
+		return fmt.Errorf("parse signature: %w", err)
+	}
+	if err := pubkey.Verify(signed, &s); err != nil {
+		return fmt.Errorf("bad signature: %w", err)
+	}
+	return nil
+}
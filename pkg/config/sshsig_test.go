@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"hash"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keygenData, keygenPubKey and keygenSig are a file signed with
+// "ssh-keygen -Y sign -f team_key -n sshm hosts.yaml".
+const (
+	keygenData   = "hosts:\n  - name: web1\n    host: 10.0.0.1\n    user: app\n"
+	keygenPubKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPDAt1FEhdIDjHaSNhjRf2dY/ICcO5wgm3s/+zI5C5om team"
+	keygenSig    = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAg8MC3UUSF0gOMdpI2GNF/Z1j8gJ
+w7nCCbez/7MjkLmiYAAAAEc3NobQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEDgIttugy9sZF3HkX0XoMzsVfyPnGKfnfYg3FIe4XhDOND3ARJeJlNx6XasJo1zSv
+GNVLsTCPfs6XKqczPsJnsH
+-----END SSH SIGNATURE-----
+`
+)
+
+// newTestSigner returns a fresh ed25519 signing key.
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signSSHSig signs data the way "ssh-keygen -Y sign" does, with the given
+// namespace and hash algorithm.
+func signSSHSig(t *testing.T, signer ssh.Signer, data []byte, namespace, hashAlg string) []byte {
+	t.Helper()
+	var h hash.Hash = sha512.New()
+	if hashAlg == "sha256" {
+		h = sha256.New()
+	}
+	h.Write(data)
+	signed := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Hash      []byte
+	}{namespace, "", hashAlg, h.Sum(nil)})...)
+
+	sig, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsig{
+		Version:   1,
+		PublicKey: signer.PublicKey().Marshal(),
+		Namespace: namespace,
+		HashAlg:   hashAlg,
+		Signature: ssh.Marshal(sig),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob})
+}
+
+func TestVerifySSHSig(t *testing.T) {
+	data := []byte("hosts: []\n")
+	signer, other := newTestSigner(t), newTestSigner(t)
+	keygenKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keygenPubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sig     []byte
+		pubkey  ssh.PublicKey
+		wantErr string
+	}{
+		{"valid sha512", data, signSSHSig(t, signer, data, "sshm", "sha512"), signer.PublicKey(), ""},
+		{"valid sha256", data, signSSHSig(t, signer, data, "sshm", "sha256"), signer.PublicKey(), ""},
+		{"ssh-keygen signature", []byte(keygenData), []byte(keygenSig), keygenKey, ""},
+		{"wrong namespace", data, signSSHSig(t, signer, data, "file", "sha512"), signer.PublicKey(), "namespace"},
+		{"tampered data", []byte("hosts: [evil]\n"), signSSHSig(t, signer, data, "sshm", "sha512"), signer.PublicKey(), "bad signature"},
+		{"tampered ssh-keygen data", []byte(strings.Replace(keygenData, "10.0.0.1", "10.6.6.6", 1)), []byte(keygenSig), keygenKey, "bad signature"},
+		{"wrong key", data, signSSHSig(t, other, data, "sshm", "sha512"), signer.PublicKey(), "not the configured pubkey"},
+		{"unsupported hash", data, signSSHSig(t, signer, data, "sshm", "md5"), signer.PublicKey(), "unsupported signature hash"},
+		{"not armored", data, []byte("garbage"), signer.PublicKey(), "not an armored SSH signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySSHSig(tt.data, tt.sig, tt.pubkey)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("verifySSHSig = %v, want success", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("verifySSHSig = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// sshwNode is a host entry in sshw's config format.
+type sshwNode struct {
+	Name           string               `yaml:"name"`
+	Alias          string               `yaml:"alias"`
+	Host           string               `yaml:"host"`
+	User           string               `yaml:"user"`
+	Port           int                  `yaml:"port"`
+	KeyPath        string               `yaml:"keypath"`
+	Passphrase     string               `yaml:"passphrase"`
+	Password       string               `yaml:"password"`
+	CallbackShells []*sshwCallbackShell `yaml:"callback-shells"`
+	Children       []*sshwNode          `yaml:"children"`
+	Jump           []*sshwNode          `yaml:"jump"`
+}
+
+// sshwCallbackShell is a command sshw types after login. Delay is in
+// milliseconds and may be written as a plain string command instead.
+type sshwCallbackShell struct {
+	Cmd   string `yaml:"cmd"`
+	Delay int    `yaml:"delay"`
+}
+
+// UnmarshalYAML accepts both {cmd, delay} and a bare command string.
+func (c *sshwCallbackShell) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Cmd = value.Value
+		return nil
+	}
+	type plain sshwCallbackShell
+	return value.Decode((*plain)(c))
+}
+
+// SSHWConfigPaths returns the locations sshw reads its config from.
+func SSHWConfigPaths() ([]string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("get home directory: %w", err)
+	}
+	return []string{
+		filepath.Join(home, ".sshw.yaml"),
+		filepath.Join(home, ".sshw.yml"),
+		filepath.Join(home, ".sshw"),
+	}, nil
+}
+
+// MigrateSSHW reads an sshw config file and converts it into sshm hosts.
+// Fields sshm can't represent are dropped and described in the returned
+// notes, one per line.
+func MigrateSSHW(path string) ([]*Host, []string, error) {
+	expandedPath, err := expandPath(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("expand config path: %w", err)
+	}
+
+	data, err := os.ReadFile(expandedPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read sshw config %s: %w", expandedPath, err)
+	}
+
+	var nodes []*sshwNode
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, nil, fmt.Errorf("parse sshw config: %w", err)
+	}
+
+	var notes []string
+	hosts := convertSSHWNodes(nodes, "", false, &notes)
+	return hosts, notes, nil
+}
+
+// convertSSHWNodes converts a list of sshw nodes. parent is the path used
+// in notes; jump marks jump host lists, which don't need a name.
+func convertSSHWNodes(nodes []*sshwNode, parent string, jump bool, notes *[]string) []*Host {
+	hosts := make([]*Host, 0, len(nodes))
+	for i, n := range nodes {
+		if n == nil {
+			continue
+		}
+
+		label := n.Name
+		if label == "" {
+			label = n.Host
+		}
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		if parent != "" {
+			label = parent + "/" + label
+		}
+		note := func(format string, args ...interface{}) {
+			*notes = append(*notes, label+": "+fmt.Sprintf(format, args...))
+		}
+
+		h := &Host{
+			Name:          n.Name,
+			Host:          n.Host,
+			User:          n.User,
+			Port:          n.Port,
+			Password:      n.Password,
+			KeyPath:       n.KeyPath,
+			KeyPassphrase: n.Passphrase,
+		}
+
+		// sshw shows the alias in the menu when there is no name
+		if h.Name == "" && n.Alias != "" {
+			h.Name = n.Alias
+		}
+		if h.Name == "" && !jump {
+			h.Name = n.Host
+		}
+		if n.Alias != "" && n.Alias != h.Name {
+			note("alias %q dropped (sshm has no aliases; use the name to search)", n.Alias)
+		}
+
+		for _, cs := range n.CallbackShells {
+			if cs == nil || strings.TrimSpace(cs.Cmd) == "" {
+				continue
+			}
+			h.CallbackShells = append(h.CallbackShells, &CallbackShell{
+				Cmd:   cs.Cmd,
+				Delay: Duration(time.Duration(max(cs.Delay, 0)) * time.Millisecond),
+			})
+		}
+
+		h.Jump = convertSSHWNodes(n.Jump, label+" jump", true, notes)
+		h.Children = convertSSHWNodes(n.Children, label, false, notes)
+		if len(h.Jump) == 0 {
+			h.Jump = nil
+		}
+		if len(h.Children) == 0 {
+			h.Children = nil
+		}
+
+		// sshw falls back to the local user name; sshm requires one
+		if len(h.Children) == 0 && !jump && h.User == "" {
+			note("no user set; add one before connecting")
+		}
+
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
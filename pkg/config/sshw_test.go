@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestConvertSSHWNodesPassphrase(t *testing.T) {
+	nodes := []*sshwNode{{
+		Name: "web", Host: "10.0.0.1", User: "app", KeyPath: "~/.ssh/id_ed25519", Passphrase: "s3cret",
+		Jump: []*sshwNode{{Host: "bastion", User: "jump", KeyPath: "~/.ssh/jump", Passphrase: "hop"}},
+	}}
+	var notes []string
+	hosts := convertSSHWNodes(nodes, "", false, &notes)
+	if len(notes) != 0 {
+		t.Errorf("notes = %q, want none", notes)
+	}
+	if got := hosts[0].KeyPassphrase; got != "s3cret" {
+		t.Errorf("key passphrase = %q, want s3cret", got)
+	}
+	if got := hosts[0].Jump[0].KeyPassphrase; got != "hop" {
+		t.Errorf("jump key passphrase = %q, want hop", got)
+	}
+}
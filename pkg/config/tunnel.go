@@ -0,0 +1,64 @@
+package config
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TunnelPreset describes a service a tunnel can be typed as.
+type TunnelPreset struct {
+	Port int // The service's standard port
+	// Args point the service's command line clients at the local end of
+	// the tunnel. "{host}", "{port}" and "{addr}" (host:port) are replaced.
+	Args []string
+}
+
+// TunnelPresets are the tunnel types, keyed by name.
+var TunnelPresets = map[string]TunnelPreset{
+	"postgres": {Port: 5432, Args: []string{"-h", "{host}", "-p", "{port}"}},
+	"mysql":    {Port: 3306, Args: []string{"-h", "{host}", "-P", "{port}"}},
+	"redis":    {Port: 6379, Args: []string{"-h", "{host}", "-p", "{port}"}},
+	"mongodb":  {Port: 27017, Args: []string{"mongodb://{addr}"}},
+	"mssql":    {Port: 1433, Args: []string{"-S", "{host},{port}"}},
+}
+
+// ClientArgs returns the preset's client arguments for a server at
+// host:port.
+func (p TunnelPreset) ClientArgs(host, port string) []string {
+	r := strings.NewReplacer("{host}", host, "{port}", port, "{addr}", net.JoinHostPort(host, port))
+	args := make([]string, len(p.Args))
+	for i, arg := range p.Args {
+		args[i] = r.Replace(arg)
+	}
+	return args
+}
+
+// tunnelTypes lists the preset names for error messages.
+func tunnelTypes() string {
+	names := make([]string, 0, len(TunnelPresets))
+	for name := range TunnelPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// WithDefaults returns the tunnel with what its type implies filled in:
+// the service's standard port on a remote given without one, and on the
+// local side when it is empty.
+func (t Tunnel) WithDefaults() Tunnel {
+	preset, ok := TunnelPresets[t.Type]
+	if !ok {
+		return t
+	}
+	port := strconv.Itoa(preset.Port)
+	if _, _, err := net.SplitHostPort(t.Remote); err != nil && t.Remote != "" && !strings.HasPrefix(t.Remote, "/") {
+		t.Remote = net.JoinHostPort(strings.Trim(t.Remote, "[]"), port)
+	}
+	if t.Local == "" {
+		t.Local = port
+	}
+	return t
+}
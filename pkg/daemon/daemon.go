@@ -0,0 +1,325 @@
+// Package daemon runs the background sshm process that owns long-lived
+// tunnels and pooled connections, and talks to it over a Unix socket in
+// the state directory.
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+// Daemon requests.
+const (
+	OpStatus = "status"
+	OpAdd    = "add"
+	OpStop   = "stop"
+	OpMaster = "master"
+)
+
+// callTimeout bounds a request so a wedged daemon doesn't hang the CLI.
+const callTimeout = 10 * time.Second
+
+// Request is sent by the CLI to the daemon.
+type Request struct {
+	Op   string       `json:"op"`
+	Spec forward.Spec `json:"spec,omitempty"` // OpAdd
+	Name string       `json:"name,omitempty"` // OpStop; empty stops all
+
+	// OpMaster: the host path and how long its connection is kept idle
+	Host    string        `json:"host,omitempty"`
+	Persist time.Duration `json:"persist,omitempty"`
+}
+
+// Response is the daemon's answer to a Request.
+type Response struct {
+	Error   string           `json:"error,omitempty"`
+	PID     int              `json:"pid"`
+	Started time.Time        `json:"started"`
+	Tunnels []forward.Status `json:"tunnels"`
+	Masters []MasterStatus   `json:"masters,omitempty"`
+	Socket  string           `json:"socket,omitempty"` // OpMaster
+}
+
+// SocketPath returns the daemon's control socket.
+func SocketPath() (string, error) {
+	return state.Path("daemon.sock")
+}
+
+// LogPath returns the file the daemon logs to when spawned.
+func LogPath() (string, error) {
+	return state.Path("daemon.log")
+}
+
+// Call sends req to the running daemon.
+func Call(req Request) (*Response, error) {
+	sock, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", sock, callTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not running: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(callTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Running reports whether a daemon answers on the socket.
+func Running() bool {
+	_, err := Call(Request{Op: OpStatus})
+	return err == nil
+}
+
+// Ensure spawns the daemon unless it is already running.
+func Ensure() error {
+	if Running() {
+		return nil
+	}
+	return Spawn()
+}
+
+// Spawn starts "sshm daemon" in the background and waits until it answers.
+func Spawn() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+	logPath, err := LogPath()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "daemon")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detached()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start daemon: %w", err)
+	}
+	_ = cmd.Process.Release()
+
+	for i := 0; i < 50; i++ {
+		if Running() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("daemon did not start, see %s", logPath)
+}
+
+// Resolver turns a host path into a function dialing that host.
+type Resolver func(host string) (forward.DialFunc, error)
+
+// Server owns the running tunnels and pooled connections.
+type Server struct {
+	resolve Resolver
+	logger  *log.Logger
+	started time.Time
+
+	mu      sync.Mutex
+	tunnels map[string]*forward.Tunnel
+	masters map[string]*master // By host path
+	done    chan struct{}
+}
+
+// NewServer creates a daemon that dials hosts through resolve.
+func NewServer(resolve Resolver, logger *log.Logger) *Server {
+	return &Server{
+		resolve: resolve,
+		logger:  logger,
+		started: time.Now(),
+		tunnels: make(map[string]*forward.Tunnel),
+		masters: make(map[string]*master),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add starts a tunnel. Resolving the host and starting the tunnel happen
+// without holding s.mu, so status requests aren't kept waiting.
+func (s *Server) Add(spec forward.Spec) error {
+	s.mu.Lock()
+	_, ok := s.tunnels[spec.Name]
+	s.mu.Unlock()
+	if ok {
+		return fmt.Errorf("tunnel %q is already running", spec.Name)
+	}
+
+	t, err := s.startTunnel(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tunnels[spec.Name]; ok {
+		// Added twice at once; keep the first
+		t.Stop()
+		return fmt.Errorf("tunnel %q is already running", spec.Name)
+	}
+	s.tunnels[spec.Name] = t
+	s.logger.Printf("tunnel %s: started (%s via %s)", spec.Name, spec, spec.Host)
+	return nil
+}
+
+func (s *Server) startTunnel(spec forward.Spec) (*forward.Tunnel, error) {
+	dial, err := s.resolve(spec.Host)
+	if err != nil {
+		return nil, err
+	}
+	return forward.Start(spec, s.pooled(spec.Host, dial), s.logger)
+}
+
+// Stop stops the named tunnel, or all tunnels when name is empty. The
+// daemon exits once no tunnels or pooled connections are left.
+func (s *Server) Stop(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name != "" {
+		if _, ok := s.tunnels[name]; !ok {
+			return fmt.Errorf("no tunnel named %q", name)
+		}
+	}
+	for n, t := range s.tunnels {
+		if name == "" || n == name {
+			t.Stop()
+			delete(s.tunnels, n)
+			s.logger.Printf("tunnel %s: stopped", n)
+		}
+	}
+	s.exitIfIdle()
+	return nil
+}
+
+// exitIfIdle ends Serve when there are no tunnels or pooled connections
+// left. s.mu must be held.
+func (s *Server) exitIfIdle() {
+	if len(s.tunnels) > 0 || len(s.masters) > 0 {
+		return
+	}
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+// Statuses returns the tunnels sorted by name.
+func (s *Server) Statuses() []forward.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]forward.Status, 0, len(s.tunnels))
+	for _, t := range s.tunnels {
+		statuses = append(statuses, t.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Serve answers requests on the control socket until the last tunnel is
+// stopped and the last pooled connection closed. It fails if another
+// daemon is already running.
+func (s *Server) Serve() error {
+	if Running() {
+		return fmt.Errorf("daemon already running")
+	}
+	sock, err := SocketPath()
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(sock) // left over from a daemon that died
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", sock, err)
+	}
+	defer os.Remove(sock)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+
+	s.logger.Printf("daemon started (pid %d)", os.Getpid())
+	go s.reap()
+	<-s.done
+	s.logger.Printf("no tunnels or pooled connections left, exiting")
+	s.mu.Lock()
+	for _, m := range s.masters {
+		m.close()
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// handle answers one request.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(callTimeout))
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var err error
+	var sock string
+	switch req.Op {
+	case OpStatus:
+	case OpMaster:
+		sock, err = s.Master(req.Host, req.Persist)
+	case OpAdd:
+		err = s.Add(req.Spec)
+	case OpStop:
+		err = s.Stop(req.Name)
+	default:
+		err = fmt.Errorf("unknown request %q", req.Op)
+	}
+
+	resp := Response{
+		PID:     os.Getpid(),
+		Started: s.started,
+		Tunnels: s.Statuses(),
+		Masters: s.Masters(),
+		Socket:  sock,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import "syscall"
+
+// detached starts the daemon in its own session so it outlives the
+// terminal that spawned it.
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
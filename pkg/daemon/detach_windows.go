@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package daemon
+
+import "syscall"
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// detached starts the daemon without a console so it outlives the
+// terminal that spawned it.
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: createNewProcessGroup | detachedProcess,
+		HideWindow:    true,
+	}
+}
@@ -0,0 +1,242 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/state"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// reapInterval is how often idle pooled connections are looked for.
+const reapInterval = 5 * time.Second
+
+// MasterStatus is a snapshot of a pooled connection.
+type MasterStatus struct {
+	Host      string        `json:"host"`
+	Since     time.Time     `json:"since"`      // when it was dialed
+	Clients   int           `json:"clients"`    // sessions and tunnels using it
+	IdleSince time.Time     `json:"idle_since"` // when the last one left
+	Persist   time.Duration `json:"persist"`    // how long it is kept idle
+}
+
+// master is a host connection the daemon keeps open for sshm processes
+// and tunnels to share.
+type master struct {
+	host    string
+	conn    forward.Conn
+	mux     *ssh.Mux
+	ln      net.Listener
+	sock    string
+	since   time.Time
+	persist time.Duration
+	lost    chan struct{} // closed when the connection is gone
+}
+
+// Master returns the socket of the pooled connection to host, dialing it
+// first if there is none. It is kept for persist after its last user
+// leaves. Hosts that need a prompt to log in fail: the daemon can't ask.
+func (s *Server) Master(host string, persist time.Duration) (string, error) {
+	s.mu.Lock()
+	if m := s.masters[host]; m != nil && m.alive() {
+		m.persist = persist
+		s.mu.Unlock()
+		return m.sock, nil
+	}
+	s.mu.Unlock()
+
+	m, err := s.dialMaster(host, persist)
+	if err != nil {
+		// A daemon spawned just for this has nothing left to do
+		s.mu.Lock()
+		s.exitIfIdle()
+		s.mu.Unlock()
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if other := s.masters[host]; other != nil && other.alive() {
+		// Dialed twice at once; keep the first
+		m.close()
+		return other.sock, nil
+	}
+	s.masters[host] = m
+	s.logger.Printf("pool %s: connected, kept %s when idle", host, persist)
+	go func() {
+		<-m.lost
+		s.dropMaster(m, "connection lost")
+	}()
+	return m.sock, nil
+}
+
+func (s *Server) dialMaster(host string, persist time.Duration) (*master, error) {
+	dial, err := s.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	var client *gossh.Client
+	switch c := conn.(type) {
+	case *gossh.Client:
+		client = c
+	case interface{ SSHClient() *gossh.Client }:
+		client = c.SSHClient()
+	}
+	if client == nil {
+		conn.Close()
+		return nil, fmt.Errorf("connection to %s can't be shared", host)
+	}
+
+	mux, err := ssh.NewMux(client)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(host))
+	sock, err := state.Path(fmt.Sprintf("mux-%x.sock", sum[:8]))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = os.Remove(sock) // left over from a daemon that died
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("listen %s: %w", sock, err)
+	}
+
+	m := &master{
+		host:    host,
+		conn:    conn,
+		mux:     mux,
+		ln:      ln,
+		sock:    sock,
+		since:   time.Now(),
+		persist: persist,
+		lost:    make(chan struct{}),
+	}
+	go mux.Serve(ln)
+	go func() {
+		conn.Wait()
+		close(m.lost)
+	}()
+	// Jump chains keep every hop alive themselves
+	if c, ok := conn.(*gossh.Client); ok {
+		go forward.Keepalive(c, m.lost)
+	}
+	return m, nil
+}
+
+func (m *master) alive() bool {
+	select {
+	case <-m.lost:
+		return false
+	default:
+		return true
+	}
+}
+
+func (m *master) close() {
+	m.ln.Close()
+	m.conn.Close()
+	_ = os.Remove(m.sock)
+}
+
+func (m *master) status() MasterStatus {
+	clients, idle := m.mux.Clients()
+	return MasterStatus{
+		Host:      m.host,
+		Since:     m.since,
+		Clients:   clients,
+		IdleSince: idle,
+		Persist:   m.persist,
+	}
+}
+
+// dropMaster closes m and forgets it, unless it was already replaced.
+func (s *Server) dropMaster(m *master, why string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.close()
+	if s.masters[m.host] != m {
+		return
+	}
+	delete(s.masters, m.host)
+	s.logger.Printf("pool %s: closed (%s)", m.host, why)
+	s.exitIfIdle()
+}
+
+// reap closes pooled connections idle for longer than they are kept.
+func (s *Server) reap() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		var idle []*master
+		for _, m := range s.masters {
+			if st := m.status(); st.Clients == 0 && time.Since(st.IdleSince) > m.persist {
+				idle = append(idle, m)
+			}
+		}
+		s.mu.Unlock()
+		for _, m := range idle {
+			s.dropMaster(m, "idle")
+		}
+	}
+}
+
+// pooled returns dial made to hand out the pooled connection to host
+// while there is one, so tunnels share it too.
+func (s *Server) pooled(host string, dial forward.DialFunc) forward.DialFunc {
+	return func() (forward.Conn, error) {
+		s.mu.Lock()
+		m := s.masters[host]
+		s.mu.Unlock()
+		if m == nil || !m.alive() {
+			return dial()
+		}
+		return &sharedConn{Conn: m.conn, release: m.mux.Acquire()}, nil
+	}
+}
+
+// sharedConn lends a pooled connection to a tunnel. Closing it only
+// gives it back.
+type sharedConn struct {
+	forward.Conn
+	release func()
+}
+
+func (c *sharedConn) Close() error {
+	c.release()
+	return nil
+}
+
+// Masters returns the pooled connections sorted by host.
+func (s *Server) Masters() []MasterStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]MasterStatus, 0, len(s.masters))
+	for _, m := range s.masters {
+		statuses = append(statuses, m.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
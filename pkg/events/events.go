@@ -0,0 +1,89 @@
+// Package events writes machine-readable JSON events, one per line, to the
+// file descriptor given with --events-fd, so wrapper tools can follow what
+// sshm is doing without scraping the terminal.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	ConnectStart     = "connect-start"
+	AuthOK           = "auth-ok"
+	SessionEnd       = "session-end"
+	TransferProgress = "transfer-progress"
+)
+
+// Event is one line written to the events fd. Fields that don't apply to
+// the event type are omitted.
+type Event struct {
+	Type    string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`    // host name in the config
+	Address string    `json:"address,omitempty"` // user@host:port
+	Mode    string    `json:"mode,omitempty"`    // ssh, sftp or exec
+
+	// session-end
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// transfer-progress
+	Direction string `json:"direction,omitempty"` // upload or download
+	Path      string `json:"path,omitempty"`      // file being transferred
+	Bytes     int64  `json:"bytes,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+}
+
+var (
+	mu  sync.Mutex
+	out io.Writer
+)
+
+// Open sends events to file descriptor fd, which the caller must have
+// opened (e.g. "3>events.jsonl" in the shell).
+func Open(fd int) error {
+	f := os.NewFile(uintptr(fd), "events")
+	if f == nil {
+		return fmt.Errorf("invalid events fd %d", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return fmt.Errorf("events fd %d is not open", fd)
+	}
+
+	mu.Lock()
+	out = f
+	mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether events are being written.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return out != nil
+}
+
+// Emit writes e, stamped with the current time. A failed write (the
+// reader went away) turns events off instead of disturbing the session.
+func Emit(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if out == nil {
+		return
+	}
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		out = nil
+	}
+}
@@ -0,0 +1,37 @@
+package forward
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentClients are the connections already serving agent requests; a
+// connection can only have one handler for them.
+var agentClients sync.Map // *ssh.Client -> struct{}
+
+// Agent forwards the local ssh-agent (SSH_AUTH_SOCK) to session, so ssh
+// and git there authenticate with local keys, also through further hops.
+// Each request from the host opens a new connection to the agent. Call
+// it before the session starts its shell or command.
+func Agent(client *ssh.Client, session *ssh.Session) error {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return errors.New("SSH_AUTH_SOCK is not set; no local ssh-agent to forward")
+	}
+
+	if _, loaded := agentClients.LoadOrStore(client, struct{}{}); !loaded {
+		if err := agent.ForwardToRemote(client, sock); err != nil {
+			agentClients.Delete(client)
+			return err
+		}
+		go func() {
+			client.Wait()
+			agentClients.Delete(client)
+		}()
+	}
+	return agent.RequestAgentForwarding(session)
+}
@@ -0,0 +1,126 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+)
+
+// gpgRemoteSocket prepares the host for a forwarded agent and prints the
+// socket gpg there connects to. The socket directory is created, and
+// whatever is at the socket is removed, like OpenSSH's
+// StreamLocalBindUnlink, since a local agent can't reuse it.
+const gpgRemoteSocket = `gpgconf --create-socketdir >/dev/null 2>&1
+p=$(gpgconf --list-dirs agent-socket 2>/dev/null) || p="$HOME/.gnupg/S.gpg-agent"
+mkdir -p -m 700 "$(dirname "$p")" && rm -f -- "$p" && printf '%s\n' "$p"`
+
+// GPGForward serves the host's gpg-agent socket from the local agent.
+type GPGForward struct {
+	client *ssh.Client
+	ln     net.Listener
+	local  string
+	remote string
+}
+
+// GPG forwards the local gpg-agent's extra socket, which only offers
+// signing and decryption, to the agent socket gpg uses on the host, so
+// e.g. git commit -S there signs with local keys. Pinentry runs locally.
+// The forward lasts until Close or until the connection is lost.
+func GPG(client *ssh.Client) (*GPGForward, error) {
+	local, err := localGPGSocket()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	out, err := session.Output(gpgRemoteSocket)
+	session.Close()
+	if err != nil {
+		return nil, fmt.Errorf("prepare agent socket on host: %w", err)
+	}
+	remote := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(remote, "/") {
+		return nil, fmt.Errorf("unexpected agent socket on host: %q", remote)
+	}
+
+	ln, err := client.Listen("unix", remote)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s on host: %w", remote, err)
+	}
+	f := &GPGForward{client: client, ln: ln, local: local, remote: remote}
+	go f.accept()
+	return f, nil
+}
+
+// Remote returns the socket path on the host.
+func (f *GPGForward) Remote() string {
+	return f.remote
+}
+
+// Close stops the forward and removes the socket from the host, so gpg
+// there can start its own agent again.
+func (f *GPGForward) Close() error {
+	err := f.ln.Close()
+	removeRemoteSocket(f.client, f.remote)
+	return err
+}
+
+func (f *GPGForward) accept() {
+	for {
+		remote, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer remote.Close()
+			local, err := net.DialTimeout("unix", f.local, dialTimeout)
+			if err != nil {
+				return
+			}
+			defer local.Close()
+
+			done := make(chan struct{}, 2)
+			go func() {
+				_, _ = io.Copy(remote, local)
+				remote.Close()
+				done <- struct{}{}
+			}()
+			go func() {
+				_, _ = io.Copy(local, remote)
+				local.Close()
+				done <- struct{}{}
+			}()
+			<-done
+			<-done
+		}()
+	}
+}
+
+// localGPGSocket returns the local agent's extra socket, starting the agent
+// if it is not running.
+func localGPGSocket() (string, error) {
+	// Best effort: without gpgconf the agent may already be running
+	_ = exec.Command("gpgconf", "--launch", "gpg-agent").Run()
+
+	if out, err := exec.Command("gpgconf", "--list-dirs", "agent-extra-socket").Output(); err == nil {
+		// gpgconf percent-escapes colons, e.g. in Windows drive letters
+		if path, err := url.PathUnescape(strings.TrimSpace(string(out))); err == nil && path != "" {
+			return path, nil
+		}
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gnupg", "S.gpg-agent.extra"), nil
+}
@@ -0,0 +1,106 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// probeTimeout bounds checking whether a socket left behind still has a
+// listener.
+const probeTimeout = time.Second
+
+// listenLocal listens on a TCP address or a Unix socket path. A socket
+// left behind by a process that is gone is replaced, and the new one is
+// only accessible to the user. Closing the listener removes the socket.
+func listenLocal(addr string) (net.Listener, error) {
+	if !IsSocket(addr) {
+		return net.Listen("tcp", addr)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(addr), 0700); err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(addr); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(addr, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket at path if nothing listens on it.
+// Anything else at path is left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, probeTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// listenRemote asks the host to listen on addr. sshd does not remove the
+// sockets it listens on, so a socket path that is taken by a stale socket
+// is removed over an exec session and the listen retried.
+func listenRemote(conn Conn, addr string) (net.Listener, error) {
+	ln, err := conn.Listen(network(addr), addr)
+	if err == nil || !IsSocket(addr) {
+		return ln, err
+	}
+
+	if probe, dialErr := conn.Dial("unix", addr); dialErr == nil {
+		probe.Close()
+		return nil, fmt.Errorf("%w (%s is in use)", err, addr)
+	}
+	if rmErr := removeRemoteSocket(conn, addr); rmErr != nil {
+		return nil, err
+	}
+	return conn.Listen("unix", addr)
+}
+
+// removeRemoteSocket removes the socket at path on the host, if there is
+// one.
+func removeRemoteSocket(conn Conn, path string) error {
+	var (
+		session *ssh.Session
+		err     error
+	)
+	// *ssh.Client and jump chains both run commands, under different names
+	switch c := conn.(type) {
+	case interface{ NewSession() (*ssh.Session, error) }:
+		session, err = c.NewSession()
+	case interface{ Session() (*ssh.Session, error) }:
+		session, err = c.Session()
+	default:
+		return errors.New("cannot run commands on the host")
+	}
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	return session.Run("if test -S " + quoted + "; then rm -f -- " + quoted + "; fi")
+}
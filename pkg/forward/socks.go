@@ -0,0 +1,110 @@
+package forward
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 reply codes (RFC 1928).
+const (
+	socksSucceeded          = 0x00
+	socksGeneralFailure     = 0x01
+	socksCommandUnsupported = 0x07
+	socksAddrUnsupported    = 0x08
+)
+
+// socksServe answers a SOCKS5 CONNECT request on client without
+// authentication and returns the connection dial opened to the requested
+// address.
+func socksServe(client net.Conn, dial func(network, addr string) (net.Conn, error)) (net.Conn, error) {
+	_ = client.SetDeadline(time.Now().Add(dialTimeout))
+	defer client.SetDeadline(time.Time{})
+
+	// Greeting: only "no authentication" is offered
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(client, head); err != nil {
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	if head[0] != 0x05 {
+		return nil, errors.New("not a SOCKS5 client")
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(client, methods); err != nil {
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	noAuth := false
+	for _, m := range methods {
+		noAuth = noAuth || m == 0x00
+	}
+	if !noAuth {
+		_, _ = client.Write([]byte{0x05, 0xff})
+		return nil, errors.New("client requires authentication")
+	}
+	if _, err := client.Write([]byte{0x05, 0x00}); err != nil {
+		return nil, err
+	}
+
+	// Request
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(client, req); err != nil {
+		return nil, fmt.Errorf("read request: %w", err)
+	}
+	if req[1] != 0x01 {
+		socksReply(client, socksCommandUnsupported)
+		return nil, fmt.Errorf("unsupported command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 0x01, 0x04:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == 0x04 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(client, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(client, n); err != nil {
+			return nil, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(client, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		socksReply(client, socksAddrUnsupported)
+		return nil, fmt.Errorf("unsupported address type %d", req[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(client, port); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	remote, err := dial("tcp", addr)
+	if err != nil {
+		socksReply(client, socksGeneralFailure)
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if err := socksReply(client, socksSucceeded); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socksReply sends a reply with an unspecified bound address, which
+// clients ignore for CONNECT.
+func socksReply(client net.Conn, code byte) error {
+	_, err := client.Write([]byte{0x05, code, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return err
+}
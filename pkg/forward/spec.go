@@ -0,0 +1,222 @@
+// Package forward implements SSH port forwards that survive connection
+// loss by reconnecting with backoff.
+package forward
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Forward kinds.
+const (
+	KindLocal   = "local"   // -L: local listener, connections dialed from the host
+	KindRemote  = "remote"  // -R: listener on the host, connections dialed locally
+	KindDynamic = "dynamic" // -D: local SOCKS5 proxy dialing from the host
+)
+
+// Spec describes a tunnel.
+type Spec struct {
+	Name string `json:"name"`
+	Host string `json:"host"`           // host path in the config, e.g. "prod/bastion"
+	Kind string `json:"kind,omitempty"` // empty means KindLocal
+	// Local is the local listen address, or the address dialed locally for
+	// remote forwards. Either end may be a Unix socket path.
+	Local string `json:"local"`
+	// Remote is the address dialed from the host, or listened on by the
+	// host for remote forwards. Dynamic forwards have none.
+	Remote string `json:"remote,omitempty"`
+}
+
+// String describes where the tunnel's traffic flows.
+func (s Spec) String() string {
+	switch s.Kind {
+	case KindRemote:
+		return fmt.Sprintf("%s (remote) -> %s", s.Remote, s.Local)
+	case KindDynamic:
+		return fmt.Sprintf("socks5://%s", s.Local)
+	}
+	return fmt.Sprintf("%s -> %s", s.Local, s.Remote)
+}
+
+// FromConfig returns the spec of a tunnel declared on the host at
+// hostPath. Bare ports become loopback addresses, and typed tunnels get
+// their service's defaults.
+func FromConfig(hostPath string, t config.Tunnel) Spec {
+	t = t.WithDefaults()
+	spec := Spec{
+		Name:   t.Name,
+		Host:   hostPath,
+		Kind:   t.Kind,
+		Local:  LocalAddr(t.Local),
+		Remote: t.Remote,
+	}
+	if t.Kind == config.TunnelRemote {
+		spec.Remote = LocalAddr(t.Remote)
+	}
+	return spec
+}
+
+// ParseLocal parses an OpenSSH style -L argument,
+// "[bind:]port:host:hostport", into a listen address and a remote address.
+// IPv6 addresses must be bracketed. Either side may be a socket path, as in
+// "/tmp/docker.sock:/var/run/docker.sock".
+func ParseLocal(arg string) (local, remote string, err error) {
+	local, remote, err = parseForward(arg)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkRemoteSocket(remote); err != nil {
+		return "", "", err
+	}
+	return LocalAddr(local), remote, nil
+}
+
+// ParseRemote parses an OpenSSH style -R argument,
+// "[bind:]port:host:hostport", into the address the host listens on and
+// the local address connections are forwarded to. Either side may be a
+// socket path.
+func ParseRemote(arg string) (local, remote string, err error) {
+	remote, local, err = parseForward(arg)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkRemoteSocket(remote); err != nil {
+		return "", "", err
+	}
+	return LocalAddr(local), remote, nil
+}
+
+// ParseDynamic parses an OpenSSH style -D argument, "[bind:]port", into a
+// listen address. A socket path is accepted as well.
+func ParseDynamic(arg string) (string, error) {
+	if IsSocket(arg) {
+		return LocalAddr(arg), nil
+	}
+	parts := splitAddr(arg)
+	var local string
+	switch len(parts) {
+	case 1:
+		local = LocalAddr(parts[0])
+	case 2:
+		local = net.JoinHostPort(parts[0], parts[1])
+	default:
+		return "", fmt.Errorf("invalid forward %q (want [bind:]port)", arg)
+	}
+	if err := checkAddr(local); err != nil {
+		return "", err
+	}
+	return local, nil
+}
+
+// parseForward splits "[bind:]port:host:hostport" into a listen address
+// (loopback unless bind is given) and a target address. Either side may be
+// a socket path instead; ~ is left for the caller to expand on the local
+// side.
+func parseForward(arg string) (listen, target string, err error) {
+	parts := splitAddr(arg)
+	n := len(parts)
+	switch {
+	case IsSocket(parts[n-1]):
+		target, parts = parts[n-1], parts[:n-1]
+	case n >= 3:
+		target, parts = net.JoinHostPort(parts[n-2], parts[n-1]), parts[:n-2]
+	}
+
+	switch {
+	case target == "":
+	case len(parts) == 1 && IsSocket(parts[0]):
+		listen = parts[0]
+	case len(parts) == 1:
+		listen = LocalAddr(parts[0])
+	case len(parts) == 2:
+		listen = net.JoinHostPort(parts[0], parts[1])
+	}
+	if listen == "" {
+		return "", "", fmt.Errorf("invalid forward %q (want [bind:]port:host:hostport, with a socket path on either side)", arg)
+	}
+
+	for _, addr := range []string{listen, target} {
+		if IsSocket(addr) {
+			continue
+		}
+		if err := checkAddr(addr); err != nil {
+			return "", "", err
+		}
+	}
+	return listen, target, nil
+}
+
+// LocalAddr turns "port" into a loopback listen address and expands ~ in a
+// socket path. Other addresses are returned unchanged.
+func LocalAddr(s string) string {
+	if _, err := strconv.Atoi(s); err == nil {
+		return net.JoinHostPort("127.0.0.1", s)
+	}
+	if strings.HasPrefix(s, "~/") {
+		if home, err := homedir.Dir(); err == nil {
+			return filepath.Join(home, s[2:])
+		}
+	}
+	return s
+}
+
+// IsSocket reports whether addr is a Unix socket path rather than a
+// host:port address.
+func IsSocket(addr string) bool {
+	return strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "~/") || filepath.IsAbs(addr)
+}
+
+// network returns the network to dial or listen on addr with.
+func network(addr string) string {
+	if IsSocket(addr) {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// checkRemoteSocket rejects a socket path on the host that is not
+// absolute: ~ could only be expanded locally.
+func checkRemoteSocket(addr string) error {
+	if strings.HasPrefix(addr, "~") {
+		return fmt.Errorf("socket path %q on the host must be absolute", addr)
+	}
+	return nil
+}
+
+// splitAddr splits on colons outside square brackets.
+func splitAddr(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, strings.Trim(s[start:i], "[]"))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.Trim(s[start:], "[]"))
+}
+
+// checkAddr validates a host:port address.
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Reconnect backoff bounds.
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Keepalives detect a dead link that TCP alone would not notice for a
+// long time.
+const (
+	keepaliveInterval = 30 * time.Second
+	keepaliveTimeout  = 15 * time.Second
+)
+
+// dialTimeout bounds connecting to the local end of a remote forward and
+// the SOCKS5 handshake of a dynamic one.
+const dialTimeout = 30 * time.Second
+
+// Conn is an SSH connection a tunnel forwards through: an *ssh.Client, or
+// a jump chain that watches each of its hops.
+type Conn interface {
+	Dial(network, addr string) (net.Conn, error)
+	// Listen asks the host to accept connections, for remote forwards.
+	Listen(network, addr string) (net.Listener, error)
+	// Wait blocks until the connection is lost.
+	Wait() error
+	Close() error
+}
+
+// DialFunc connects to the tunnel's SSH host.
+type DialFunc func() (Conn, error)
+
+// State is the lifecycle state of a tunnel.
+type State string
+
+const (
+	StateConnecting State = "connecting"
+	StateUp         State = "up"
+	StateRetrying   State = "retrying"
+	StateStopped    State = "stopped"
+)
+
+// Status is a snapshot of a tunnel.
+type Status struct {
+	Spec
+	State    State     `json:"state"`
+	Since    time.Time `json:"since"`           // when State was entered
+	Retries  int       `json:"retries"`         // failed attempts since the last success
+	Err      string    `json:"error,omitempty"` // last connection error
+	Conns    int64     `json:"conns"`           // open forwarded connections
+	BytesIn  int64     `json:"bytes_in"`        // remote to local
+	BytesOut int64     `json:"bytes_out"`       // local to remote
+}
+
+// Tunnel is a port forward that reconnects when its SSH connection is
+// lost.
+type Tunnel struct {
+	spec   Spec
+	dial   DialFunc
+	logger *log.Logger
+	ln     net.Listener // local listener; nil for remote forwards
+
+	mu     sync.Mutex
+	status Status
+	conn   Conn
+
+	conns    atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	stop chan struct{}
+}
+
+// Start listens on spec.Local and starts connecting in the background.
+// Local listen errors are returned immediately; connection errors, and
+// for remote forwards listen errors on the host, are retried.
+func Start(spec Spec, dial DialFunc, logger *log.Logger) (*Tunnel, error) {
+	var ln net.Listener
+	if spec.Kind != KindRemote {
+		var err error
+		if ln, err = listenLocal(spec.Local); err != nil {
+			return nil, fmt.Errorf("listen %s: %w", spec.Local, err)
+		}
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	t := &Tunnel{
+		spec:   spec,
+		dial:   dial,
+		logger: logger,
+		ln:     ln,
+		status: Status{Spec: spec, State: StateConnecting, Since: time.Now()},
+		stop:   make(chan struct{}),
+	}
+	if ln != nil {
+		go t.accept()
+	}
+	go t.run()
+	return t, nil
+}
+
+// Stop closes the listener and the SSH connection. A connection attempt
+// in progress is closed as soon as it completes.
+func (t *Tunnel) Stop() {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	if t.ln != nil {
+		t.ln.Close()
+	}
+}
+
+// Status returns a snapshot of the tunnel.
+func (t *Tunnel) Status() Status {
+	t.mu.Lock()
+	s := t.status
+	t.mu.Unlock()
+
+	s.Conns = t.conns.Load()
+	s.BytesIn = t.bytesIn.Load()
+	s.BytesOut = t.bytesOut.Load()
+	return s
+}
+
+// run keeps the SSH connection up until Stop is called.
+func (t *Tunnel) run() {
+	backoff := minBackoff
+	for {
+		conn, err := t.dial()
+		if err != nil {
+			t.setState(StateRetrying, err)
+			t.logger.Printf("tunnel %s: connect: %v (retrying in %s)", t.spec.Name, err, backoff)
+			if !t.sleep(backoff) {
+				t.setState(StateStopped, nil)
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		select {
+		case <-t.stop:
+			conn.Close()
+			t.setState(StateStopped, nil)
+			return
+		default:
+		}
+
+		// The host's listener goes away with the connection
+		var rln net.Listener
+		if t.spec.Kind == KindRemote {
+			var err error
+			rln, err = listenRemote(conn, t.spec.Remote)
+			if err != nil {
+				conn.Close()
+				t.setState(StateRetrying, fmt.Errorf("listen %s on host: %w", t.spec.Remote, err))
+				t.logger.Printf("tunnel %s: listen %s on host: %v (retrying in %s)", t.spec.Name, t.spec.Remote, err, backoff)
+				if !t.sleep(backoff) {
+					t.setState(StateStopped, nil)
+					return
+				}
+				backoff = min(backoff*2, maxBackoff)
+				continue
+			}
+			go t.acceptRemote(rln)
+		}
+
+		backoff = minBackoff
+		t.setConn(conn)
+		t.setState(StateUp, nil)
+		t.logger.Printf("tunnel %s: up (%s via %s)", t.spec.Name, t.spec, t.spec.Host)
+
+		lost := make(chan error, 1)
+		go func() { lost <- conn.Wait() }()
+		stopKeepalive := make(chan struct{})
+		// Jump chains keep every hop alive themselves
+		if client, ok := conn.(*ssh.Client); ok {
+			go Keepalive(client, stopKeepalive)
+		}
+
+		select {
+		case <-t.stop:
+			close(stopKeepalive)
+			t.setConn(nil)
+			if rln != nil && IsSocket(t.spec.Remote) {
+				// Don't leave a dead socket behind on the host
+				rln.Close()
+				if err := removeRemoteSocket(conn, t.spec.Remote); err != nil {
+					t.logger.Printf("tunnel %s: remove %s on host: %v", t.spec.Name, t.spec.Remote, err)
+				}
+			}
+			conn.Close()
+			t.setState(StateStopped, nil)
+			return
+		case err := <-lost:
+			close(stopKeepalive)
+			t.setConn(nil)
+			conn.Close()
+			if err == nil {
+				err = io.EOF
+			}
+			t.setState(StateRetrying, fmt.Errorf("connection lost: %w", err))
+			t.logger.Printf("tunnel %s: connection lost: %v", t.spec.Name, err)
+		}
+	}
+}
+
+// sleep waits d, returning false if the tunnel was stopped meanwhile.
+func (t *Tunnel) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-t.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (t *Tunnel) setState(state State, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.status.State != state {
+		t.status.Since = time.Now()
+	}
+	t.status.State = state
+	switch {
+	case err != nil:
+		t.status.Err = err.Error()
+		t.status.Retries++
+	case state == StateUp:
+		t.status.Err = ""
+		t.status.Retries = 0
+	}
+}
+
+func (t *Tunnel) setConn(conn Conn) {
+	t.mu.Lock()
+	t.conn = conn
+	t.mu.Unlock()
+}
+
+func (t *Tunnel) currentConn() Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn
+}
+
+// accept forwards local connections until the listener is closed.
+func (t *Tunnel) accept() {
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			return
+		}
+		if t.spec.Kind == KindDynamic {
+			go t.forwardSOCKS(conn)
+		} else {
+			go t.forward(conn)
+		}
+	}
+}
+
+// acceptRemote forwards connections accepted by the host until its
+// listener is closed along with the SSH connection.
+func (t *Tunnel) acceptRemote(ln net.Listener) {
+	for {
+		remote, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer remote.Close()
+			local, err := net.DialTimeout(network(t.spec.Local), t.spec.Local, dialTimeout)
+			if err != nil {
+				t.logger.Printf("tunnel %s: dial %s: %v", t.spec.Name, t.spec.Local, err)
+				return
+			}
+			t.pipe(local, remote)
+		}()
+	}
+}
+
+// forward copies one local connection to the remote address. Connections
+// arriving while reconnecting are refused.
+func (t *Tunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	conn := t.currentConn()
+	if conn == nil {
+		return
+	}
+	remote, err := conn.Dial(network(t.spec.Remote), t.spec.Remote)
+	if err != nil {
+		t.logger.Printf("tunnel %s: dial %s: %v", t.spec.Name, t.spec.Remote, err)
+		return
+	}
+	t.pipe(local, remote)
+}
+
+// forwardSOCKS serves one SOCKS5 client, dialing the requested address
+// from the host.
+func (t *Tunnel) forwardSOCKS(local net.Conn) {
+	defer local.Close()
+
+	conn := t.currentConn()
+	if conn == nil {
+		return
+	}
+	remote, err := socksServe(local, conn.Dial)
+	if err != nil {
+		t.logger.Printf("tunnel %s: socks: %v", t.spec.Name, err)
+		return
+	}
+	t.pipe(local, remote)
+}
+
+// pipe copies between both ends until either closes, counting the bytes.
+func (t *Tunnel) pipe(local, remote net.Conn) {
+	defer local.Close()
+	defer remote.Close()
+
+	t.conns.Add(1)
+	defer t.conns.Add(-1)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(counter{remote, &t.bytesOut}, local)
+		remote.Close()
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(counter{local, &t.bytesIn}, remote)
+		local.Close()
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// counter counts the bytes written through it, so Status is current while
+// a connection is still open.
+type counter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Keepalive closes client when the server stops answering keepalive
+// requests, so a dead link is noticed and the tunnel reconnects.
+func Keepalive(client *ssh.Client, stop <-chan struct{}) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case err := <-reply:
+			if err != nil {
+				client.Close()
+				return
+			}
+		case <-time.After(keepaliveTimeout):
+			client.Close()
+			return
+		case <-stop:
+			return
+		}
+	}
+}
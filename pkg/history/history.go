@@ -0,0 +1,192 @@
+// Package history keeps the hosts sshm connected to and those starred as
+// favorites, which the host list shows at the top.
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+// maxConnections is how many connections are kept, newest first. It
+// bounds how far back "sshm stats" sees.
+const maxConnections = 1000
+
+// historyFile is the history's file in the state directory.
+const historyFile = "history.json"
+
+// IdleAfter is how long a session may go without input or output before
+// the gap counts as idle time.
+const IdleAfter = 5 * time.Minute
+
+// Connection is one connection made from sshm.
+type Connection struct {
+	Path string    `json:"path"` // Host path in the config, e.g. "prod/web1"
+	Mode string    `json:"mode"` // ssh or sftp
+	At   time.Time `json:"at"`
+	// Duration is how long the session lasted and Idle how much of it
+	// was idle; both are 0 until it ends.
+	Duration time.Duration `json:"duration,omitempty"`
+	Idle     time.Duration `json:"idle,omitempty"`
+}
+
+// Active returns how much of the session was not idle.
+func (c Connection) Active() time.Duration {
+	return c.Duration - c.Idle
+}
+
+// History is the content of history.json in the state directory.
+type History struct {
+	Connections []Connection `json:"connections,omitempty"`
+	Favorites   []string     `json:"favorites,omitempty"` // Host paths, in the order starred
+}
+
+// Load reads the history, treating a missing or corrupt file as empty.
+func Load() *History {
+	path, err := state.Path(historyFile)
+	if err != nil {
+		return &History{}
+	}
+	data, _ := os.ReadFile(path)
+	return parse(data)
+}
+
+// parse reads history.json's content, treating corrupt data as empty.
+func parse(data []byte) *History {
+	h := &History{}
+	if json.Unmarshal(data, h) != nil {
+		return &History{}
+	}
+	return h
+}
+
+// Update applies change to the history as it is on disk and writes it
+// back, locked against other sshm processes so their changes aren't lost.
+func Update(change func(h *History)) error {
+	return state.Update(historyFile, func(data []byte) ([]byte, error) {
+		h := parse(data)
+		change(h)
+		return json.MarshalIndent(h, "", "  ")
+	})
+}
+
+// Session is a connection being recorded, measuring how much of it is
+// idle.
+type Session struct {
+	path string
+	at   time.Time
+
+	mu   sync.Mutex
+	last time.Time // last activity
+	busy bool      // working without input or output, e.g. a transfer
+	idle time.Duration
+}
+
+// Start adds a connection to the host at path and returns its session,
+// to be ended with End. Like other cached state it is best effort; write
+// errors are dropped.
+func Start(path, mode string) *Session {
+	s := &Session{path: path, at: time.Now()}
+	s.last = s.at
+
+	_ = Update(func(h *History) {
+		h.Connections = append([]Connection{{Path: path, Mode: mode, At: s.at}}, h.Connections...)
+		if len(h.Connections) > maxConnections {
+			h.Connections = h.Connections[:maxConnections]
+		}
+	})
+	return s
+}
+
+// Touch marks activity in the session: a gap since the last of more than
+// IdleAfter is counted as idle.
+func (s *Session) Touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch(time.Now())
+}
+
+// SetBusy marks activity and says whether the session is working on its
+// own from now on, so the gap until the next activity isn't idle.
+func (s *Session) SetBusy(busy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch(time.Now())
+	s.busy = busy
+}
+
+// touch marks activity at now. Callers hold mu.
+func (s *Session) touch(now time.Time) {
+	if gap := now.Sub(s.last); gap > IdleAfter && !s.busy {
+		s.idle += gap
+	}
+	s.last = now
+}
+
+// Writer returns w, marking activity on every write.
+func (s *Session) Writer(w io.Writer) io.Writer {
+	return activityWriter{w: w, s: s}
+}
+
+// End records how long the session lasted and how much of it was idle.
+func (s *Session) End() {
+	s.mu.Lock()
+	now := time.Now()
+	s.touch(now)
+	duration, idle := now.Sub(s.at), s.idle
+	s.mu.Unlock()
+
+	_ = Update(func(h *History) {
+		for i, c := range h.Connections {
+			if c.Path == s.path && c.At.Equal(s.at) {
+				h.Connections[i].Duration = duration.Round(time.Second)
+				h.Connections[i].Idle = idle.Round(time.Second)
+				return
+			}
+		}
+	})
+}
+
+// activityWriter marks activity in a session on every write.
+type activityWriter struct {
+	w io.Writer
+	s *Session
+}
+
+func (a activityWriter) Write(p []byte) (int, error) {
+	a.s.Touch()
+	return a.w.Write(p)
+}
+
+// Recent returns the paths of the hosts connected to, most recent first,
+// each once.
+func (h *History) Recent() []string {
+	var paths []string
+	for _, c := range h.Connections {
+		if !slices.Contains(paths, c.Path) {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// IsFavorite reports whether the host at path is starred.
+func (h *History) IsFavorite(path string) bool {
+	return slices.Contains(h.Favorites, path)
+}
+
+// ToggleFavorite stars the host at path, or unstars it if it was, and
+// reports whether it is now a favorite.
+func (h *History) ToggleFavorite(path string) bool {
+	if i := slices.Index(h.Favorites, path); i >= 0 {
+		h.Favorites = slices.Delete(h.Favorites, i, i+1)
+		return false
+	}
+	h.Favorites = append(h.Favorites, path)
+	return true
+}
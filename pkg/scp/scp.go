@@ -0,0 +1,393 @@
+// Package scp copies files with the SCP protocol over an SSH exec
+// session, for servers that have no SFTP subsystem (network gear, old
+// appliances). The remote side is the server's own scp binary.
+package scp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options controls a transfer.
+type Options struct {
+	Recursive bool // Copy directories (-r)
+	Preserve  bool // Keep modification times and permissions (-p)
+
+	// Progress, when set, is called as each file starts and returns the
+	// func told how many more bytes of it were copied.
+	Progress func(name string, size int64) func(n int64)
+}
+
+// Client runs transfers on an SSH connection.
+type Client struct {
+	conn *ssh.Client
+}
+
+// New returns a client for conn.
+func New(conn *ssh.Client) *Client {
+	return &Client{conn: conn}
+}
+
+// Download copies remotePath to localPath. Like scp, an existing
+// directory at localPath receives the copy under its remote name.
+func (c *Client) Download(ctx context.Context, remotePath, localPath string, opts Options) error {
+	return c.run(ctx, "-f", remotePath, opts, func(r *bufio.Reader, w io.Writer) error {
+		return receive(r, w, localPath, opts)
+	})
+}
+
+// Upload copies localPath to remotePath. An existing remote directory
+// receives the copy under its local name.
+func (c *Client) Upload(ctx context.Context, localPath, remotePath string, opts Options) error {
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !opts.Recursive {
+		return fmt.Errorf("%s is a directory (use -r)", localPath)
+	}
+	return c.run(ctx, "-t", remotePath, opts, func(r *bufio.Reader, w io.Writer) error {
+		if err := readAck(r); err != nil {
+			return err
+		}
+		return send(r, w, localPath, fi, opts)
+	})
+}
+
+// run starts the remote scp in mode (-f sends, -t receives) and speaks
+// the protocol with it through talk. Cancelling ctx ends the session.
+func (c *Client) run(ctx context.Context, mode, remotePath string, opts Options, talk func(r *bufio.Reader, w io.Writer) error) error {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	session.Stderr = &stderr
+
+	cmd := "scp " + mode
+	if opts.Recursive {
+		cmd += " -r"
+	}
+	if opts.Preserve {
+		cmd += " -p"
+	}
+	if err := session.Start(cmd + " " + Quote(remotePath)); err != nil {
+		return fmt.Errorf("start scp: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	err = talk(bufio.NewReader(stdout), stdin)
+	stdin.Close()
+	if ctx.Err() != nil {
+		return context.Canceled
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return errors.New(msg)
+		}
+		return err
+	}
+	if err := session.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("scp: %w", err)
+	}
+	return nil
+}
+
+// readAck reads the remote side's answer to a message: 0 is OK, 1 a
+// warning and 2 a fatal error, both followed by a line of text.
+func readAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return errors.New(strings.TrimSpace(msg))
+}
+
+// ack tells the remote side its last message was accepted.
+func ack(w io.Writer) error {
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// send uploads path, whose info is fi, and the tree under it.
+func send(r *bufio.Reader, w io.Writer, path string, fi os.FileInfo, opts Options) error {
+	if opts.Preserve {
+		t := fi.ModTime().Unix()
+		if _, err := fmt.Fprintf(w, "T%d 0 %d 0\n", t, t); err != nil {
+			return err
+		}
+		if err := readAck(r); err != nil {
+			return err
+		}
+	}
+
+	name := fi.Name()
+	if !fi.IsDir() {
+		return sendFile(r, w, path, name, fi, opts)
+	}
+
+	if _, err := fmt.Fprintf(w, "D%04o 0 %s\n", fi.Mode().Perm(), name); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		info, err := os.Stat(child)
+		if err != nil {
+			return err
+		}
+		// Only regular files and directories have an SCP message
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		if err := send(r, w, child, info, opts); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "E\n"); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+// sendFile uploads one file as name.
+func sendFile(r *bufio.Reader, w io.Writer, path, name string, fi os.FileInfo, opts Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", fi.Mode().Perm(), fi.Size(), name); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+	var src io.Reader = f
+	if opts.Progress != nil {
+		src = &countingReader{f, opts.Progress(path, fi.Size())}
+	}
+	if _, err := io.CopyN(w, src, fi.Size()); err != nil {
+		return err
+	}
+	if err := ack(w); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+// receive downloads what the remote side sends to localPath.
+func receive(r *bufio.Reader, w io.Writer, localPath string, opts Options) error {
+	if err := ack(w); err != nil {
+		return err
+	}
+
+	var (
+		dirs     []string // Directories being received, innermost last
+		times    *[2]time.Time
+		warnings []error // Files the server skipped
+		first    = true
+	)
+	// target is where an item called name goes: inside the directory
+	// being received, else into or as localPath
+	target := func(name string) string {
+		if len(dirs) > 0 {
+			return filepath.Join(dirs[len(dirs)-1], name)
+		}
+		if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+			return filepath.Join(localPath, name)
+		}
+		return localPath
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if first {
+				return io.ErrUnexpectedEOF
+			}
+			return errors.Join(warnings...)
+		}
+		if err != nil {
+			return err
+		}
+		first = false
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return errors.New("bad empty message")
+		}
+
+		switch line[0] {
+		case 1:
+			// The server goes on with the next file unacknowledged
+			warnings = append(warnings, errors.New(strings.TrimSpace(line[1:])))
+			continue
+
+		case 2:
+			return errors.New(strings.TrimSpace(line[1:]))
+
+		case 'T':
+			var mtime, atime int64
+			if _, err := fmt.Sscanf(line, "T%d 0 %d 0", &mtime, &atime); err != nil {
+				return fmt.Errorf("bad message %q", line)
+			}
+			times = &[2]time.Time{time.Unix(atime, 0), time.Unix(mtime, 0)}
+
+		case 'D':
+			mode, _, name, err := parseHeader(line)
+			if err != nil {
+				return err
+			}
+			dir := target(name)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if opts.Preserve {
+				os.Chmod(dir, mode)
+			}
+			dirs = append(dirs, dir)
+			times = nil
+
+		case 'E':
+			if len(dirs) == 0 {
+				return fmt.Errorf("bad message %q", line)
+			}
+			dirs = dirs[:len(dirs)-1]
+
+		case 'C':
+			mode, size, name, err := parseHeader(line)
+			if err != nil {
+				return err
+			}
+			if err := ack(w); err != nil {
+				return err
+			}
+			path := target(name)
+			if err := receiveFile(r, path, size, opts); err != nil {
+				return err
+			}
+			if err := readAck(r); err != nil {
+				return err
+			}
+			if opts.Preserve {
+				os.Chmod(path, mode)
+				if times != nil {
+					os.Chtimes(path, times[0], times[1])
+				}
+			}
+			times = nil
+
+		default:
+			return fmt.Errorf("bad message %q", line)
+		}
+
+		if err := ack(w); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveFile writes the next size bytes from r to path.
+func receiveFile(r io.Reader, path string, size int64, opts Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var dst io.Writer = f
+	if opts.Progress != nil {
+		dst = &countingWriter{f, opts.Progress(path, size)}
+	}
+	if _, err := io.CopyN(dst, r, size); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// parseHeader parses a "C0644 1234 name" or "D0755 0 name" message. The
+// name comes from the server, so it must be a plain file name.
+func parseHeader(line string) (os.FileMode, int64, string, error) {
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("bad message %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("bad message %q", line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("bad message %q", line)
+	}
+	name := fields[2]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return 0, 0, "", fmt.Errorf("unsafe file name %q from server", name)
+	}
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+// Quote quotes s for a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// countingReader reports the bytes read through it.
+type countingReader struct {
+	r   io.Reader
+	add func(n int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(int64(n))
+	return n, err
+}
+
+// countingWriter reports the bytes written through it.
+type countingWriter struct {
+	w   io.Writer
+	add func(n int64)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.add(int64(n))
+	return n, err
+}
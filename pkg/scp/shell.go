@@ -0,0 +1,375 @@
+package scp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/ai-help-me/sshm/pkg/theme"
+	"github.com/mitchellh/go-homedir"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// historySize is how many command lines the shell remembers.
+const historySize = 1000
+
+// ShellOptions holds per-host settings for the SCP shell.
+type ShellOptions struct {
+	Quiet bool // Suppress the banner and progress bars
+
+	// Terminal reads command lines; nil uses a manager of its own.
+	Terminal *terminal.Manager
+
+	// HistoryFile keeps command lines across sessions; empty keeps them
+	// for this session only.
+	HistoryFile string
+
+	// Busy, when set, is called with true as each command starts and
+	// false as it ends, telling time spent working from time at the
+	// prompt.
+	Busy func(bool)
+}
+
+// Shell is the file shell for servers without SFTP: get and put over
+// SCP, with ls and cd run as remote commands. It keeps a local and a
+// remote working directory like the SFTP shell.
+type Shell struct {
+	conn   *ssh.Client
+	client *Client
+	user   string
+	host   string
+	opts   ShellOptions
+
+	localCWD   string
+	remoteCWD  string
+	homeRemote string
+
+	stdout io.Writer
+	stderr io.Writer
+	info   io.Writer // Banner and summaries; discarded in quiet mode
+}
+
+// NewShell creates an SCP shell on conn, starting in the remote home
+// directory.
+func NewShell(conn *ssh.Client, user, host string, opts ShellOptions) (*Shell, error) {
+	s := &Shell{
+		conn:   conn,
+		client: New(conn),
+		user:   user,
+		host:   host,
+		opts:   opts,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		info:   os.Stdout,
+	}
+	if opts.Quiet {
+		s.info = io.Discard
+	}
+
+	var err error
+	if s.localCWD, err = os.Getwd(); err != nil {
+		return nil, fmt.Errorf("get local cwd: %w", err)
+	}
+	home, err := s.output("pwd")
+	if err != nil {
+		return nil, fmt.Errorf("get remote home: %w", err)
+	}
+	s.remoteCWD, s.homeRemote = home, home
+	return s, nil
+}
+
+// Run reads and runs commands until exit or end of input.
+func (s *Shell) Run() error {
+	fmt.Fprintf(s.info, "SCP shell started; the server has no SFTP, so only basic commands work. Type 'help' for commands.\n")
+
+	// Ctrl+C only cancels transfers; it must not end sshm
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	termMgr := s.opts.Terminal
+	if termMgr == nil {
+		termMgr = terminal.New()
+	}
+	editor := termMgr.NewLineEditor(nil)
+	editor.SetHistory(terminal.LoadHistory(s.opts.HistoryFile, historySize))
+
+	for {
+		prompt := fmt.Sprintf("%sscp %s@%s:%s>\033[0m ", theme.SGR(theme.Current().Prompt, true), s.user, s.host, s.remoteCWD)
+		line, err := editor.ReadLine(prompt)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read input: %w", err)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := strings.ToLower(fields[0]), fields[1:]
+		if cmd == "exit" || cmd == "quit" || cmd == "bye" {
+			return nil
+		}
+		if err := s.executeBusy(cmd, args); err != nil {
+			if err == context.Canceled {
+				fmt.Fprintf(s.stderr, "Transfer cancelled.\n")
+			} else {
+				fmt.Fprintf(s.stderr, "Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// executeBusy runs a command like execute, telling ShellOptions.Busy.
+func (s *Shell) executeBusy(cmd string, args []string) error {
+	if s.opts.Busy != nil {
+		s.opts.Busy(true)
+		defer s.opts.Busy(false)
+	}
+	return s.execute(cmd, args)
+}
+
+// execute runs one command.
+func (s *Shell) execute(cmd string, args []string) error {
+	switch cmd {
+	case "get":
+		return s.transfer(args, true)
+	case "put":
+		return s.transfer(args, false)
+	case "ls":
+		return s.cmdLS(args)
+	case "cd":
+		return s.cmdCD(args)
+	case "pwd":
+		fmt.Fprintf(s.stdout, "Remote working directory: %s\n", s.remoteCWD)
+	case "lcd":
+		return s.cmdLCD(args)
+	case "lls":
+		return s.cmdLLS(args)
+	case "lpwd":
+		fmt.Fprintf(s.stdout, "Local working directory: %s\n", s.localCWD)
+	case "help", "?":
+		fmt.Fprint(s.stdout, `Commands (SCP mode):
+  get [-r] [-p] <remote> [local]   Download a file, or a directory with -r
+  put [-r] [-p] <local> [remote]   Upload a file, or a directory with -r
+  ls [path]                        List remote files (runs ls -la)
+  cd [path] / pwd                  Change / print the remote directory
+  lcd [path] / lls [path] / lpwd   Local directory commands
+  exit                             Leave the shell
+`)
+	default:
+		return fmt.Errorf("unknown command: %s (not available over SCP)", cmd)
+	}
+	return nil
+}
+
+// transfer runs get (download) or put with its flags. Ctrl+C cancels it.
+func (s *Shell) transfer(args []string, download bool) error {
+	var opts Options
+	var paths []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			for _, c := range arg[1:] {
+				switch c {
+				case 'r':
+					opts.Recursive = true
+				case 'p':
+					opts.Preserve = true
+				default:
+					return fmt.Errorf("unknown flag -%c", c)
+				}
+			}
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) == 0 || len(paths) > 2 {
+		if download {
+			return fmt.Errorf("usage: get [-r] [-p] remote-path [local-path]")
+		}
+		return fmt.Errorf("usage: put [-r] [-p] local-path [remote-path]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts.Progress = s.progress(download)
+
+	if download {
+		remote := s.resolveRemote(paths[0])
+		local := s.localCWD
+		if len(paths) > 1 {
+			local = s.resolveLocal(paths[1])
+		}
+		if err := s.client.Download(ctx, remote, local, opts); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.info, "Download complete: %s\n", remote)
+		return nil
+	}
+
+	local := s.resolveLocal(paths[0])
+	remote := s.remoteCWD
+	if len(paths) > 1 {
+		remote = s.resolveRemote(paths[1])
+	}
+	if err := s.client.Upload(ctx, local, remote, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.info, "Upload complete: %s\n", local)
+	return nil
+}
+
+// progress returns the Progress func drawing a bar per file, or nil when
+// there is no terminal to draw on.
+func (s *Shell) progress(download bool) func(name string, size int64) func(int64) {
+	if s.opts.Quiet || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	verb := "Uploading"
+	if download {
+		verb = "Downloading"
+	}
+	return func(name string, size int64) func(int64) {
+		bar := progressbar.NewOptions64(size,
+			progressbar.OptionSetWriter(os.Stderr),
+			progressbar.OptionSetDescription(fmt.Sprintf("%s %s", verb, filepath.Base(name))),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionSetRenderBlankState(true),
+			progressbar.OptionOnCompletion(func() { fmt.Fprintln(os.Stderr) }),
+		)
+		return func(n int64) { bar.Add64(n) }
+	}
+}
+
+// cmdLS lists a remote directory with the server's ls.
+func (s *Shell) cmdLS(args []string) error {
+	dir := s.remoteCWD
+	if len(args) > 0 {
+		dir = s.resolveRemote(args[0])
+	}
+	session, err := s.conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	defer session.Close()
+	session.Stdout = s.stdout
+	session.Stderr = s.stderr
+	if err := session.Run("ls -la " + Quote(dir)); err != nil {
+		return fmt.Errorf("ls %s: %w", dir, err)
+	}
+	return nil
+}
+
+// cmdCD changes the remote directory, which the server's shell checks and
+// resolves.
+func (s *Shell) cmdCD(args []string) error {
+	dir := s.homeRemote
+	if len(args) > 0 {
+		dir = s.resolveRemote(args[0])
+	}
+	resolved, err := s.output("cd " + Quote(dir) + " && pwd")
+	if err != nil {
+		return fmt.Errorf("cd %s: %w", dir, err)
+	}
+	s.remoteCWD = resolved
+	return nil
+}
+
+// cmdLCD changes the local directory.
+func (s *Shell) cmdLCD(args []string) error {
+	dir := "~"
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	resolved := s.resolveLocal(dir)
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", resolved)
+	}
+	s.localCWD = resolved
+	return nil
+}
+
+// cmdLLS lists a local directory.
+func (s *Shell) cmdLLS(args []string) error {
+	dir := s.localCWD
+	if len(args) > 0 {
+		dir = s.resolveLocal(args[0])
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(s.stdout, "%s %8d %s %s\n", info.Mode(), info.Size(), info.ModTime().Format("Jan 02 15:04"), name)
+	}
+	return nil
+}
+
+// output runs cmd on the server and returns its output, trimmed.
+func (s *Shell) output(cmd string) (string, error) {
+	session, err := s.conn.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("open session: %w", err)
+	}
+	defer session.Close()
+	var stderr strings.Builder
+	session.Stderr = &stderr
+	out, err := session.Output(cmd)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// resolveRemote makes p absolute against the remote working directory,
+// expanding ~ to the remote home.
+func (s *Shell) resolveRemote(p string) string {
+	switch {
+	case p == "~":
+		return s.homeRemote
+	case strings.HasPrefix(p, "~/"):
+		return path.Join(s.homeRemote, p[2:])
+	case path.IsAbs(p):
+		return path.Clean(p)
+	}
+	return path.Join(s.remoteCWD, p)
+}
+
+// resolveLocal makes p absolute against the local working directory,
+// expanding ~ to the local home.
+func (s *Shell) resolveLocal(p string) string {
+	if strings.HasPrefix(p, "~") {
+		if expanded, err := homedir.Expand(p); err == nil {
+			return expanded
+		}
+	}
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(s.localCWD, p)
+}
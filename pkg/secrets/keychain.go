@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeychainPrefix references a secret in the OS keychain by name instead
+// of storing it in the config, e.g. "keychain:prod-web1".
+const KeychainPrefix = "keychain:"
+
+// keychainService is the service (or target prefix on Windows) sshm's
+// secrets are filed under.
+const keychainService = "sshm"
+
+// IsKeychainRef reports whether value names a keychain secret.
+func IsKeychainRef(value string) bool {
+	return strings.HasPrefix(value, KeychainPrefix)
+}
+
+// Lookup reads the named secret from the OS keychain: the macOS login
+// keychain, Windows Credential Manager, or the Secret Service (libsecret)
+// elsewhere.
+func Lookup(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty keychain name")
+	}
+	secret, err := keychainGet(name)
+	if err != nil {
+		return "", fmt.Errorf("keychain %q: %w", name, err)
+	}
+	return secret, nil
+}
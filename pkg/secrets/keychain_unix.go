@@ -0,0 +1,32 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// keychainGet reads a Secret Service item stored with
+//
+//	secret-tool store --label=<label> service sshm account <name>
+func keychainGet(name string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", errors.New("secret-tool not found (install libsecret-tools)")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", keychainService, "account", name)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", errors.New("not found")
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,240 @@
+// Package secrets resolves the passwords and passphrases in the config:
+// values encrypted with a master passphrase, and references to the OS
+// keychain. An encrypted value reads "enc:v1:<salt>:<sealed>", both
+// base64: the key is derived from the passphrase with scrypt and the
+// password sealed with AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Prefix marks an encrypted config value.
+const Prefix = "enc:v1:"
+
+// PassphraseEnv supplies the master passphrase without a prompt, e.g. to
+// the tunnel daemon.
+const PassphraseEnv = "SSHM_PASSPHRASE"
+
+// unlockTries is how many times a wrong passphrase may be re-entered.
+const unlockTries = 3
+
+// scrypt parameters; a key takes roughly 100ms to derive.
+const (
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	keyLen    = 32
+	saltLen   = 16
+	nonceSize = 12
+)
+
+// ErrWrongPassphrase means a value could not be decrypted with the given
+// passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// unlocked caches the passphrase that last decrypted a value and the keys
+// derived from it, so a process asks at most once.
+var unlocked struct {
+	sync.Mutex
+	passphrase string
+	keys       map[string]cipher.AEAD // by passphrase and salt
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Key seals values with one passphrase and salt.
+type Key struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// NewKey derives a key from passphrase with a fresh salt.
+func NewKey(passphrase string) (*Key, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{salt: salt, aead: aead}, nil
+}
+
+// KeyFor returns the key value was sealed with, so new values can share
+// its salt and be unlocked together. It fails with ErrWrongPassphrase if
+// passphrase does not open value.
+func KeyFor(value, passphrase string) (*Key, error) {
+	salt, _, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Decrypt(value, passphrase); err != nil {
+		return nil, err
+	}
+	aead, err := cachedKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{salt: salt, aead: aead}, nil
+}
+
+// Encrypt seals plain.
+func (k *Key) Encrypt(plain string) (string, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return Prefix + base64.RawStdEncoding.EncodeToString(k.salt) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt.
+func Decrypt(value, passphrase string) (string, error) {
+	salt, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cachedKey(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < nonceSize {
+		return "", errors.New("encrypted value is truncated")
+	}
+	plain, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
+
+// Reveal returns the secret a config value stands for: the keychain item
+// it references, the value decrypted, or the value itself when it is plain.
+// The passphrase comes from $SSHM_PASSPHRASE, from an earlier successful
+// Reveal in this process, or from ask, which is retried when wrong. With a
+// nil ask and no other source, Reveal fails.
+func Reveal(value string, ask func() (string, error)) (string, error) {
+	if name, ok := strings.CutPrefix(value, KeychainPrefix); ok {
+		return Lookup(name)
+	}
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	unlocked.Lock()
+	known := unlocked.passphrase
+	unlocked.Unlock()
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		known = env
+	}
+	if known != "" {
+		plain, err := Decrypt(value, known)
+		if err == nil || ask == nil {
+			return plain, err
+		}
+	}
+	if ask == nil {
+		return "", fmt.Errorf("value is encrypted; set %s or run interactively", PassphraseEnv)
+	}
+
+	for i := 0; i < unlockTries; i++ {
+		passphrase, err := ask()
+		if err != nil {
+			return "", err
+		}
+		plain, err := Decrypt(value, passphrase)
+		if errors.Is(err, ErrWrongPassphrase) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		Remember(passphrase)
+		return plain, nil
+	}
+	return "", ErrWrongPassphrase
+}
+
+// Remember makes passphrase the one Reveal tries first.
+func Remember(passphrase string) {
+	unlocked.Lock()
+	unlocked.passphrase = passphrase
+	unlocked.Unlock()
+}
+
+// Unlocked returns the passphrase known to this process, if any.
+func Unlocked() string {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return env
+	}
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	return unlocked.passphrase
+}
+
+// parse splits an encrypted value into its salt and sealed box.
+func parse(value string) (salt, sealed []byte, err error) {
+	rest, ok := strings.CutPrefix(value, Prefix)
+	if !ok {
+		return nil, nil, errors.New("value is not encrypted")
+	}
+	saltText, sealedText, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, nil, errors.New("malformed encrypted value")
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(saltText); err != nil {
+		return nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if sealed, err = base64.RawStdEncoding.DecodeString(sealedText); err != nil {
+		return nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return salt, sealed, nil
+}
+
+// cachedKey derives the key for passphrase and salt once per process.
+func cachedKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+
+	id := passphrase + "\x00" + string(salt)
+	if aead, ok := unlocked.keys[id]; ok {
+		return aead, nil
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if unlocked.keys == nil {
+		unlocked.keys = make(map[string]cipher.AEAD)
+	}
+	unlocked.keys[id] = aead
+	return aead, nil
+}
+
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := NewKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"s3cret", "", "pässwörd with spaces:and:colons"} {
+		value, err := key.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(value) || (plain != "" && strings.Contains(value, plain)) {
+			t.Errorf("Encrypt(%q) = %q, not sealed", plain, value)
+		}
+		got, err := Decrypt(value, "correct horse")
+		if err != nil || got != plain {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plain, got, err)
+		}
+	}
+
+	// The same password encrypts differently each time
+	a, _ := key.Encrypt("s3cret")
+	b, _ := key.Encrypt("s3cret")
+	if a == b {
+		t.Error("two encryptions of one value are identical")
+	}
+
+	// A key for an existing value shares its salt
+	shared, err := KeyFor(a, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := shared.Encrypt("other")
+	if saltOf(t, c) != saltOf(t, a) {
+		t.Error("KeyFor did not reuse the value's salt")
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	key, err := NewKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := key.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := Decrypt(value, "battery staple"); !errors.Is(err, ErrWrongPassphrase) || got != "" {
+		t.Errorf("Decrypt with a wrong passphrase = %q, %v; want ErrWrongPassphrase", got, err)
+	}
+	if _, err := KeyFor(value, "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("KeyFor with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+
+	// A tampered value fails the same way rather than decrypting to junk
+	tampered := value[:len(value)-2] + "AA"
+	if tampered == value {
+		tampered = value[:len(value)-2] + "BB"
+	}
+	if _, err := Decrypt(tampered, "correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Decrypt of a tampered value = %v, want ErrWrongPassphrase", err)
+	}
+	for _, bad := range []string{"s3cret", Prefix + "nosep", Prefix + "!!:AAAA", Prefix + "AAAA:"} {
+		if _, err := Decrypt(bad, "correct horse"); err == nil || errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("Decrypt(%q) = %v, want a malformed value error", bad, err)
+		}
+	}
+}
+
+func TestReveal(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	key, err := NewKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := key.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := Reveal("plain", nil); err != nil || got != "plain" {
+		t.Errorf("Reveal(plain) = %q, %v", got, err)
+	}
+
+	// A wrong passphrase is asked again, up to unlockTries times
+	asked := 0
+	wrong := func() (string, error) { asked++; return "battery staple", nil }
+	if _, err := Reveal(value, wrong); !errors.Is(err, ErrWrongPassphrase) || asked != unlockTries {
+		t.Errorf("Reveal with wrong answers = %v after %d asks, want ErrWrongPassphrase after %d", err, asked, unlockTries)
+	}
+
+	asked = 0
+	answers := []string{"battery staple", "correct horse"}
+	ask := func() (string, error) { asked++; return answers[asked-1], nil }
+	if got, err := Reveal(value, ask); err != nil || got != "s3cret" || asked != 2 {
+		t.Errorf("Reveal = %q, %v after %d asks, want s3cret after 2", got, err, asked)
+	}
+
+	// The right passphrase is remembered
+	if got, err := Reveal(value, nil); err != nil || got != "s3cret" {
+		t.Errorf("Reveal after unlocking = %q, %v", got, err)
+	}
+	Remember("")
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	if got, err := Reveal(value, nil); err != nil || got != "s3cret" {
+		t.Errorf("Reveal with %s = %q, %v", PassphraseEnv, got, err)
+	}
+}
+
+// saltOf returns the salt part of an encrypted value.
+func saltOf(t *testing.T, value string) string {
+	t.Helper()
+	salt, _, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok {
+		t.Fatalf("malformed value %q", value)
+	}
+	return salt
+}
@@ -0,0 +1,93 @@
+package sftp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// expandAlias replaces the command word of input with the command it is
+// an alias for. Only the first word is expanded, once, so an alias may
+// reuse its own name (ls: "ls -l").
+func (s *Shell) expandAlias(input string) string {
+	word, rest, _ := strings.Cut(strings.TrimSpace(input), " ")
+	command, ok := s.aliases[word]
+	if !ok {
+		return input
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		return command + " " + rest
+	}
+	return command
+}
+
+// aliasedCommand returns the command name word stands for, following an
+// alias if it is one.
+func (s *Shell) aliasedCommand(word string) string {
+	if command, ok := s.aliases[word]; ok {
+		if fields := strings.Fields(command); len(fields) > 0 {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return strings.ToLower(word)
+}
+
+// cmdAlias lists the aliases, shows one, or defines one for the rest of
+// the session:
+//
+//	alias
+//	alias ll
+//	alias ll="ls -l"
+func (s *Shell) cmdAlias(args []string) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(s.aliases))
+		for name := range s.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(s.stdout, "alias %s=%q\n", name, s.aliases[name])
+		}
+		return nil
+	}
+
+	name, command, define := strings.Cut(strings.Join(args, " "), "=")
+	if !define {
+		if len(args) > 1 {
+			return fmt.Errorf("usage: alias [name[=command]]")
+		}
+		command, ok := s.aliases[name]
+		if !ok {
+			return fmt.Errorf("alias %s not found", name)
+		}
+		fmt.Fprintf(s.stdout, "alias %s=%q\n", name, command)
+		return nil
+	}
+
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	command = strings.TrimSpace(command)
+	if len(command) >= 2 && (command[0] == '"' || command[0] == '\'') && command[len(command)-1] == command[0] {
+		command = command[1 : len(command)-1]
+	}
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("alias %s: empty command", name)
+	}
+	s.aliases[name] = command
+	return nil
+}
+
+// cmdUnalias removes aliases for the rest of the session.
+func (s *Shell) cmdUnalias(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unalias name...")
+	}
+	for _, name := range args {
+		if _, ok := s.aliases[name]; !ok {
+			return fmt.Errorf("alias %s not found", name)
+		}
+		delete(s.aliases, name)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package sftp
+
+import "strings"
+
+// cmdArgs holds the flags and positional arguments of a shell command.
+//
+// Supported forms:
+//   - long flags: --name, --name=value, --name value (for value flags)
+//   - short flags: -r, combined short flags: -rf
+//   - "--" ends flag parsing
+type cmdArgs struct {
+	flags map[string]string
+	args  []string
+}
+
+// parseCmdArgs splits args into flags and positional arguments.
+// valueFlags lists the long flag names that take a separate value.
+func parseCmdArgs(args []string, valueFlags ...string) cmdArgs {
+	takesValue := make(map[string]bool, len(valueFlags))
+	for _, f := range valueFlags {
+		takesValue[f] = true
+	}
+
+	parsed := cmdArgs{flags: make(map[string]string)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			parsed.args = append(parsed.args, args[i+1:]...)
+			return parsed
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			if !hasValue && takesValue[name] && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			parsed.flags[name] = value
+
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for _, c := range arg[1:] {
+				parsed.flags[string(c)] = ""
+			}
+
+		default:
+			parsed.args = append(parsed.args, arg)
+		}
+	}
+
+	return parsed
+}
+
+// has reports whether any of the given flag names was set.
+func (a cmdArgs) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := a.flags[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value of the first given flag that was set.
+func (a cmdArgs) value(names ...string) string {
+	for _, name := range names {
+		if v, ok := a.flags[name]; ok {
+			return v
+		}
+	}
+	return ""
+}
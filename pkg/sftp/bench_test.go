@@ -0,0 +1,247 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// Sizes of the transfers benchmarked: one large file, and a directory of
+// many small ones where per-file round trips dominate.
+const (
+	benchFileSize   = 16 << 20
+	benchSmallFiles = 64
+	benchSmallSize  = 4 << 10
+)
+
+// benchLatency is the one-way latency of the loopback link, making a
+// round trip of about a nearby datacenter's.
+const benchLatency = 2 * time.Millisecond
+
+// benchServer starts an in-memory SFTP server and returns a client of it.
+type benchServer func(b *testing.B) *sftp.Client
+
+// benchServers are the links the transfer engine is measured over.
+var benchServers = []struct {
+	name  string
+	start benchServer
+}{
+	{"mem", memServer},
+	{"tcp-latency", latencyServer},
+}
+
+// memServer serves over an in-process pipe, measuring the engine alone.
+func memServer(b *testing.B) *sftp.Client {
+	clientConn, serverConn := net.Pipe()
+	return serveOn(b, clientConn, serverConn)
+}
+
+// latencyServer serves over loopback TCP with benchLatency added in each
+// direction, so round trips cost what they would over a network.
+func latencyServer(b *testing.B) *sftp.Client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	serverConn, ok := <-accepted
+	if !ok {
+		b.Fatal("accept failed")
+	}
+	return serveOn(b, newLatencyConn(clientConn, benchLatency), newLatencyConn(serverConn, benchLatency))
+}
+
+// serveOn runs a request server on a memFS on serverConn and returns a
+// client on clientConn, both closed when the benchmark ends.
+func serveOn(b *testing.B, clientConn, serverConn net.Conn) *sftp.Client {
+	server := sftp.NewRequestServer(serverConn, newMemHandlers())
+	go server.Serve()
+	b.Cleanup(func() { server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { client.Close() })
+	return client
+}
+
+// latencyConn delays everything read from a connection by delay, as a
+// link with that one-way latency would, without limiting its bandwidth.
+type latencyConn struct {
+	net.Conn
+	chunks chan latencyChunk
+	buf    []byte
+	err    error
+}
+
+// latencyChunk is data read from the connection and when it may be
+// delivered.
+type latencyChunk struct {
+	data []byte
+	at   time.Time
+	err  error
+}
+
+func newLatencyConn(conn net.Conn, delay time.Duration) *latencyConn {
+	l := &latencyConn{Conn: conn, chunks: make(chan latencyChunk, 1024)}
+	go func() {
+		for {
+			buf := make([]byte, 32<<10)
+			n, err := conn.Read(buf)
+			l.chunks <- latencyChunk{data: buf[:n], at: time.Now().Add(delay), err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return l
+}
+
+func (l *latencyConn) Read(p []byte) (int, error) {
+	for len(l.buf) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		chunk := <-l.chunks
+		time.Sleep(time.Until(chunk.at))
+		l.buf, l.err = chunk.data, chunk.err
+	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+// benchShell returns a quiet shell on client, working in a temporary
+// local directory.
+func benchShell(b *testing.B, client *sftp.Client) *Shell {
+	local := b.TempDir()
+	paths := &PathState{LocalCWD: local, HomeLocal: local, RemoteCWD: "/", HomeRemote: "/"}
+	return NewShell(client, paths, "bench", "bench", Options{Quiet: true})
+}
+
+// writeRemote creates a remote file of size bytes.
+func writeRemote(b *testing.B, client *sftp.Client, name string, size int) {
+	f, err := client.Create(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		b.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// writeLocal creates a local file of size bytes.
+func writeLocal(b *testing.B, name string, size int) {
+	if err := os.WriteFile(name, make([]byte, size), 0644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchParallel are the worker counts directory transfers are measured at.
+var benchParallel = []int{1, 8}
+
+func BenchmarkDownload(b *testing.B) {
+	ctx := context.Background()
+	for _, srv := range benchServers {
+		b.Run(srv.name+"/single", func(b *testing.B) {
+			client := srv.start(b)
+			s := benchShell(b, client)
+			writeRemote(b, client, "/big", benchFileSize)
+			dst := filepath.Join(s.paths.LocalCWD, "big")
+
+			b.SetBytes(benchFileSize)
+			b.ResetTimer()
+			for range b.N {
+				if err := s.downloadSingleFile(ctx, "/big", dst, transferOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		for _, workers := range benchParallel {
+			b.Run(fmt.Sprintf("%s/small/parallel-%d", srv.name, workers), func(b *testing.B) {
+				client := srv.start(b)
+				s := benchShell(b, client)
+				if err := client.Mkdir("/small"); err != nil {
+					b.Fatal(err)
+				}
+				for i := range benchSmallFiles {
+					writeRemote(b, client, fmt.Sprintf("/small/%03d", i), benchSmallSize)
+				}
+				dst := filepath.Join(s.paths.LocalCWD, "small")
+
+				b.SetBytes(benchSmallFiles * benchSmallSize)
+				b.ResetTimer()
+				for range b.N {
+					if err := s.downloadDirectory(ctx, "/small", dst, transferOptions{parallel: workers}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUpload(b *testing.B) {
+	ctx := context.Background()
+	for _, srv := range benchServers {
+		b.Run(srv.name+"/single", func(b *testing.B) {
+			s := benchShell(b, srv.start(b))
+			src := filepath.Join(s.paths.LocalCWD, "big")
+			writeLocal(b, src, benchFileSize)
+
+			b.SetBytes(benchFileSize)
+			b.ResetTimer()
+			for range b.N {
+				if err := s.uploadSingleFile(ctx, src, "/big", transferOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		for _, workers := range benchParallel {
+			b.Run(fmt.Sprintf("%s/small/parallel-%d", srv.name, workers), func(b *testing.B) {
+				s := benchShell(b, srv.start(b))
+				src := filepath.Join(s.paths.LocalCWD, "small")
+				if err := os.Mkdir(src, 0755); err != nil {
+					b.Fatal(err)
+				}
+				for i := range benchSmallFiles {
+					writeLocal(b, filepath.Join(src, fmt.Sprintf("%03d", i)), benchSmallSize)
+				}
+
+				b.SetBytes(benchSmallFiles * benchSmallSize)
+				b.ResetTimer()
+				for range b.N {
+					if err := s.uploadDirectory(ctx, src, "/small", transferOptions{parallel: workers}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package sftp
+
+import (
+	"fmt"
+
+	"github.com/ai-help-me/sshm/pkg/theme"
+	"github.com/pkg/sftp"
+)
+
+// sftpVersion is the only protocol version pkg/sftp negotiates; servers
+// offering anything else are rejected when the client is created.
+const sftpVersion = 3
+
+// knownExtensions are the OpenSSH extensions reported by `capabilities`.
+var knownExtensions = []struct {
+	name string
+	desc string
+}{
+	{"posix-rename@openssh.com", "atomic rename over existing files"},
+	{"statvfs@openssh.com", "filesystem free space"},
+	{"fstatvfs@openssh.com", "filesystem free space by handle"},
+	{"hardlink@openssh.com", "hard links (ln)"},
+	{"fsync@openssh.com", "flush files to disk (put --fsync)"},
+	{"lsetstat@openssh.com", "set attributes without following symlinks"},
+	{"limits@openssh.com", "server packet and handle limits"},
+	{"expand-path@openssh.com", "server-side ~ expansion"},
+	{"copy-data", "server-side copy"},
+}
+
+// serverCaps records which optional extensions the transfer engine may use.
+// Detected once per shell so features degrade gracefully instead of failing
+// halfway through a transfer.
+type serverCaps struct {
+	statvfs  bool
+	hardlink bool
+	fsync    bool
+}
+
+// detectCaps queries the extensions advertised during the SFTP handshake.
+func detectCaps(client *sftp.Client) serverCaps {
+	has := func(name string) bool {
+		_, ok := client.HasExtension(name)
+		return ok
+	}
+	return serverCaps{
+		statvfs:  has("statvfs@openssh.com"),
+		hardlink: has("hardlink@openssh.com"),
+		fsync:    has("fsync@openssh.com"),
+	}
+}
+
+// cmdCapabilities lists the protocol version and supported extensions.
+func (s *Shell) cmdCapabilities(args []string) error {
+	fmt.Fprintf(s.stdout, "SFTP protocol version: %d\n", sftpVersion)
+	fmt.Fprintf(s.stdout, "Extensions:\n")
+	t := theme.Current()
+	for _, ext := range knownExtensions {
+		mark := theme.SGR(t.Heading, false) + "no " + colorReset
+		if data, ok := s.client.HasExtension(ext.name); ok {
+			mark = theme.SGR(t.Prompt, false) + "yes" + colorReset
+			if data != "" && data != "1" {
+				mark += " (v" + data + ")"
+			}
+		}
+		fmt.Fprintf(s.stdout, "  %-28s %s  %s\n", ext.name, mark, ext.desc)
+	}
+	return nil
+}
+
+// checkRemoteSpace fails early when the server reports less free space in
+// dir than needed. Servers without statvfs are not checked.
+func (s *Shell) checkRemoteSpace(dir string, needed int64) error {
+	if !s.caps.statvfs || needed <= 0 {
+		return nil
+	}
+
+	vfs, err := s.client.StatVFS(dir)
+	if err != nil {
+		// Not fatal: the upload itself will report real errors
+		return nil
+	}
+
+	avail := int64(vfs.Frsize * vfs.Bavail)
+	if avail < needed {
+		return fmt.Errorf("not enough space on remote %s: need %s, %s available",
+			dir, formatBytes(needed), formatBytes(avail))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package sftp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+)
+
+// checksumWorkers bounds how many remote files are hashed concurrently.
+const checksumWorkers = 4
+
+// checksumAlgorithms maps command names to hash constructors.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// checksumResult is the outcome of hashing one file.
+type checksumResult struct {
+	sum string
+	err error
+}
+
+// cmdChecksum hashes a remote file, or every file under a remote directory,
+// and prints "<hex>  <path>" lines compatible with `sha256sum -c` /
+// `md5sum -c`. Paths are printed relative to the argument as typed.
+func (s *Shell) cmdChecksum(ctx context.Context, algo string, args []string) error {
+	newHash, ok := checksumAlgorithms[algo]
+	if !ok {
+		return fmt.Errorf("unknown checksum algorithm: %s", algo)
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <path>", algo)
+	}
+
+	remotePath, err := s.paths.ResolveRemote(args[0])
+	if err != nil {
+		return fmt.Errorf("resolve remote: %w", err)
+	}
+
+	fi, err := s.client.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("stat remote: %w", err)
+	}
+
+	// Collect (remote path, display path) pairs
+	var remotes, displays []string
+	if fi.IsDir() {
+		files, _, err := s.getRemoteFileList(remotePath)
+		if err != nil {
+			return fmt.Errorf("scan remote directory: %w", err)
+		}
+		for _, f := range files {
+			remotes = append(remotes, joinPath(remotePath, f.RelPath))
+			displays = append(displays, joinPath(args[0], f.RelPath))
+		}
+	} else {
+		remotes = []string{remotePath}
+		displays = []string{args[0]}
+	}
+
+	results := make([]checksumResult, len(remotes))
+	done := make([]chan struct{}, len(remotes))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < checksumWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sum, err := s.hashRemote(ctx, remotes[i], newHash())
+				results[i] = checksumResult{sum: sum, err: err}
+				close(done[i])
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range remotes {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Print in listing order while workers run ahead
+	var failed int
+	for i := range remotes {
+		select {
+		case <-done[i]:
+		case <-ctx.Done():
+			wg.Wait()
+			return context.Canceled
+		}
+
+		if results[i].err != nil {
+			if results[i].err == context.Canceled {
+				wg.Wait()
+				return context.Canceled
+			}
+			fmt.Fprintf(s.stderr, "%s: %s: %v\n", algo, displayName(displays[i]), results[i].err)
+			failed++
+			continue
+		}
+		fmt.Fprintln(s.stdout, checksumLine(results[i].sum, displays[i]))
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be hashed", failed)
+	}
+	return nil
+}
+
+// checksumEscaper escapes the names checksumLine has to escape.
+var checksumEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// checksumLine formats a sum the way sha256sum does. The name is printed
+// as it is, except that a backslash or newline in it is escaped and the
+// line then starts with a backslash, which -c understands.
+func checksumLine(sum, name string) string {
+	if !strings.ContainsAny(name, "\\\n") {
+		return sum + "  " + name
+	}
+	return `\` + sum + "  " + checksumEscaper.Replace(name)
+}
+
+// hashRemote streams a remote file through h and returns the hex digest.
+func (s *Shell) hashRemote(ctx context.Context, remotePath string, h hash.Hash) (string, error) {
+	f, err := s.client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(&ctxWriter{ctx: ctx, w: h}, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ctxWriter aborts a copy once ctx is cancelled.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, context.Canceled
+	}
+	return cw.w.Write(p)
+}
@@ -0,0 +1,24 @@
+package sftp
+
+import "testing"
+
+func TestChecksumLine(t *testing.T) {
+	const sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	tests := []struct {
+		name, want string
+	}{
+		{"a.txt", sum + "  a.txt"},
+		{"dir/with space.txt", sum + "  dir/with space.txt"},
+		{"日本語.txt", sum + "  日本語.txt"},
+		{`"quoted"`, sum + `  "quoted"`},
+		{"tab\there", sum + "  tab\there"},
+		{`back\slash`, `\` + sum + `  back\\slash`},
+		{"new\nline", `\` + sum + `  new\nline`},
+		{"both\\\n", `\` + sum + `  both\\\n`},
+	}
+	for _, tt := range tests {
+		if got := checksumLine(sum, tt.name); got != tt.want {
+			t.Errorf("checksumLine(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package sftp
 
 import (
+	"cmp"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -17,14 +23,127 @@ import (
 // These optimizations can improve transfer speeds from ~9MB/s to 100+MB/s
 // in high-latency networks (100ms+).
 // Reference: https://pkg.go.dev/github.com/pkg/sftp
-func NewClient(sshClient *ssh.Client) (*sftp.Client, error) {
+//
+// serverPath, when set, is an sftp-server binary run with exec instead of
+// requesting the "sftp" subsystem, for appliances that don't configure
+// one. It is passed to the remote shell as is, so it may carry arguments.
+func NewClient(sshClient *ssh.Client, serverPath string) (*sftp.Client, error) {
+	if serverPath != "" {
+		return pipeClient(sshClient, serverPath, func(s *ssh.Session) error {
+			if err := s.Start(serverPath); err != nil {
+				return fmt.Errorf("start %s: %w", serverPath, err)
+			}
+			return nil
+		})
+	}
+	return pipeClient(sshClient, "", func(s *ssh.Session) error {
+		if err := s.RequestSubsystem("sftp"); err != nil {
+			return fmt.Errorf("create sftp client: %w", err)
+		}
+		return nil
+	})
+}
+
+// pipeClient speaks SFTP over a session that start turns into an SFTP
+// server: serverPath run over exec, or the subsystem when it is empty.
+// Closing the client closes the server's stdin, which ends it and the
+// session. The packets that went each way are logged then.
+func pipeClient(sshClient *ssh.Client, serverPath string, start func(*ssh.Session) error) (*sftp.Client, error) {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("create sftp client: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("create sftp client: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("create sftp client: %w", err)
+	}
+	if err := start(session); err != nil {
+		session.Close()
+		return nil, err
+	}
+
 	// Reduce concurrent requests to avoid connection instability
 	// Some SFTP servers may close connections with too many concurrent requests
-	client, err := sftp.NewClient(sshClient,
+	sent, received := &packetCounter{}, &packetCounter{}
+	client, err := sftp.NewClientPipe(countingReader{stdout, received}, countingWriter{stdin, sent},
 		sftp.UseConcurrentWrites(true),
 	)
 	if err != nil {
+		session.Close()
+		if serverPath != "" {
+			return nil, fmt.Errorf("%s: %w", serverPath, err)
+		}
 		return nil, fmt.Errorf("create sftp client: %w", err)
 	}
+	slog.Info("sftp started", "server", cmp.Or(serverPath, "subsystem"))
+
+	began := time.Now()
+	go func() {
+		session.Wait()
+		session.Close()
+		slog.Debug("sftp ended", "elapsed", time.Since(began).Round(time.Millisecond),
+			"sent-packets", sent.packets.Load(), "sent-bytes", sent.bytes.Load(),
+			"received-packets", received.packets.Load(), "received-bytes", received.bytes.Load())
+	}()
 	return client, nil
 }
+
+// packetCounter counts the SFTP packets and bytes going one way through a
+// stream, where each packet is a 4-byte length and that many bytes.
+type packetCounter struct {
+	packets, bytes atomic.Int64
+	header         []byte // length read so far of the next packet
+	remaining      uint32 // bytes left in the current packet
+}
+
+func (c *packetCounter) count(p []byte) {
+	c.bytes.Add(int64(len(p)))
+	for len(p) > 0 {
+		if c.remaining > 0 {
+			n := min(uint32(len(p)), c.remaining)
+			c.remaining -= n
+			p = p[n:]
+			continue
+		}
+		n := min(4-len(c.header), len(p))
+		c.header = append(c.header, p[:n]...)
+		p = p[n:]
+		if len(c.header) == 4 {
+			c.remaining = binary.BigEndian.Uint32(c.header)
+			c.header = c.header[:0]
+			c.packets.Add(1)
+		}
+	}
+}
+
+// countingReader counts what is read from an SFTP stream.
+type countingReader struct {
+	r io.Reader
+	c *packetCounter
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.count(p[:n])
+	return n, err
+}
+
+// countingWriter counts what is written to an SFTP stream.
+type countingWriter struct {
+	w io.WriteCloser
+	c *packetCounter
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.c.count(p[:n])
+	return n, err
+}
+
+func (w countingWriter) Close() error { return w.w.Close() }
@@ -1,27 +1,45 @@
 package sftp
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ai-help-me/sshm/pkg/state"
+	"github.com/ai-help-me/sshm/pkg/supervise"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/ai-help-me/sshm/pkg/theme"
+	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/sftp"
 	"github.com/schollz/progressbar/v3"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 )
 
-// Table column widths
+// historySize is how many command lines the shell remembers.
+const historySize = 1000
+
+// Minimum table column widths for help output
 const (
 	cmdWidth  = 10
 	argsWidth = 20
 	descWidth = 35
 )
 
+// FormatBytes formats a byte count for display, e.g. "1.50 MB".
+func FormatBytes(bytes int64) string {
+	return formatBytes(bytes)
+}
+
 // formatBytes formats byte size to human readable string
 func formatBytes(bytes int64) string {
 	const (
@@ -45,112 +63,243 @@ func formatBytes(bytes int64) string {
 	}
 }
 
+// transferOptions holds the flags of a single get/put command.
+type transferOptions struct {
+	mangle   bool // Replace characters local filesystems reject (--mangle-names)
+	preserve bool // Keep times, permissions and mapped ownership (-p)
+	ignore   bool // Honor .gitignore/.sshmignore in directory uploads
+	fsync    bool // Flush uploaded files on the server before closing
+	skip     bool // Skip directory files whose remote copy has the same SHA-256
+	parallel int  // Files of a directory transferred at once (--parallel)
+	times    bool // Keep modification times, which sync compares
+}
+
+// Options holds per-host settings for the SFTP shell.
+type Options struct {
+	DownloadMode os.FileMode // Mode for downloaded files; 0 keeps os.Create defaults
+	UploadMode   os.FileMode // Mode for uploaded files; 0 leaves it to the server umask
+	MapOwner     map[int]int // uid mapping applied with -p
+	MapGroup     map[int]int // gid mapping applied with -p
+	HonorIgnore  bool        // Apply .gitignore/.sshmignore to directory uploads by default
+	SSHClient    *ssh.Client // Connection for exec-based fast paths; may be nil
+	Quiet        bool        // Suppress banners, summaries and progress bars
+
+	// Terminal reads command lines; nil uses a manager of its own.
+	Terminal *terminal.Manager
+
+	// HistoryFile keeps command lines across sessions; empty keeps them
+	// for this session only.
+	HistoryFile string
+
+	// ServerPath is the sftp-server run with exec instead of the "sftp"
+	// subsystem, as given to NewClient; used when reconnecting.
+	ServerPath string
+
+	// Timeout bounds metadata requests (stat, ls, mkdir...); 0 means
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// Reconnect dials the host again when the server stops responding; nil
+	// leaves the shell on the broken connection.
+	Reconnect func() (*ssh.Client, error)
+
+	// Aliases map command names to the command lines they stand for; the
+	// alias command adds more for the session.
+	Aliases map[string]string
+
+	// Init are command lines run when the shell starts, before the first
+	// prompt. The first that fails skips the rest.
+	Init []string
+
+	// Parallel is the --parallel value directory transfers use when not
+	// given one: a worker count or "auto". Empty means 1.
+	Parallel string
+
+	// Busy, when set, is called with true as each command starts and
+	// false as it ends, telling time spent working from time at the
+	// prompt.
+	Busy func(bool)
+}
+
+// DefaultHistoryFile returns the file the shell keeps command history in:
+// ~/.sshm_sftp_history where one was kept before, otherwise sftp_history
+// in the state directory.
+func DefaultHistoryFile() (string, error) {
+	if home, err := homedir.Dir(); err == nil {
+		legacy := filepath.Join(home, ".sshm_sftp_history")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return state.Path("sftp_history")
+}
+
 // Shell implements interactive SFTP shell.
 type Shell struct {
 	user   string
 	host   string
-	client *sftp.Client
+	client *remoteClient // Shared with paths
 	paths  *PathState
+	opts   Options
+	caps   serverCaps
 	stdout io.Writer
 	stderr io.Writer
+
+	// info receives informational output (banner, summaries) and progress
+	// receives progress bars; both are discarded in quiet mode.
+	info     io.Writer
+	progress io.Writer
+	plain    bool // progress is not a terminal; print lines, not bars
+
+	tempDir string // Downloads opened with view, removed on exit
+
+	aliases map[string]string // Options.Aliases and those defined since
+
+	term *terminal.Manager // Reads command lines and pages long output
 }
 
 // NewShell creates SFTP shell (always in cooked mode).
-func NewShell(client *sftp.Client, paths *PathState, user, host string) *Shell {
-	return &Shell{
-		client: client,
-		paths:  paths,
-		stdout: os.Stdout,
-		user:   user,
-		host:   host,
-		stderr: os.Stderr,
-	}
+func NewShell(client *sftp.Client, paths *PathState, user, host string, opts Options) *Shell {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	remote := &remoteClient{Client: client, timeout: opts.Timeout}
+	paths.client = remote
+	s := &Shell{
+		client:   remote,
+		paths:    paths,
+		opts:     opts,
+		caps:     detectCaps(client),
+		stdout:   os.Stdout,
+		user:     user,
+		host:     host,
+		stderr:   os.Stderr,
+		info:     os.Stdout,
+		progress: os.Stderr,
+		plain:    !term.IsTerminal(int(os.Stderr.Fd())),
+		aliases:  make(map[string]string, len(opts.Aliases)),
+	}
+	for name, command := range opts.Aliases {
+		s.aliases[name] = command
+	}
+	if opts.Quiet {
+		s.info = io.Discard
+		s.progress = io.Discard
+	}
+	return s
 }
 
 // Run starts the interactive shell.
 // Runs in cooked mode - uses terminal Manager for context.
 func (s *Shell) Run() error {
-	fmt.Fprintf(s.stdout, "SFTP shell started. Type 'help' for commands.\n")
-	fmt.Fprintf(s.stdout, "Press Ctrl+C to interrupt file transfers.\n")
+	fmt.Fprintf(s.info, "SFTP shell started. Type 'help' for commands.\n")
+	fmt.Fprintf(s.info, "Press Ctrl+C to interrupt file transfers.\n")
+
+	// Files opened with view live only as long as the shell
+	defer s.cleanupViews()
 
 	// Set up signal handler for SIGINT (Ctrl+C)
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	defer signal.Stop(sigChan)
 
-	// ONE goroutine reads stdin for the entire shell lifetime
-	// Use buffered channel to prevent blocking
-	lineChan := make(chan string, 1)
-	eofChan := make(chan error, 1)
-	go func() {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			line := scanner.Text()
-			lineChan <- line
+	// The terminal is raw only while a line is typed; commands run in
+	// cooked mode, where Ctrl+C raises SIGINT
+	s.term = s.opts.Terminal
+	if s.term == nil {
+		s.term = terminal.New()
+	}
+	editor := s.term.NewLineEditor(s.complete)
+	editor.SetHistory(terminal.LoadHistory(s.opts.HistoryFile, historySize))
+
+	for _, line := range s.opts.Init {
+		exit, err := s.runBusy(line, sigChan)
+		if exit {
+			return nil
 		}
-		if err := scanner.Err(); err != nil {
-			eofChan <- err
-		} else {
-			eofChan <- io.EOF
+		if errors.Is(err, errNotResponding) {
+			s.offerReconnect(editor)
 		}
-	}()
+		if err != nil {
+			fmt.Fprintf(s.stderr, "sftp-init stopped at '%s'\n", line)
+			break
+		}
+	}
 
-	loopCount := 0
 	for {
-		loopCount++
-		s.showPrompt()
-		select {
-		case line := <-lineChan:
-			input := strings.TrimSpace(line)
-			if input == "" {
-				continue
-			}
+		line, err := editor.ReadLine(s.prompt())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read input: %w", err)
+		}
 
-			// Check if this is a transfer command
-			parts := strings.Fields(input)
-			if len(parts) == 0 {
-				continue
-			}
-			cmd := strings.ToLower(parts[0])
-			isTransfer := cmd == "get" || cmd == "put"
+		exit, err := s.runBusy(line, sigChan)
+		if exit {
+			return nil
+		}
+		if errors.Is(err, errNotResponding) {
+			s.offerReconnect(editor)
+		}
+	}
+}
 
-			if isTransfer {
-				s.runTransfer(input, sigChan)
-			} else {
-				// For non-transfer commands, execute directly
-				if err := s.executeCommand(input); err != nil {
-					// Check if this is an exit command
-					if err.Error() == "exit" {
-						return nil
-					}
-					fmt.Fprintf(s.stderr, "Error: %v\n", err)
-				}
-			}
+// runBusy runs one command line like runLine, telling Options.Busy.
+func (s *Shell) runBusy(line string, sigChan <-chan os.Signal) (exit bool, err error) {
+	if s.opts.Busy != nil {
+		s.opts.Busy(true)
+		defer s.opts.Busy(false)
+	}
+	return s.runLine(line, sigChan)
+}
 
-		case <-sigChan:
-			// Ctrl+C pressed (no active transfer)
-			fmt.Fprintf(s.stdout, "\n")
+// runLine runs one command line, reporting its error, which it returns.
+// exit is true for the commands that leave the shell.
+func (s *Shell) runLine(line string, sigChan <-chan os.Signal) (exit bool, err error) {
+	words, err := splitLine(s.expandAlias(line))
+	if err != nil {
+		fmt.Fprintf(s.stderr, "Error: %v\n", err)
+		return false, err
+	}
+	if len(words) == 0 {
+		return false, nil
+	}
 
-		case err := <-eofChan:
-			if err == io.EOF {
-				return nil
-			}
-			return fmt.Errorf("read input: %w", err)
+	// Check if this is a transfer command
+	cmd := strings.ToLower(words[0])
+
+	// A Ctrl+C from before the prompt must not cancel the next transfer
+	select {
+	case <-sigChan:
+	default:
+	}
+
+	if transferCommands[cmd] {
+		return false, s.runTransfer(words, sigChan)
+	}
+	// For non-transfer commands, execute directly
+	if err = s.executeCommand(words); err != nil {
+		// Check if this is an exit command
+		if err.Error() == "exit" {
+			return true, nil
 		}
+		fmt.Fprintf(s.stderr, "Error: %v\n", err)
 	}
+	return false, err
 }
 
 // runTransfer executes a transfer command (get/put) with signal handling.
 // The sigChan acts as a baton: ownership passes to this method during transfer.
-func (s *Shell) runTransfer(input string, sigChan <-chan os.Signal) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// It returns the command's error, which it has already reported.
+func (s *Shell) runTransfer(words []string, sigChan <-chan os.Signal) error {
+	tasks := supervise.New(context.Background())
+	defer tasks.Stop()
 
 	done := make(chan error, 1)
-	go func() {
-		err := s.executeTransferCommand(ctx, input)
-		done <- err
-	}()
+	tasks.Go(func(ctx context.Context) {
+		done <- s.executeTransferCommand(ctx, words)
+	})
 
 	select {
 	case err := <-done:
@@ -161,57 +310,67 @@ func (s *Shell) runTransfer(input string, sigChan <-chan os.Signal) {
 				fmt.Fprintf(s.stderr, "Error: %v\n", err)
 			}
 		}
+		return err
 	case <-sigChan:
 		fmt.Fprintf(s.stdout, "\n^C\nTransfer cancelled.\n")
-		cancel()
-		<-done // wait for cleanup
+		tasks.Stop() // cancel and wait for cleanup
+		return context.Canceled
 	}
 }
 
+// transferCommands are long-running commands executed with Ctrl+C support.
+var transferCommands = map[string]bool{
+	"get":    true,
+	"put":    true,
+	"view":   true,
+	"sha256": true,
+	"md5":    true,
+	"rm":     true,
+	"sync":   true,
+}
+
 // executeTransferCommand executes a transfer command (get/put) with context.
-func (s *Shell) executeTransferCommand(ctx context.Context, input string) error {
-	parts := strings.Fields(strings.TrimSpace(input))
-	if len(parts) == 0 {
+// words is the command line split by splitLine.
+func (s *Shell) executeTransferCommand(ctx context.Context, words []string) error {
+	if len(words) == 0 {
 		return fmt.Errorf("empty command")
 	}
 
-	cmd := strings.ToLower(parts[0])
-	args := parts[1:]
+	cmd := strings.ToLower(words[0])
+	args := words[1:]
 
 	switch cmd {
 	case "get":
 		return s.cmdGetWithContext(ctx, args)
 	case "put":
 		return s.cmdPutWithContext(ctx, args)
+	case "view":
+		return s.cmdView(ctx, args)
+	case "sha256", "md5":
+		return s.cmdChecksum(ctx, cmd, args)
+	case "rm":
+		return s.cmdRm(ctx, args)
+	case "sync":
+		return s.cmdSync(ctx, args)
 	default:
 		return fmt.Errorf("not a transfer command: %s", cmd)
 	}
 }
 
-// showPrompt displays sftp> prompt.
-func (s *Shell) showPrompt() {
-	fmt.Fprintf(s.stdout, "\033[1;32msftp %s@%s:%s>\033[0m ", s.user, s.host, s.paths.RemoteCWD)
-	// Force flush stdout to ensure prompt is visible immediately
-	// Use both Sync() and explicit flush for terminal output
-	if f, ok := s.stdout.(*os.File); ok {
-		f.Sync()
-	} else {
-		// If not a file, try to flush if it's a Writer with Flush method
-		if flusher, ok := s.stdout.(interface{ Flush() }); ok {
-			flusher.Flush()
-		}
-	}
+// prompt returns the sftp> prompt.
+func (s *Shell) prompt() string {
+	return fmt.Sprintf("%ssftp %s@%s:%s>%s ", theme.SGR(theme.Current().Prompt, true), s.user, s.host, s.paths.RemoteCWD, colorReset)
 }
 
-// executeCommand parses and runs a single SFTP command (non-transfer).
-func (s *Shell) executeCommand(input string) error {
-	parts := strings.Fields(strings.TrimSpace(input))
-	if len(parts) == 0 {
+// executeCommand runs a single SFTP command (non-transfer), split into
+// words by splitLine.
+func (s *Shell) executeCommand(words []string) error {
+	if len(words) == 0 {
 		return nil
 	}
 
-	cmd := strings.ToLower(parts[0])
-	args := parts[1:]
+	cmd := strings.ToLower(words[0])
+	args := words[1:]
 
 	switch cmd {
 	case "cd":
@@ -223,9 +382,9 @@ func (s *Shell) executeCommand(input string) error {
 	case "lpwd":
 		return s.cmdLPWD(args)
 	case "ls":
-		return s.cmdLS(args)
+		return s.paged(func() error { return s.cmdLS(args) })
 	case "lls":
-		return s.cmdLLS(args)
+		return s.paged(func() error { return s.cmdLLS(args) })
 	case "mkdir":
 		return s.cmdMkdir(args)
 	case "lmkdir":
@@ -233,13 +392,42 @@ func (s *Shell) executeCommand(input string) error {
 	case "exit", "quit", "bye":
 		// Return a special error to signal exit
 		return fmt.Errorf("exit")
+	case "ln":
+		return s.cmdLn(args)
+	case "fsync":
+		return s.cmdFsync(args)
+	case "capabilities":
+		return s.cmdCapabilities(args)
+	case "alias":
+		return s.cmdAlias(args)
+	case "unalias":
+		return s.cmdUnalias(args)
 	case "help", "?":
-		return s.cmdHelp()
+		return s.paged(s.cmdHelp)
 	default:
 		return fmt.Errorf("unknown command: %s", cmd)
 	}
 }
 
+// paged runs a command with its output shown through the pager, so a
+// long listing doesn't scroll off screen.
+func (s *Shell) paged(cmd func() error) error {
+	out := s.stdout
+	var buf bytes.Buffer
+	s.stdout = &buf
+	err := cmd()
+	s.stdout = out
+
+	if s.term == nil || out != os.Stdout {
+		out.Write(buf.Bytes())
+		return err
+	}
+	if perr := s.term.Page(buf.String()); perr != nil && err == nil {
+		err = fmt.Errorf("pager: %w", perr)
+	}
+	return err
+}
+
 // cmdCD changes the remote directory.
 func (s *Shell) cmdCD(args []string) error {
 	path := "~"
@@ -301,29 +489,40 @@ func (s *Shell) cmdLPWD(args []string) error {
 	return nil
 }
 
-// cmdLS lists remote files.
-func (s *Shell) cmdLS(args []string) error {
-	path := "."
-	if len(args) > 0 {
-		path = args[0]
-	}
-
-	resolved, err := s.paths.ResolveRemote(path)
+// cmdLS lists remote files, or those matching a wildcard.
+func (s *Shell) cmdLS(rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs, "time-style")
+	style, err := parseTimeStyle(parsed)
 	if err != nil {
-		return fmt.Errorf("resolve path: %w", err)
+		return err
+	}
+	path := "."
+	if len(parsed.args) > 0 {
+		path = parsed.args[0]
 	}
 
-	entries, err := s.client.ReadDir(resolved)
-	if err != nil {
-		return fmt.Errorf("read dir: %w", err)
+	var entries []os.FileInfo
+	if hasGlob(path) {
+		if _, entries, err = s.globRemote(path); err != nil {
+			return err
+		}
+	} else {
+		resolved, err := s.paths.ResolveRemote(path)
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		if entries, err = s.client.ReadDir(resolved); err != nil {
+			return fmt.Errorf("read dir: %w", err)
+		}
 	}
 
+	now := time.Now()
 	for _, entry := range entries {
-		name := entry.Name()
+		name := displayName(entry.Name())
 		if entry.Mode().IsDir() {
 			name += "/"
 		}
-		modTime := entry.ModTime().Format("Jan 02 15:04")
+		modTime := formatModTime(entry.ModTime(), now, style)
 		size := entry.Size()
 
 		mode := entry.Mode().String()
@@ -333,31 +532,47 @@ func (s *Shell) cmdLS(args []string) error {
 	return nil
 }
 
-// cmdLLS lists local files.
-func (s *Shell) cmdLLS(args []string) error {
-	path := "."
-	if len(args) > 0 {
-		path = args[0]
-	}
-
-	resolved, err := s.paths.ResolveLocal(path)
+// cmdLLS lists local files, or those matching a wildcard.
+func (s *Shell) cmdLLS(rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs, "time-style")
+	style, err := parseTimeStyle(parsed)
 	if err != nil {
-		return fmt.Errorf("resolve path: %w", err)
+		return err
+	}
+	path := "."
+	if len(parsed.args) > 0 {
+		path = parsed.args[0]
 	}
 
-	entries, err := os.ReadDir(resolved)
-	if err != nil {
-		return fmt.Errorf("read dir: %w", err)
+	var infos []os.FileInfo
+	if hasGlob(path) {
+		if _, infos, err = s.globLocal(path); err != nil {
+			return err
+		}
+	} else {
+		resolved, err := s.paths.ResolveLocal(path)
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		entries, err := os.ReadDir(resolved)
+		if err != nil {
+			return fmt.Errorf("read dir: %w", err)
+		}
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				infos = append(infos, info)
+			}
+		}
 	}
 
-	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() {
+	now := time.Now()
+	for _, info := range infos {
+		name := displayName(info.Name())
+		if info.IsDir() {
 			name += "/"
 		}
 
-		info, _ := entry.Info()
-		modTime := info.ModTime().Format("Jan 02 15:04")
+		modTime := formatModTime(info.ModTime(), now, style)
 		size := info.Size()
 
 		mode := info.Mode().String()
@@ -395,7 +610,7 @@ func (s *Shell) cmdGet(args []string) error {
 	}
 
 	if remoteInfo.Mode().IsDir() {
-		return s.downloadDirectory(context.Background(), remotePath, localPath)
+		return s.downloadDirectory(context.Background(), remotePath, localPath, transferOptions{})
 	}
 
 	// Check if local path is a directory, if so append the filename
@@ -417,34 +632,25 @@ func (s *Shell) cmdGet(args []string) error {
 	}
 
 	// Create local file
-	dstFile, err := os.Create(localPath)
+	dstFile, err := s.createLocal(localPath, fi.Size())
 	if err != nil {
 		return fmt.Errorf("create local: %w", err)
 	}
 	defer dstFile.Close()
 
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		fi.Size(),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetDescription(fmt.Sprintf("Downloading %s", filepath.Base(remotePath))),
+	bar := s.newBar(fi.Size(), fmt.Sprintf("Downloading %s", filepath.Base(remotePath)),
 		progressbar.OptionShowBytes(true),
 		progressbar.OptionShowCount(),
 		progressbar.OptionSetItsString("bytes"),
 		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
+		barTheme(transferTheme),
 	)
 	defer bar.Close()
 
 	// Wrap local file with progress writer that implements io.ReaderFrom
 	// This enables SFTP's concurrent read optimization
-	progressDst := newProgressWriterFrom(dstFile, bar)
+	progressDst := newProgressWriterFrom(dstFile, trackTransfer(bar, "download", remotePath, fi.Size()))
 
 	// Directly call ReadFrom to enable concurrent reads
 	// The SFTP client will detect the ReaderFrom interface and use concurrent operations
@@ -455,15 +661,43 @@ func (s *Shell) cmdGet(args []string) error {
 		return fmt.Errorf("read from: %w", err)
 	}
 
-	fmt.Fprintln(s.stdout)
-	fmt.Fprintf(s.stdout, "Download complete: %s (%s)\n", remotePath, formatBytes(fi.Size()))
+	fmt.Fprintln(s.info)
+	fmt.Fprintf(s.info, "Download complete: %s (%s)\n", remotePath, formatBytes(fi.Size()))
 	return nil
 }
 
 // cmdGetWithContext downloads a file or directory from remote to local with cancellation support.
-func (s *Shell) cmdGetWithContext(ctx context.Context, args []string) error {
+func (s *Shell) cmdGetWithContext(ctx context.Context, rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs, "parallel")
+	args := parsed.args
 	if len(args) < 1 {
-		return fmt.Errorf("usage: get remote-path [local-path]")
+		return fmt.Errorf("usage: get [-p] [--mangle-names] [--parallel N|auto] [--] remote-path [local-path]")
+	}
+	parallel, err := s.parseParallel(parsed)
+	if err != nil {
+		return err
+	}
+	opts := transferOptions{
+		mangle:   parsed.has("mangle-names"),
+		preserve: parsed.has("p", "preserve"),
+		parallel: parallel,
+	}
+
+	if hasGlob(args[0]) {
+		dir, matches, err := s.globRemote(args[0])
+		if err != nil {
+			return err
+		}
+		if len(matches) > 1 {
+			localDir := s.paths.LocalCWD
+			if len(args) > 1 {
+				if localDir, err = s.paths.ResolveLocal(args[1]); err != nil {
+					return fmt.Errorf("resolve local: %w", err)
+				}
+			}
+			return s.downloadMatches(ctx, args[0], dir, matches, localDir, opts)
+		}
+		args[0] = joinPath(dir, matches[0].Name())
 	}
 
 	remotePath, err := s.paths.ResolveRemote(args[0])
@@ -475,7 +709,7 @@ func (s *Shell) cmdGetWithContext(ctx context.Context, args []string) error {
 	if len(args) > 1 {
 		localPath, err = s.paths.ResolveLocal(args[1])
 	} else {
-		localPath, err = s.paths.ResolveLocal(filepath.Base(args[0]))
+		localPath, err = s.paths.ResolveLocal(opts.localName(path.Base(remotePath)))
 	}
 	if err != nil {
 		return fmt.Errorf("resolve local: %w", err)
@@ -495,18 +729,26 @@ func (s *Shell) cmdGetWithContext(ctx context.Context, args []string) error {
 	}
 
 	if remoteInfo.Mode().IsDir() {
-		return s.downloadDirectory(ctx, remotePath, localPath)
+		return s.downloadDirectory(ctx, remotePath, localPath, opts)
 	}
 
 	// Single file download
-	return s.downloadSingleFile(ctx, remotePath, localPath)
+	return s.downloadSingleFile(ctx, remotePath, localPath, opts)
+}
+
+// localName maps a remote name to the local name used for a download.
+func (o transferOptions) localName(name string) string {
+	if o.mangle {
+		return mangleRelPath(name)
+	}
+	return name
 }
 
 // downloadSingleFile downloads a single file from remote to local.
-func (s *Shell) downloadSingleFile(ctx context.Context, remotePath, localPath string) error {
+func (s *Shell) downloadSingleFile(ctx context.Context, remotePath, localPath string, opts transferOptions) error {
 	// Check if local path is a directory, if so append the filename
 	if stat, err := os.Stat(localPath); err == nil && stat.IsDir() {
-		localPath = filepath.Join(localPath, filepath.Base(remotePath))
+		localPath = filepath.Join(localPath, opts.localName(path.Base(remotePath)))
 	}
 
 	// Check for cancellation before starting
@@ -530,7 +772,7 @@ func (s *Shell) downloadSingleFile(ctx context.Context, remotePath, localPath st
 	}
 
 	// Create local file
-	dstFile, err := os.Create(localPath)
+	dstFile, err := s.createLocal(localPath, fi.Size())
 	if err != nil {
 		return fmt.Errorf("create local: %w", err)
 	}
@@ -543,35 +785,27 @@ func (s *Shell) downloadSingleFile(ctx context.Context, remotePath, localPath st
 	}()
 
 	// Create progress bar with throttle to reduce update overhead
-	bar := progressbar.NewOptions64(
-		fi.Size(),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetDescription(fmt.Sprintf("Downloading %s", filepath.Base(remotePath))),
+	bar := s.newBar(fi.Size(), fmt.Sprintf("Downloading %s", filepath.Base(remotePath)),
 		progressbar.OptionShowBytes(true),
 		progressbar.OptionShowCount(),
 		progressbar.OptionSetItsString("bytes"),
 		progressbar.OptionSetRenderBlankState(true),
 		progressbar.OptionThrottle(100*time.Millisecond), // Throttle updates for better performance
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
+		barTheme(transferTheme),
 	)
 	defer bar.Close()
 
 	// Wrap writer to track progress
 	progressWriter := &progressWriter{
 		writer: dstFile,
-		bar:    bar,
+		bar:    trackTransfer(bar, "download", remotePath, fi.Size()),
 		ctx:    ctx,
 	}
 
 	// Use io.CopyBuffer with large buffer for better performance
 	buf := make([]byte, 1024*1024) // 1MB buffer
 	written, err := io.CopyBuffer(progressWriter, srcFile, buf)
+	progressWriter.Flush()
 	if err != nil {
 		dstFile.Close()
 		os.Remove(localPath)
@@ -598,15 +832,56 @@ func (s *Shell) downloadSingleFile(ctx context.Context, remotePath, localPath st
 		return fmt.Errorf("close file: %w", err)
 	}
 
+	if opts.preserve {
+		if err := s.preserveLocal(localPath, fi); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: preserve %s: %v\n", localPath, err)
+		}
+	}
+
 	// Ensure progress bar finishes rendering
 	bar.Close()
-	fmt.Fprintln(s.stdout)
-	fmt.Fprintf(s.stdout, "Download complete: %s (%s)\n", remotePath, formatBytes(fi.Size()))
+	fmt.Fprintln(s.info)
+	fmt.Fprintf(s.info, "Download complete: %s (%s)\n", remotePath, formatBytes(fi.Size()))
 	return nil
 }
 
+// createLocal creates a download destination, honoring DownloadMode, and
+// reserves disk for the size bytes about to be written to it. It fails
+// without leaving a file when the disk has no room for them.
+func (s *Shell) createLocal(localPath string, size int64) (*os.File, error) {
+	f, err := s.openLocal(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := preallocate(f, size); err != nil {
+		f.Close()
+		os.Remove(localPath)
+		return nil, fmt.Errorf("reserve %s: %w", formatBytes(size), err)
+	}
+	return f, nil
+}
+
+// openLocal creates or truncates localPath, with DownloadMode if set.
+func (s *Shell) openLocal(localPath string) (*os.File, error) {
+	if s.opts.DownloadMode == 0 {
+		return os.Create(localPath)
+	}
+
+	f, err := os.OpenFile(localPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, s.opts.DownloadMode)
+	if err != nil {
+		return nil, err
+	}
+	// OpenFile only applies the mode to new files and is subject to umask,
+	// so set it explicitly before any data is written
+	if err := f.Chmod(s.opts.DownloadMode); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("chmod %04o: %w", s.opts.DownloadMode, err)
+	}
+	return f, nil
+}
+
 // downloadDirectory downloads a remote directory recursively to local.
-func (s *Shell) downloadDirectory(ctx context.Context, remotePath, localPath string) error {
+func (s *Shell) downloadDirectory(ctx context.Context, remotePath, localPath string, opts transferOptions) error {
 	// Get all files in the directory
 	files, totalSize, err := s.getRemoteFileList(remotePath)
 	if err != nil {
@@ -618,46 +893,22 @@ func (s *Shell) downloadDirectory(ctx context.Context, remotePath, localPath str
 		if err := os.MkdirAll(localPath, 0755); err != nil {
 			return fmt.Errorf("create local directory: %w", err)
 		}
-		fmt.Fprintf(s.stdout, "Downloaded empty directory: %s\n", remotePath)
+		fmt.Fprintf(s.info, "Downloaded empty directory: %s\n", remotePath)
 		return nil
 	}
 
-	fmt.Fprintf(s.stdout, "\nDownloading %s (%d files, %s total)\n", remotePath, len(files), formatBytes(totalSize))
-
-	var downloadedSize int64
-	var downloadedCount int
-	var failedFiles []string
-
-	for i, file := range files {
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			return context.Canceled
-		default:
-		}
-
-		// Calculate progress prefix
-		progressPrefix := fmt.Sprintf("[%d/%d]", i+1, len(files))
-
-		// Download the file
-		fileLocalPath := filepath.Join(localPath, file.RelPath)
-		fileRemotePath := joinPath(remotePath, file.RelPath)
+	return s.downloadFiles(ctx, remotePath, remotePath, localPath, files, totalSize, opts)
+}
 
-		// Create parent directories
-		if err := os.MkdirAll(filepath.Dir(fileLocalPath), 0755); err != nil {
-			fmt.Fprintf(s.stdout, "Warning: failed to create directory for %s: %v\n", file.RelPath, err)
-			failedFiles = append(failedFiles, file.RelPath)
-			continue
-		}
+// downloadFiles downloads files, relative to remotePath, to the same
+// relative paths under localPath, reporting progress as one transfer
+// described by label.
+func (s *Shell) downloadFiles(ctx context.Context, label, remotePath, localPath string, files []remoteFileInfo, totalSize int64, opts transferOptions) error {
+	fmt.Fprintf(s.info, "\nDownloading %s (%d files, %s total)\n", label, len(files), formatBytes(totalSize))
 
-		if err := s.downloadSingleFileWithPrefix(ctx, fileRemotePath, fileLocalPath, progressPrefix); err != nil {
-			fmt.Fprintf(s.stdout, "Warning: failed to download %s: %v\n", file.RelPath, err)
-			failedFiles = append(failedFiles, file.RelPath)
-			continue
-		}
-
-		downloadedSize += file.Size
-		downloadedCount++
+	downloadedCount, downloadedSize, failedFiles, err := s.downloadAll(ctx, remotePath, localPath, files, opts)
+	if err != nil {
+		return err
 	}
 
 	// Report results
@@ -667,7 +918,7 @@ func (s *Shell) downloadDirectory(ctx context.Context, remotePath, localPath str
 			fmt.Fprintf(s.stdout, "  - %s\n", f)
 		}
 	}
-	fmt.Fprintf(s.stdout, "Download complete: %d/%d files, %s/%s downloaded\n",
+	fmt.Fprintf(s.info, "Download complete: %d/%d files, %s/%s downloaded\n",
 		downloadedCount, len(files), formatBytes(downloadedSize), formatBytes(totalSize))
 
 	if len(failedFiles) > 0 {
@@ -680,6 +931,7 @@ func (s *Shell) downloadDirectory(ctx context.Context, remotePath, localPath str
 type remoteFileInfo struct {
 	RelPath string
 	Size    int64
+	ModTime time.Time
 }
 
 // getRemoteFileList recursively lists all files in a remote directory.
@@ -708,6 +960,12 @@ func (s *Shell) walkRemoteDir(basePath, relPath string, files *[]remoteFileInfo,
 	}
 
 	for _, entry := range entries {
+		// Names come from the server and must not escape the destination
+		if !validRemoteName(entry.Name()) {
+			fmt.Fprintf(s.stderr, "Warning: skipping unsafe remote name %q in %s\n", entry.Name(), currentPath)
+			continue
+		}
+
 		entryRelPath := entry.Name()
 		if relPath != "" {
 			entryRelPath = joinPath(relPath, entry.Name())
@@ -730,6 +988,7 @@ func (s *Shell) walkRemoteDir(basePath, relPath string, files *[]remoteFileInfo,
 			*files = append(*files, remoteFileInfo{
 				RelPath: entryRelPath,
 				Size:    entry.Size(),
+				ModTime: entry.ModTime(),
 			})
 			*totalSize += entry.Size()
 		}
@@ -738,8 +997,9 @@ func (s *Shell) walkRemoteDir(basePath, relPath string, files *[]remoteFileInfo,
 	return nil
 }
 
-// downloadSingleFileWithPrefix downloads a single file with a progress prefix.
-func (s *Shell) downloadSingleFileWithPrefix(ctx context.Context, remotePath, localPath, prefix string) error {
+// downloadFile downloads remotePath to localPath, reporting progress to
+// the adder track returns for the file's size.
+func (s *Shell) downloadFile(ctx context.Context, remotePath, localPath string, opts transferOptions, track func(size int64) progressAdder) error {
 	// Check for cancellation before starting
 	select {
 	case <-ctx.Done():
@@ -761,7 +1021,7 @@ func (s *Shell) downloadSingleFileWithPrefix(ctx context.Context, remotePath, lo
 	}
 
 	// Create local file
-	dstFile, err := os.Create(localPath)
+	dstFile, err := s.createLocal(localPath, fi.Size())
 	if err != nil {
 		return fmt.Errorf("create local: %w", err)
 	}
@@ -773,36 +1033,17 @@ func (s *Shell) downloadSingleFileWithPrefix(ctx context.Context, remotePath, lo
 		}
 	}()
 
-	// Create progress bar with prefix
-	bar := progressbar.NewOptions64(
-		fi.Size(),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetDescription(fmt.Sprintf("%s %s", prefix, filepath.Base(remotePath))),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetItsString("bytes"),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionThrottle(100*time.Millisecond),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
-	defer bar.Close()
-
 	// Wrap writer to track progress
 	progressWriter := &progressWriter{
 		writer: dstFile,
-		bar:    bar,
+		bar:    trackTransfer(track(fi.Size()), "download", remotePath, fi.Size()),
 		ctx:    ctx,
 	}
 
 	// Use io.CopyBuffer with large buffer for better performance
 	buf := make([]byte, 1024*1024) // 1MB buffer
 	written, err := io.CopyBuffer(progressWriter, srcFile, buf)
+	progressWriter.Flush()
 	if err != nil {
 		dstFile.Close()
 		os.Remove(localPath)
@@ -829,15 +1070,56 @@ func (s *Shell) downloadSingleFileWithPrefix(ctx context.Context, remotePath, lo
 		return fmt.Errorf("close file: %w", err)
 	}
 
-	bar.Close()
-	fmt.Fprintln(s.stdout)
+	if opts.preserve {
+		if err := s.preserveLocal(localPath, fi); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: preserve %s: %v\n", localPath, err)
+		}
+	} else if opts.times {
+		if err := os.Chtimes(localPath, fi.ModTime(), fi.ModTime()); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: set times %s: %v\n", localPath, err)
+		}
+	}
 	return nil
 }
 
 // cmdPutWithContext uploads a file or directory from local to remote with cancellation support.
-func (s *Shell) cmdPutWithContext(ctx context.Context, args []string) error {
+func (s *Shell) cmdPutWithContext(ctx context.Context, rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs, "parallel")
+	args := parsed.args
 	if len(args) < 1 {
-		return fmt.Errorf("usage: put local-path [remote-path]")
+		return fmt.Errorf("usage: put [-p] [--ignore|--no-ignore] [--fsync] [--skip-unchanged] [--parallel N|auto] [--] local-path [remote-path]")
+	}
+	parallel, err := s.parseParallel(parsed)
+	if err != nil {
+		return err
+	}
+	opts := transferOptions{
+		preserve: parsed.has("p", "preserve"),
+		ignore:   (s.opts.HonorIgnore || parsed.has("ignore")) && !parsed.has("no-ignore"),
+		fsync:    parsed.has("fsync"),
+		skip:     parsed.has("skip-unchanged"),
+		parallel: parallel,
+	}
+	if opts.fsync && !s.caps.fsync {
+		fmt.Fprintf(s.stderr, "Warning: server does not support fsync, uploads will not be flushed\n")
+		opts.fsync = false
+	}
+
+	if hasGlob(args[0]) {
+		dir, matches, err := s.globLocal(args[0])
+		if err != nil {
+			return err
+		}
+		if len(matches) > 1 {
+			remoteDir := s.paths.RemoteCWD
+			if len(args) > 1 {
+				if remoteDir, err = s.paths.ResolveRemote(args[1]); err != nil {
+					return fmt.Errorf("resolve remote: %w", err)
+				}
+			}
+			return s.uploadMatches(ctx, args[0], dir, matches, remoteDir, opts)
+		}
+		args[0] = filepath.Join(dir, matches[0].Name())
 	}
 
 	localPath, err := s.paths.ResolveLocal(args[0])
@@ -869,15 +1151,15 @@ func (s *Shell) cmdPutWithContext(ctx context.Context, args []string) error {
 	}
 
 	if localInfo.IsDir() {
-		return s.uploadDirectory(ctx, localPath, remotePath)
+		return s.uploadDirectory(ctx, localPath, remotePath, opts)
 	}
 
 	// Single file upload
-	return s.uploadSingleFile(ctx, localPath, remotePath)
+	return s.uploadSingleFile(ctx, localPath, remotePath, opts)
 }
 
 // uploadSingleFile uploads a single file from local to remote.
-func (s *Shell) uploadSingleFile(ctx context.Context, localPath, remotePath string) error {
+func (s *Shell) uploadSingleFile(ctx context.Context, localPath, remotePath string, opts transferOptions) error {
 	// Check if remote path is a directory, if so append the filename
 	if stat, err := s.client.Stat(remotePath); err == nil && stat.Mode().IsDir() {
 		remotePath = joinPath(remotePath, filepath.Base(localPath))
@@ -903,8 +1185,18 @@ func (s *Shell) uploadSingleFile(ctx context.Context, localPath, remotePath stri
 		return fmt.Errorf("stat local: %w", err)
 	}
 
+	// Fail before transferring anything if the server is short on space.
+	// An existing file will be replaced, so its size counts as free.
+	needed := fi.Size()
+	if existing, err := s.client.Stat(remotePath); err == nil {
+		needed -= existing.Size()
+	}
+	if err := s.checkRemoteSpace(path.Dir(remotePath), needed); err != nil {
+		return err
+	}
+
 	// Create remote file
-	dstFile, err := s.client.Create(remotePath)
+	dstFile, err := s.createRemote(remotePath)
 	if err != nil {
 		return fmt.Errorf("create remote: %w", err)
 	}
@@ -920,34 +1212,26 @@ func (s *Shell) uploadSingleFile(ctx context.Context, localPath, remotePath stri
 	}()
 
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		fi.Size(),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetDescription(fmt.Sprintf("Uploading %s", filepath.Base(localPath))),
+	bar := s.newBar(fi.Size(), fmt.Sprintf("Uploading %s", filepath.Base(localPath)),
 		progressbar.OptionShowBytes(true),
 		progressbar.OptionShowCount(),
 		progressbar.OptionSetItsString("bytes"),
 		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
+		barTheme(transferTheme),
 	)
 	defer bar.Close()
 
 	// Wrap reader with progress tracking - same pattern as download
 	progressReader := &progressReader{
 		reader: srcFile,
-		bar:    bar,
+		bar:    trackTransfer(bar, "upload", localPath, fi.Size()),
 		size:   fi.Size(),
 	}
 
 	// Use io.CopyBuffer with large buffer - same pattern as download
 	buf := make([]byte, 1024*1024) // 1MB buffer
 	written, err := io.CopyBuffer(dstFile, progressReader, buf)
+	progressReader.Flush()
 	if err != nil {
 		if err == context.Canceled {
 			return context.Canceled
@@ -966,32 +1250,62 @@ func (s *Shell) uploadSingleFile(ctx context.Context, localPath, remotePath stri
 		return fmt.Errorf("incomplete upload: sent %d bytes, expected %d bytes", written, fi.Size())
 	}
 
+	// Flush to stable storage before closing when requested
+	if opts.fsync {
+		if err := dstFile.Sync(); err != nil {
+			return fmt.Errorf("fsync remote file: %w", err)
+		}
+	}
+
 	// Close remote file to finalize
 	if err := dstFile.Close(); err != nil {
 		return fmt.Errorf("close remote file: %w", err)
 	}
 	fileClosed = true
 
+	if opts.preserve {
+		if err := s.preserveRemote(remotePath, fi); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: preserve %s: %v\n", remotePath, err)
+		}
+	}
+
 	bar.Close()
-	fmt.Fprintln(s.stdout)
-	fmt.Fprintf(s.stdout, "Upload complete: %s (%s)\n", remotePath, formatBytes(written))
+	fmt.Fprintln(s.info)
+	fmt.Fprintf(s.info, "Upload complete: %s (%s)\n", remotePath, formatBytes(written))
 	return nil
 }
 
+// createRemote creates an upload destination, honoring UploadMode.
+func (s *Shell) createRemote(remotePath string) (*sftp.File, error) {
+	f, err := s.client.Create(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.UploadMode != 0 {
+		if err := f.Chmod(s.opts.UploadMode); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("chmod %04o: %w", s.opts.UploadMode, err)
+		}
+	}
+	return f, nil
+}
+
 // uploadDirectory uploads a local directory recursively to remote.
-func (s *Shell) uploadDirectory(ctx context.Context, localPath, remotePath string) error {
+func (s *Shell) uploadDirectory(ctx context.Context, localPath, remotePath string, opts transferOptions) error {
 	// Get all files in the directory
-	files, totalSize, err := s.getLocalFileList(localPath)
+	files, totalSize, err := s.getLocalFileList(localPath, opts.ignore)
 	if err != nil {
 		return fmt.Errorf("scan local directory: %w", err)
 	}
 
 	// Check if remote path exists and what type it is
+	existed := false
 	if stat, err := s.client.Stat(remotePath); err == nil {
 		if !stat.Mode().IsDir() {
 			return fmt.Errorf("remote path '%s' already exists and is not a directory (it's a %s)", remotePath, stat.Mode())
 		}
 		// Directory exists, we'll upload into it
+		existed = true
 	} else {
 		// Path doesn't exist, create it
 		if err := s.client.MkdirAll(remotePath); err != nil {
@@ -1000,46 +1314,57 @@ func (s *Shell) uploadDirectory(ctx context.Context, localPath, remotePath strin
 	}
 
 	if len(files) == 0 {
-		fmt.Fprintf(s.stdout, "Uploaded empty directory: %s\n", remotePath)
+		fmt.Fprintf(s.info, "Uploaded empty directory: %s\n", remotePath)
 		return nil
 	}
 
-	fmt.Fprintf(s.stdout, "\nUploading %s (%d files, %s total)\n", localPath, len(files), formatBytes(totalSize))
-
-	var uploadedSize int64
-	var uploadedCount int
-	var failedFiles []string
+	return s.uploadFiles(ctx, localPath, localPath, remotePath, files, totalSize, existed, opts)
+}
 
-	for i, file := range files {
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			return context.Canceled
-		default:
+// uploadFiles uploads files, relative to localPath, to the same relative
+// paths under remotePath, reporting progress as one transfer described by
+// label. existed says whether remotePath was there before, so may hold
+// unchanged copies.
+func (s *Shell) uploadFiles(ctx context.Context, label, localPath, remotePath string, files []localFileInfo, totalSize int64, existed bool, opts transferOptions) error {
+	// A freshly created directory has nothing to compare against
+	if opts.skip && existed {
+		unchanged, err := s.unchangedFiles(ctx, localPath, remotePath, files)
+		if err != nil {
+			return err
 		}
+		if len(unchanged) > 0 {
+			kept := files[:0]
+			for _, file := range files {
+				if unchanged[file.RelPath] {
+					totalSize -= file.Size
+					continue
+				}
+				kept = append(kept, file)
+			}
+			files = kept
+			fmt.Fprintf(s.info, "Skipped %d unchanged files\n", len(unchanged))
+		}
+		if len(files) == 0 {
+			fmt.Fprintf(s.info, "Nothing to upload: %s is up to date\n", remotePath)
+			return nil
+		}
+	}
 
-		// Calculate progress prefix
-		progressPrefix := fmt.Sprintf("[%d/%d]", i+1, len(files))
-
-		// Upload the file
-		fileLocalPath := filepath.Join(localPath, file.RelPath)
-		fileRemotePath := joinPath(remotePath, file.RelPath)
+	if err := s.checkRemoteSpace(remotePath, totalSize); err != nil {
+		return err
+	}
 
-		// Create parent directories
-		if err := s.client.MkdirAll(filepath.Dir(fileRemotePath)); err != nil {
-			fmt.Fprintf(s.stdout, "Warning: failed to create directory for %s: %v\n", file.RelPath, err)
-			failedFiles = append(failedFiles, file.RelPath)
-			continue
-		}
+	fmt.Fprintf(s.info, "\nUploading %s (%d files, %s total)\n", label, len(files), formatBytes(totalSize))
 
-		if err := s.uploadSingleFileWithPrefix(ctx, fileLocalPath, fileRemotePath, progressPrefix); err != nil {
-			fmt.Fprintf(s.stdout, "Warning: failed to upload %s: %v\n", file.RelPath, err)
-			failedFiles = append(failedFiles, file.RelPath)
-			continue
-		}
+	// Create the whole tree up front so the file loop only sends data
+	dirErrs, err := s.createRemoteDirs(ctx, remotePath, files)
+	if err != nil {
+		return err
+	}
 
-		uploadedSize += file.Size
-		uploadedCount++
+	uploadedCount, uploadedSize, failedFiles, err := s.uploadAll(ctx, localPath, remotePath, files, dirErrs, opts)
+	if err != nil {
+		return err
 	}
 
 	// Report results
@@ -1049,7 +1374,7 @@ func (s *Shell) uploadDirectory(ctx context.Context, localPath, remotePath strin
 			fmt.Fprintf(s.stdout, "  - %s\n", f)
 		}
 	}
-	fmt.Fprintf(s.stdout, "Upload complete: %d/%d files, %s/%s uploaded\n",
+	fmt.Fprintf(s.info, "Upload complete: %d/%d files, %s/%s uploaded\n",
 		uploadedCount, len(files), formatBytes(uploadedSize), formatBytes(totalSize))
 
 	if len(failedFiles) > 0 {
@@ -1062,14 +1387,21 @@ func (s *Shell) uploadDirectory(ctx context.Context, localPath, remotePath strin
 type localFileInfo struct {
 	RelPath string
 	Size    int64
+	ModTime time.Time
 }
 
 // getLocalFileList recursively lists all files in a local directory.
-func (s *Shell) getLocalFileList(localPath string) ([]localFileInfo, int64, error) {
+// With honorIgnore, .gitignore/.sshmignore rules are applied and .git is skipped.
+func (s *Shell) getLocalFileList(localPath string, honorIgnore bool) ([]localFileInfo, int64, error) {
 	var files []localFileInfo
 	var totalSize int64
 
-	err := s.walkLocalDir(localPath, "", &files, &totalSize)
+	var ignores ignoreStack
+	if honorIgnore {
+		ignores = ignoreStack{}.loadIgnoreDir(localPath, "")
+	}
+
+	err := s.walkLocalDir(localPath, "", ignores, honorIgnore, &files, &totalSize)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -1078,7 +1410,7 @@ func (s *Shell) getLocalFileList(localPath string) ([]localFileInfo, int64, erro
 }
 
 // walkLocalDir recursively walks a local directory.
-func (s *Shell) walkLocalDir(basePath, relPath string, files *[]localFileInfo, totalSize *int64) error {
+func (s *Shell) walkLocalDir(basePath, relPath string, ignores ignoreStack, honorIgnore bool, files *[]localFileInfo, totalSize *int64) error {
 	currentPath := basePath
 	if relPath != "" {
 		currentPath = filepath.Join(basePath, relPath)
@@ -1095,9 +1427,22 @@ func (s *Shell) walkLocalDir(basePath, relPath string, files *[]localFileInfo, t
 			entryRelPath = filepath.Join(relPath, entry.Name())
 		}
 
+		if honorIgnore {
+			if entry.IsDir() && entry.Name() == ".git" {
+				continue
+			}
+			if ignores.ignored(entryRelPath, entry.IsDir()) {
+				continue
+			}
+		}
+
 		if entry.IsDir() {
 			// Recurse into subdirectory
-			if err := s.walkLocalDir(basePath, entryRelPath, files, totalSize); err != nil {
+			subIgnores := ignores
+			if honorIgnore {
+				subIgnores = ignores.loadIgnoreDir(filepath.Join(basePath, entryRelPath), entryRelPath)
+			}
+			if err := s.walkLocalDir(basePath, entryRelPath, subIgnores, honorIgnore, files, totalSize); err != nil {
 				return err
 			}
 		} else {
@@ -1108,6 +1453,7 @@ func (s *Shell) walkLocalDir(basePath, relPath string, files *[]localFileInfo, t
 			*files = append(*files, localFileInfo{
 				RelPath: entryRelPath,
 				Size:    info.Size(),
+				ModTime: info.ModTime(),
 			})
 			*totalSize += info.Size()
 		}
@@ -1116,8 +1462,9 @@ func (s *Shell) walkLocalDir(basePath, relPath string, files *[]localFileInfo, t
 	return nil
 }
 
-// uploadSingleFileWithPrefix uploads a single file with a progress prefix.
-func (s *Shell) uploadSingleFileWithPrefix(ctx context.Context, localPath, remotePath, prefix string) error {
+// uploadFile uploads localPath to remotePath, reporting progress to the
+// adder track returns for the file's size.
+func (s *Shell) uploadFile(ctx context.Context, localPath, remotePath string, opts transferOptions, track func(size int64) progressAdder) error {
 	// Check if remote path is a directory, if so append the filename
 	if stat, err := s.client.Stat(remotePath); err == nil && stat.Mode().IsDir() {
 		remotePath = joinPath(remotePath, filepath.Base(localPath))
@@ -1144,7 +1491,7 @@ func (s *Shell) uploadSingleFileWithPrefix(ctx context.Context, localPath, remot
 	}
 
 	// Create remote file
-	dstFile, err := s.client.Create(remotePath)
+	dstFile, err := s.createRemote(remotePath)
 	if err != nil {
 		return fmt.Errorf("create remote: %w", err)
 	}
@@ -1159,36 +1506,17 @@ func (s *Shell) uploadSingleFileWithPrefix(ctx context.Context, localPath, remot
 		}
 	}()
 
-	// Create progress bar with prefix
-	bar := progressbar.NewOptions64(
-		fi.Size(),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetDescription(fmt.Sprintf("%s %s", prefix, filepath.Base(localPath))),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetItsString("bytes"),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionThrottle(100*time.Millisecond),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
-	defer bar.Close()
-
 	// Wrap reader with progress tracking
 	progressReader := &progressReader{
 		reader: srcFile,
-		bar:    bar,
+		bar:    trackTransfer(track(fi.Size()), "upload", localPath, fi.Size()),
 		size:   fi.Size(),
 	}
 
 	// Use io.CopyBuffer with large buffer
 	buf := make([]byte, 1024*1024) // 1MB buffer
 	written, err := io.CopyBuffer(dstFile, progressReader, buf)
+	progressReader.Flush()
 	if err != nil {
 		if err == context.Canceled {
 			return context.Canceled
@@ -1207,14 +1535,28 @@ func (s *Shell) uploadSingleFileWithPrefix(ctx context.Context, localPath, remot
 		return fmt.Errorf("incomplete upload: sent %d bytes, expected %d bytes", written, fi.Size())
 	}
 
+	// Flush to stable storage before closing when requested
+	if opts.fsync {
+		if err := dstFile.Sync(); err != nil {
+			return fmt.Errorf("fsync remote file: %w", err)
+		}
+	}
+
 	// Close remote file to finalize
 	if err := dstFile.Close(); err != nil {
 		return fmt.Errorf("close remote file: %w", err)
 	}
 	fileClosed = true
 
-	bar.Close()
-	fmt.Fprintln(s.stdout)
+	if opts.preserve {
+		if err := s.preserveRemote(remotePath, fi); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: preserve %s: %v\n", remotePath, err)
+		}
+	} else if opts.times {
+		if err := s.client.Chtimes(remotePath, fi.ModTime(), fi.ModTime()); err != nil {
+			fmt.Fprintf(s.stderr, "Warning: set times %s: %v\n", remotePath, err)
+		}
+	}
 	return nil
 }
 
@@ -1235,7 +1577,7 @@ func (s *Shell) cmdMkdir(args []string) error {
 		return fmt.Errorf("mkdir: %w", err)
 	}
 
-	fmt.Fprintf(s.stdout, "Created remote directory: %s\n", resolved)
+	fmt.Fprintf(s.info, "Created remote directory: %s\n", resolved)
 	return nil
 }
 
@@ -1256,17 +1598,12 @@ func (s *Shell) cmdLMkdir(args []string) error {
 		return fmt.Errorf("mkdir: %w", err)
 	}
 
-	fmt.Fprintf(s.stdout, "Created local directory: %s\n", resolved)
+	fmt.Fprintf(s.info, "Created local directory: %s\n", resolved)
 	return nil
 }
 
-// ANSI color codes
-const (
-	colorGreenBold = "\033[1;32m"
-	colorGreen     = "\033[32m"
-	colorGray      = "\033[90m"
-	colorReset     = "\033[0m"
-)
+// colorReset ends the theme colors in shell output.
+const colorReset = "\033[0m"
 
 // cmdHelp shows help information.
 func (s *Shell) cmdHelp() error {
@@ -1279,52 +1616,75 @@ func (s *Shell) cmdHelp() error {
 		{"lcd", "<path>", "Change local directory"},
 		{"pwd", "", "Print remote working directory"},
 		{"lpwd", "", "Print local working directory"},
-		{"ls", "[path]", "List remote files"},
-		{"lls", "[path]", "List local files"},
-		{"get", "<remote> [local]", "Download file or directory"},
-		{"put", "<local> [remote]", "Upload file or directory"},
+		{"ls", "[--time-style=S] [path]", "List remote files or wildcard matches (S: locale, iso, full-iso)"},
+		{"lls", "[--time-style=S] [path]", "List local files or wildcard matches"},
+		{"get", "[-p] [--mangle-names] [--parallel N|auto] <remote> [local]", "Download file, directory or wildcard matches"},
+		{"put", "[-p] [--ignore] [--fsync] [--skip-unchanged] [--parallel N|auto] <local> [remote]", "Upload file, directory or wildcard matches"},
+		{"sync", "[-r] [-n] [--checksum] [--delete] [--parallel N|auto] <src> <dst>", "Transfer only changed files of a directory (-r: remote to local)"},
+		{"view", "<remote>", "Open remote file in local default app"},
+		{"sha256", "<path>", "SHA-256 of remote file or directory"},
+		{"md5", "<path>", "MD5 of remote file or directory"},
 		{"mkdir", "<path>", "Create remote directory"},
 		{"lmkdir", "<path>", "Create local directory"},
+		{"rm", "[-rf] [--fast] <path>", "Remove remote file or directory"},
+		{"ln", "[-s] <target> <link>", "Create remote hard link (or symlink)"},
+		{"fsync", "<path>", "Flush remote file to disk"},
+		{"capabilities", "", "Show server SFTP version and extensions"},
+		{"alias", "[name[=command]]", "List aliases, or define one for this session"},
+		{"unalias", "<name>", "Remove an alias for this session"},
 		{"exit", "", "Exit SFTP shell"},
 		{"quit", "", "Exit SFTP shell (alias)"},
 		{"bye", "", "Exit SFTP shell (alias)"},
 	}
 
+	// Columns grow to fit the longest entry
+	widths := [3]int{cmdWidth, argsWidth, descWidth}
+	for _, c := range commands {
+		widths[0] = max(widths[0], utf8.RuneCountInString(c.cmd))
+		widths[1] = max(widths[1], utf8.RuneCountInString(c.args))
+		widths[2] = max(widths[2], utf8.RuneCountInString(c.desc))
+	}
+
+	t := theme.Current()
+	heading, command := theme.SGR(t.Heading, false), theme.SGR(t.Prompt, false)
+
 	// 上边框
-	s.printTableLine("┌", "┬", "┐")
+	s.printTableLine(widths, "┌", "┬", "┐")
 
 	// 表头
-	s.printTableRow("COMMAND", "ARGUMENTS", "DESCRIPTION", colorGray, colorGray, colorGray)
+	s.printTableRow(widths, "COMMAND", "ARGUMENTS", "DESCRIPTION", heading, heading, heading)
 
 	// 分隔线
-	s.printTableLine("├", "┼", "┤")
+	s.printTableLine(widths, "├", "┼", "┤")
 
 	// 数据行
 	for _, c := range commands {
-		s.printTableRow(c.cmd, c.args, c.desc, colorGreen, colorReset, colorReset)
+		s.printTableRow(widths, c.cmd, c.args, c.desc, command, colorReset, colorReset)
 	}
 
 	// 下边框
-	s.printTableLine("└", "┴", "┘")
+	s.printTableLine(widths, "└", "┴", "┘")
+	fmt.Fprintln(s.stdout, "  Commands with flags treat every argument starting with - as a flag;")
+	fmt.Fprintln(s.stdout, "  put -- before paths that start with -, e.g. rm -- -old.log")
 
 	return nil
 }
 
 // printTableLine prints a horizontal table line
-func (s *Shell) printTableLine(left, mid, right string) {
+func (s *Shell) printTableLine(widths [3]int, left, mid, right string) {
 	fmt.Fprintf(s.stdout, "  %s%s%s%s%s%s\n",
 		left,
-		strings.Repeat("─", cmdWidth+2),
+		strings.Repeat("─", widths[0]+2),
 		mid,
-		strings.Repeat("─", argsWidth+2),
+		strings.Repeat("─", widths[1]+2),
 		mid,
-		strings.Repeat("─", descWidth+2)+right)
+		strings.Repeat("─", widths[2]+2)+right)
 }
 
 // printTableRow prints a table row
-func (s *Shell) printTableRow(col1, col2, col3, c1Color, c2Color, c3Color string) {
+func (s *Shell) printTableRow(widths [3]int, col1, col2, col3, c1Color, c2Color, c3Color string) {
 	fmt.Fprintf(s.stdout, "  │ %s%-*s%s │ %s%-*s%s │ %s%-*s%s │\n",
-		c1Color, cmdWidth, col1, colorReset,
-		c2Color, argsWidth, col2, colorReset,
-		c3Color, descWidth, col3, colorReset)
+		c1Color, widths[0], col1, colorReset,
+		c2Color, widths[1], col2, colorReset,
+		c3Color, widths[2], col3, colorReset)
 }
@@ -0,0 +1,154 @@
+package sftp
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// commandNames are offered when completing the first word of a line.
+var commandNames = []string{
+	"alias", "bye", "capabilities", "cd", "exit", "fsync", "get", "help",
+	"lcd", "lls", "lmkdir", "ln", "lpwd", "ls", "md5", "mkdir", "put",
+	"pwd", "quit", "rm", "sha256", "sync", "unalias", "view",
+}
+
+// localArgCommands take local paths; the rest take remote ones, except
+// get, put and sync, which take one of each.
+var localArgCommands = map[string]bool{
+	"lcd":    true,
+	"lls":    true,
+	"lmkdir": true,
+}
+
+// dirArgCommands only take directories.
+var dirArgCommands = map[string]bool{
+	"cd":  true,
+	"lcd": true,
+}
+
+// complete is the line editor's tab completion: command names for the
+// first word, then local or remote paths depending on the command and the
+// argument's position.
+func (s *Shell) complete(line string, pos int) (int, []string) {
+	start := strings.LastIndexAny(line[:pos], " \t") + 1
+	word := line[start:pos]
+	fields := strings.Fields(line[:start])
+	if len(fields) == 0 {
+		names := slices.Clone(commandNames)
+		for name := range s.aliases {
+			if !slices.Contains(commandNames, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		return start, matchPrefix(names, word)
+	}
+	// A flag, unless it comes after "--"
+	if strings.HasPrefix(word, "-") && !slices.Contains(fields[1:], "--") {
+		return start, nil
+	}
+
+	cmd := s.aliasedCommand(fields[0])
+	// The source of get is remote and its destination local; put is the
+	// other way round, and so is sync unless -r
+	parsed := parseCmdArgs(fields[1:], "parallel")
+	arg := len(parsed.args) + 1
+	local := localArgCommands[cmd]
+	switch cmd {
+	case "get":
+		local = arg > 1
+	case "put":
+		local = arg == 1
+	case "sync":
+		local = (arg == 1) != parsed.has("r")
+	}
+
+	if local {
+		return start, s.completeLocal(word, dirArgCommands[cmd])
+	}
+	return start, s.completeRemote(word, dirArgCommands[cmd])
+}
+
+// completeRemote returns the remote paths starting with word.
+func (s *Shell) completeRemote(word string, dirsOnly bool) []string {
+	dir, base := splitWord(word, "/")
+	resolved, err := s.paths.ResolveRemote(dir)
+	if err != nil {
+		return nil
+	}
+	entries, err := s.client.ReadDir(resolved)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, fi := range entries {
+		name := fi.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := fi.IsDir()
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if target, err := s.client.Stat(joinPath(resolved, name)); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+		if isDir {
+			matches = append(matches, dir+name+"/")
+		} else if !dirsOnly {
+			matches = append(matches, dir+name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeLocal returns the local paths starting with word.
+func (s *Shell) completeLocal(word string, dirsOnly bool) []string {
+	dir, base := splitWord(word, "/"+string(filepath.Separator))
+	resolved, err := s.paths.ResolveLocal(dir)
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		// Stat follows symlinks to directories
+		if fi, err := os.Stat(filepath.Join(resolved, name)); err == nil && fi.IsDir() {
+			matches = append(matches, dir+name+"/")
+		} else if !dirsOnly {
+			matches = append(matches, dir+name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// splitWord splits a partial path into the directory typed so far, with
+// its trailing separator, and the start of the name being completed.
+func splitWord(word, separators string) (dir, base string) {
+	i := strings.LastIndexAny(word, separators) + 1
+	return word[:i], word[i:]
+}
+
+// matchPrefix returns the words starting with prefix.
+func matchPrefix(words []string, prefix string) []string {
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
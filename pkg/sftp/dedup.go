@@ -0,0 +1,205 @@
+package sftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/scp"
+	"github.com/schollz/progressbar/v3"
+)
+
+// dedupStatWorkers bounds concurrent Stat calls when looking for remote
+// counterparts of local files.
+const dedupStatWorkers = 16
+
+// remoteSumBatch is how many paths are passed to one sha256sum command.
+const remoteSumBatch = 64
+
+// unchangedFiles returns the relative paths of files whose counterpart
+// under remotePath has the same size and SHA-256, so put --skip-unchanged
+// can leave them alone. Remote files are hashed with sha256sum over exec
+// when the server allows it, and read back over SFTP otherwise.
+func (s *Shell) unchangedFiles(ctx context.Context, localPath, remotePath string, files []localFileInfo) (map[string]bool, error) {
+	// Only files with a remote counterpart of the same size need hashing
+	sameSize := make([]bool, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < dedupStatWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fi, err := s.client.Stat(joinPath(remotePath, files[i].RelPath))
+				sameSize[i] = err == nil && fi.Mode().IsRegular() && fi.Size() == files[i].Size
+			}
+		}()
+	}
+feed:
+	for i := range files {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, context.Canceled
+	}
+
+	var candidates []string
+	for i, file := range files {
+		if sameSize[i] {
+			candidates = append(candidates, filepath.ToSlash(file.RelPath))
+		}
+	}
+	same, err := s.sameContent(ctx, localPath, remotePath, candidates)
+	if err != nil {
+		return nil, err
+	}
+	unchanged := make(map[string]bool, len(same))
+	for _, file := range files {
+		if same[filepath.ToSlash(file.RelPath)] {
+			unchanged[file.RelPath] = true
+		}
+	}
+	return unchanged, nil
+}
+
+// sameContent returns those of rels, slash-separated paths relative to
+// localPath and remotePath, whose local and remote files have the same
+// SHA-256.
+func (s *Shell) sameContent(ctx context.Context, localPath, remotePath string, rels []string) (map[string]bool, error) {
+	same := make(map[string]bool)
+	if len(rels) == 0 {
+		return same, nil
+	}
+
+	bar := s.newBar(int64(len(rels)), "Comparing files",
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		barTheme(progressbar.ThemeDefault),
+	)
+	defer bar.Close()
+
+	remotes := make([]string, len(rels))
+	for i, rel := range rels {
+		remotes[i] = joinPath(remotePath, rel)
+	}
+	remoteSums, err := s.remoteSums(ctx, remotes)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rel := range rels {
+		if ctx.Err() != nil {
+			return nil, context.Canceled
+		}
+		bar.Add(1)
+		remoteSum, ok := remoteSums[remotes[i]]
+		if !ok {
+			continue
+		}
+		localSum, err := hashLocal(filepath.Join(localPath, filepath.FromSlash(rel)))
+		if err == nil && localSum == remoteSum {
+			same[rel] = true
+		}
+	}
+
+	bar.Close()
+	fmt.Fprintln(s.info)
+	return same, nil
+}
+
+// remoteSums returns the SHA-256 of each remote path it could hash. Paths
+// that sha256sum could not handle are hashed over SFTP instead.
+func (s *Shell) remoteSums(ctx context.Context, paths []string) (map[string]string, error) {
+	sums := make(map[string]string, len(paths))
+	if s.opts.SSHClient != nil {
+		for start := 0; start < len(paths); start += remoteSumBatch {
+			batch := paths[start:min(start+remoteSumBatch, len(paths))]
+			got, err := s.execSums(batch)
+			if len(got) == 0 && err != nil {
+				// Exec is forbidden or sha256sum is missing; don't retry
+				break
+			}
+			for p, sum := range got {
+				sums[p] = sum
+			}
+		}
+	}
+
+	for _, p := range paths {
+		if _, ok := sums[p]; ok {
+			continue
+		}
+		sum, err := s.hashRemote(ctx, p, sha256.New())
+		if err == context.Canceled {
+			return nil, err
+		}
+		if err == nil {
+			sums[p] = sum
+		}
+	}
+	return sums, nil
+}
+
+// execSums runs sha256sum on the server for paths. Files it fails on are
+// missing from the result, which may be partial even when err is set.
+func (s *Shell) execSums(paths []string) (map[string]string, error) {
+	session, err := s.opts.SSHClient.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = scp.Quote(p)
+	}
+	out, err := session.Output("sha256sum -- " + strings.Join(quoted, " "))
+
+	want := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		want[p] = true
+	}
+	sums := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		// Names with a newline or backslash are escaped and start with
+		// "\"; they fall back to SFTP
+		sum, name, ok := strings.Cut(sc.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 || !want[name] {
+			continue
+		}
+		sums[name] = sum
+	}
+	return sums, err
+}
+
+// hashLocal returns the hex SHA-256 of a local file.
+func hashLocal(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
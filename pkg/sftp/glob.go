@@ -0,0 +1,178 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hasGlob reports whether p contains wildcards (*, ? or [...]).
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// matchName matches a file name against a wildcard pattern. Like a shell,
+// names starting with "." only match patterns that do.
+func matchName(pattern, name string) (bool, error) {
+	if strings.HasPrefix(name, ".") && !strings.HasPrefix(pattern, ".") {
+		return false, nil
+	}
+	return path.Match(pattern, name)
+}
+
+// globRemote expands a remote pattern, which may only have wildcards in
+// its last element. It returns the directory searched and the entries
+// matched, sorted by name, with symlinks followed.
+func (s *Shell) globRemote(pattern string) (string, []os.FileInfo, error) {
+	resolved, err := s.paths.ResolveRemote(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve remote: %w", err)
+	}
+	dir, base := path.Dir(resolved), path.Base(resolved)
+	if hasGlob(dir) {
+		return "", nil, fmt.Errorf("%s: wildcards are only supported in the last path element", pattern)
+	}
+
+	entries, err := s.client.ReadDir(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("read dir: %w", err)
+	}
+	var matches []os.FileInfo
+	for _, entry := range entries {
+		ok, err := matchName(base, entry.Name())
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		if !ok || !validRemoteName(entry.Name()) {
+			continue
+		}
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if target, err := s.client.Stat(joinPath(dir, entry.Name())); err == nil {
+				entry = renamedInfo{target, entry.Name()}
+			}
+		}
+		matches = append(matches, entry)
+	}
+	if len(matches) == 0 {
+		return "", nil, fmt.Errorf("no matches for %s", pattern)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name() < matches[j].Name() })
+	return dir, matches, nil
+}
+
+// globLocal expands a local pattern like globRemote.
+func (s *Shell) globLocal(pattern string) (string, []os.FileInfo, error) {
+	resolved, err := s.paths.ResolveLocal(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve local: %w", err)
+	}
+	dir, base := filepath.Dir(resolved), filepath.Base(resolved)
+	if hasGlob(dir) {
+		return "", nil, fmt.Errorf("%s: wildcards are only supported in the last path element", pattern)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("read dir: %w", err)
+	}
+	var matches []os.FileInfo
+	for _, entry := range entries {
+		ok, err := matchName(base, entry.Name())
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		if !ok {
+			continue
+		}
+		// Stat follows symlinks
+		fi, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		matches = append(matches, fi)
+	}
+	if len(matches) == 0 {
+		return "", nil, fmt.Errorf("no matches for %s", pattern)
+	}
+	return dir, matches, nil
+}
+
+// renamedInfo is a symlink target's FileInfo under the link's name.
+type renamedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi renamedInfo) Name() string {
+	return fi.name
+}
+
+// downloadMatches downloads the remote entries a pattern matched in dir
+// into the local directory localDir as one transfer. Matched directories
+// are downloaded recursively.
+func (s *Shell) downloadMatches(ctx context.Context, pattern, dir string, matches []os.FileInfo, localDir string, opts transferOptions) error {
+	if fi, err := os.Stat(localDir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s matches %d files; %s is not a directory", pattern, len(matches), localDir)
+	}
+
+	var files []remoteFileInfo
+	var totalSize int64
+	for _, fi := range matches {
+		switch {
+		case fi.IsDir():
+			sub, size, err := s.getRemoteFileList(joinPath(dir, fi.Name()))
+			if err != nil {
+				return fmt.Errorf("scan remote directory: %w", err)
+			}
+			for _, f := range sub {
+				files = append(files, remoteFileInfo{RelPath: joinPath(fi.Name(), f.RelPath), Size: f.Size})
+			}
+			totalSize += size
+		case fi.Mode().IsRegular():
+			files = append(files, remoteFileInfo{RelPath: fi.Name(), Size: fi.Size()})
+			totalSize += fi.Size()
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(s.info, "Nothing to download: %s matches no files\n", pattern)
+		return nil
+	}
+	return s.downloadFiles(ctx, pattern, dir, localDir, files, totalSize, opts)
+}
+
+// uploadMatches uploads the local entries a pattern matched in dir into
+// the remote directory remoteDir as one transfer. Matched directories are
+// uploaded recursively.
+func (s *Shell) uploadMatches(ctx context.Context, pattern, dir string, matches []os.FileInfo, remoteDir string, opts transferOptions) error {
+	if fi, err := s.client.Stat(remoteDir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s matches %d files; %s is not a directory", pattern, len(matches), remoteDir)
+	}
+
+	var files []localFileInfo
+	var totalSize int64
+	for _, fi := range matches {
+		switch {
+		case fi.IsDir():
+			sub, size, err := s.getLocalFileList(filepath.Join(dir, fi.Name()), opts.ignore)
+			if err != nil {
+				return fmt.Errorf("scan local directory: %w", err)
+			}
+			for _, f := range sub {
+				files = append(files, localFileInfo{RelPath: filepath.Join(fi.Name(), f.RelPath), Size: f.Size})
+			}
+			totalSize += size
+		case fi.Mode().IsRegular():
+			files = append(files, localFileInfo{RelPath: fi.Name(), Size: fi.Size()})
+			totalSize += fi.Size()
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(s.info, "Nothing to upload: %s matches no files\n", pattern)
+		return nil
+	}
+	return s.uploadFiles(ctx, pattern, dir, remoteDir, files, totalSize, true, opts)
+}
@@ -0,0 +1,165 @@
+package sftp
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFiles are read from every directory of an upload when ignore
+// handling is enabled. Rules in deeper directories take precedence.
+var ignoreFiles = []string{".gitignore", ".sshmignore"}
+
+// ignoreRule is a single pattern line using gitignore semantics.
+type ignoreRule struct {
+	segments []string // pattern split on "/"
+	negate   bool     // "!pattern" re-includes a previously ignored path
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // pattern contains a "/" and is relative to its file
+}
+
+// ignoreList holds the rules of one ignore file.
+type ignoreList struct {
+	base  string // directory of the ignore file, relative to the walk root ("" for root)
+	rules []ignoreRule
+}
+
+// ignoreStack is the set of ignore lists in effect for a directory,
+// ordered from the walk root down.
+type ignoreStack []*ignoreList
+
+// loadIgnoreDir reads the ignore files in dir (relative path rel) and
+// returns the stack extended with their rules.
+func (st ignoreStack) loadIgnoreDir(dir, rel string) ignoreStack {
+	for _, name := range ignoreFiles {
+		list, err := loadIgnoreFile(filepath.Join(dir, name), filepath.ToSlash(rel))
+		if err != nil || len(list.rules) == 0 {
+			continue
+		}
+		// Copy so sibling directories don't share appended lists
+		st = append(st[:len(st):len(st)], list)
+	}
+	return st
+}
+
+// loadIgnoreFile parses a gitignore-style file.
+func loadIgnoreFile(file, base string) (*ignoreList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &ignoreList{base: base}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			list.rules = append(list.rules, rule)
+		}
+	}
+	return list, scanner.Err()
+}
+
+// parseIgnoreRule parses one line; blank lines and comments yield false.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// Escaped leading "!" or "#"
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignored reports whether rel (slash separated, relative to the walk root)
+// is excluded. The last matching rule wins, so deeper files and later lines
+// override earlier ones.
+func (st ignoreStack) ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	ignored := false
+
+	for _, list := range st {
+		local := rel
+		if list.base != "" {
+			if !strings.HasPrefix(rel, list.base+"/") {
+				continue
+			}
+			local = strings.TrimPrefix(rel, list.base+"/")
+		}
+
+		for _, rule := range list.rules {
+			if rule.matches(local, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+
+	return ignored
+}
+
+// matches reports whether the rule matches a path relative to its file.
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		// Patterns without a slash match the name at any depth
+		ok, _ := path.Match(r.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches glob segments against path segments, where "**"
+// matches zero or more whole segments. A trailing "**" matches what is
+// inside a directory but not the directory itself, as in git.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+
+	return len(parts) == 0
+}
@@ -0,0 +1,89 @@
+package sftp
+
+import "testing"
+
+// ignoreLines builds the ignore list of a file in base from its lines.
+func ignoreLines(base string, lines ...string) *ignoreList {
+	list := &ignoreList{base: base}
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(line); ok {
+			list.rules = append(list.rules, rule)
+		}
+	}
+	return list
+}
+
+func TestIgnored(t *testing.T) {
+	root := ignoreLines("",
+		"# build output",
+		"*.log",
+		"!keep.log",
+		"tmp/",
+		"/TODO",
+		"doc/*.txt",
+		"**/cache",
+		"vendor/**/testdata",
+		"generated/**",
+		"!generated/README",
+		`\!bang`,
+		"trailing   ",
+	)
+	sub := ignoreLines("pkg", "*.out", "!app.log")
+	st := ignoreStack{root, sub}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		// Unanchored patterns match the name at any depth
+		{"a.log", false, true},
+		{"src/deep/a.log", false, true},
+		{"a.txt", false, false},
+
+		// Negation re-includes, the last matching rule wins
+		{"keep.log", false, false},
+		{"src/keep.log", false, false},
+
+		// dir/ only matches directories
+		{"tmp", true, true},
+		{"src/tmp", true, true},
+		{"tmp", false, false},
+
+		// A leading slash anchors to the ignore file's directory
+		{"TODO", false, true},
+		{"src/TODO", false, false},
+
+		// A slash in the middle anchors too, and * stays in one segment
+		{"doc/a.txt", false, true},
+		{"doc/sub/a.txt", false, false},
+		{"src/doc/a.txt", false, false},
+
+		// ** matches zero or more directories
+		{"cache", true, true},
+		{"a/b/cache", true, true},
+		{"vendor/testdata", true, true},
+		{"vendor/x/y/testdata", true, true},
+		{"vendor/x/testdata2", true, false},
+		{"generated/a.go", false, true},
+		{"generated/x/a.go", false, true},
+		{"generated", true, false},
+		{"generated/README", false, false},
+
+		// Comments, escapes and trailing spaces
+		{"# build output", false, false},
+		{"!bang", false, true},
+		{"trailing", false, true},
+
+		// Deeper files apply below their directory and win over the root
+		{"pkg/a.out", false, true},
+		{"a.out", false, false},
+		{"pkg/app.log", false, false},
+		{"pkg/other.log", false, true},
+	}
+	for _, tt := range tests {
+		if got := st.ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package sftp
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Transfers must not leave goroutines behind once they return.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
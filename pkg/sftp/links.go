@@ -0,0 +1,69 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+)
+
+// cmdLn creates a hard link (hardlink@openssh.com) or, with -s, a symlink.
+func (s *Shell) cmdLn(rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs)
+	args := parsed.args
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ln [-s] [--] <target> <link>")
+	}
+
+	target, err := s.paths.ResolveRemote(args[0])
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+	link, err := s.paths.ResolveRemote(args[1])
+	if err != nil {
+		return fmt.Errorf("resolve link: %w", err)
+	}
+
+	if parsed.has("s") {
+		// Keep relative symlink targets relative, like ln -s
+		if err := s.client.Symlink(args[0], link); err != nil {
+			return fmt.Errorf("symlink: %w", err)
+		}
+		fmt.Fprintf(s.info, "Created symlink: %s -> %s\n", link, args[0])
+		return nil
+	}
+
+	if !s.caps.hardlink {
+		return fmt.Errorf("server does not support hard links (hardlink@openssh.com)")
+	}
+	if err := s.client.Link(target, link); err != nil {
+		return fmt.Errorf("link: %w", err)
+	}
+	fmt.Fprintf(s.info, "Created hard link: %s => %s\n", link, target)
+	return nil
+}
+
+// cmdFsync asks the server to flush a remote file to stable storage.
+func (s *Shell) cmdFsync(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: fsync <path>")
+	}
+	if !s.caps.fsync {
+		return fmt.Errorf("server does not support fsync (fsync@openssh.com)")
+	}
+
+	resolved, err := s.paths.ResolveRemote(args[0])
+	if err != nil {
+		return fmt.Errorf("resolve path: %w", err)
+	}
+
+	f, err := s.client.OpenFile(resolved, os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("fsync: %w", err)
+	}
+	fmt.Fprintf(s.info, "Synced: %s\n", resolved)
+	return nil
+}
@@ -0,0 +1,204 @@
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// memFS is an in-memory filesystem for SFTP request servers. Unlike
+// sftp.InMemHandler it doesn't sleep on writes to mimic a slow disk, so
+// benchmarks measure the transfer engine rather than the server.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memEntry // By clean absolute path; "/" always exists
+}
+
+// memEntry is a file or directory of a memFS.
+type memEntry struct {
+	name    string
+	dir     bool
+	data    []byte
+	modTime time.Time
+}
+
+func (e *memEntry) Name() string       { return e.name }
+func (e *memEntry) Size() int64        { return int64(len(e.data)) }
+func (e *memEntry) ModTime() time.Time { return e.modTime }
+func (e *memEntry) IsDir() bool        { return e.dir }
+func (e *memEntry) Sys() any           { return nil }
+
+func (e *memEntry) Mode() os.FileMode {
+	if e.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// newMemHandlers returns the handlers of a request server on an empty
+// memFS.
+func newMemHandlers() sftp.Handlers {
+	fs := &memFS{files: map[string]*memEntry{
+		"/": {name: "/", dir: true, modTime: time.Now()},
+	}}
+	return sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}
+}
+
+// lookup returns the entry at p, which must be held under mu.
+func (fs *memFS) lookup(p string) (*memEntry, error) {
+	e, ok := fs.files[path.Clean(p)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return e, nil
+}
+
+// create adds an entry at p, whose parent must be a directory.
+func (fs *memFS) create(p string, dir bool) (*memEntry, error) {
+	p = path.Clean(p)
+	if parent, err := fs.lookup(path.Dir(p)); err != nil || !parent.dir {
+		return nil, os.ErrNotExist
+	}
+	e := &memEntry{name: path.Base(p), dir: dir, modTime: time.Now()}
+	fs.files[p] = e
+	return e, nil
+}
+
+func (fs *memFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if e.dir {
+		return nil, os.ErrInvalid
+	}
+	return bytes.NewReader(e.data), nil
+}
+
+func (fs *memFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(r.Filepath)
+	switch {
+	case err != nil:
+		if e, err = fs.create(r.Filepath, false); err != nil {
+			return nil, err
+		}
+	case e.dir:
+		return nil, os.ErrInvalid
+	case r.Pflags().Trunc:
+		e.data = nil
+	}
+	return &memWriter{fs: fs, entry: e}, nil
+}
+
+func (fs *memFS) Filecmd(r *sftp.Request) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	switch r.Method {
+	case "Setstat":
+		_, err := fs.lookup(r.Filepath)
+		return err
+
+	case "Mkdir":
+		if _, err := fs.lookup(r.Filepath); err == nil {
+			return os.ErrExist
+		}
+		_, err := fs.create(r.Filepath, true)
+		return err
+
+	case "Remove", "Rmdir":
+		e, err := fs.lookup(r.Filepath)
+		if err != nil {
+			return err
+		}
+		if e.dir != (r.Method == "Rmdir") {
+			return os.ErrInvalid
+		}
+		delete(fs.files, path.Clean(r.Filepath))
+		return nil
+
+	case "Rename", "PosixRename":
+		e, err := fs.lookup(r.Filepath)
+		if err != nil || e.dir {
+			return os.ErrInvalid
+		}
+		delete(fs.files, path.Clean(r.Filepath))
+		moved, err := fs.create(r.Target, false)
+		if err != nil {
+			return err
+		}
+		moved.data, moved.modTime = e.data, e.modTime
+		return nil
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *memFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "Stat", "Lstat":
+		return memLister{e}, nil
+
+	case "List":
+		if !e.dir {
+			return nil, os.ErrInvalid
+		}
+		dir := path.Clean(r.Filepath)
+		var list memLister
+		for p, child := range fs.files {
+			if p != "/" && path.Dir(p) == dir {
+				list = append(list, child)
+			}
+		}
+		return list, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// memWriter writes to a file of a memFS.
+type memWriter struct {
+	fs    *memFS
+	entry *memEntry
+}
+
+func (w *memWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(w.entry.data) {
+		w.entry.data = append(w.entry.data, make([]byte, end-len(w.entry.data))...)
+	}
+	w.entry.modTime = time.Now()
+	return copy(w.entry.data[off:], p), nil
+}
+
+// memLister lists entries of a memFS.
+type memLister []os.FileInfo
+
+func (l memLister) ListAt(out []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(out, l[offset:])
+	if offset+int64(n) == int64(len(l)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
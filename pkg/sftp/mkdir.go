@@ -0,0 +1,129 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// mkdirWorkers bounds concurrent Mkdir calls when pre-creating the
+// directories of a recursive upload.
+const mkdirWorkers = 16
+
+// createRemoteDirs creates every directory the files live in under root,
+// which must already exist, before any file is sent. Each directory gets a
+// single Mkdir, level by level with a pool of workers, instead of a
+// MkdirAll per file that stats every parent again.
+//
+// It returns the directories (slash-separated, relative to root) that could
+// not be created; a failed directory's descendants carry its error.
+func (s *Shell) createRemoteDirs(ctx context.Context, root string, files []localFileInfo) (map[string]error, error) {
+	seen := make(map[string]bool)
+	dirsByDepth := map[int][]string{}
+	for _, file := range files {
+		for d := path.Dir(filepath.ToSlash(file.RelPath)); d != "." && !seen[d]; d = path.Dir(d) {
+			seen[d] = true
+			depth := strings.Count(d, "/")
+			dirsByDepth[depth] = append(dirsByDepth[depth], d)
+		}
+	}
+	failed := make(map[string]error)
+	if len(seen) == 0 {
+		return failed, nil
+	}
+
+	bar := s.newBar(int64(len(seen)), "Creating directories",
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		barTheme(progressbar.ThemeDefault),
+	)
+	defer bar.Close()
+
+	depths := make([]int, 0, len(dirsByDepth))
+	for d := range dirsByDepth {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+	for _, d := range depths {
+		if err := s.mkdirLevel(ctx, root, dirsByDepth[d], failed, bar); err != nil {
+			return nil, err
+		}
+	}
+
+	bar.Close()
+	fmt.Fprintln(s.info)
+	return failed, nil
+}
+
+// mkdirLevel creates dirs, which are all at the same depth, with
+// mkdirWorkers concurrent requests. Directories whose parent failed are
+// skipped; new failures are added to failed.
+func (s *Shell) mkdirLevel(ctx context.Context, root string, dirs []string, failed map[string]error, bar progressBar) error {
+	jobs := make(chan string)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for w := 0; w < mkdirWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				if err := s.mkdirExisting(joinPath(root, d)); err != nil {
+					mu.Lock()
+					failed[d] = err
+					mu.Unlock()
+				}
+				bar.Add(1)
+			}
+		}()
+	}
+
+feed:
+	for _, d := range dirs {
+		// The previous level is complete, so failed is stable here
+		mu.Lock()
+		parentErr, ok := failed[path.Dir(d)]
+		if ok {
+			failed[d] = parentErr
+		}
+		mu.Unlock()
+		if ok {
+			bar.Add(1)
+			continue
+		}
+		select {
+		case jobs <- d:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return context.Canceled
+	}
+	return nil
+}
+
+// mkdirExisting creates dir, accepting a directory that is already there.
+func (s *Shell) mkdirExisting(dir string) error {
+	err := s.client.Mkdir(dir)
+	if err == nil {
+		return nil
+	}
+	if fi, statErr := s.client.Stat(dir); statErr == nil && fi.IsDir() {
+		return nil
+	}
+	return fmt.Errorf("create directory %s: %w", dir, err)
+}
@@ -0,0 +1,68 @@
+package sftp
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// displayName returns a file name that is safe to print on a terminal.
+// Names with control characters or invalid UTF-8 are shown Go-quoted
+// (e.g. "foo\nbar") so they can't break the listing or inject escapes.
+func displayName(name string) string {
+	if needsEscape(name) {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// needsEscape reports whether name contains bytes unsafe for display.
+func needsEscape(name string) bool {
+	if !utf8.ValidString(name) {
+		return true
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// mangleName replaces characters that common local filesystems reject
+// (control characters, invalid UTF-8 and the Windows-reserved <>:"\|?*)
+// with '_'. Used by downloads with --mangle-names.
+func mangleName(name string) string {
+	var b strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		name = name[size:]
+
+		if r == utf8.RuneError && size == 1 {
+			b.WriteByte('_')
+			continue
+		}
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"\|?*`, r) {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	// Trailing dots and spaces are stripped by Windows
+	mangled := strings.TrimRight(b.String(), ". ")
+	if mangled == "" {
+		return "_"
+	}
+	return mangled
+}
+
+// mangleRelPath applies mangleName to every element of a / separated path.
+func mangleRelPath(rel string) string {
+	elems := strings.Split(rel, "/")
+	for i, elem := range elems {
+		elems[i] = mangleName(elem)
+	}
+	return strings.Join(elems, "/")
+}
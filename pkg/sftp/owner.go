@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package sftp
+
+import (
+	"os"
+	"syscall"
+)
+
+// localOwner returns the uid and gid of a local file.
+func localOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package sftp
+
+import "os"
+
+// localOwner is not supported on Windows, which has no uid/gid.
+func localOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
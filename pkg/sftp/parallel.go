@@ -0,0 +1,415 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ai-help-me/sshm/pkg/theme"
+	"github.com/mitchellh/colorstring"
+	"golang.org/x/term"
+)
+
+// maxParallel bounds --parallel; past this the server, not the number of
+// requests in flight, is the limit.
+const maxParallel = 16
+
+// parseParallel returns the --parallel worker count, or autoParallel for
+// "auto". Without the flag the host's default applies, and 1 without that.
+func (s *Shell) parseParallel(parsed cmdArgs) (int, error) {
+	value := s.opts.Parallel
+	if parsed.has("parallel") {
+		value = parsed.value("parallel")
+	}
+	if value == "" {
+		return 1, nil
+	}
+	if value == "auto" {
+		return autoParallel, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxParallel {
+		return 0, fmt.Errorf("--parallel must be auto or a number from 1 to %d", maxParallel)
+	}
+	return n, nil
+}
+
+// downloadAll downloads files, relative to remotePath, to the same
+// relative paths under localPath, opts.parallel at a time. It returns the
+// number and size of the files downloaded and the relative paths of those
+// that failed.
+func (s *Shell) downloadAll(ctx context.Context, remotePath, localPath string, files []remoteFileInfo, opts transferOptions) (int, int64, []string, error) {
+	list := make([]transferFile, len(files))
+	for i, f := range files {
+		list[i] = transferFile{f.RelPath, f.Size}
+	}
+	return s.transferAll(ctx, "download", list, opts.parallel, func(i int, track func(int64) progressAdder) error {
+		fileLocalPath, err := safeLocalJoin(localPath, opts.localName(files[i].RelPath))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fileLocalPath), 0755); err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
+		return s.downloadFile(ctx, joinPath(remotePath, files[i].RelPath), fileLocalPath, opts, track)
+	})
+}
+
+// uploadAll uploads files like downloadAll. dirErrs are the directories
+// that could not be created.
+func (s *Shell) uploadAll(ctx context.Context, localPath, remotePath string, files []localFileInfo, dirErrs map[string]error, opts transferOptions) (int, int64, []string, error) {
+	list := make([]transferFile, len(files))
+	for i, f := range files {
+		list[i] = transferFile{f.RelPath, f.Size}
+	}
+	return s.transferAll(ctx, "upload", list, opts.parallel, func(i int, track func(int64) progressAdder) error {
+		if err := dirErrs[path.Dir(filepath.ToSlash(files[i].RelPath))]; err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
+		return s.uploadFile(ctx, filepath.Join(localPath, files[i].RelPath), joinPath(remotePath, files[i].RelPath), opts, track)
+	})
+}
+
+// transferFile is one file of a directory transfer.
+type transferFile struct {
+	name string // Shown in progress and failure messages
+	size int64
+}
+
+// transferAll runs transfer for each file with workers concurrent
+// transfers (at least one), drawing a progress bar per worker above one
+// for the whole transfer. With autoParallel the count is tuned as the
+// transfer runs, starting from the one last settled on for the host.
+// transfer reports progress to the adder track returns for the file's
+// size. It returns the number and size of the files transferred and the
+// names of those that failed; failures are reported as they happen.
+func (s *Shell) transferAll(ctx context.Context, verb string, files []transferFile, workers int, transfer func(i int, track func(size int64) progressAdder) error) (int, int64, []string, error) {
+	auto := workers == autoParallel
+	pool := workers
+	if auto {
+		pool = maxParallel
+		workers = s.autoStart()
+	}
+	pool = max(1, min(pool, len(files)))
+	workers = max(1, min(workers, pool))
+	var totalSize int64
+	for _, f := range files {
+		totalSize += f.size
+	}
+	display := newMultiProgress(s.progress, s.plain, pool, len(files), totalSize)
+	limit := newWorkerLimit(workers)
+	display.setWorkers(workers)
+
+	// Tune when there is a choice of count
+	var tune *tuner
+	tuneDone := make(chan struct{})
+	tuneStopped := make(chan struct{})
+	if auto && pool > 1 {
+		tune = &tuner{s: s, display: display, limit: limit, start: workers, pool: pool}
+		display.log(s.info, fmt.Sprintf("parallel: auto, starting with %d workers", workers))
+		go func() {
+			defer close(tuneStopped)
+			tune.run(tuneDone)
+		}()
+	} else {
+		close(tuneStopped)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		count  int
+		size   int64
+		failed []string
+	)
+	jobs := make(chan int)
+	for w := 0; w < pool; w++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			for {
+				limit.wait(slot)
+				i, ok := <-jobs
+				if !ok {
+					return
+				}
+				label := fmt.Sprintf("[%d/%d] %s", i+1, len(files), files[i].name)
+				began := time.Now()
+				err := transfer(i, func(size int64) progressAdder {
+					return display.start(slot, label, size)
+				})
+				if err == nil && tune != nil {
+					tune.fileDone(time.Since(began))
+				}
+				display.finish(slot, err == nil)
+				if err == context.Canceled {
+					continue
+				}
+
+				mu.Lock()
+				if err != nil {
+					display.log(s.stdout, fmt.Sprintf("Warning: failed to %s %s: %v", verb, files[i].name, err))
+					failed = append(failed, files[i].name)
+				} else {
+					count++
+					size += files[i].size
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+
+	func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	// Stop the tuner before releasing the gated workers, which then find
+	// no more files
+	close(tuneDone)
+	<-tuneStopped
+	limit.set(pool)
+	wg.Wait()
+	display.close()
+
+	if tune != nil && ctx.Err() == nil && tune.best > 0 {
+		s.rememberTuned(tune.best)
+	}
+	if ctx.Err() != nil {
+		return count, size, failed, context.Canceled
+	}
+	return count, size, failed, nil
+}
+
+// multiProgress draws a progress bar per worker and one for the whole
+// transfer below them, with its throughput and time left, redrawing the
+// block in place. When plain, nothing is redrawn; files and the total
+// print percentage lines instead.
+type multiProgress struct {
+	w     io.Writer
+	plain bool
+	mu    sync.Mutex
+
+	slots      []progressSlot
+	workers    int // Slots shown even when idle
+	files      int
+	totalFiles int
+	bytes      int64
+	totalBytes int64
+	started    time.Time
+	total      *lineProgress // Total percentage lines when plain
+
+	drawn int // Lines of the block on screen
+	last  time.Time
+}
+
+// progressSlot is the file a worker is transferring; an empty label means
+// the worker is idle.
+type progressSlot struct {
+	label string
+	done  int64
+	total int64
+}
+
+func newMultiProgress(w io.Writer, plain bool, workers, totalFiles int, totalBytes int64) *multiProgress {
+	m := &multiProgress{
+		w:          w,
+		plain:      plain,
+		slots:      make([]progressSlot, workers),
+		workers:    workers,
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		started:    time.Now(),
+	}
+	if plain {
+		m.total = &lineProgress{w: w, description: "Total", total: totalBytes}
+	}
+	m.mu.Lock()
+	m.draw(true)
+	m.mu.Unlock()
+	return m
+}
+
+// setWorkers shows n worker lines, and those beyond only while they
+// finish a file.
+func (m *multiProgress) setWorkers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workers = n
+	m.draw(true)
+}
+
+// counts returns the files and bytes transferred so far and their totals.
+func (m *multiProgress) counts() (files int, bytes int64, totalFiles int, totalBytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files, m.bytes, m.totalFiles, m.totalBytes
+}
+
+// start shows label on the worker's line and returns the adder for its
+// progress.
+func (m *multiProgress) start(slot int, label string, total int64) progressAdder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots[slot] = progressSlot{label: label, total: total}
+	m.draw(false)
+	if m.plain {
+		return slotAdder{m, slot, &lineProgress{w: m.w, description: label, total: total}}
+	}
+	return slotAdder{m: m, slot: slot}
+}
+
+// finish clears the worker's line, counting the file when it succeeded.
+func (m *multiProgress) finish(slot int, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots[slot] = progressSlot{}
+	if ok {
+		m.files++
+	}
+	m.draw(false)
+}
+
+// log prints line to out above the block.
+func (m *multiProgress) log(out io.Writer, line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clear()
+	fmt.Fprintln(out, line)
+	m.draw(true)
+}
+
+// close removes the block; the caller prints a summary.
+func (m *multiProgress) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clear()
+}
+
+// slotAdder advances one worker's bar and the total, and the file's
+// percentage lines when plain.
+type slotAdder struct {
+	m    *multiProgress
+	slot int
+	line *lineProgress
+}
+
+func (a slotAdder) Add64(n int64) error {
+	if a.line != nil {
+		a.line.Add64(n)
+		a.m.total.Add64(n)
+	}
+	a.m.mu.Lock()
+	defer a.m.mu.Unlock()
+	a.m.slots[a.slot].done += n
+	a.m.bytes += n
+	a.m.draw(false)
+	return nil
+}
+
+// clear erases the block, leaving the cursor where it started.
+func (m *multiProgress) clear() {
+	if m.drawn == 0 {
+		return
+	}
+	io.WriteString(m.w, "\r")
+	if m.drawn > 1 {
+		fmt.Fprintf(m.w, "\033[%dA", m.drawn-1)
+	}
+	io.WriteString(m.w, "\033[J")
+	m.drawn = 0
+}
+
+// draw redraws the block, at most every 100ms unless forced.
+func (m *multiProgress) draw(force bool) {
+	if m.plain || (!force && time.Since(m.last) < 100*time.Millisecond) {
+		return
+	}
+	m.last = time.Now()
+
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stderr.Fd())); err == nil && w > 0 {
+		width = w
+	}
+	width-- // Writing the last column wraps on some terminals
+
+	lines := make([]string, 0, len(m.slots)+1)
+	for i, slot := range m.slots {
+		if i >= m.workers && slot.label == "" {
+			continue
+		}
+		line := ""
+		if slot.label != "" {
+			line = barLine(slot.label, slot.done, slot.total,
+				fmt.Sprintf("%s/%s", formatBytes(slot.done), formatBytes(slot.total)), width)
+		}
+		lines = append(lines, line)
+	}
+
+	stats := fmt.Sprintf("%s/%s", formatBytes(m.bytes), formatBytes(m.totalBytes))
+	if elapsed := time.Since(m.started).Seconds(); elapsed >= 1 && m.bytes > 0 {
+		rate := float64(m.bytes) / elapsed
+		eta := time.Duration(float64(m.totalBytes-m.bytes) / rate * float64(time.Second))
+		stats += fmt.Sprintf(", %s/s, ETA %s", formatBytes(int64(rate)), eta.Round(time.Second))
+	}
+	label := fmt.Sprintf("Total %d/%d files", m.files, m.totalFiles)
+	lines = append(lines, barLine(label, m.bytes, m.totalBytes, stats, width))
+
+	m.clear()
+	io.WriteString(m.w, strings.Join(lines, "\n"))
+	m.drawn = len(lines)
+}
+
+// barWidth is the width of the bars inside the brackets.
+const barWidth = 20
+
+// barLine lays out "label [===>    ]  40% stats" in width columns,
+// shortening label so the line never wraps, which would throw off the
+// redraw.
+func barLine(label string, done, total int64, stats string, width int) string {
+	pct := percent(done, total)
+	filled := int(min(pct, 100)) * barWidth / 100
+	fill := strings.Repeat("=", filled)
+	if filled > 0 && filled < barWidth {
+		fill = fill[:filled-1] + ">"
+	}
+	if color := theme.Current().Progress; color != "" && fill != "" {
+		fill = colorstring.Color("[" + color + "]" + fill + "[reset]")
+	}
+	tail := fmt.Sprintf(" [%s%s] %3d%% %s", fill, strings.Repeat(" ", barWidth-filled), pct, stats)
+	tailWidth := barWidth + utf8.RuneCountInString(fmt.Sprintf(" [] %3d%% %s", pct, stats))
+	return truncateLine(label, width-tailWidth) + tail
+}
+
+// percent returns done as a percentage of total; nothing to do is done.
+func percent(done, total int64) int64 {
+	if total <= 0 {
+		return 100
+	}
+	return done * 100 / total
+}
+
+// truncateLine shortens line to width characters.
+func truncateLine(line string, width int) string {
+	runes := []rune(line)
+	if width < 1 {
+		return ""
+	}
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:width-1]) + "…"
+}
@@ -23,25 +23,33 @@ type PathState struct {
 	RemoteCWD  string
 	HomeLocal  string
 	HomeRemote string
-	client     *sftp.Client
+	client     realPather
+}
+
+// realPather canonicalizes remote paths on the server. *remoteClient is
+// one; tests substitute a fake filesystem.
+type realPather interface {
+	RealPath(path string) (string, error)
 }
 
 // NewPathState creates initial path state.
 func NewPathState(client *sftp.Client) (*PathState, error) {
-	// Get local home directory
-	homeLocal, err := homedir.Dir()
-	if err != nil {
-		return nil, fmt.Errorf("get local home: %w", err)
-	}
-
 	// Get local working directory
 	localCWD, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("get local cwd: %w", err)
 	}
 
+	// Get local home directory; without one (a container with no $HOME),
+	// lcd ~ goes to where the shell started
+	homeLocal, err := homedir.Dir()
+	if err != nil {
+		homeLocal = localCWD
+	}
+
 	// Get remote home directory
-	homeRemote, err := client.Getwd()
+	remote := &remoteClient{Client: client, timeout: DefaultTimeout}
+	homeRemote, err := remote.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("get remote home: %w", err)
 	}
@@ -51,7 +59,7 @@ func NewPathState(client *sftp.Client) (*PathState, error) {
 		RemoteCWD:  homeRemote,
 		HomeLocal:  homeLocal,
 		HomeRemote: homeRemote,
-		client:     client,
+		client:     remote,
 	}, nil
 }
 
@@ -89,9 +97,17 @@ func (ps *PathState) ResolveLocal(path string) (string, error) {
 // Does NOT use filepath.Join - uses / as separator.
 // Supports: ~ expansion, absolute paths, relative paths, ..
 func (ps *PathState) ResolveRemote(path string) (string, error) {
+	return resolveRemote(ps.RemoteCWD, ps.HomeRemote, path)
+}
+
+// resolveRemote resolves path against the remote cwd and home. The result
+// is always absolute and clean: ".." and "." are applied lexically and
+// repeated or trailing slashes dropped. Symlinks are left for the server;
+// UpdateRemoteCWD canonicalizes the cwd itself.
+func resolveRemote(cwd, home, path string) (string, error) {
 	// Handle empty path
 	if path == "" || path == "." {
-		return ps.RemoteCWD, nil
+		return cwd, nil
 	}
 
 	// Handle absolute path
@@ -104,15 +120,11 @@ func (ps *PathState) ResolveRemote(path string) (string, error) {
 		if len(path) > 1 && path[1] != '/' {
 			return "", fmt.Errorf("~user not supported")
 		}
-		rest := strings.TrimPrefix(path, "~")
-		if rest == "" {
-			return ps.HomeRemote, nil
-		}
-		return joinPath(ps.HomeRemote, rest), nil
+		return cleanPath(joinPath(home, strings.TrimPrefix(path, "~"))), nil
 	}
 
 	// Relative path - join with RemoteCWD
-	return joinPath(ps.RemoteCWD, path), nil
+	return cleanPath(joinPath(cwd, path)), nil
 }
 
 // UpdateRemoteCWD updates RemoteCWD after successful cd.
@@ -176,3 +188,39 @@ func joinPath(base, rel string) string {
 	}
 	return base + "/" + rel
 }
+
+// safeLocalJoin joins a remote-supplied relative path (using / as separator)
+// onto a local base directory.
+//
+// Names in a directory listing come from the server, so a malicious or
+// confused server could return entries like "../../etc/cron.d/x". Any
+// element that is empty, ".", "..", contains a local separator or a volume
+// name is rejected, and the result is verified to stay inside base.
+func safeLocalJoin(base, rel string) (string, error) {
+	elems := strings.Split(rel, "/")
+	for _, elem := range elems {
+		if !validRemoteName(elem) {
+			return "", fmt.Errorf("unsafe remote path %q", rel)
+		}
+	}
+
+	joined := filepath.Join(append([]string{base}, elems...)...)
+
+	relToBase, err := filepath.Rel(base, joined)
+	if err != nil || relToBase == ".." || strings.HasPrefix(relToBase, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("remote path %q escapes %s", rel, base)
+	}
+	return joined, nil
+}
+
+// validRemoteName reports whether a single directory entry name returned by
+// the server is safe to use as a local path element.
+func validRemoteName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	if strings.ContainsAny(name, "/\x00") || strings.ContainsRune(name, filepath.Separator) {
+		return false
+	}
+	return filepath.VolumeName(name) == ""
+}
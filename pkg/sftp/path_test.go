@@ -0,0 +1,319 @@
+package sftp
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"", "/"},
+		{"/a/b", "/a/b"},
+		{"/a/b/", "/a/b"},
+		{"/a//b", "/a/b"},
+		{"//a///b//", "/a/b"},
+		{"/a/./b/.", "/a/b"},
+		{"/a/b/..", "/a"},
+		{"/a/b/../..", "/"},
+		{"/a/../../..", "/"},
+		{"/..", "/"},
+		{"/a/../b/../c", "/c"},
+		{"/a/.../b", "/a/.../b"},
+		{"/a/..b/c", "/a/..b/c"},
+		{"/a b/c", "/a b/c"},
+	}
+	for _, tt := range tests {
+		if got := cleanPath(tt.path); got != tt.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		base, rel string
+		want      string
+	}{
+		{"/", "a", "/a"},
+		{"/home/u", "a", "/home/u/a"},
+		{"/home/u/", "a", "/home/u/a"},
+		{"/home/u", "a/b", "/home/u/a/b"},
+		{"/home/u", "", "/home/u/"},
+	}
+	for _, tt := range tests {
+		if got := joinPath(tt.base, tt.rel); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tt.base, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRemote(t *testing.T) {
+	const (
+		cwd  = "/srv/app"
+		home = "/home/u"
+	)
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		// The cwd itself
+		{"", cwd, false},
+		{".", cwd, false},
+		{"./", cwd, false},
+
+		// Relative to the cwd
+		{"a", "/srv/app/a", false},
+		{"a/b", "/srv/app/a/b", false},
+		{"a/", "/srv/app/a", false},
+		{"a//b", "/srv/app/a/b", false},
+		{"./a/./b", "/srv/app/a/b", false},
+
+		// ..
+		{"..", "/srv", false},
+		{"../", "/srv", false},
+		{"../..", "/", false},
+		{"../../../..", "/", false},
+		{"a/../b", "/srv/app/b", false},
+		{"a/b/../../c", "/srv/app/c", false},
+		{"../app/a", "/srv/app/a", false},
+
+		// Absolute
+		{"/", "/", false},
+		{"/etc", "/etc", false},
+		{"/etc/", "/etc", false},
+		{"//etc//ssh/", "/etc/ssh", false},
+		{"/etc/../var", "/var", false},
+
+		// Home
+		{"~", home, false},
+		{"~/", home, false},
+		{"~/a", "/home/u/a", false},
+		{"~//a/", "/home/u/a", false},
+		{"~/..", "/home", false},
+		{"~/../../..", "/", false},
+		{"~root", "", true},
+		{"~root/a", "", true},
+
+		// Names that only look special
+		{"...", "/srv/app/...", false},
+		{"a~", "/srv/app/a~", false},
+		{"a/~", "/srv/app/a/~", false},
+		{"..a", "/srv/app/..a", false},
+	}
+	for _, tt := range tests {
+		got, err := resolveRemote(cwd, home, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveRemote(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveRemote(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// fakeRealPath canonicalizes paths on a server whose symlinks map a path
+// to its target.
+type fakeRealPath struct {
+	symlinks map[string]string
+	missing  map[string]bool
+}
+
+func (f fakeRealPath) RealPath(path string) (string, error) {
+	parts := strings.Split(cleanPath(path), "/")[1:]
+	real := "/"
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		real = joinPath(real, part)
+		if target, ok := f.symlinks[real]; ok {
+			real = target
+		}
+		if f.missing[real] {
+			return "", errors.New("no such file")
+		}
+	}
+	return real, nil
+}
+
+func TestUpdateRemoteCWD(t *testing.T) {
+	fs := fakeRealPath{
+		symlinks: map[string]string{
+			"/home/u/current": "/srv/releases/v2",
+			"/var/www":        "/srv/www",
+		},
+		missing: map[string]bool{"/home/u/gone": true},
+	}
+
+	// Each step resolves its argument against the cwd the steps before
+	// left, as cd does
+	tests := []struct {
+		name    string
+		steps   []string
+		want    string
+		wantErr bool
+	}{
+		{"plain directory", []string{"logs"}, "/home/u/logs", false},
+		{"into a symlink", []string{"current"}, "/srv/releases/v2", false},
+		{"parent of a symlinked cwd", []string{"current", ".."}, "/srv/releases", false},
+		{"back up twice", []string{"current", "../.."}, "/srv", false},
+		{"absolute symlink", []string{"/var/www/site"}, "/srv/www/site", false},
+		{"home after drift", []string{"current", "~"}, "/home/u", false},
+		{"double slashes", []string{"current//a//"}, "/srv/releases/v2/a", false},
+		{"missing directory", []string{"gone"}, "/home/u", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &PathState{RemoteCWD: "/home/u", HomeRemote: "/home/u", client: fs}
+			var err error
+			for _, step := range tt.steps {
+				var path string
+				if path, err = ps.ResolveRemote(step); err != nil {
+					break
+				}
+				if err = ps.UpdateRemoteCWD(path); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ps.RemoteCWD != tt.want {
+				t.Errorf("RemoteCWD = %q, want %q", ps.RemoteCWD, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeLocalJoin(t *testing.T) {
+	base := filepath.Join("tmp", "dst")
+	type joinTest struct {
+		rel     string
+		want    string
+		wantErr bool
+	}
+	tests := []joinTest{
+		{"a", filepath.Join(base, "a"), false},
+		{"a/b", filepath.Join(base, "a", "b"), false},
+		{"..", "", true},
+		{"../x", "", true},
+		{"a/../../x", "", true},
+		{"a//b", "", true},
+		{"a/./b", "", true},
+		{"", "", true},
+		{"a/", "", true},
+		{"a\x00b", "", true},
+		{"\x00", "", true},
+		{"/etc/passwd", "", true},
+		{"//etc/passwd", "", true},
+		{"a/b/../../..", "", true},
+		{"...", filepath.Join(base, "..."), false},
+		{".ssh/config", filepath.Join(base, ".ssh", "config"), false},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []joinTest{
+			{`..\x`, "", true},
+			{`a\..\..\x`, "", true},
+			{`C:\Windows\x`, "", true},
+			{"C:x", "", true},
+			{`\\server\share`, "", true},
+		}...)
+	} else {
+		// A backslash is part of the name, not a separator
+		tests = append(tests, joinTest{`a\..\..\x`, filepath.Join(base, `a\..\..\x`), false})
+	}
+	for _, tt := range tests {
+		got, err := safeLocalJoin(base, tt.rel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("safeLocalJoin(%q) error = %v, wantErr %v", tt.rel, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("safeLocalJoin(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestValidRemoteName(t *testing.T) {
+	type nameTest struct {
+		name string
+		want bool
+	}
+	tests := []nameTest{
+		{"file.txt", true},
+		{".hidden", true},
+		{"...", true},
+		{"with space", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{"/", false},
+		{"/etc", false},
+		{"a\x00", false},
+		{"\x00", false},
+		{string(filepath.Separator) + "x", false},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []nameTest{{`a\b`, false}, {"C:", false}, {"C:x", false}}...)
+	} else {
+		tests = append(tests, []nameTest{{`a\b`, true}, {"C:x", true}}...)
+	}
+	for _, tt := range tests {
+		if got := validRemoteName(tt.name); got != tt.want {
+			t.Errorf("validRemoteName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func FuzzResolveRemote(f *testing.F) {
+	for _, seed := range []string{
+		"", ".", "..", "a/../..", "~", "~/..", "~x", "/a//b/", "a/./b", "../../../etc/passwd", "\x00", "~/../../",
+	} {
+		f.Add("/srv/app", seed)
+	}
+	f.Fuzz(func(t *testing.T, cwd, path string) {
+		cwd = cleanPath(cwd)
+		got, err := resolveRemote(cwd, "/home/u", path)
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(got, "/") || cleanPath(got) != got {
+			t.Fatalf("resolveRemote(%q, %q) = %q, not absolute and clean", cwd, path, got)
+		}
+		// A relative path that never goes up stays inside the cwd
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "~") && !slices.Contains(strings.Split(path, "/"), "..") {
+			if got != cwd && !strings.HasPrefix(got, strings.TrimSuffix(cwd, "/")+"/") {
+				t.Fatalf("resolveRemote(%q, %q) = %q, outside the cwd", cwd, path, got)
+			}
+		}
+	})
+}
+
+func FuzzSafeLocalJoin(f *testing.F) {
+	for _, seed := range []string{"a", "a/b", "..", "../x", "a/../../x", "a//b", `a\..\..\x`, "C:x", "/etc/passwd", "\x00"} {
+		f.Add(seed)
+	}
+	base := filepath.Join("tmp", "dst")
+	f.Fuzz(func(t *testing.T, rel string) {
+		got, err := safeLocalJoin(base, rel)
+		if err != nil {
+			return
+		}
+		// Whatever the server sends, the file lands inside base
+		inside, err := filepath.Rel(base, got)
+		if err != nil || inside == "." || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) || filepath.IsAbs(inside) {
+			t.Fatalf("safeLocalJoin(%q) = %q, outside %s", rel, got, base)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package sftp
+
+import (
+	"errors"
+	"syscall"
+)
+
+// preallocErr keeps the preallocation errors a download should fail on:
+// the disk has no room for the file. Filesystems that can't preallocate
+// are not an error; the file then grows as it is written.
+func preallocErr(err error) error {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EFBIG) || errors.Is(err, syscall.EDQUOT) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package sftp
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes of disk for f, a file about to be
+// written that long, so it is laid out in one piece and a full disk shows
+// before the transfer rather than partway through. The file's size is left
+// alone until the data is written.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	store := &unix.Fstore_t{Flags: unix.F_ALLOCATECONTIG, Posmode: unix.F_PEOFPOSMODE, Length: size}
+	err := unix.FcntlFstore(f.Fd(), unix.F_PREALLOCATE, store)
+	if err != nil {
+		// No contiguous space that long: any will do
+		store.Flags = unix.F_ALLOCATEALL
+		err = unix.FcntlFstore(f.Fd(), unix.F_PREALLOCATE, store)
+	}
+	return preallocErr(err)
+}
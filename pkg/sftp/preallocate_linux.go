@@ -0,0 +1,18 @@
+package sftp
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes of disk for f, a file about to be
+// written that long, so it is laid out in one piece and a full disk shows
+// before the transfer rather than partway through. The file's size is left
+// alone until the data is written.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	return preallocErr(unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size))
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package sftp
+
+import "os"
+
+// preallocate does nothing where the system offers no way to reserve disk
+// for a file; it grows as it is written.
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
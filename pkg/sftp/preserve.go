@@ -0,0 +1,87 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// preserveLocal applies the remote file's times, permissions and (when
+// running as root) ownership to a downloaded file. Used by get -p.
+//
+// An explicit DownloadMode wins over the remote permissions.
+func (s *Shell) preserveLocal(localPath string, remote os.FileInfo) error {
+	stat, ok := remote.Sys().(*sftp.FileStat)
+	if !ok {
+		return os.Chtimes(localPath, remote.ModTime(), remote.ModTime())
+	}
+
+	if err := os.Chtimes(localPath, unixTime(stat.Atime), unixTime(stat.Mtime)); err != nil {
+		return fmt.Errorf("set times: %w", err)
+	}
+
+	if s.opts.DownloadMode == 0 {
+		if err := os.Chmod(localPath, remote.Mode().Perm()); err != nil {
+			return fmt.Errorf("set mode: %w", err)
+		}
+	}
+
+	// Only root can give files away
+	if os.Geteuid() == 0 {
+		uid := mapID(s.opts.MapOwner, int(stat.UID))
+		gid := mapID(s.opts.MapGroup, int(stat.GID))
+		if err := os.Lchown(localPath, uid, gid); err != nil {
+			return fmt.Errorf("set owner %d:%d: %w", uid, gid, err)
+		}
+	}
+
+	return nil
+}
+
+// preserveRemote applies the local file's times and permissions to an
+// uploaded file. Ownership is only changed when map-owner or map-group rules
+// are configured, since servers usually refuse chown for non-root users.
+// Used by put -p.
+//
+// An explicit UploadMode wins over the local permissions.
+func (s *Shell) preserveRemote(remotePath string, local os.FileInfo) error {
+	if err := s.client.Chtimes(remotePath, local.ModTime(), local.ModTime()); err != nil {
+		return fmt.Errorf("set times: %w", err)
+	}
+
+	if s.opts.UploadMode == 0 {
+		if err := s.client.Chmod(remotePath, local.Mode().Perm()); err != nil {
+			return fmt.Errorf("set mode: %w", err)
+		}
+	}
+
+	if len(s.opts.MapOwner) == 0 && len(s.opts.MapGroup) == 0 {
+		return nil
+	}
+	uid, gid, ok := localOwner(local)
+	if !ok {
+		return nil
+	}
+	uid = mapID(s.opts.MapOwner, uid)
+	gid = mapID(s.opts.MapGroup, gid)
+	if err := s.client.Chown(remotePath, uid, gid); err != nil {
+		return fmt.Errorf("set owner %d:%d: %w", uid, gid, err)
+	}
+
+	return nil
+}
+
+// mapID translates a uid/gid through a mapping table, keeping unmapped ids.
+func mapID(m map[int]int, id int) int {
+	if mapped, ok := m[id]; ok {
+		return mapped
+	}
+	return id
+}
+
+// unixTime converts an SFTP timestamp to time.Time.
+func unixTime(sec uint32) time.Time {
+	return time.Unix(int64(sec), 0)
+}
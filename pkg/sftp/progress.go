@@ -2,15 +2,144 @@ package sftp
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"sync"
+	"time"
 
+	"github.com/ai-help-me/sshm/pkg/events"
+	"github.com/ai-help-me/sshm/pkg/theme"
 	"github.com/schollz/progressbar/v3"
 )
 
+// transferTheme draws transfer progress as [===>   ].
+var transferTheme = progressbar.Theme{
+	Saucer:        "=",
+	SaucerHead:    ">",
+	SaucerPadding: " ",
+	BarStart:      "[",
+	BarEnd:        "]",
+}
+
+// barTheme draws a bar with base, filled in the theme's progress color.
+func barTheme(base progressbar.Theme) progressbar.Option {
+	color := theme.Current().Progress
+	if color == "" {
+		return progressbar.OptionSetTheme(base)
+	}
+	base.Saucer = "[" + color + "]" + base.Saucer + "[reset]"
+	if base.SaucerHead != "" {
+		base.SaucerHead = "[" + color + "]" + base.SaucerHead + "[reset]"
+	}
+	return func(p *progressbar.ProgressBar) {
+		progressbar.OptionSetTheme(base)(p)
+		progressbar.OptionEnableColorCodes(true)(p)
+	}
+}
+
+// progressAdder is the part of a progress bar the transfer wrappers use.
+type progressAdder interface {
+	Add64(n int64) error
+}
+
+// progressBar is the part of a progress bar the shell uses, so animated
+// bars and plain percentage lines are interchangeable.
+type progressBar interface {
+	progressAdder
+	Add(n int) error
+	Close() error
+}
+
+// newBar creates a progress bar of max units. When progress does not go to
+// a terminal (cron, CI), a line is printed at every tenth instead.
+func (s *Shell) newBar(max int64, description string, opts ...progressbar.Option) progressBar {
+	if s.plain {
+		return &lineProgress{w: s.progress, description: description, total: max}
+	}
+	opts = append([]progressbar.Option{
+		progressbar.OptionSetWriter(s.progress),
+		progressbar.OptionSetDescription(description),
+	}, opts...)
+	return progressbar.NewOptions64(max, opts...)
+}
+
+// lineProgress reports progress as "description: 40%" lines, one per
+// tenth done, for logs that cannot show an animated bar.
+type lineProgress struct {
+	w           io.Writer
+	description string
+	total       int64
+
+	mu      sync.Mutex
+	done    int64
+	printed int64 // Last percentage printed
+}
+
+func (p *lineProgress) Add(n int) error {
+	return p.Add64(int64(n))
+}
+
+func (p *lineProgress) Add64(n int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if pct := percent(p.done, p.total) / 10 * 10; pct > p.printed {
+		p.printed = pct
+		fmt.Fprintf(p.w, "%s: %d%%\n", p.description, pct)
+	}
+	return nil
+}
+
+// Close reports an empty transfer, which never advances, as complete.
+func (p *lineProgress) Close() error {
+	return p.Add64(0)
+}
+
+// eventInterval limits how often transfer-progress events are written for
+// one file.
+const eventInterval = 500 * time.Millisecond
+
+// eventBar advances a progress bar and reports the progress as
+// transfer-progress events.
+type eventBar struct {
+	bar   progressAdder
+	event events.Event
+	last  time.Time
+}
+
+// trackTransfer returns bar, reporting the transfer of path on the events
+// fd when one is open. direction is "upload" or "download".
+func trackTransfer(bar progressAdder, direction, path string, total int64) progressAdder {
+	if !events.Enabled() {
+		return bar
+	}
+	b := &eventBar{
+		bar: bar,
+		event: events.Event{
+			Type:      events.TransferProgress,
+			Direction: direction,
+			Path:      path,
+			Total:     total,
+		},
+		last: time.Now(),
+	}
+	events.Emit(b.event)
+	return b
+}
+
+func (b *eventBar) Add64(n int64) error {
+	b.event.Bytes += n
+	if b.event.Bytes >= b.event.Total || time.Since(b.last) >= eventInterval {
+		b.last = time.Now()
+		events.Emit(b.event)
+	}
+	return b.bar.Add64(n)
+}
+
 // progressReader wraps an io.Reader to track progress with batched updates
 type progressReader struct {
 	reader           io.Reader
-	bar              *progressbar.ProgressBar
+	bar              progressAdder
 	size             int64
 	bytesSinceUpdate int64
 }
@@ -48,7 +177,7 @@ func (pr *progressReader) Flush() {
 // progressWriter wraps an io.Writer to update progress bar with batched updates
 type progressWriter struct {
 	writer           io.Writer
-	bar              *progressbar.ProgressBar
+	bar              progressAdder
 	ctx              context.Context
 	bytesSinceUpdate int64
 }
@@ -85,12 +214,12 @@ func (pw *progressWriter) Flush() {
 // Kept for backward compatibility with non-context version of cmdGet.
 type progressWriterFrom struct {
 	writer           io.Writer
-	bar              *progressbar.ProgressBar
+	bar              progressAdder
 	ctx              context.Context
 	bytesSinceUpdate int64
 }
 
-func newProgressWriterFrom(w io.Writer, bar *progressbar.ProgressBar) *progressWriterFrom {
+func newProgressWriterFrom(w io.Writer, bar progressAdder) *progressWriterFrom {
 	return &progressWriterFrom{
 		writer: w,
 		bar:    bar,
@@ -142,12 +271,12 @@ func (pwf *progressWriterFrom) ReadFrom(r io.Reader) (n int64, err error) {
 // Kept for backward compatibility with non-context version of cmdPut.
 type progressWriterTo struct {
 	reader           io.Reader
-	bar              *progressbar.ProgressBar
+	bar              progressAdder
 	size             int64
 	bytesSinceUpdate int64
 }
 
-func newProgressWriterTo(r io.Reader, bar *progressbar.ProgressBar, size int64) *progressWriterTo {
+func newProgressWriterTo(r io.Reader, bar progressAdder, size int64) *progressWriterTo {
 	return &progressWriterTo{
 		reader: r,
 		bar:    bar,
@@ -0,0 +1,210 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/scp"
+	"github.com/schollz/progressbar/v3"
+)
+
+// removeWorkers bounds concurrent Remove calls for rm --fast.
+const removeWorkers = 16
+
+// cmdRm removes remote files and directories.
+//
+//	rm <path>            remove a file
+//	rm -r <dir>          remove a tree serially
+//	rm -rf --fast <dir>  remove via `rm -rf` over exec when the server allows
+//	                     it, otherwise with a bounded pool of SFTP workers
+//
+// -f ignores paths that don't exist.
+func (s *Shell) cmdRm(ctx context.Context, rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs)
+	if len(parsed.args) == 0 {
+		return fmt.Errorf("usage: rm [-r] [-f] [--fast] [--] <path>...")
+	}
+	recursive := parsed.has("r", "R", "recursive")
+	force := parsed.has("f", "force")
+	fast := parsed.has("fast")
+
+	for _, arg := range parsed.args {
+		resolved, err := s.paths.ResolveRemote(arg)
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		if resolved == "/" || resolved == s.paths.HomeRemote {
+			return fmt.Errorf("refusing to remove %s", resolved)
+		}
+
+		fi, err := s.client.Lstat(resolved)
+		if err != nil {
+			if force && os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("stat: %w", err)
+		}
+
+		if !fi.IsDir() {
+			if err := s.client.Remove(resolved); err != nil {
+				return fmt.Errorf("remove %s: %w", resolved, err)
+			}
+			continue
+		}
+
+		if !recursive {
+			return fmt.Errorf("%s is a directory (use rm -r)", resolved)
+		}
+
+		switch {
+		case fast:
+			err = s.removeTreeFast(ctx, resolved)
+		default:
+			err = s.client.RemoveAll(resolved)
+		}
+		if err != nil {
+			return fmt.Errorf("remove %s: %w", resolved, err)
+		}
+		fmt.Fprintf(s.info, "Removed %s\n", resolved)
+	}
+
+	return nil
+}
+
+// removeTreeFast deletes a remote tree as quickly as the server permits.
+func (s *Shell) removeTreeFast(ctx context.Context, dir string) error {
+	if s.opts.SSHClient != nil {
+		if err := s.execRemote("rm -rf -- " + scp.Quote(dir)); err == nil {
+			return nil
+		}
+		// Exec may be forbidden (sftp-only accounts); fall back to SFTP
+	}
+	return s.removeTreeParallel(ctx, dir)
+}
+
+// execRemote runs a command in a new session on the underlying SSH client.
+func (s *Shell) execRemote(cmd string) error {
+	session, err := s.opts.SSHClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return session.Run(cmd)
+}
+
+// removeTreeParallel deletes files with a worker pool, then directories
+// deepest first, level by level.
+func (s *Shell) removeTreeParallel(ctx context.Context, dir string) error {
+	var files []string
+	dirsByDepth := map[int][]string{}
+	if err := s.collectTree(dir, 0, &files, dirsByDepth); err != nil {
+		return err
+	}
+
+	total := len(files)
+	for _, dirs := range dirsByDepth {
+		total += len(dirs)
+	}
+
+	bar := s.newBar(int64(total), fmt.Sprintf("Deleting %s", dir),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		barTheme(progressbar.ThemeDefault),
+	)
+	defer bar.Close()
+
+	if err := s.removeAllParallel(ctx, files, bar); err != nil {
+		return err
+	}
+
+	depths := make([]int, 0, len(dirsByDepth))
+	for d := range dirsByDepth {
+		depths = append(depths, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+	for _, d := range depths {
+		if err := s.removeAllParallel(ctx, dirsByDepth[d], bar); err != nil {
+			return err
+		}
+	}
+
+	bar.Close()
+	fmt.Fprintln(s.info)
+	return nil
+}
+
+// collectTree lists every file and directory under dir.
+func (s *Shell) collectTree(dir string, depth int, files *[]string, dirsByDepth map[int][]string) error {
+	dirsByDepth[depth] = append(dirsByDepth[depth], dir)
+
+	entries, err := s.client.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read dir %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		p := joinPath(dir, entry.Name())
+		if entry.IsDir() {
+			if err := s.collectTree(p, depth+1, files, dirsByDepth); err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, p)
+	}
+	return nil
+}
+
+// removeAllParallel removes paths with removeWorkers concurrent requests and
+// returns the first error.
+func (s *Shell) removeAllParallel(ctx context.Context, paths []string, bar progressBar) error {
+	jobs := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for w := 0; w < removeWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if err := s.client.Remove(p); err != nil && !os.IsNotExist(err) {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("remove %s: %w", p, err)
+					}
+					mu.Unlock()
+				}
+				bar.Add(1)
+			}
+		}()
+	}
+
+feed:
+	for _, p := range paths {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case jobs <- p:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return context.Canceled
+	}
+	return firstErr
+}
@@ -0,0 +1,250 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// syncFile is a file on one side of a sync.
+type syncFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// cmdSync brings a directory up to date with another, transferring only
+// the files that are new or changed, like rsync:
+//
+//	sync <local> <remote>      upload changes
+//	sync -r <remote> <local>   download changes
+//
+// Files differ when their size or modification time does; with
+// --checksum, when their size or SHA-256 does. Transferred files keep
+// their modification time so the next sync can compare it. --delete
+// removes destination files the source lacks, and -n (--dry-run) lists
+// what would change without changing anything.
+func (s *Shell) cmdSync(ctx context.Context, rawArgs []string) error {
+	parsed := parseCmdArgs(rawArgs, "parallel")
+	if len(parsed.args) != 2 {
+		return fmt.Errorf("usage: sync [-r] [-n] [-p] [--checksum] [--delete] [--parallel N|auto] [--] src-dir dst-dir")
+	}
+	parallel, err := s.parseParallel(parsed)
+	if err != nil {
+		return err
+	}
+	opts := transferOptions{
+		preserve: parsed.has("p", "preserve"),
+		times:    true,
+		parallel: parallel,
+	}
+	download := parsed.has("r", "reverse")
+
+	localArg, remoteArg := parsed.args[0], parsed.args[1]
+	if download {
+		localArg, remoteArg = remoteArg, localArg
+	}
+	localPath, err := s.paths.ResolveLocal(localArg)
+	if err != nil {
+		return fmt.Errorf("resolve local: %w", err)
+	}
+	remotePath, err := s.paths.ResolveRemote(remoteArg)
+	if err != nil {
+		return fmt.Errorf("resolve remote: %w", err)
+	}
+
+	local, localExists, err := s.syncLocalFiles(localPath)
+	if err != nil {
+		return err
+	}
+	remote, remoteExists, err := s.syncRemoteFiles(remotePath)
+	if err != nil {
+		return err
+	}
+	src, dst := local, remote
+	if download {
+		src, dst = remote, local
+		if !remoteExists {
+			return fmt.Errorf("%s does not exist", remotePath)
+		}
+	} else if !localExists {
+		return fmt.Errorf("%s does not exist", localPath)
+	}
+
+	// Files of the same size may still differ
+	var added, changed, candidates []string
+	for rel, f := range src {
+		d, ok := dst[rel]
+		switch {
+		case !ok:
+			added = append(added, rel)
+		case d.size != f.size:
+			changed = append(changed, rel)
+		case parsed.has("checksum"):
+			candidates = append(candidates, rel)
+		// SFTP times are whole seconds
+		case d.modTime.Unix() != f.modTime.Unix():
+			changed = append(changed, rel)
+		}
+	}
+	if len(candidates) > 0 {
+		same, err := s.sameContent(ctx, localPath, remotePath, candidates)
+		if err != nil {
+			return err
+		}
+		for _, rel := range candidates {
+			if !same[rel] {
+				changed = append(changed, rel)
+			}
+		}
+	}
+	var deleted []string
+	if parsed.has("delete") {
+		for rel := range dst {
+			if _, ok := src[rel]; !ok {
+				deleted = append(deleted, rel)
+			}
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(deleted)
+
+	target := remotePath
+	if download {
+		target = localPath
+	}
+	if len(added)+len(changed)+len(deleted) == 0 {
+		fmt.Fprintf(s.info, "Nothing to sync: %s is up to date\n", target)
+		return nil
+	}
+
+	if parsed.has("n", "dry-run") {
+		for _, rel := range added {
+			fmt.Fprintf(s.stdout, "+ %s\n", displayName(rel))
+		}
+		for _, rel := range changed {
+			fmt.Fprintf(s.stdout, "~ %s\n", displayName(rel))
+		}
+		for _, rel := range deleted {
+			fmt.Fprintf(s.stdout, "- %s\n", displayName(rel))
+		}
+		fmt.Fprintf(s.stdout, "Dry run: %d new, %d changed, %d to delete in %s\n", len(added), len(changed), len(deleted), target)
+		return nil
+	}
+
+	transfer := append(added, changed...)
+	sort.Strings(transfer)
+	if len(transfer) > 0 {
+		var totalSize int64
+		for _, rel := range transfer {
+			totalSize += src[rel].size
+		}
+		if download {
+			files := make([]remoteFileInfo, len(transfer))
+			for i, rel := range transfer {
+				files[i] = remoteFileInfo{RelPath: rel, Size: src[rel].size}
+			}
+			err = s.downloadFiles(ctx, remotePath, remotePath, localPath, files, totalSize, opts)
+		} else {
+			if !remoteExists {
+				if err := s.client.MkdirAll(remotePath); err != nil {
+					return fmt.Errorf("create remote directory '%s': %w", remotePath, err)
+				}
+			}
+			files := make([]localFileInfo, len(transfer))
+			for i, rel := range transfer {
+				files[i] = localFileInfo{RelPath: filepath.FromSlash(rel), Size: src[rel].size}
+			}
+			err = s.uploadFiles(ctx, localPath, localPath, remotePath, files, totalSize, remoteExists, opts)
+		}
+		// Leave the destination's extra files alone until it has the rest
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.syncDelete(ctx, download, localPath, remotePath, deleted)
+}
+
+// syncLocalFiles returns the files under dir by slash-separated relative
+// path, and whether dir exists.
+func (s *Shell) syncLocalFiles(dir string) (map[string]syncFile, bool, error) {
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("stat local: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, false, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	list, _, err := s.getLocalFileList(dir, false)
+	if err != nil {
+		return nil, false, fmt.Errorf("scan local directory: %w", err)
+	}
+	files := make(map[string]syncFile, len(list))
+	for _, f := range list {
+		files[filepath.ToSlash(f.RelPath)] = syncFile{f.Size, f.ModTime}
+	}
+	return files, true, nil
+}
+
+// syncRemoteFiles is syncLocalFiles for a remote directory.
+func (s *Shell) syncRemoteFiles(dir string) (map[string]syncFile, bool, error) {
+	fi, err := s.client.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("stat remote: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, false, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	list, _, err := s.getRemoteFileList(dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("scan remote directory: %w", err)
+	}
+	files := make(map[string]syncFile, len(list))
+	for _, f := range list {
+		files[f.RelPath] = syncFile{f.Size, f.ModTime}
+	}
+	return files, true, nil
+}
+
+// syncDelete removes the destination files sync --delete found missing
+// from the source. Directories are left in place.
+func (s *Shell) syncDelete(ctx context.Context, download bool, localPath, remotePath string, rels []string) error {
+	if len(rels) == 0 {
+		return nil
+	}
+
+	failed := 0
+	for _, rel := range rels {
+		if ctx.Err() != nil {
+			return context.Canceled
+		}
+		var err error
+		if download {
+			err = os.Remove(filepath.Join(localPath, filepath.FromSlash(rel)))
+		} else {
+			err = s.client.Remove(joinPath(remotePath, rel))
+		}
+		if err != nil {
+			fmt.Fprintf(s.stderr, "Warning: failed to delete %s: %v\n", displayName(rel), err)
+			failed++
+		}
+	}
+
+	fmt.Fprintf(s.info, "Deleted %d files\n", len(rels)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to delete", failed)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time styles for ls --time-style.
+const (
+	timeStyleLocale  = "locale"   // "Jan 02 15:04", or the year for old files (default)
+	timeStyleISO     = "iso"      // "2006-01-02 15:04"
+	timeStyleFullISO = "full-iso" // "2006-01-02 15:04:05 -0700"
+)
+
+// recentAge is how old a file can be for the listing to show its time of
+// day rather than its year, six months like ls.
+const recentAge = 182 * 24 * time.Hour
+
+// parseTimeStyle returns the --time-style of ls and lls.
+func parseTimeStyle(parsed cmdArgs) (string, error) {
+	if !parsed.has("time-style") {
+		return timeStyleLocale, nil
+	}
+	switch style := parsed.value("time-style"); style {
+	case timeStyleLocale, timeStyleISO, timeStyleFullISO:
+		return style, nil
+	}
+	return "", fmt.Errorf("--time-style must be %s, %s or %s", timeStyleLocale, timeStyleISO, timeStyleFullISO)
+}
+
+// formatModTime formats a listing's modification time in style. The
+// locale style shows the year instead of the time for files older than
+// six months or in the future, as ls does.
+func formatModTime(t, now time.Time, style string) string {
+	switch style {
+	case timeStyleISO:
+		return t.Format("2006-01-02 15:04")
+	case timeStyleFullISO:
+		return t.Format("2006-01-02 15:04:05 -0700")
+	}
+
+	month := localMonths()[t.Month()-1]
+	if age := now.Sub(t); age < 0 || age > recentAge {
+		return fmt.Sprintf("%s %02d  %d", month, t.Day(), t.Year())
+	}
+	return fmt.Sprintf("%s %02d %s", month, t.Day(), t.Format("15:04"))
+}
+
+// monthNames are abbreviated month names by language, for the languages
+// whose listings don't use English ones.
+var monthNames = map[string][12]string{
+	"zh": {"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+	"ja": {"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+	"ko": {"1월", "2월", "3월", "4월", "5월", "6월", "7월", "8월", "9월", "10월", "11월", "12월"},
+	"de": {"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+	"fr": {"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"},
+	"es": {"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+	"it": {"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+	"pt": {"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+	"ru": {"янв", "фев", "мар", "апр", "май", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"},
+}
+
+// localMonths returns the month names for the language of LC_ALL,
+// LC_TIME or LANG, English when it has none of its own.
+var localMonths = sync.OnceValue(func() [12]string {
+	english := [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		// "zh_CN.UTF-8" is Chinese
+		lang, _, _ := strings.Cut(locale, "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		if months, ok := monthNames[strings.ToLower(lang)]; ok {
+			return months
+		}
+		return english
+	}
+	return english
+})
@@ -0,0 +1,154 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/pkg/sftp"
+)
+
+// DefaultTimeout bounds a metadata request when the host sets none.
+const DefaultTimeout = 30 * time.Second
+
+// errNotResponding is returned, wrapped, when a request outlives the
+// timeout; the connection is most likely gone.
+var errNotResponding = errors.New("server not responding")
+
+// remoteClient is the SFTP client with metadata requests (stat, listing,
+// mkdir, remove...) bounded by a timeout, so a broken connection fails the
+// command instead of freezing the shell. File reads and writes are not
+// bounded; transfers are cancelled with Ctrl+C.
+type remoteClient struct {
+	*sftp.Client
+	timeout time.Duration
+}
+
+// bounded runs call on the client, giving up after c.timeout. The request
+// is left to finish, or fail, in the background.
+func bounded[T any](c *remoteClient, call func(*sftp.Client) (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	client := c.Client // Reconnecting replaces it
+	done := make(chan result, 1)
+	go func() {
+		v, err := call(client)
+		done <- result{v, err}
+	}()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-timer.C:
+		var zero T
+		return zero, fmt.Errorf("%w after %s", errNotResponding, c.timeout)
+	}
+}
+
+// boundedErr is bounded for requests that only return an error.
+func boundedErr(c *remoteClient, call func(*sftp.Client) error) error {
+	_, err := bounded(c, func(client *sftp.Client) (struct{}, error) {
+		return struct{}{}, call(client)
+	})
+	return err
+}
+
+func (c *remoteClient) Stat(p string) (os.FileInfo, error) {
+	return bounded(c, func(client *sftp.Client) (os.FileInfo, error) { return client.Stat(p) })
+}
+
+func (c *remoteClient) Lstat(p string) (os.FileInfo, error) {
+	return bounded(c, func(client *sftp.Client) (os.FileInfo, error) { return client.Lstat(p) })
+}
+
+func (c *remoteClient) ReadDir(p string) ([]os.FileInfo, error) {
+	return bounded(c, func(client *sftp.Client) ([]os.FileInfo, error) { return client.ReadDir(p) })
+}
+
+func (c *remoteClient) RealPath(p string) (string, error) {
+	return bounded(c, func(client *sftp.Client) (string, error) { return client.RealPath(p) })
+}
+
+func (c *remoteClient) Getwd() (string, error) {
+	return bounded(c, (*sftp.Client).Getwd)
+}
+
+func (c *remoteClient) StatVFS(p string) (*sftp.StatVFS, error) {
+	return bounded(c, func(client *sftp.Client) (*sftp.StatVFS, error) { return client.StatVFS(p) })
+}
+
+func (c *remoteClient) Mkdir(p string) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Mkdir(p) })
+}
+
+func (c *remoteClient) MkdirAll(p string) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.MkdirAll(p) })
+}
+
+func (c *remoteClient) Remove(p string) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Remove(p) })
+}
+
+func (c *remoteClient) Symlink(oldname, newname string) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Symlink(oldname, newname) })
+}
+
+func (c *remoteClient) Link(oldname, newname string) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Link(oldname, newname) })
+}
+
+func (c *remoteClient) Chmod(p string, mode os.FileMode) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Chmod(p, mode) })
+}
+
+func (c *remoteClient) Chown(p string, uid, gid int) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Chown(p, uid, gid) })
+}
+
+func (c *remoteClient) Chtimes(p string, atime, mtime time.Time) error {
+	return boundedErr(c, func(client *sftp.Client) error { return client.Chtimes(p, atime, mtime) })
+}
+
+// offerReconnect asks whether to replace a connection that stopped
+// responding, when the shell has a way to make a new one. The working
+// directories are kept.
+func (s *Shell) offerReconnect(editor *terminal.LineEditor) {
+	if s.opts.Reconnect == nil {
+		return
+	}
+	answer, err := editor.ReadLine("Server not responding. Reconnect? [y/N] ")
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		return
+	}
+
+	sshClient, err := s.opts.Reconnect()
+	if err != nil {
+		fmt.Fprintf(s.stderr, "Error: reconnect: %v\n", err)
+		return
+	}
+	client, err := NewClient(sshClient, s.opts.ServerPath)
+	if err != nil {
+		sshClient.Close()
+		fmt.Fprintf(s.stderr, "Error: reconnect: %v\n", err)
+		return
+	}
+
+	// Closing the old client can block on the dead connection
+	go s.client.Client.Close()
+	s.client.Client = client
+	s.opts.SSHClient = sshClient
+	s.caps = detectCaps(client)
+	fmt.Fprintf(s.info, "Reconnected.\n")
+}
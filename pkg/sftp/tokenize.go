@@ -0,0 +1,82 @@
+package sftp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitLine splits a command line into words the way a POSIX shell does,
+// without any expansion: blanks separate words, '...' keeps its content
+// as is, "..." too except that \" and \\ stand for " and \, and outside
+// quotes a backslash makes the next character literal. So
+//
+//	get "My Documents/report 1.pdf" 'a b'
+//
+// has the words get, My Documents/report 1.pdf and a b. Everything that
+// matters is ASCII, so the line is read byte by byte and names that are not
+// valid UTF-8 pass through unchanged.
+func splitLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool // A word has started, if only with ""
+		quote   byte // The open quote, 0 outside quotes
+		escaped bool // The previous character was a backslash
+	)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case escaped:
+			// Inside "..." a backslash only escapes " and itself
+			if quote == '"' && c != '"' && c != '\\' {
+				word.WriteByte('\\')
+			}
+			word.WriteByte(c)
+			escaped = false
+
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+
+		case c == '\\':
+			escaped = true
+			inWord = true
+
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	case escaped:
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,135 @@
+package sftp
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"   \t ", nil, false},
+		{"ls", []string{"ls"}, false},
+		{"  get  a   b ", []string{"get", "a", "b"}, false},
+		{"get\ta\tb", []string{"get", "a", "b"}, false},
+		{`get "My Documents/a b.pdf"`, []string{"get", "My Documents/a b.pdf"}, false},
+		{`get 'a b' c`, []string{"get", "a b", "c"}, false},
+		{`get a\ b`, []string{"get", "a b"}, false},
+		{`get "" x`, []string{"get", "", "x"}, false},
+		{`get ''`, []string{"get", ""}, false},
+		{`get a"b c"d`, []string{"get", "ab cd"}, false},
+		{`get 'it'\''s'`, []string{"get", "it's"}, false},
+		{`get "say \"hi\""`, []string{"get", `say "hi"`}, false},
+		{`get "a\\b"`, []string{"get", `a\b`}, false},
+		{`get "a\nb"`, []string{"get", `a\nb`}, false},
+		{`get 'a\b'`, []string{"get", `a\b`}, false},
+		{"get caf\xe9", []string{"get", "caf\xe9"}, false},
+		{`get \\`, []string{"get", `\`}, false},
+		{`alias ll="ls -l"`, []string{"alias", "ll=ls -l"}, false},
+		{`get "a`, nil, true},
+		{`get 'a`, nil, true},
+		{`get a\`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// quoteWord quotes word for splitLine to read back as is.
+func quoteWord(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+func FuzzSplitLine(f *testing.F) {
+	for _, seed := range []string{
+		"", "ls -l", `get "a b" c`, `put 'x y' "z\"w"`, `a\ b`, `"unterminated`,
+		`'it'\''s'`, "\t\x00\xff", `alias ll="ls -l"`, `\`, `""''`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		words, err := splitLine(line)
+		if err != nil {
+			return
+		}
+		// Quoting the words and splitting again gives them back
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = quoteWord(w)
+		}
+		again, err := splitLine(strings.Join(quoted, " "))
+		if err != nil {
+			t.Fatalf("splitLine of requoted %q: %v", words, err)
+		}
+		if !slices.Equal(again, words) {
+			t.Fatalf("requoted %q split to %q", words, again)
+		}
+		// Words without quotes or escapes are the line's fields
+		if !strings.ContainsAny(line, `'"\`) && !slices.Equal(words, strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' })) {
+			t.Fatalf("splitLine(%q) = %q, want its fields", line, words)
+		}
+	})
+}
+
+func TestParseCmdArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		flags map[string]string
+		want  []string
+	}{
+		{[]string{"a", "b"}, map[string]string{}, []string{"a", "b"}},
+		{[]string{"-rf", "x"}, map[string]string{"r": "", "f": ""}, []string{"x"}},
+		{[]string{"--parallel", "4", "a"}, map[string]string{"parallel": "4"}, []string{"a"}},
+		{[]string{"--parallel=auto", "a"}, map[string]string{"parallel": "auto"}, []string{"a"}},
+		{[]string{"-", "a"}, map[string]string{}, []string{"-", "a"}},
+		{[]string{"-r", "--", "-old.log", "--fast"}, map[string]string{"r": ""}, []string{"-old.log", "--fast"}},
+		{[]string{"--", "--"}, map[string]string{}, []string{"--"}},
+		{[]string{"-old.log"}, map[string]string{"o": "", "l": "", "d": "", ".": "", "g": ""}, nil},
+	}
+	for _, tt := range tests {
+		parsed := parseCmdArgs(tt.args, "parallel")
+		if !maps.Equal(parsed.flags, tt.flags) || !slices.Equal(parsed.args, tt.want) {
+			t.Errorf("parseCmdArgs(%q) = %v %q, want %v %q", tt.args, parsed.flags, parsed.args, tt.flags, tt.want)
+		}
+	}
+}
+
+func FuzzParseCmdArgs(f *testing.F) {
+	for _, seed := range []string{
+		"get -p --parallel 4 a b", "put --parallel=auto -- -a", "-rf x", "--", "- -- --x=",
+		"sync -r -n --delete a b", "--parallel",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		words, err := splitLine(line)
+		if err != nil {
+			return
+		}
+		parsed := parseCmdArgs(words, "parallel")
+		// Every positional argument is a word of the line, in order
+		i := 0
+		for _, arg := range parsed.args {
+			for i < len(words) && words[i] != arg {
+				i++
+			}
+			if i == len(words) {
+				t.Fatalf("parseCmdArgs(%q) invented argument %q", words, arg)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package sftp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+// autoParallel is the --parallel value that lets the transfer pick its
+// worker count.
+const autoParallel = 0
+
+// defaultAutoParallel is where auto-tuning starts for a host it has not
+// tuned before.
+const defaultAutoParallel = 4
+
+// tuneInterval is how long each worker count is measured before comparing
+// it with the last.
+const tuneInterval = 2 * time.Second
+
+// workerLimit gates a pool of workers: only those below the limit take
+// files, so the tuner can change the count while files are in flight.
+type workerLimit struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+}
+
+func newWorkerLimit(limit int) *workerLimit {
+	l := &workerLimit{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// wait blocks until slot is below the limit.
+func (l *workerLimit) wait(slot int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for slot >= l.limit {
+		l.cond.Wait()
+	}
+}
+
+func (l *workerLimit) get() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *workerLimit) set(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// tuner adjusts a transfer's worker count as it runs. Every tuneInterval
+// it measures progress, counting files and bytes alike so that many small
+// files (latency bound) and a few large ones (bandwidth bound) both
+// register, and doubles the count while that pays off by 10% or more.
+// When the first doubling doesn't, it tries halving instead, keeping the
+// lower count while it does within 5% as well. Each change and the count
+// settled on are logged.
+type tuner struct {
+	s       *Shell
+	display *multiProgress
+	limit   *workerLimit
+	start   int // Count the transfer started with
+	pool    int // Workers started; the count never exceeds it
+
+	best      int     // Count to settle on so far; 0 before measuring
+	bestScore float64 // What best scored
+	down      bool    // Halving rather than doubling
+	settled   bool
+
+	lastFiles int // Progress at the end of the last interval
+	lastBytes int64
+
+	mu      sync.Mutex
+	elapsed time.Duration // Time spent on completed files
+}
+
+// fileDone adds a completed file's transfer time to the per-file latency.
+func (t *tuner) fileDone(d time.Duration) {
+	t.mu.Lock()
+	t.elapsed += d
+	t.mu.Unlock()
+}
+
+// run measures and tunes until done is closed.
+func (t *tuner) run(done <-chan struct{}) {
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+	for !t.settled {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			t.step()
+		}
+	}
+}
+
+// step measures the last interval and picks the count for the next.
+func (t *tuner) step() {
+	files, bytes, totalFiles, totalBytes := t.display.counts()
+	n := t.limit.get()
+
+	// Fraction of the files plus fraction of the bytes done this interval
+	score := float64(files-t.lastFiles) / float64(totalFiles)
+	if totalBytes > 0 {
+		score += float64(bytes-t.lastBytes) / float64(totalBytes)
+	}
+	stats := t.stats(files-t.lastFiles, bytes-t.lastBytes, files)
+	t.lastFiles, t.lastBytes = files, bytes
+
+	// The last few files can't keep more workers busy; measuring them
+	// would favor fewer
+	if totalFiles-files <= n*2 {
+		if t.best == 0 || t.bestScore <= score {
+			t.best = n
+		}
+		t.settle(stats)
+		return
+	}
+
+	switch {
+	case t.best == 0:
+		t.best, t.bestScore = n, score
+		if n < t.pool {
+			t.try(n, min(n*2, t.pool), stats)
+		} else {
+			t.down = true
+			t.try(n, n/2, stats)
+		}
+	case !t.down && score >= t.bestScore*1.10:
+		t.best, t.bestScore = n, score
+		t.try(n, min(n*2, t.pool), stats)
+	case !t.down && t.best == t.start:
+		// Doubling didn't pay off; see whether fewer do as well
+		t.down = true
+		t.try(n, t.start/2, stats)
+	case t.down && score >= t.bestScore*0.95:
+		t.best, t.bestScore = n, max(t.bestScore, score)
+		t.try(n, n/2, stats)
+	default:
+		t.settle(stats)
+	}
+}
+
+// try moves from count n to next, settling instead when next isn't a
+// count left to try.
+func (t *tuner) try(n, next int, stats string) {
+	if next < 1 || next == n {
+		t.settle(stats)
+		return
+	}
+	t.log(fmt.Sprintf("parallel: %d -> %d workers (%s)", n, next, stats))
+	t.limit.set(next)
+	t.display.setWorkers(next)
+}
+
+// settle fixes the count at the best measured for the rest of the
+// transfer.
+func (t *tuner) settle(stats string) {
+	t.settled = true
+	t.limit.set(t.best)
+	t.display.setWorkers(t.best)
+	t.log(fmt.Sprintf("parallel: settled on %d workers (%s)", t.best, stats))
+}
+
+// stats describes an interval in which files files and bytes bytes
+// completed; done is the files completed so far.
+func (t *tuner) stats(files int, bytes int64, done int) string {
+	secs := tuneInterval.Seconds()
+	line := fmt.Sprintf("%.1f files/s, %s/s", float64(files)/secs, formatBytes(int64(float64(bytes)/secs)))
+	t.mu.Lock()
+	elapsed := t.elapsed
+	t.mu.Unlock()
+	if done > 0 {
+		line += fmt.Sprintf(", %s per file", (elapsed / time.Duration(done)).Round(time.Millisecond))
+	}
+	return line
+}
+
+func (t *tuner) log(line string) {
+	t.display.log(t.s.info, line)
+}
+
+// autoStart returns the worker count auto-tuning starts from: the count it
+// settled on last time for this host, or defaultAutoParallel.
+func (s *Shell) autoStart() int {
+	if n, ok := loadTuned()[s.tuneKey()]; ok && n >= 1 && n <= maxParallel {
+		return n
+	}
+	return defaultAutoParallel
+}
+
+// rememberTuned keeps n as the count to start from next time. Like other
+// cached state it is best effort; write errors are dropped.
+func (s *Shell) rememberTuned(n int) {
+	_ = state.Update(tunedFile, func(data []byte) ([]byte, error) {
+		tuned := parseTuned(data)
+		tuned[s.tuneKey()] = n
+		return json.MarshalIndent(tuned, "", "  ")
+	})
+}
+
+// tuneKey identifies the host: the link, not the files, decides the count.
+func (s *Shell) tuneKey() string {
+	return s.user + "@" + s.host
+}
+
+// tunedFile is where the counts are remembered in the state directory.
+const tunedFile = "parallel.json"
+
+// loadTuned reads the remembered counts, treating a missing or corrupt
+// file as empty.
+func loadTuned() map[string]int {
+	path, err := state.Path(tunedFile)
+	if err != nil {
+		return make(map[string]int)
+	}
+	data, _ := os.ReadFile(path)
+	return parseTuned(data)
+}
+
+func parseTuned(data []byte) map[string]int {
+	tuned := make(map[string]int)
+	_ = json.Unmarshal(data, &tuned)
+	return tuned
+}
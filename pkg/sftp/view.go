@@ -0,0 +1,93 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+)
+
+// cmdView downloads a remote file to a temporary directory and opens it with
+// the OS default application. Temp files are removed when the shell exits.
+func (s *Shell) cmdView(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: view <remote-file>")
+	}
+
+	remotePath, err := s.paths.ResolveRemote(args[0])
+	if err != nil {
+		return fmt.Errorf("resolve remote: %w", err)
+	}
+
+	fi, err := s.client.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("stat remote: %w", err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", remotePath)
+	}
+
+	// One subdirectory per view so equal names from different dirs don't clash
+	dir, err := s.viewDir()
+	if err != nil {
+		return err
+	}
+	viewDir, err := os.MkdirTemp(dir, "")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+
+	localPath := filepath.Join(viewDir, mangleName(path.Base(remotePath)))
+	if err := s.downloadSingleFile(ctx, remotePath, localPath, transferOptions{}); err != nil {
+		return err
+	}
+
+	if err := openWithDefaultApp(localPath); err != nil {
+		return fmt.Errorf("open %s: %w", localPath, err)
+	}
+	return nil
+}
+
+// viewDir returns the shell's temp directory, creating it on first use.
+func (s *Shell) viewDir() (string, error) {
+	if s.tempDir == "" {
+		dir, err := os.MkdirTemp("", "sshm-view-")
+		if err != nil {
+			return "", fmt.Errorf("create temp dir: %w", err)
+		}
+		s.tempDir = dir
+	}
+	return s.tempDir, nil
+}
+
+// cleanupViews removes files downloaded by view.
+func (s *Shell) cleanupViews() {
+	if s.tempDir != "" {
+		os.RemoveAll(s.tempDir)
+		s.tempDir = ""
+	}
+}
+
+// openWithDefaultApp opens a local file with the OS default handler without
+// waiting for the application to exit.
+func openWithDefaultApp(file string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", file)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", file)
+	default:
+		cmd = exec.Command("xdg-open", file)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the launcher in the background
+	go cmd.Wait()
+	return nil
+}
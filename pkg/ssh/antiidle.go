@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultAntiIdleInterval is used when anti-idle is switched on from the
+// escape menu for a host that doesn't configure an interval.
+const DefaultAntiIdleInterval = 60 * time.Second
+
+// AntiIdle keeps an interactive session from looking idle to bastions that
+// kill sessions without traffic.
+//
+// It sits between local stdin and the remote stdin pipe: every write from the
+// user counts as activity, and when nothing was typed for a full interval it
+// either writes the configured no-op string or sends an SSH keepalive request.
+type AntiIdle struct {
+	mu           sync.Mutex
+	client       *ssh.Client
+	stdin        io.Writer
+	payload      []byte
+	interval     time.Duration
+	enabled      bool
+	lastActivity time.Time
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewAntiIdle creates an anti-idle keeper for a session.
+// seconds <= 0 creates it disabled; it can still be toggled on later.
+func NewAntiIdle(client *ssh.Client, stdin io.Writer, seconds int, payload string) *AntiIdle {
+	a := &AntiIdle{
+		client:       client,
+		stdin:        stdin,
+		payload:      []byte(payload),
+		interval:     DefaultAntiIdleInterval,
+		lastActivity: time.Now(),
+	}
+	if seconds > 0 {
+		a.interval = time.Duration(seconds) * time.Second
+		a.enabled = true
+	}
+	return a
+}
+
+// Write forwards user input to the remote stdin and records activity.
+func (a *AntiIdle) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	a.lastActivity = time.Now()
+	a.mu.Unlock()
+	return a.stdin.Write(p)
+}
+
+// Start begins the background ticker. Call Stop when the session ends.
+func (a *AntiIdle) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+
+	a.wg.Add(1)
+	go a.loop(a.stop, a.interval)
+}
+
+// Stop stops the background ticker and waits for it to exit.
+func (a *AntiIdle) Stop() {
+	a.mu.Lock()
+	stop := a.stop
+	a.stop = nil
+	a.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		a.wg.Wait()
+	}
+}
+
+// Toggle flips anti-idle on or off and returns the new state.
+func (a *AntiIdle) Toggle() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enabled = !a.enabled
+	a.lastActivity = time.Now()
+	return a.enabled
+}
+
+// Enabled reports whether anti-idle traffic is currently being sent.
+func (a *AntiIdle) Enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enabled
+}
+
+// Interval returns the idle interval after which traffic is sent.
+func (a *AntiIdle) Interval() time.Duration {
+	return a.interval
+}
+
+// loop checks for idleness a few times per interval so that the first no-op
+// goes out close to interval after the last keystroke.
+func (a *AntiIdle) loop(stop <-chan struct{}, interval time.Duration) {
+	defer a.wg.Done()
+
+	tick := interval / 4
+	if tick < time.Second {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			a.mu.Lock()
+			idle := a.enabled && now.Sub(a.lastActivity) >= interval
+			if idle {
+				a.lastActivity = now
+			}
+			a.mu.Unlock()
+
+			if idle {
+				a.ping()
+			}
+		}
+	}
+}
+
+// ping sends one round of anti-idle traffic.
+func (a *AntiIdle) ping() {
+	if len(a.payload) > 0 {
+		_, _ = a.stdin.Write(a.payload)
+		return
+	}
+	if a.client != nil {
+		// Reply is requested so the server actually processes it, but we don't
+		// wait on the result: a dead link must not block the ticker.
+		go func() {
+			_, _, _ = a.client.SendRequest("keepalive@openssh.com", true, nil)
+		}()
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/ai-help-me/sshm/pkg/secrets"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
 	"net"
 )
 
@@ -23,13 +28,14 @@ var defaultKeyPaths = []string{
 }
 
 // AuthMethods returns authentication methods for a host configuration.
-// Priority: key auth > password auth > ssh agent.
+// Priority: key auth > ssh agent. Password and keyboard-interactive
+// methods are appended by the dialer, since they may prompt.
 func AuthMethods(host *HostConfig) ([]ssh.AuthMethod, error) {
 	var methods []ssh.AuthMethod
 
 	// Try key authentication first (explicit keypath)
 	if host.KeyPath != "" {
-		keyAuth, err := keyAuthMethod(host.KeyPath)
+		keyAuth, err := keyAuthMethod(host.KeyPath, host.KeyPassphrase)
 		if err == nil {
 			methods = append(methods, keyAuth)
 		} else {
@@ -39,7 +45,7 @@ func AuthMethods(host *HostConfig) ([]ssh.AuthMethod, error) {
 		// No explicit keypath, try default SSH keys
 		for _, keyPath := range defaultKeyPaths {
 			expandedPath := expandPath(keyPath)
-			keyAuth, err := keyAuthMethod(expandedPath)
+			keyAuth, err := keyAuthMethod(expandedPath, host.KeyPassphrase)
 			if err == nil {
 				methods = append(methods, keyAuth)
 				break // Use first valid key found
@@ -47,11 +53,6 @@ func AuthMethods(host *HostConfig) ([]ssh.AuthMethod, error) {
 		}
 	}
 
-	// Add password authentication
-	if host.Password != "" {
-		methods = append(methods, ssh.Password(host.Password))
-	}
-
 	// Try SSH agent as fallback
 	if agentAuth := trySSHAgent(); agentAuth != nil {
 		methods = append(methods, agentAuth)
@@ -62,12 +63,12 @@ func AuthMethods(host *HostConfig) ([]ssh.AuthMethod, error) {
 
 // AuthMethodsFromConfig creates authentication methods from individual config values.
 // Also tries default keys and SSH agent if no explicit key provided.
-func AuthMethodsFromConfig(keyPath, password string) ([]ssh.AuthMethod, error) {
+func AuthMethodsFromConfig(keyPath, keyPassphrase string) ([]ssh.AuthMethod, error) {
 	var methods []ssh.AuthMethod
 
 	// Try key authentication first (explicit keypath)
 	if keyPath != "" {
-		keyAuth, err := keyAuthMethod(keyPath)
+		keyAuth, err := keyAuthMethod(keyPath, keyPassphrase)
 		if err == nil {
 			methods = append(methods, keyAuth)
 		}
@@ -75,7 +76,7 @@ func AuthMethodsFromConfig(keyPath, password string) ([]ssh.AuthMethod, error) {
 		// No explicit keypath, try default SSH keys
 		for _, defaultPath := range defaultKeyPaths {
 			expandedPath := expandPath(defaultPath)
-			keyAuth, err := keyAuthMethod(expandedPath)
+			keyAuth, err := keyAuthMethod(expandedPath, keyPassphrase)
 			if err == nil {
 				methods = append(methods, keyAuth)
 				break // Use first valid key found
@@ -83,11 +84,6 @@ func AuthMethodsFromConfig(keyPath, password string) ([]ssh.AuthMethod, error) {
 		}
 	}
 
-	// Add password authentication
-	if password != "" {
-		methods = append(methods, ssh.Password(password))
-	}
-
 	// Try SSH agent as fallback
 	if agentAuth := trySSHAgent(); agentAuth != nil {
 		methods = append(methods, agentAuth)
@@ -96,8 +92,134 @@ func AuthMethodsFromConfig(keyPath, password string) ([]ssh.AuthMethod, error) {
 	return methods, nil
 }
 
-// keyAuthMethod creates an SSH auth method from a private key file.
-func keyAuthMethod(keyPath string) (ssh.AuthMethod, error) {
+// Prompter asks the user one keyboard-interactive question. echo is false
+// for secrets such as passwords and one-time codes.
+type Prompter func(question string, echo bool) (string, error)
+
+// prompter shows keyboard-interactive challenges; nil when there is no
+// terminal to ask on (e.g. the tunnel daemon).
+var prompter Prompter
+
+// SetPrompter sets how keyboard-interactive challenges are put to the
+// user. Callers pass terminal.Manager.Prompt so prompts appear in cooked
+// mode before the shell starts.
+func SetPrompter(p Prompter) {
+	prompter = p
+}
+
+// passwordPrompts is how many times the user is asked for a password
+// after the stored one, if any, is rejected.
+const passwordPrompts = 3
+
+// revealPassword decrypts a password encrypted in the config, asking for
+// the master passphrase when interactive.
+func revealPassword(password string, interactive bool) (string, error) {
+	var ask func() (string, error)
+	if interactive && prompter != nil && term.IsTerminal(int(os.Stdin.Fd())) {
+		ask = func() (string, error) {
+			promptMu.Lock()
+			defer promptMu.Unlock()
+			return prompter("Config passphrase: ", false)
+		}
+	}
+	return secrets.Reveal(password, ask)
+}
+
+// labeled prefixes a prompt with label, the hop of a jump chain it is
+// asked for, so a bastion's questions can be told from the target's. A
+// direct connection has no label.
+func labeled(label, prompt string) string {
+	if label == "" {
+		return prompt
+	}
+	return "[" + label + "] " + prompt
+}
+
+// passwordAuth tries the stored password, then asks for one up to
+// passwordPrompts times when interactive. It runs after the key and agent
+// methods, so hosts without any stored credentials still get a prompt.
+// The last password typed is kept in *prompted so the caller can offer to
+// save it once the login succeeds. Prompts are labeled with label.
+func passwordAuth(label, user, host, password string, interactive bool, prompted *string) ssh.AuthMethod {
+	tries := passwordPrompts
+	if password != "" {
+		tries++
+	}
+	usedPassword := false
+	prompts := 0
+	return ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+		if password != "" && !usedPassword {
+			usedPassword = true
+			slog.Info("auth attempt", "method", "password", "source", "config")
+			return password, nil
+		}
+		if !interactive || prompter == nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", authError{err: errors.New("password authentication needs a terminal")}
+		}
+
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		if prompts > 0 {
+			fmt.Fprintln(os.Stderr, labeled(label, "Permission denied, please try again."))
+		}
+		prompts++
+		answer, err := prompter(labeled(label, fmt.Sprintf("%s@%s's password: ", user, host)), false)
+		if err != nil {
+			return "", authError{err: err}
+		}
+		slog.Info("auth attempt", "method", "password", "source", "prompt")
+		*prompted = answer
+		return answer, nil
+	}), tries)
+}
+
+// keyboardInteractive answers challenge-response authentication such as
+// PAM passwords and 2FA codes. A lone password question is answered once
+// from the config; anything else is asked through the prompter, unless
+// interactive is false. Reaching it means password authentication failed,
+// so *prompted is cleared. Prompts are labeled with label.
+func keyboardInteractive(label, password string, interactive bool, prompted *string) ssh.AuthMethod {
+	usedPassword := false
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		*prompted = ""
+		slog.Info("auth attempt", "method", "keyboard-interactive", "questions", len(questions))
+		answers := make([]string, len(questions))
+		if password != "" && !usedPassword && len(questions) == 1 && !echos[0] &&
+			strings.Contains(strings.ToLower(questions[0]), "password") {
+			usedPassword = true
+			answers[0] = password
+			return answers, nil
+		}
+
+		if !interactive || prompter == nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+			if len(questions) == 0 {
+				return answers, nil
+			}
+			return nil, authError{err: errors.New("keyboard-interactive authentication needs a terminal")}
+		}
+
+		promptMu.Lock()
+		defer promptMu.Unlock()
+
+		for _, text := range []string{name, instruction} {
+			if text != "" {
+				fmt.Fprintln(os.Stderr, labeled(label, text))
+			}
+		}
+		for i, q := range questions {
+			answer, err := prompter(labeled(label, q), echos[i])
+			if err != nil {
+				return nil, authError{err: err}
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	})
+}
+
+// keyAuthMethod creates an SSH auth method from a private key file,
+// decrypting it with passphrase when it is protected.
+func keyAuthMethod(keyPath, passphrase string) (ssh.AuthMethod, error) {
 	// Read key file
 	keyData, err := os.ReadFile(keyPath)
 	if err != nil {
@@ -115,7 +237,7 @@ func keyAuthMethod(keyPath string) (ssh.AuthMethod, error) {
 
 	// Try encrypted private key
 	if len(signers) == 0 {
-		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte{})
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(passphrase))
 		if err == nil {
 			signers = append(signers, signer)
 		}
@@ -136,7 +258,7 @@ func keyAuthMethod(keyPath string) (ssh.AuthMethod, error) {
 		return nil, fmt.Errorf("no valid key found in %s", keyPath)
 	}
 
-	return ssh.PublicKeys(signers[0]), nil
+	return loggedKeys(keyPath, signers[0]), nil
 }
 
 // expandPath expands ~ to home directory
@@ -169,7 +291,7 @@ func trySSHAgent() ssh.AuthMethod {
 		return nil
 	}
 
-	return ssh.PublicKeys(signers...)
+	return loggedKeys("agent", signers...)
 }
 
 // GenerateKey generates a new RSA key pair for testing.
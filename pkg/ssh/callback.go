@@ -0,0 +1,163 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+// CallbackExpectTimeout is how long a callback shell waits for its expect
+// pattern before the remaining commands are given up.
+const CallbackExpectTimeout = 30 * time.Second
+
+// maxCallbackOutput bounds the output kept for expect patterns to match.
+const maxCallbackOutput = 64 * 1024
+
+// CallbackShells types a host's callback-shells into its interactive
+// shell after login, like sshw: each command waits for its expect pattern
+// to show up in the output, if it has one, then for its delay.
+//
+// Output reaches it through Watch, and commands go to the remote stdin
+// alongside what the user types.
+type CallbackShells struct {
+	stdin    io.Writer
+	commands []*config.CallbackShell
+
+	mu      sync.Mutex
+	output  []byte        // Output since the last command was typed
+	changed chan struct{} // Signalled when output arrives
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCallbackShells creates the runner for commands, writing them to
+// stdin. With no commands, it does nothing.
+func NewCallbackShells(stdin io.Writer, commands []*config.CallbackShell) *CallbackShells {
+	return &CallbackShells{
+		stdin:    stdin,
+		commands: commands,
+		changed:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Watch returns w wrapped so the session output written to it can be
+// matched against expect patterns.
+func (c *CallbackShells) Watch(w io.Writer) io.Writer {
+	if len(c.commands) == 0 {
+		return w
+	}
+	return &callbackOutput{w: w, c: c}
+}
+
+// Start begins typing the commands in the background. Call Stop when the
+// session ends.
+func (c *CallbackShells) Start() {
+	if len(c.commands) == 0 {
+		return
+	}
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop abandons the commands not typed yet and waits for the runner.
+func (c *CallbackShells) Stop() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.wg.Wait()
+}
+
+func (c *CallbackShells) run() {
+	defer c.wg.Done()
+
+	for _, cs := range c.commands {
+		if cs.Expect != "" {
+			re, err := regexp.Compile(cs.Expect)
+			if err != nil {
+				c.warn("invalid expect %q: %v", cs.Expect, err)
+				return
+			}
+			if !c.expect(re) {
+				return
+			}
+		}
+		if cs.Delay > 0 {
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(time.Duration(cs.Delay)):
+			}
+		}
+
+		c.mu.Lock()
+		c.output = c.output[:0]
+		c.mu.Unlock()
+		if _, err := io.WriteString(c.stdin, cs.Cmd+"\n"); err != nil {
+			return
+		}
+	}
+}
+
+// expect waits for the output to match re. It gives up, with a warning,
+// after CallbackExpectTimeout.
+func (c *CallbackShells) expect(re *regexp.Regexp) bool {
+	timeout := time.NewTimer(CallbackExpectTimeout)
+	defer timeout.Stop()
+	for {
+		c.mu.Lock()
+		matched := re.Match(c.output)
+		c.mu.Unlock()
+		if matched {
+			return true
+		}
+
+		select {
+		case <-c.changed:
+		case <-c.stop:
+			return false
+		case <-timeout.C:
+			c.warn("%q did not appear within %s; remaining commands skipped", re, CallbackExpectTimeout)
+			return false
+		}
+	}
+}
+
+// warn reports a problem on the terminal, which is in raw mode.
+func (c *CallbackShells) warn(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "\r\n[sshm] callback-shells: "+format+"\r\n", args...)
+}
+
+// record keeps output for expect, dropping the oldest beyond the bound.
+func (c *CallbackShells) record(p []byte) {
+	c.mu.Lock()
+	c.output = append(c.output, p...)
+	if over := len(c.output) - maxCallbackOutput; over > 0 {
+		c.output = append(c.output[:0], c.output[over:]...)
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// callbackOutput passes session output through, recording it for expect.
+type callbackOutput struct {
+	w io.Writer
+	c *CallbackShells
+}
+
+func (o *callbackOutput) Write(p []byte) (int, error) {
+	o.c.record(p)
+	return o.w.Write(p)
+}
@@ -3,6 +3,7 @@ package ssh
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,16 +18,43 @@ type HostConfig struct {
 	Port     int
 	Password string
 	KeyPath  string
+	// KeyPassphrase unlocks an encrypted key; may be encrypted or a
+	// keychain reference like Password.
+	KeyPassphrase string
+	// HostKeyPolicy is the host's strict-host-key-checking setting.
+	HostKeyPolicy string
+	// Proxy is an http:// or socks5:// proxy to connect through.
+	Proxy string
+	// ProxyCommand is a command whose stdin and stdout are the connection,
+	// with %h, %p and %r still to be expanded.
+	ProxyCommand string
+	// DialHost is the address dialed in place of Host; Host is still used
+	// for host key checking.
+	DialHost string
+	// AliveInterval and AliveCountMax are the host's keepalive settings,
+	// see serverAlive.
+	AliveInterval time.Duration
+	AliveCountMax int
 }
 
 // NewHostConfig creates a HostConfig from a config.Host.
 func NewHostConfig(host *config.Host) *HostConfig {
+	aliveInterval, aliveCountMax := serverAlive(host)
 	return &HostConfig{
 		Host:     host.Host,
 		User:     host.User,
 		Port:     host.Port,
 		Password: host.Password,
 		KeyPath:  host.KeyPath,
+
+		KeyPassphrase: host.KeyPassphrase,
+
+		HostKeyPolicy: host.StrictHostKeyChecking,
+		Proxy:         host.Proxy,
+		ProxyCommand:  host.ProxyCommand,
+		DialHost:      host.DialHost(),
+		AliveInterval: aliveInterval,
+		AliveCountMax: aliveCountMax,
 	}
 }
 
@@ -39,6 +67,21 @@ type Client struct {
 	config   *HostConfig
 	jumpHost *config.Host
 	mu       sync.Mutex
+
+	// warm marks a background pre-dial, which must never prompt.
+	warm bool
+	// prompted is the password typed at the prompt, see PromptedPassword.
+	prompted string
+	// hostKey and version are the key and SSH version the server
+	// presented, see ProbeHost.
+	hostKey ssh.PublicKey
+	version string
+
+	// Connection health, see keepalive.go
+	stopWatch chan struct{} // stops the keepalive
+	lost      chan struct{} // closed when the connection drops
+	lostErr   error         // why, nil after a deliberate Close
+	closing   bool
 }
 
 // NewClient creates a new SSH client for the given host.
@@ -61,32 +104,64 @@ func (c *Client) Dial() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	authMethods, err := AuthMethods(c.config)
+	password, err := revealPassword(c.config.Password, !c.warm)
 	if err != nil {
-		return fmt.Errorf("get auth methods: %w", err)
+		return fmt.Errorf("read password: %w", markAuth(err, false))
+	}
+	revealed := *c.config
+	if revealed.KeyPassphrase, err = revealPassword(c.config.KeyPassphrase, !c.warm); err != nil {
+		return fmt.Errorf("read key passphrase: %w", markAuth(err, false))
 	}
+	authMethods, err := AuthMethods(&revealed)
+	if err != nil {
+		return fmt.Errorf("get auth methods: %w", markAuth(err, false))
+	}
+	c.prompted = ""
+	authMethods = append(authMethods,
+		passwordAuth("", c.config.User, c.config.Host, password, !c.warm, &c.prompted),
+		keyboardInteractive("", password, !c.warm, &c.prompted))
 
+	addr := net.JoinHostPort(c.config.Host, strconv.Itoa(c.config.Port))
 	sshConfig := &ssh.ClientConfig{
-		User:            c.config.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+		User:              c.config.User,
+		Auth:              authMethods,
+		HostKeyCallback:   recordHostKey(hostKeyCallback(c.config.HostKeyPolicy, !c.warm), &c.hostKey),
+		HostKeyAlgorithms: HostKeyAlgorithms(addr, c.config.HostKeyPolicy),
+		Timeout:           30 * time.Second,
 	}
 
-	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	dialAddr := addr
+	if c.config.DialHost != "" {
+		dialAddr = net.JoinHostPort(c.config.DialHost, strconv.Itoa(c.config.Port))
+	}
 
-	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	// The handshake gets addr, so known_hosts is checked for the name
+	var conn net.Conn
+	if c.config.ProxyCommand != "" {
+		host := c.config.Host
+		if c.config.DialHost != "" {
+			host = c.config.DialHost
+		}
+		var command string
+		if command, err = ExpandProxyCommand(c.config.ProxyCommand, host, c.config.Port, c.config.User); err == nil {
+			conn, err = dialProxyCommand(command)
+		}
+	} else {
+		conn, err = dialHop(nil, c.config.Proxy, dialAddr)
+	}
 	if err != nil {
-		return fmt.Errorf("dial %s: %w", addr, err)
+		return fmt.Errorf("dial %s: %w", dialAddr, err)
 	}
+	conn = &versionConn{Conn: conn, version: &c.version}
 
-	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	client, err := handshake(conn, addr, sshConfig)
 	if err != nil {
 		conn.Close()
-		return fmt.Errorf("ssh connection to %s: %w", addr, err)
+		return fmt.Errorf("ssh connection to %s: %w", addr, markAuth(err, true))
 	}
 
-	c.client = ssh.NewClient(sshConn, chans, reqs)
+	c.client = client
+	c.watch()
 	return nil
 }
 
@@ -104,7 +179,7 @@ func (c *Client) Session() (*ssh.Session, error) {
 		return nil, fmt.Errorf("not connected")
 	}
 
-	return c.client.NewSession()
+	return openSession(c.client)
 }
 
 // SFTPClient creates a new SFTP client.
@@ -119,8 +194,16 @@ func (c *Client) SFTPClient() (*ssh.Client, error) {
 	return c.client, nil
 }
 
-// GetSSHClient returns the underlying SSH client for SFTP operations.
-func (c *Client) GetSSHClient() *ssh.Client {
+// PromptedPassword returns the password the user typed to log in, or ""
+// when the login did not need one.
+func (c *Client) PromptedPassword() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prompted
+}
+
+// SSHClient returns the underlying SSH client for SFTP operations.
+func (c *Client) SSHClient() *ssh.Client {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return c.client
@@ -131,6 +214,11 @@ func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.stopWatch != nil {
+		c.closing = true
+		close(c.stopWatch)
+		c.stopWatch = nil
+	}
 	if c.client != nil {
 		return c.client.Close()
 	}
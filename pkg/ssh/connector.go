@@ -0,0 +1,30 @@
+package ssh
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connector is an established connection to a host, direct or through a
+// jump chain, that sessions are opened on.
+type Connector interface {
+	// Session opens a session on the host.
+	Session() (*ssh.Session, error)
+	// SSHClient returns the client of the host, or nil when closed.
+	SSHClient() *ssh.Client
+	// Broken reports why the connection dropped, waiting up to grace for
+	// it to be noticed, or nil if it is still up.
+	Broken(grace time.Duration) error
+	// Reconnect closes the connection and establishes it again.
+	Reconnect() error
+	// PromptedPassword returns the password typed to log in, if any.
+	PromptedPassword() string
+	// Close closes the connection.
+	Close() error
+}
+
+var (
+	_ Connector = (*Client)(nil)
+	_ Connector = (*JumpChain)(nil)
+)
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection details are logged through log/slog: the handshake, host
+// key and each authentication attempt at Info, channel opens and
+// keepalives at Debug. The main package decides where, if anywhere, they
+// go (-v and -vv).
+
+// handshake runs the SSH handshake for addr over conn and logs how it
+// went. On failure the caller still owns conn.
+func handshake(conn net.Conn, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	start := time.Now()
+	slog.Info("ssh handshake", "addr", addr, "user", cfg.User)
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		slog.Info("ssh handshake failed", "addr", addr, "elapsed", elapsed, "err", err)
+		return nil, err
+	}
+	slog.Info("ssh connected", "addr", addr, "server", string(sshConn.ServerVersion()), "elapsed", elapsed)
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// loggedKeys offers signers for public key authentication, logging the
+// attempt; source says where they come from (a key file, the agent).
+func loggedKeys(source string, signers ...ssh.Signer) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		for _, s := range signers {
+			slog.Info("auth attempt", "method", "publickey", "source", source,
+				"type", s.PublicKey().Type(), "fingerprint", ssh.FingerprintSHA256(s.PublicKey()))
+		}
+		return signers, nil
+	})
+}
+
+// openSession opens a session channel on client, logging it.
+func openSession(client *ssh.Client) (*ssh.Session, error) {
+	session, err := client.NewSession()
+	slog.Debug("channel open", "type", "session", "err", err)
+	return session, err
+}
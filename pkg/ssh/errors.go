@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authError marks an authentication failure without changing its message.
+type authError struct {
+	err error
+}
+
+func (e authError) Error() string { return e.err.Error() }
+func (e authError) Unwrap() error { return e.err }
+
+// markAuth wraps credential and handshake errors caused by authentication
+// so callers can tell them apart with IsAuthError. A server key that fails
+// verification counts as an authentication failure too.
+func markAuth(err error, handshake bool) error {
+	if err == nil {
+		return nil
+	}
+	// x/crypto reports a keyboard-interactive attempt the server rejects
+	// outright as an unexpected USERAUTH_FAILURE (51) when it is the last
+	// method left
+	if handshake && strings.Contains(err.Error(), "unexpected message type 51") {
+		return authError{err: fmt.Errorf("ssh: unable to authenticate: %w", err)}
+	}
+	var hostKeyErr *HostKeyError
+	// Handshake errors are only auth failures if the server rejected us
+	if handshake && !errors.As(err, &hostKeyErr) && !strings.Contains(err.Error(), "unable to authenticate") &&
+		!strings.Contains(err.Error(), "no supported methods remain") {
+		return err
+	}
+	return authError{err: err}
+}
+
+// IsAuthError reports whether err means the credentials could not be
+// loaded or were rejected by the server.
+func IsAuthError(err error) bool {
+	var ae authError
+	return errors.As(err, &ae)
+}
+
+// IsNetworkError reports whether err means the host could not be reached
+// or the connection dropped.
+func IsNetworkError(err error) bool {
+	if err == nil || IsAuthError(err) {
+		return false
+	}
+
+	var netErr net.Error
+	var openErr *ssh.OpenChannelError
+	var proxyErr *proxyCommandError
+	var lostErr *ConnectionLostError
+	switch {
+	case errors.As(err, &netErr), errors.As(err, &openErr), errors.As(err, &proxyErr), errors.As(err, &lostErr):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	}
+	return false
+}
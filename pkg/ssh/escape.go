@@ -0,0 +1,186 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEscapeChar is the OpenSSH-style escape character.
+const DefaultEscapeChar = '~'
+
+// escapeCommand is a single entry in the escape menu.
+type escapeCommand struct {
+	help    string
+	run     func()
+	discard bool // drop the input typed around it instead of sending it
+}
+
+// EscapeWriter forwards local keystrokes to the remote stdin and intercepts
+// OpenSSH-style escape sequences: the escape character typed at the start of
+// a line followed by a command key (e.g. "~?" for the menu).
+//
+// It only inspects the byte stream; it never touches terminal modes.
+// Messages are written to msg with CRLF line endings because the terminal
+// is in raw mode while a shell is running.
+type EscapeWriter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	msg         io.Writer
+	char        byte
+	commands    map[byte]escapeCommand
+	atLineStart bool
+	pending     bool
+}
+
+// NewEscapeWriter creates an escape filter in front of w.
+func NewEscapeWriter(w io.Writer, msg io.Writer) *EscapeWriter {
+	return &EscapeWriter{
+		w:           w,
+		msg:         msg,
+		char:        DefaultEscapeChar,
+		commands:    make(map[byte]escapeCommand),
+		atLineStart: true,
+	}
+}
+
+// SetChar changes the escape character; 0 turns escapes off, passing every
+// keystroke through.
+func (e *EscapeWriter) SetChar(c byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.char = c
+	e.pending = false
+}
+
+// Handle registers fn to run when the escape character is followed by key.
+func (e *EscapeWriter) Handle(key byte, help string, fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands[key] = escapeCommand{help: help, run: fn}
+}
+
+// HandleDiscard registers fn like Handle, for commands that give up on the
+// connection: fn runs before anything typed ahead of it is written, and
+// that input is dropped with the rest of the write, since sending it to a
+// dead connection may block.
+func (e *EscapeWriter) HandleDiscard(key byte, help string, fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands[key] = escapeCommand{help: help, run: fn, discard: true}
+}
+
+// Printf writes a status message on its own line.
+func (e *EscapeWriter) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(e.msg, "\r\n[sshm] "+format+"\r\n", args...)
+}
+
+// Write implements io.Writer.
+func (e *EscapeWriter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	out := make([]byte, 0, len(p))
+	var run []func() error
+
+loop:
+	for _, b := range p {
+		if e.pending {
+			e.pending = false
+			switch {
+			case b == e.char:
+				// Escape char typed twice sends it once.
+				out = append(out, b)
+				e.atLineStart = false
+			case b == '?':
+				run = append(run, e.flushThen(&out, e.printHelp))
+				e.atLineStart = true
+			default:
+				cmd, ok := e.commands[b]
+				switch {
+				case ok && cmd.discard:
+					run = []func() error{func() error { cmd.run(); return nil }}
+					out = out[:0]
+					e.atLineStart = true
+					break loop
+				case ok:
+					run = append(run, e.flushThen(&out, cmd.run))
+					e.atLineStart = true
+				default:
+					out = append(out, e.char, b)
+					e.atLineStart = b == '\r' || b == '\n'
+				}
+			}
+			continue
+		}
+
+		if e.atLineStart && b == e.char && e.char != 0 {
+			e.pending = true
+			continue
+		}
+
+		out = append(out, b)
+		e.atLineStart = b == '\r' || b == '\n'
+	}
+	e.mu.Unlock()
+
+	// Commands run outside the lock so they may call Printf or Handle.
+	for _, fn := range run {
+		if err := fn(); err != nil {
+			return len(p), err
+		}
+	}
+	if len(out) > 0 {
+		if _, err := e.w.Write(out); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// flushThen returns a step that writes the bytes collected so far and then
+// runs fn, keeping keystrokes typed before the escape in order.
+func (e *EscapeWriter) flushThen(out *[]byte, fn func()) func() error {
+	pending := *out
+	*out = make([]byte, 0, cap(pending))
+	return func() error {
+		if len(pending) > 0 {
+			if _, err := e.w.Write(pending); err != nil {
+				return err
+			}
+		}
+		fn()
+		return nil
+	}
+}
+
+// printHelp lists the supported escape sequences.
+func (e *EscapeWriter) printHelp() {
+	e.mu.Lock()
+	keys := make([]int, 0, len(e.commands))
+	for k := range e.commands {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+
+	var b strings.Builder
+	char := keyName(e.char)
+	b.WriteString("Supported escape sequences:\r\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s%s - %s\r\n", char, keyName(byte(k)), e.commands[byte(k)].help)
+	}
+	fmt.Fprintf(&b, " %s? - this message\r\n", char)
+	fmt.Fprintf(&b, " %s%s - send the escape character\r\n", char, char)
+	b.WriteString("(Note that escapes are only recognized immediately after newline.)")
+	e.mu.Unlock()
+
+	e.Printf("%s", b.String())
+}
+
+// keyName renders a command key, showing control characters as ^X.
+func keyName(k byte) string {
+	if k < 0x20 {
+		return "^" + string(rune(k+'@'))
+	}
+	return string(rune(k))
+}
@@ -0,0 +1,47 @@
+package ssh
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscapeWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		ran   string
+	}{
+		{"plain", "ls\r", "ls\r", ""},
+		{"command", "ls\r~x", "ls\r", "x"},
+		{"mid line", "a~x", "a~x", ""},
+		{"doubled", "~~x", "~x", ""},
+		{"unknown", "~y", "~y", ""},
+		{"discard", "ls\r~.after", "", "."},
+		{"discard after command", "~xls\r~.", "", "."},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		var ran []byte
+		e := NewEscapeWriter(&out, &bytes.Buffer{})
+		e.Handle('x', "run x", func() {
+			ran = append(ran, 'x')
+		})
+		e.HandleDiscard('.', "close", func() {
+			// Nothing typed before it may have been written yet
+			if out.Len() > 0 {
+				t.Errorf("%s: %q written before the discarding command ran", tt.name, out.String())
+			}
+			ran = append(ran, '.')
+		})
+		if _, err := e.Write([]byte(tt.input)); err != nil {
+			t.Fatalf("%s: Write: %v", tt.name, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: forwarded %q, want %q", tt.name, got, tt.want)
+		}
+		if string(ran) != tt.ran {
+			t.Errorf("%s: ran %q, want %q", tt.name, ran, tt.ran)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Every hop of a jump chain is probed on its own, so a dead bastion is
+// noticed and named instead of surfacing as an EOF on the target.
+const (
+	hopKeepaliveInterval = 30 * time.Second
+	hopKeepaliveTimeout  = 15 * time.Second
+)
+
+// errHopUnresponsive is recorded when a hop stops answering keepalives.
+var errHopUnresponsive = errors.New("stopped responding")
+
+// HopError reports which hop of a jump chain broke the connection.
+type HopError struct {
+	Hop  int // 1-based position in the chain
+	Name string
+	Err  error
+}
+
+func (e *HopError) Error() string {
+	return fmt.Sprintf("hop %d (%s): %v", e.Hop, e.Name, e.Err)
+}
+
+func (e *HopError) Unwrap() error { return e.Err }
+
+// watch starts a keepalive and a connection watcher for every hop. It is
+// called with jc.mu held once all hops are connected.
+func (jc *JumpChain) watch() {
+	jc.stopWatch = make(chan struct{})
+	jc.broken = make(chan struct{})
+	jc.dead = nil
+
+	for i, client := range jc.clients {
+		go func(i int, client *ssh.Client) {
+			err := client.Wait()
+			if err == nil {
+				err = io.EOF
+			}
+			jc.markDead(i, fmt.Errorf("connection closed: %w", err))
+		}(i, client)
+		go jc.keepalive(i, client, jc.stopWatch)
+	}
+}
+
+// keepalive closes a hop that stops answering, which breaks the chain
+// behind it and lets Wait report the hop. A hop with server-alive-interval
+// set is probed on its own terms.
+func (jc *JumpChain) keepalive(i int, client *ssh.Client, stop <-chan struct{}) {
+	interval, timeout, countMax := hopKeepaliveInterval, hopKeepaliveTimeout, 1
+	if hopInterval, hopCountMax := serverAlive(jc.hosts[i]); hopInterval > 0 {
+		interval, timeout, countMax = hopInterval, hopInterval, hopCountMax
+	}
+	if !keepalive(client, interval, timeout, countMax, stop) {
+		jc.markDead(i, errHopUnresponsive)
+		client.Close()
+	}
+}
+
+// alive sends a keepalive request and waits up to timeout for the reply.
+func alive(client *ssh.Client, timeout time.Duration) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// markDead records a failed hop. Failures after Close are expected and
+// ignored; otherwise the earliest hop seen failing wins.
+func (jc *JumpChain) markDead(i int, err error) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	if jc.broken == nil || jc.closing {
+		return
+	}
+	if jc.dead == nil || i < jc.dead.Hop-1 {
+		jc.dead = &HopError{Hop: i + 1, Name: jc.hosts[i].Name, Err: err}
+	}
+	select {
+	case <-jc.broken:
+	default:
+		close(jc.broken)
+	}
+}
+
+// Wait blocks until the chain breaks and returns the hop responsible.
+// When a later hop fails first, the hops before it are probed, since a
+// dead bastion takes down every connection carried through it.
+func (jc *JumpChain) Wait() error {
+	jc.mu.Lock()
+	broken := jc.broken
+	jc.mu.Unlock()
+	if broken == nil {
+		return fmt.Errorf("not connected")
+	}
+	<-broken
+
+	jc.mu.Lock()
+	dead := jc.dead
+	clients := append([]*ssh.Client(nil), jc.clients...)
+	jc.mu.Unlock()
+	if dead == nil {
+		// Closed deliberately
+		return nil
+	}
+
+	for i := 0; i < dead.Hop-1 && i < len(clients); i++ {
+		if !alive(clients[i], hopKeepaliveTimeout) {
+			return &HopError{Hop: i + 1, Name: jc.hosts[i].Name, Err: errHopUnresponsive}
+		}
+	}
+	return dead
+}
+
+// Broken reports the hop that broke the chain, waiting up to grace for
+// the hops to notice, or nil if the chain is still healthy.
+func (jc *JumpChain) Broken(grace time.Duration) error {
+	jc.mu.Lock()
+	broken := jc.broken
+	jc.mu.Unlock()
+	if broken == nil {
+		return nil
+	}
+
+	select {
+	case <-broken:
+		return jc.Wait()
+	case <-time.After(grace):
+		return nil
+	}
+}
+
+// Dial opens a connection from the target host, like ssh.Client.Dial.
+func (jc *JumpChain) Dial(network, addr string) (net.Conn, error) {
+	client := jc.SSHClient()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return client.Dial(network, addr)
+}
+
+// Listen asks the target host to accept connections on addr, like
+// ssh.Client.Listen.
+func (jc *JumpChain) Listen(network, addr string) (net.Listener, error) {
+	client := jc.SSHClient()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return client.Listen(network, addr)
+}
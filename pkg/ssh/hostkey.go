@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// promptMu serializes host key prompts and known_hosts writes when several
+// hops or tunnels connect at once.
+var promptMu sync.Mutex
+
+// HostKeyError reports a server key that could not be verified.
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Reason      string
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("host key for %s (%s) %s", e.Host, e.Fingerprint, e.Reason)
+}
+
+// KnownHostsPath returns the known_hosts file used for verification.
+func KnownHostsPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("get home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// HostKeyCallback verifies server keys against ~/.ssh/known_hosts using
+// the given strict-host-key-checking policy.
+func HostKeyCallback(policy string) ssh.HostKeyCallback {
+	return hostKeyCallback(policy, true)
+}
+
+// hostKeyCallback is HostKeyCallback for connections that may not be
+// allowed to prompt. Without a prompt, unknown keys are rejected under the
+// "ask" policy.
+func hostKeyCallback(policy string, interactive bool) ssh.HostKeyCallback {
+	if policy == config.HostKeyNo {
+		return ssh.InsecureIgnoreHostKey()
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+
+		path, err := KnownHostsPath()
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			check, err := knownhosts.New(path)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", path, err)
+			}
+
+			err = check(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			switch {
+			case err == nil:
+				return nil
+			case !errors.As(err, &keyErr):
+				return &HostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Reason: err.Error()}
+			case len(keyErr.Want) > 0:
+				want := keyErr.Want[0]
+				return &HostKeyError{
+					Host:        hostname,
+					Fingerprint: ssh.FingerprintSHA256(key),
+					Reason: fmt.Sprintf("does not match %s:%d; the host key has changed, "+
+						"which may mean someone is intercepting the connection", want.Filename, want.Line),
+				}
+			}
+		}
+
+		// The key is unknown
+		unknown := &HostKeyError{
+			Host:        hostname,
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Reason:      "is not in " + path,
+		}
+		switch policy {
+		case config.HostKeyYes:
+			return unknown
+		case config.HostKeyAcceptNew:
+			return addKnownHost(path, hostname, key)
+		}
+
+		if !interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return unknown
+		}
+
+		fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", hostname)
+		fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			fmt.Fprintf(os.Stderr, "Are you sure you want to continue connecting (yes/no/once)? ")
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				return unknown
+			}
+
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "yes", "y":
+				return addKnownHost(path, hostname, key)
+			case "once":
+				return nil
+			case "no", "n":
+				unknown.Reason = "was rejected"
+				return unknown
+			}
+		}
+	}
+}
+
+// HostKeyAlgorithms returns the host key algorithms to ask the server for
+// when connecting to addr ("host:port") under policy: those of the keys
+// known_hosts has for it, so that a server with several keys presents
+// one that can be checked instead of another type, which would look like
+// a changed key. It is nil, for the default order, when no key is known.
+func HostKeyAlgorithms(addr, policy string) []string {
+	if policy == config.HostKeyNo {
+		return nil
+	}
+	path, err := KnownHostsPath()
+	if err != nil {
+		return nil
+	}
+	return knownHostAlgorithms(path, addr)
+}
+
+// knownHostAlgorithms returns the algorithms of the keys the known_hosts
+// file at path has for addr.
+func knownHostAlgorithms(path, addr string) []string {
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil
+	}
+	// A key that can't be in the file makes the check list the ones that are
+	probe, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	key, err := ssh.NewPublicKey(probe)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err := check(addr, &net.TCPAddr{IP: net.IPv4zero}, key); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algos []string
+	for _, want := range keyErr.Want {
+		switch typ := want.Key.Type(); typ {
+		case ssh.KeyAlgoRSA:
+			// An RSA key signs with any of these
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algos = append(algos, typ)
+		}
+	}
+	return algos
+}
+
+// recordHostKey wraps cb to keep the key the server presents in *key,
+// whether or not it is accepted.
+func recordHostKey(cb ssh.HostKeyCallback, key *ssh.PublicKey) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+		*key = k
+		err := cb(hostname, remote, k)
+		slog.Info("host key", "host", hostname, "type", k.Type(), "fingerprint", ssh.FingerprintSHA256(k), "accepted", err == nil)
+		return err
+	}
+}
+
+// addKnownHost records key for hostname in the known_hosts file.
+func addKnownHost(path, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: permanently added '%s' (%s) to %s.\n", hostname, key.Type(), path)
+	return nil
+}
@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newSigner returns a host key signer for the private key k.
+func newSigner(t *testing.T, k any) ssh.Signer {
+	t.Helper()
+	s, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeKnownHosts writes a known_hosts file listing keys for host.
+func writeKnownHosts(t *testing.T, host string, keys ...ssh.PublicKey) string {
+	t.Helper()
+	var data []byte
+	for _, k := range keys {
+		data = append(data, knownhosts.Line([]string{knownhosts.Normalize(host)}, k)+"\n"...)
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKnownHostAlgorithms(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed := newSigner(t, edKey).PublicKey()
+	rs := newSigner(t, rsaKey).PublicKey()
+
+	tests := []struct {
+		name string
+		keys []ssh.PublicKey
+		addr string
+		want []string
+	}{
+		{"ed25519 only", []ssh.PublicKey{ed}, "example.com:22", []string{ssh.KeyAlgoED25519}},
+		{"rsa signs with sha2", []ssh.PublicKey{rs}, "example.com:22", []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+		{"other port", []ssh.PublicKey{ed}, "example.com:2222", nil},
+		{"unknown host", []ssh.PublicKey{ed}, "other.example.com:22", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeKnownHosts(t, "example.com:22", tt.keys...)
+			if got := knownHostAlgorithms(path, tt.addr); !slices.Equal(got, tt.want) {
+				t.Errorf("algorithms = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A server with several host keys presents the one known_hosts has, even
+// when it is not the type the client prefers by default.
+func TestHandshakeWithNonDefaultKnownKeyType(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecSigner, edSigner := newSigner(t, ecKey), newSigner(t, edKey)
+
+	const addr = "example.com:22"
+	path := writeKnownHosts(t, addr, edSigner.PublicKey())
+	check, err := knownhosts.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		algos  []string
+		wantOK bool
+	}{
+		{"default order", nil, false}, // ECDSA comes first and looks changed
+		{"known types", knownHostAlgorithms(path, addr), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			server := &ssh.ServerConfig{NoClientAuth: true}
+			server.AddHostKey(ecSigner)
+			server.AddHostKey(edSigner)
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				ssh.NewServerConn(c, server)
+			}()
+
+			clientConn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer clientConn.Close()
+
+			cfg := &ssh.ClientConfig{User: "u", HostKeyCallback: check, HostKeyAlgorithms: tt.algos}
+			conn, _, _, err := ssh.NewClientConn(clientConn, addr, cfg)
+			if err == nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.wantOK {
+				t.Errorf("handshake error = %v, want success %v", err, tt.wantOK)
+			}
+		})
+	}
+}
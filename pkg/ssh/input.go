@@ -0,0 +1,207 @@
+package ssh
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// maxCoalesce is how much input is held for the coalescing window before
+// it is sent anyway, so a paste doesn't wait on the timer.
+const maxCoalesce = 32 * 1024
+
+// InputBuffer sits in front of the remote stdin and shapes input for slow
+// links.
+//
+// With a coalescing window, keystrokes are held for up to the window and
+// written together, so fast typing costs one packet rather than one per
+// key. With local echo, each line is composed locally: printable input is
+// echoed to the terminal at once and backspace edits it, and the line is
+// sent when Enter, a control key or an escape sequence is typed. The local
+// echo is then erased, for the remote echo to replace it.
+//
+// Like EscapeWriter it only looks at bytes; the terminal stays in raw mode.
+type InputBuffer struct {
+	mu        sync.Mutex
+	w         io.Writer
+	echo      io.Writer
+	window    time.Duration
+	localEcho bool
+	line      []byte // composed under local echo, not sent yet
+	pending   []byte // held for the coalescing window
+	timer     *time.Timer
+	err       error // from a write the timer made, reported on the next
+}
+
+// NewInputBuffer creates an input buffer writing to w and echoing to echo.
+// A window <= 0 writes input through as it comes.
+func NewInputBuffer(w, echo io.Writer, window time.Duration, localEcho bool) *InputBuffer {
+	return &InputBuffer{w: w, echo: echo, window: window, localEcho: localEcho}
+}
+
+// Write implements io.Writer.
+func (b *InputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	if !b.localEcho {
+		return len(p), b.send(p)
+	}
+
+	var echo []byte
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == 0x7f || c == '\b':
+			if len(b.line) == 0 {
+				if err := b.send(p[i : i+1]); err != nil {
+					return i, err
+				}
+				continue
+			}
+			r, size := utf8.DecodeLastRune(b.line)
+			b.line = b.line[:len(b.line)-size]
+			n := max(runewidth.RuneWidth(r), 1)
+			echo = append(echo, strings.Repeat("\b", n)+strings.Repeat(" ", n)+strings.Repeat("\b", n)...)
+
+		case c == 0x1b:
+			// Escape sequences (arrow keys, function keys) arrive in one
+			// read and go through whole
+			b.echoOut(echo)
+			echo = nil
+			if err := b.sendLine(p[i:]); err != nil {
+				return i, err
+			}
+			return len(p), nil
+
+		case c < 0x20:
+			// Enter, Tab, ^C and the like send the line along with the key
+			b.echoOut(echo)
+			echo = nil
+			if err := b.sendLine(p[i : i+1]); err != nil {
+				return i, err
+			}
+
+		default:
+			b.line = append(b.line, c)
+			echo = append(echo, c)
+		}
+	}
+	b.echoOut(echo)
+	return len(p), nil
+}
+
+// SetLocalEcho switches local echo on or off. Switching it off sends the
+// line being composed.
+func (b *InputBuffer) SetLocalEcho(on bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.localEcho = on
+	if on {
+		return nil
+	}
+	return b.sendLine(nil)
+}
+
+// LocalEcho reports whether local echo is on.
+func (b *InputBuffer) LocalEcho() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.localEcho
+}
+
+// Flush sends everything held back: the line being composed and input
+// waiting for the coalescing window. Call it before closing the remote
+// stdin.
+func (b *InputBuffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.sendLine(nil); err != nil {
+		return err
+	}
+	return b.flushPending()
+}
+
+// Discard drops everything held back without sending it, for when the
+// connection is given up on.
+func (b *InputBuffer) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.line = nil
+	b.pending = nil
+}
+
+// sendLine erases the local echo of the composed line and sends it,
+// followed by key. Callers hold mu.
+func (b *InputBuffer) sendLine(key []byte) error {
+	if len(b.line) > 0 {
+		n := runewidth.StringWidth(string(b.line))
+		b.echoOut([]byte(strings.Repeat("\b", n) + "\x1b[K"))
+	}
+	out := append(b.line, key...)
+	b.line = nil
+	if len(out) == 0 {
+		return nil
+	}
+	return b.send(out)
+}
+
+// send writes p, or holds it for the coalescing window. Callers hold mu.
+func (b *InputBuffer) send(p []byte) error {
+	if b.window <= 0 {
+		_, err := b.w.Write(p)
+		return err
+	}
+	b.pending = append(b.pending, p...)
+	if len(b.pending) >= maxCoalesce {
+		return b.flushPending()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.timerFlush)
+	}
+	return nil
+}
+
+// timerFlush writes the input held when the coalescing window ends.
+func (b *InputBuffer) timerFlush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timer = nil
+	if err := b.flushPending(); err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+// flushPending writes the input held for the coalescing window. Callers
+// hold mu.
+func (b *InputBuffer) flushPending() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return nil
+	}
+	pending := b.pending
+	b.pending = nil
+	_, err := b.w.Write(pending)
+	return err
+}
+
+// echoOut writes local echo to the terminal. Callers hold mu.
+func (b *InputBuffer) echoOut(p []byte) {
+	if len(p) > 0 && b.echo != nil {
+		_, _ = b.echo.Write(p)
+	}
+}
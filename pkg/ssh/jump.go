@@ -1,8 +1,11 @@
 package ssh
 
 import (
+	"cmp"
 	"fmt"
+	"log/slog"
 	"net"
+	"strconv"
 	"sync"
 
 	"github.com/ai-help-me/sshm/pkg/config"
@@ -16,6 +19,21 @@ type JumpChain struct {
 	hosts   []*config.Host
 	clients []*ssh.Client
 	mu      sync.Mutex
+
+	// Hop health, see hops.go
+	stopWatch chan struct{} // stops the keepalives
+	broken    chan struct{} // closed when a hop fails or the chain is closed
+	dead      *HopError     // the failed hop, nil after a deliberate Close
+	closing   bool
+
+	// warm marks a background pre-dial, which must never prompt.
+	warm bool
+	// prompted is the password typed for the target, see PromptedPassword.
+	prompted string
+	// hostKey and version are the key and SSH version the target
+	// presented, see ProbeHost.
+	hostKey ssh.PublicKey
+	version string
 }
 
 // NewJumpChain creates a new jump chain from a host's jump configuration.
@@ -48,7 +66,8 @@ func (jc *JumpChain) Connect() (*ssh.Client, error) {
 	var prevClient *ssh.Client
 
 	for i, host := range jc.hosts {
-		client, err := jc.connectHop(host, prevClient)
+		slog.Info("jump hop", "hop", i+1, "of", len(jc.hosts), "host", host.Name)
+		client, err := jc.connectHop(i, host, prevClient)
 		if err != nil {
 			// Clean up previous connections on failure
 			jc.closeAll()
@@ -59,53 +78,109 @@ func (jc *JumpChain) Connect() (*ssh.Client, error) {
 		prevClient = client
 	}
 
+	jc.closing = false
+	jc.watch()
+
 	// Return the final client (connected to target)
 	return jc.clients[len(jc.clients)-1], nil
 }
 
-// connectHop connects to a single hop in the chain.
-func (jc *JumpChain) connectHop(host *config.Host, prevClient *ssh.Client) (*ssh.Client, error) {
+// connectHop connects to a single hop in the chain, the one at index hop.
+func (jc *JumpChain) connectHop(hop int, host *config.Host, prevClient *ssh.Client) (*ssh.Client, error) {
+	addr := net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+	dialAddr := net.JoinHostPort(host.DialHost(), strconv.Itoa(host.Port))
+
+	// The first hop is dialed from the local machine, later ones through
+	// the previous hop; either may go through the hop's own proxy. The
+	// handshake gets addr, so known_hosts is checked for the name. A proxy
+	// command runs locally, so only the first hop can have one
 	var conn net.Conn
 	var err error
-
-	addr := fmt.Sprintf("%s:%d", host.Host, host.Port)
-
-	if prevClient == nil {
-		// First hop - direct connection from local machine
-		conn, err = net.Dial("tcp", addr)
-		if err != nil {
-			return nil, fmt.Errorf("direct dial %s: %w", addr, err)
+	switch {
+	case host.ProxyCommand != "" && prevClient != nil:
+		return nil, fmt.Errorf("%s: proxy-command only works on the first hop", host.Name)
+	case host.ProxyCommand != "":
+		var command string
+		if command, err = ExpandProxyCommand(host.ProxyCommand, host.DialHost(), host.Port, host.User); err == nil {
+			conn, err = dialProxyCommand(command)
 		}
-	} else {
-		// Subsequent hop - forward through previous SSH client
-		conn, err = prevClient.Dial("tcp", addr)
-		if err != nil {
-			return nil, fmt.Errorf("dial through proxy to %s: %w", addr, err)
+	default:
+		conn, err = dialHop(prevClient, host.Proxy, dialAddr)
+	}
+	if err != nil {
+		if prevClient == nil {
+			return nil, fmt.Errorf("direct dial %s: %w", dialAddr, err)
 		}
+		return nil, fmt.Errorf("dial through proxy to %s: %w", dialAddr, err)
+	}
+	target := host == jc.hosts[len(jc.hosts)-1]
+	if target {
+		conn = &versionConn{Conn: conn, version: &jc.version}
 	}
 
 	// Create SSH config with authentication
-	authMethods, err := AuthMethodsFromConfig(host.KeyPath, host.Password)
+	password, err := revealPassword(host.Password, !jc.warm)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("auth methods for %s: %w", host.Name, err)
+		return nil, fmt.Errorf("read password for %s: %w", host.Name, markAuth(err, false))
+	}
+	keyPassphrase, err := revealPassword(host.KeyPassphrase, !jc.warm)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read key passphrase for %s: %w", host.Name, markAuth(err, false))
+	}
+	authMethods, err := AuthMethodsFromConfig(host.KeyPath, keyPassphrase)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("auth methods for %s: %w", host.Name, markAuth(err, false))
+	}
+	// Every hop may ask for a password or a one-time code, labeled with
+	// the hop so the user knows which server is asking. Only the target's
+	// password is offered for saving
+	var prompted string
+	label := fmt.Sprintf("%s, hop %d/%d", cmp.Or(host.Name, host.Host), hop+1, len(jc.hosts))
+	authMethods = append(authMethods,
+		passwordAuth(label, host.User, host.Host, password, !jc.warm, &prompted),
+		keyboardInteractive(label, password, !jc.warm, &prompted))
+
+	hostKey := new(ssh.PublicKey)
+	if target {
+		hostKey = &jc.hostKey
 	}
-
 	sshConfig := &ssh.ClientConfig{
-		User:            host.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * 1000000000, // 30 seconds in nanoseconds
+		User:              host.User,
+		Auth:              authMethods,
+		HostKeyCallback:   recordHostKey(hostKeyCallback(host.StrictHostKeyChecking, !jc.warm), hostKey),
+		HostKeyAlgorithms: HostKeyAlgorithms(addr, host.StrictHostKeyChecking),
+		Timeout:           30 * 1000000000, // 30 seconds in nanoseconds
 	}
 
 	// Establish SSH connection over the TCP connection
-	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	client, err := handshake(conn, addr, sshConfig)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("ssh conn to %s: %w", host.Name, err)
+		return nil, fmt.Errorf("ssh conn to %s: %w", host.Name, markAuth(err, true))
 	}
+	if target {
+		jc.prompted = prompted
+	}
+
+	return client, nil
+}
 
-	return ssh.NewClient(sshConn, chans, reqs), nil
+// PromptedPassword returns the password the user typed to log in to the
+// target, or "" when the login did not need one.
+func (jc *JumpChain) PromptedPassword() string {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	return jc.prompted
+}
+
+// Reconnect closes the chain and establishes every hop again.
+func (jc *JumpChain) Reconnect() error {
+	jc.Close()
+	_, err := jc.Connect()
+	return err
 }
 
 // Close closes all SSH connections in reverse order.
@@ -119,6 +194,17 @@ func (jc *JumpChain) Close() error {
 func (jc *JumpChain) closeAll() error {
 	var lastErr error
 
+	if jc.stopWatch != nil {
+		jc.closing = true
+		close(jc.stopWatch)
+		jc.stopWatch = nil
+		select {
+		case <-jc.broken:
+		default:
+			close(jc.broken)
+		}
+	}
+
 	// Close in reverse order (target first, then jump hosts)
 	for i := len(jc.clients) - 1; i >= 0; i-- {
 		if err := jc.clients[i].Close(); err != nil {
@@ -130,8 +216,8 @@ func (jc *JumpChain) closeAll() error {
 	return lastErr
 }
 
-// GetSSHClient returns the underlying SSH client for SFTP operations.
-func (jc *JumpChain) GetSSHClient() *ssh.Client {
+// SSHClient returns the underlying SSH client for SFTP operations.
+func (jc *JumpChain) SSHClient() *ssh.Client {
 	jc.mu.Lock()
 	defer jc.mu.Unlock()
 
@@ -143,11 +229,11 @@ func (jc *JumpChain) GetSSHClient() *ssh.Client {
 
 // Session creates a new SSH session on the target host.
 func (jc *JumpChain) Session() (*ssh.Session, error) {
-	client := jc.GetSSHClient()
+	client := jc.SSHClient()
 	if client == nil {
 		return nil, fmt.Errorf("not connected")
 	}
-	return client.NewSession()
+	return openSession(client)
 }
 
 // IsConnected returns true if the jump chain is connected.
@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultServerAliveCountMax is how many keepalives may go unanswered
+	// in a row when server-alive-count-max is not set, as in OpenSSH.
+	defaultServerAliveCountMax = 3
+	// reconnectAliveInterval probes hosts with auto-reconnect and no
+	// server-alive-interval, so a silently dead connection is noticed.
+	reconnectAliveInterval = 15 * time.Second
+)
+
+// serverAlive returns how often host's connection is probed and how many
+// probes may go unanswered before it is given up; 0 means it isn't.
+func serverAlive(host *config.Host) (time.Duration, int) {
+	interval := time.Duration(host.ServerAliveInterval) * time.Second
+	if interval == 0 && host.AutoReconnect {
+		interval = reconnectAliveInterval
+	}
+	countMax := host.ServerAliveCountMax
+	if countMax == 0 {
+		countMax = defaultServerAliveCountMax
+	}
+	return interval, countMax
+}
+
+// keepalive probes client every interval until stop is closed. It
+// returns false once countMax probes in a row got no reply within
+// timeout.
+func keepalive(client *ssh.Client, interval, timeout time.Duration, countMax int, stop <-chan struct{}) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return true
+		case <-ticker.C:
+		}
+		if alive(client, timeout) {
+			missed = 0
+		} else if missed++; missed >= countMax {
+			slog.Info("keepalive unanswered, giving up", "missed", missed)
+			return false
+		}
+		slog.Debug("keepalive", "missed", missed)
+	}
+}
+
+// ConnectionLostError reports a direct connection that dropped under its
+// session, as opposed to the session ending.
+type ConnectionLostError struct {
+	Host string
+	Err  error
+}
+
+func (e *ConnectionLostError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Host, e.Err)
+}
+
+func (e *ConnectionLostError) Unwrap() error { return e.Err }
+
+// watch starts the keepalive and a watcher for the connection just
+// dialed. It is called with c.mu held.
+func (c *Client) watch() {
+	client := c.client
+	stop := make(chan struct{})
+	lost := make(chan struct{})
+	c.stopWatch, c.lost, c.lostErr, c.closing = stop, lost, nil, false
+
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			c.mu.Lock()
+			if c.lost == lost && !c.closing {
+				c.lostErr = err
+			}
+			c.mu.Unlock()
+			close(lost)
+		})
+	}
+	go func() {
+		err := client.Wait()
+		if err == nil {
+			err = io.EOF
+		}
+		fail(fmt.Errorf("connection closed: %w", err))
+	}()
+
+	if interval := c.config.AliveInterval; interval > 0 {
+		go func() {
+			if !keepalive(client, interval, interval, c.config.AliveCountMax, stop) {
+				fail(errHopUnresponsive)
+				client.Close()
+			}
+		}()
+	}
+}
+
+// Broken reports why the connection dropped, waiting up to grace for it
+// to be noticed, or nil if it is still up or was closed deliberately.
+func (c *Client) Broken(grace time.Duration) error {
+	c.mu.Lock()
+	lost := c.lost
+	c.mu.Unlock()
+	if lost == nil {
+		return nil
+	}
+
+	select {
+	case <-lost:
+	case <-time.After(grace):
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lostErr == nil {
+		return nil
+	}
+	return &ConnectionLostError{Host: c.config.Host, Err: c.lostErr}
+}
+
+// Reconnect closes the connection and dials the host again.
+func (c *Client) Reconnect() error {
+	c.Close()
+	return c.Dial()
+}
@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+// unreachableTTL is how long a failed connection attempt is remembered.
+const unreachableTTL = 2 * time.Minute
+
+// Unreachable is a recent failure to reach a host.
+type Unreachable struct {
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// CachedUnreachable returns the failure recorded for host within the last
+// few minutes, if any.
+func CachedUnreachable(host *config.Host) (*Unreachable, bool) {
+	cache := loadLiveness()
+	u, ok := cache[livenessKey(host)]
+	if !ok || time.Since(u.At) > unreachableTTL {
+		return nil, false
+	}
+	return &u, true
+}
+
+// RecordReachability remembers the outcome of connecting to host: network
+// failures are cached, a success clears the entry. Other errors (such as
+// rejected credentials) say nothing about reachability and are ignored.
+// The cache is best effort; write errors are dropped.
+func RecordReachability(host *config.Host, err error) {
+	if err != nil && !IsNetworkError(err) {
+		return
+	}
+
+	key := livenessKey(host)
+	_ = state.Update(livenessFile, func(data []byte) ([]byte, error) {
+		cache := parseLiveness(data)
+		if err == nil {
+			if _, ok := cache[key]; !ok {
+				return nil, nil
+			}
+			delete(cache, key)
+		} else {
+			cache[key] = Unreachable{Reason: err.Error(), At: time.Now()}
+		}
+
+		for k, u := range cache {
+			if time.Since(u.At) > unreachableTTL {
+				delete(cache, k)
+			}
+		}
+		return json.Marshal(cache)
+	})
+}
+
+// livenessKey identifies the route to host: the same address reached
+// through another jump chain or proxy is a different entry.
+func livenessKey(host *config.Host) string {
+	hops := make([]string, 0, len(host.Jump)+1)
+	for _, h := range append(append([]*config.Host{}, host.Jump...), host) {
+		hop := h.User + "@" + net.JoinHostPort(h.Host, strconv.Itoa(h.Port))
+		if h.Proxy != "" {
+			hop = h.Proxy + ">" + hop
+		}
+		if h.ProxyCommand != "" {
+			hop = h.ProxyCommand + ">" + hop
+		}
+		hops = append(hops, hop)
+	}
+	return strings.Join(hops, ">")
+}
+
+// livenessFile is where the cache is kept in the state directory.
+const livenessFile = "unreachable.json"
+
+// loadLiveness reads the cache, treating a missing or corrupt file as empty.
+func loadLiveness() map[string]Unreachable {
+	path, err := state.Path(livenessFile)
+	if err != nil {
+		return make(map[string]Unreachable)
+	}
+	data, _ := os.ReadFile(path)
+	return parseLiveness(data)
+}
+
+func parseLiveness(data []byte) map[string]Unreachable {
+	cache := make(map[string]Unreachable)
+	_ = json.Unmarshal(data, &cache)
+	return cache
+}
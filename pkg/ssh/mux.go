@@ -0,0 +1,196 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// Mux shares one SSH connection with other sshm processes, like OpenSSH's
+// ControlMaster. Each process speaks SSH to the mux over a local socket;
+// its channels (sessions, SFTP, port forwards) are opened on the shared
+// connection and relayed both ways, requests and exit statuses included.
+//
+// Channels the server opens (agent forwarding, remote port forwards) are
+// not relayed.
+type Mux struct {
+	upstream *ssh.Client
+	config   *ssh.ServerConfig
+
+	mu        sync.Mutex
+	clients   int
+	idleSince time.Time
+}
+
+// NewMux creates a mux for upstream. Its host key is made up on the spot:
+// the socket is only reachable through the private state directory.
+func NewMux(upstream *ssh.Client) (*Mux, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+	return &Mux{upstream: upstream, config: cfg, idleSince: time.Now()}, nil
+}
+
+// Serve relays the connections accepted on ln until it is closed.
+func (m *Mux) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go m.serveConn(conn)
+	}
+}
+
+// Clients returns how many processes are using the connection, and since
+// when it has had none.
+func (m *Mux) Clients() (int, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clients, m.idleSince
+}
+
+// Acquire counts a user of the connection other than a mux client, such
+// as a tunnel running next to the mux, until release is called.
+func (m *Mux) Acquire() (release func()) {
+	m.mu.Lock()
+	m.clients++
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if m.clients--; m.clients == 0 {
+				m.idleSince = time.Now()
+			}
+		})
+	}
+}
+
+func (m *Mux) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, m.config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	defer m.Acquire()()
+
+	go m.relayGlobal(reqs)
+	for nc := range chans {
+		go m.relayChannel(nc)
+	}
+}
+
+// relayGlobal passes keepalives on, so a client checking the connection
+// checks the shared one. Port forwarding requests are refused: the
+// forwarded connections would arrive here, not at the client.
+func (m *Mux) relayGlobal(reqs <-chan *ssh.Request) {
+	for r := range reqs {
+		if r.Type != "keepalive@openssh.com" {
+			r.Reply(false, nil)
+			continue
+		}
+		ok, payload, err := m.upstream.SendRequest(r.Type, r.WantReply, r.Payload)
+		r.Reply(ok && err == nil, payload)
+	}
+}
+
+// relayChannel opens nc's channel on the shared connection and copies
+// between the two until both ends are done.
+func (m *Mux) relayChannel(nc ssh.NewChannel) {
+	up, upReqs, err := m.upstream.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			nc.Reject(openErr.Reason, openErr.Message)
+		} else {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	down, downReqs, err := nc.Accept()
+	if err != nil {
+		up.Close()
+		return
+	}
+
+	// The client closing its end ends the channel
+	go func() {
+		relayRequests(up, downReqs)
+		up.Close()
+	}()
+	go func() {
+		io.Copy(up, down)
+		up.CloseWrite()
+	}()
+
+	// Output and stderr are drained before the client sees the channel
+	// close, so nothing after the exit status is lost
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		io.Copy(down, up)
+	}()
+	go func() {
+		defer output.Done()
+		io.Copy(down.Stderr(), up.Stderr())
+	}()
+	relayRequests(down, upReqs)
+	output.Wait()
+	down.CloseWrite()
+	down.Close()
+}
+
+// relayRequests passes channel requests (pty-req, exec, window-change,
+// exit-status...) to dst, with their replies.
+func relayRequests(dst ssh.Channel, reqs <-chan *ssh.Request) {
+	for r := range reqs {
+		ok, err := dst.SendRequest(r.Type, r.WantReply, r.Payload)
+		if r.WantReply {
+			r.Reply(ok && err == nil, nil)
+		}
+	}
+}
+
+// DialMux connects to host through the mux listening on sock. Closing
+// the returned client leaves the shared connection up.
+func DialMux(sock string, host *config.Host) (*Client, error) {
+	conn, err := net.DialTimeout("unix", sock, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, sock, &ssh.ClientConfig{
+		User: host.User,
+		// The mux's key is made up when it starts; the socket's place in
+		// the private state directory is what vouches for it
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect to %s: %w", sock, err)
+	}
+	return &Client{
+		client: ssh.NewClient(sshConn, chans, reqs),
+		config: NewHostConfig(host),
+	}, nil
+}
@@ -0,0 +1,165 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// osc52Prefix starts a clipboard-write sequence: ESC ] 52 ;
+var osc52Prefix = []byte("\x1b]52;")
+
+const (
+	esc = 0x1b
+	bel = 0x07
+
+	// maxOSC52 bounds the payload held while waiting for the terminator.
+	// A clipboard write is base64 text well under this; anything longer
+	// is taken as a stray prefix and its payload passed through.
+	maxOSC52 = 1 << 20
+
+	// osc52HoldDelay is how long a partial prefix at the end of a write
+	// waits for the next write before it is released as plain output.
+	osc52HoldDelay = 20 * time.Millisecond
+)
+
+// OSC52Filter removes OSC 52 clipboard-write sequences from remote output.
+//
+// Sequences are terminated by BEL or ST (ESC \) and may be split across
+// writes, so partial prefixes are held back until they can be classified,
+// or until a short delay passes without more output. A sequence whose
+// payload grows past maxOSC52 is abandoned: its payload is written out
+// without the prefix, and filtering starts over.
+type OSC52Filter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	held    []byte // possible start of an OSC 52 sequence
+	inSeq   bool   // holding an OSC 52 payload
+	payload []byte // held payload, without the prefix
+	sawEsc  bool   // last payload byte was ESC (possible ST)
+	delay   time.Duration
+	timer   *time.Timer
+	err     error // from a write the timer made, reported on the next
+}
+
+// NewOSC52Filter creates a filter in front of w.
+func NewOSC52Filter(w io.Writer) *OSC52Filter {
+	return &OSC52Filter{w: w, delay: osc52HoldDelay}
+}
+
+// Write implements io.Writer.
+func (f *OSC52Filter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+
+	out := make([]byte, 0, len(p))
+
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+
+		if f.inSeq {
+			switch {
+			case b == bel:
+				f.endSeq()
+				continue
+			case f.sawEsc && b == '\\':
+				f.endSeq()
+				continue
+			case f.sawEsc:
+				// ESC followed by anything else aborts the OSC and starts
+				// a new sequence, which must be passed through.
+				f.endSeq()
+				f.held = append(f.held[:0], esc)
+				i--
+				continue
+			}
+			f.sawEsc = b == esc
+			f.payload = append(f.payload, b)
+			if len(f.payload) > maxOSC52 {
+				out = f.abandonSeq(out)
+			}
+			continue
+		}
+
+		if len(f.held) > 0 {
+			f.held = append(f.held, b)
+			if bytes.Equal(f.held, osc52Prefix) {
+				f.held = f.held[:0]
+				f.inSeq = true
+				f.sawEsc = false
+				continue
+			}
+			if bytes.HasPrefix(osc52Prefix, f.held) {
+				continue
+			}
+			// Not a clipboard sequence: release everything but the current
+			// byte, which is re-examined since it may be a new ESC.
+			out = append(out, f.held[:len(f.held)-1]...)
+			f.held = f.held[:0]
+			i--
+			continue
+		}
+
+		if b == esc {
+			f.held = append(f.held, b)
+			continue
+		}
+		out = append(out, b)
+	}
+
+	if len(out) > 0 {
+		if _, err := f.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	if len(f.held) > 0 {
+		f.timer = time.AfterFunc(f.delay, f.timerFlush)
+	}
+	return len(p), nil
+}
+
+// timerFlush releases a partial prefix no write has completed in time.
+func (f *OSC52Filter) timerFlush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timer = nil
+	if len(f.held) == 0 {
+		return
+	}
+	held := f.held
+	f.held = nil
+	if _, err := f.w.Write(held); err != nil && f.err == nil {
+		f.err = err
+	}
+}
+
+// endSeq drops the held payload at the end of a sequence. Callers hold mu.
+func (f *OSC52Filter) endSeq() {
+	f.inSeq = false
+	f.sawEsc = false
+	f.payload = f.payload[:0]
+}
+
+// abandonSeq appends the payload of an overlong sequence to out and stops
+// filtering it. A trailing ESC is held instead, since it may start the
+// next sequence. Callers hold mu.
+func (f *OSC52Filter) abandonSeq(out []byte) []byte {
+	payload := f.payload
+	if f.sawEsc {
+		payload = payload[:len(payload)-1]
+		f.held = append(f.held[:0], esc)
+	}
+	out = append(out, payload...)
+	f.inSeq = false
+	f.sawEsc = false
+	f.payload = nil
+	return out
+}
@@ -0,0 +1,93 @@
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the filter's timer to write to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestOSC52Filter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"plain", []string{"hello"}, "hello"},
+		{"bel", []string{"a\x1b]52;c;aGk=\x07b"}, "ab"},
+		{"st", []string{"a\x1b]52;c;aGk=\x1b\\b"}, "ab"},
+		{"split prefix", []string{"a\x1b]5", "2;c;aGk=\x07b"}, "ab"},
+		{"split payload", []string{"a\x1b]52;c;a", "Gk=\x1b", "\\b"}, "ab"},
+		{"other osc", []string{"\x1b]0;title\x07"}, "\x1b]0;title\x07"},
+		{"csi", []string{"\x1b[1m", "x"}, "\x1b[1mx"},
+		{"held esc released", []string{"a\x1b", "[Kb"}, "a\x1b[Kb"},
+		{"esc aborts", []string{"\x1b]52;c;aGk=\x1b[1mx"}, "\x1b[1mx"},
+	}
+	for _, tt := range tests {
+		var buf syncBuffer
+		f := NewOSC52Filter(&buf)
+		for _, w := range tt.writes {
+			if _, err := f.Write([]byte(w)); err != nil {
+				t.Fatalf("%s: Write: %v", tt.name, err)
+			}
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOSC52FilterOverflow(t *testing.T) {
+	var buf syncBuffer
+	f := NewOSC52Filter(&buf)
+	payload := strings.Repeat("A", maxOSC52+1)
+	if _, err := f.Write([]byte("\x1b]52;" + payload + "after")); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != payload+"after" {
+		t.Errorf("output has %d bytes, want the %d byte payload and the text after it", len(got), len(payload)+len("after"))
+	}
+
+	// Filtering starts over after an abandoned sequence.
+	if _, err := f.Write([]byte("\x1b]52;c;aGk=\x07x")); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.HasSuffix(got, "afterx") {
+		t.Errorf("output ends %q, want it to end afterx", got[len(got)-10:])
+	}
+}
+
+func TestOSC52FilterHeldEscTimeout(t *testing.T) {
+	var buf syncBuffer
+	f := NewOSC52Filter(&buf)
+	f.delay = time.Millisecond
+	if _, err := f.Write([]byte("prompt\x1b]5")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for buf.String() != "prompt\x1b]5" {
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want the held prefix released", buf.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// Probe is what logging in to a host without prompting found.
+type Probe struct {
+	// Reachable is true when the host answered with its SSH version.
+	Reachable bool
+	// Version is the server's SSH version, e.g. "SSH-2.0-OpenSSH_9.6",
+	// also known when the login failed.
+	Version string
+	// KeyType and Fingerprint describe the host key the server presented,
+	// whether or not it was accepted.
+	KeyType     string
+	Fingerprint string
+	// Elapsed is how long connecting and logging in took.
+	Elapsed time.Duration
+	// Err is why the login failed, nil when it succeeded.
+	Err error
+}
+
+// ProbeHost logs in to host, through its jump chain if it has one, using
+// only what needs no prompt: configured passwords and keys, and the
+// ssh-agent. Unknown host keys are rejected unless the host's policy
+// accepts them. The connection is closed again.
+func ProbeHost(host *config.Host) Probe {
+	start := time.Now()
+	var p Probe
+	var key ssh.PublicKey
+
+	if len(host.Jump) > 0 {
+		chain := NewJumpChainWithTarget(host)
+		chain.warm = true
+		_, p.Err = chain.Connect()
+		p.Version, key = chain.version, chain.hostKey
+		chain.Close()
+	} else if client, err := NewClient(host); err != nil {
+		p.Err = err
+	} else {
+		client.warm = true
+		p.Err = client.Dial()
+		p.Version, key = client.version, client.hostKey
+		client.Close()
+	}
+
+	p.Elapsed = time.Since(start)
+	if key != nil {
+		p.KeyType = key.Type()
+		p.Fingerprint = ssh.FingerprintSHA256(key)
+	}
+	p.Reachable = p.Version != ""
+	return p
+}
+
+// maxBanner bounds what is read looking for the server's version line,
+// which may follow other lines (RFC 4253 4.2).
+const maxBanner = 8 * 1024
+
+// versionConn picks the server's version line out of what is read from
+// the start of a connection.
+type versionConn struct {
+	net.Conn
+	version *string
+	buf     []byte
+	done    bool
+}
+
+func (c *versionConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.done {
+		return n, err
+	}
+	c.buf = append(c.buf, p[:n]...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			c.done = len(c.buf) > maxBanner
+			return n, err
+		}
+		line := string(bytes.TrimRight(c.buf[:i], "\r"))
+		c.buf = c.buf[i+1:]
+		if len(line) > 4 && line[:4] == "SSH-" {
+			*c.version = line
+			c.done, c.buf = true, nil
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialTimeout bounds the TCP connect and the proxy negotiation of a hop.
+const dialTimeout = 30 * time.Second
+
+// dialFunc opens a connection from wherever the chain currently is.
+type dialFunc func(network, addr string) (net.Conn, error)
+
+// dialHop connects to addr, from the local machine when via is nil or
+// through the previous hop otherwise, optionally going through the hop's
+// HTTP CONNECT or SOCKS5 proxy.
+func dialHop(via *ssh.Client, proxy, addr string) (net.Conn, error) {
+	dial := func(network, a string) (net.Conn, error) {
+		return net.DialTimeout(network, a, dialTimeout)
+	}
+	if via != nil {
+		dial = func(network, a string) (net.Conn, error) {
+			slog.Debug("channel open", "type", "direct-tcpip", "addr", a)
+			return via.Dial(network, a)
+		}
+	}
+	slog.Info("dial", "addr", addr, "proxy", RedactProxy(proxy), "via-hop", via != nil)
+	if proxy == "" {
+		return dial("tcp", addr)
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// The parse error repeats the URL, password and all
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("parse proxy %q: %w", RedactProxy(proxy), err)
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "http":
+		conn, err = httpConnect(dial, u, addr)
+	case "socks5", "socks5h":
+		conn, err = socks5Connect(dial, u, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (want http or socks5)", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", u.Host, err)
+	}
+	return conn, nil
+}
+
+// RedactProxy hides the password of a proxy URL, for logs and messages.
+func RedactProxy(proxy string) string {
+	scheme, rest, ok := strings.Cut(proxy, "://")
+	if !ok {
+		return proxy
+	}
+	// The password may itself hold an unescaped "@"
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return proxy
+	}
+	userinfo, addr := rest[:at], rest[at+1:]
+	if user, _, ok := strings.Cut(userinfo, ":"); ok {
+		userinfo = user + ":***"
+	}
+	return scheme + "://" + userinfo + "@" + addr
+}
+
+// proxyAddr returns the proxy's host:port, filling in the usual port.
+func proxyAddr(u *url.URL, defaultPort int) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(defaultPort))
+}
+
+// httpConnect opens a tunnel with an HTTP CONNECT request.
+func httpConnect(dial dialFunc, u *url.URL, addr string) (net.Conn, error) {
+	conn, err := dial("tcp", proxyAddr(u, 8080))
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req += "Proxy-Authorization: Basic " + creds + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	// The SSH banner may already sit in the reader's buffer
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn is a net.Conn whose reads drain a bufio.Reader first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// socks5Connect opens a tunnel through a SOCKS5 proxy (RFC 1928), with
+// optional username/password authentication (RFC 1929). The target name
+// is resolved by the proxy.
+func socks5Connect(dial dialFunc, u *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || len(host) > 255 {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+
+	conn, err := dial("tcp", proxyAddr(u, 1080))
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	if err := socks5Handshake(conn, u.User, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func socks5Handshake(conn net.Conn, user *url.Userinfo, host string, port int) error {
+	// Greeting: offer no auth, plus username/password when configured
+	methods := []byte{0x00}
+	if user != nil {
+		methods = append(methods, 0x02)
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read greeting: %w", err)
+	}
+	if reply[0] != 0x05 {
+		return errors.New("not a SOCKS5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		pass, _ := user.Password()
+		name := user.Username()
+		if len(name) > 255 || len(pass) > 255 {
+			return errors.New("username or password too long")
+		}
+		msg := []byte{0x01, byte(len(name))}
+		msg = append(msg, name...)
+		msg = append(msg, byte(len(pass)))
+		msg = append(msg, pass...)
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("read auth reply: %w", err)
+		}
+		if reply[1] != 0x00 {
+			return errors.New("authentication rejected")
+		}
+	default:
+		return errors.New("no acceptable authentication method")
+	}
+
+	// CONNECT by domain name
+	req := []byte{0x05, 0x01, 0x00, 0x03, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return fmt.Errorf("read connect reply: %w", err)
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("connect %s:%d failed (code %d)", host, port, head[1])
+	}
+
+	// Skip the bound address
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("bad address type %d in reply", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return err
+	}
+	return nil
+}
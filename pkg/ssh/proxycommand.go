@@ -0,0 +1,211 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxProxyStderr bounds the proxy command output kept for error messages.
+const maxProxyStderr = 4 * 1024
+
+// ExpandProxyCommand fills in an OpenSSH-style proxy command: %h is the
+// address to connect to, %p the port, %r the user and %% a literal %.
+// The command runs through the shell, so a host or user with characters
+// other than letters, digits and "._-:@[]" is refused rather than spliced
+// in.
+func ExpandProxyCommand(command, host string, port int, user string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		if command[i] != '%' || i == len(command)-1 {
+			b.WriteByte(command[i])
+			continue
+		}
+		i++
+		switch command[i] {
+		case 'h', 'r':
+			v := host
+			if command[i] == 'r' {
+				v = user
+			}
+			if strings.ContainsFunc(v, unsafeProxyArg) {
+				return "", fmt.Errorf("proxy-command: %%%c %q has characters the shell would interpret", command[i], v)
+			}
+			b.WriteString(v)
+		case 'p':
+			b.WriteString(strconv.Itoa(port))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(command[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// ProxyProgram returns the program a proxy command runs, for logs and
+// messages: its arguments and leading variable assignments may hold
+// tokens.
+func ProxyProgram(command string) string {
+	for _, field := range strings.Fields(command) {
+		name, _, ok := strings.Cut(field, "=")
+		if ok && name != "" && !strings.ContainsFunc(name, notEnvName) {
+			continue
+		}
+		return field
+	}
+	return ""
+}
+
+// notEnvName reports whether r may not appear in a variable name.
+func notEnvName(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_')
+}
+
+// unsafeProxyArg reports whether r may not be spliced into a proxy command.
+func unsafeProxyArg(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("._-:@[]", r))
+}
+
+// dialProxyCommand starts command through the shell and returns its
+// stdin and stdout as the connection, like OpenSSH's ProxyCommand, e.g.
+// "ssh bastion -W %h:%p" or "cloudflared access ssh --hostname %h".
+func dialProxyCommand(command string) (net.Conn, error) {
+	slog.Info("proxy command", "program", ProxyProgram(command))
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Not StdoutPipe: Wait would close it with output still unread
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, waited: make(chan struct{})}
+	cmd.Stdout = w
+	cmd.Stderr = &c.stderr
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, fmt.Errorf("proxy-command: %w", err)
+	}
+	go func() {
+		c.waitErr = cmd.Wait()
+		close(c.waited)
+	}()
+	return c, nil
+}
+
+// commandConn is a net.Conn over a proxy command's stdin and stdout.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr tailBuffer
+
+	waited  chan struct{}
+	waitErr error
+	closed  sync.Once
+}
+
+// Read returns the command's output. When the command has failed, the
+// end of its output becomes an error naming the exit status and what it
+// printed, instead of a bare EOF from the SSH handshake.
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err != nil && n == 0 {
+		select {
+		case <-c.waited:
+			if c.waitErr != nil {
+				return 0, &proxyCommandError{status: c.waitErr, stderr: strings.TrimSpace(c.stderr.String())}
+			}
+		case <-time.After(time.Second):
+		}
+	}
+	return n, err
+}
+
+// proxyCommandError is a proxy command that failed, which counts as a
+// network error.
+type proxyCommandError struct {
+	status error
+	stderr string
+}
+
+func (e *proxyCommandError) Error() string {
+	if e.stderr != "" {
+		return fmt.Sprintf("proxy-command %v: %s", e.status, e.stderr)
+	}
+	return fmt.Sprintf("proxy-command %v", e.status)
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close ends the command: closing its stdin lets it exit on its own,
+// otherwise it is killed.
+func (c *commandConn) Close() error {
+	c.closed.Do(func() {
+		c.stdin.Close()
+		select {
+		case <-c.waited:
+		case <-time.After(time.Second):
+			_ = c.cmd.Process.Kill()
+			<-c.waited
+		}
+		c.stdout.Close()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("proxy-command") }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(strings.Join(c.cmd.Args, " ")) }
+
+// Pipes have no deadlines; the SSH layer has its own timeouts.
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+// commandAddr is the address of a proxy command connection.
+type commandAddr string
+
+func (a commandAddr) Network() string { return "pipe" }
+func (a commandAddr) String() string  { return string(a) }
+
+// tailBuffer keeps the last maxProxyStderr bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf.Write(p)
+	if over := t.buf.Len() - maxProxyStderr; over > 0 {
+		t.buf.Next(over)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.String()
+}
@@ -0,0 +1,47 @@
+package ssh
+
+import "testing"
+
+func TestExpandProxyCommand(t *testing.T) {
+	tests := []struct {
+		command, host, user string
+		want                string
+		wantErr             bool
+	}{
+		{command: "ssh bastion -W %h:%p", host: "db.internal", want: "ssh bastion -W db.internal:22"},
+		{command: "nc %h %p # 100%%", host: "10.0.0.5", want: "nc 10.0.0.5 22 # 100%"},
+		{command: "connect %r@[%h]:%p", host: "::1", user: "deploy", want: "connect deploy@[::1]:22"},
+		{command: "ssh bastion -W %h:%p", host: "x;rm -rf ~", wantErr: true},
+		{command: "ssh -l %r bastion", user: "$(id)", wantErr: true},
+		// Only what is substituted is checked
+		{command: "ssh bastion -W %h:%p", host: "web1", user: "a b", want: "ssh bastion -W web1:22"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandProxyCommand(tt.command, tt.host, 22, tt.user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ExpandProxyCommand(%q, %q, %q) error = %v, want error %v", tt.command, tt.host, tt.user, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandProxyCommand(%q, %q, %q) = %q, want %q", tt.command, tt.host, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestProxyProgram(t *testing.T) {
+	tests := []struct {
+		command, want string
+	}{
+		{"ssh bastion -W %h:%p", "ssh"},
+		{"  /usr/local/bin/cloudflared access ssh --hostname %h", "/usr/local/bin/cloudflared"},
+		{"TOKEN=s3cret cloudflared access ssh --hostname %h", "cloudflared"},
+		{"A=1 B_2=x connect -H proxy:3128 %h %p", "connect"},
+		{"nc\t%h %p", "nc"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ProxyProgram(tt.command); got != tt.want {
+			t.Errorf("ProxyProgram(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
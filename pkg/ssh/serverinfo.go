@@ -0,0 +1,119 @@
+package ssh
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/state"
+	"golang.org/x/crypto/ssh"
+)
+
+// ServerInfo is what the last successful connection to a host learned
+// about its SSH server.
+type ServerInfo struct {
+	// Version is the server's version line, e.g.
+	// "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13".
+	Version string `json:"version"`
+	// The algorithms negotiated with the server, which show what it
+	// supports beyond its version.
+	KeyExchange string    `json:"kex,omitempty"`
+	HostKey     string    `json:"host_key,omitempty"`
+	Cipher      string    `json:"cipher,omitempty"`
+	MAC         string    `json:"mac,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// Software returns the version line without its protocol prefix, e.g.
+// "OpenSSH_9.6p1 Ubuntu-3ubuntu13".
+func (i *ServerInfo) Software() string {
+	if _, software, ok := strings.Cut(strings.TrimPrefix(i.Version, "SSH-"), "-"); ok {
+		return software
+	}
+	return i.Version
+}
+
+// Algorithms describes the negotiated algorithms on one line.
+func (i *ServerInfo) Algorithms() string {
+	var parts []string
+	for _, a := range []struct{ name, value string }{
+		{"kex", i.KeyExchange},
+		{"host key", i.HostKey},
+		{"cipher", i.Cipher},
+		{"mac", i.MAC},
+	} {
+		if a.value != "" {
+			parts = append(parts, a.name+" "+a.value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// serverInfoOf reads the server's version and negotiated algorithms off an
+// established connection.
+func serverInfoOf(client *ssh.Client) ServerInfo {
+	info := ServerInfo{Version: string(client.ServerVersion()), At: time.Now()}
+	if conn, ok := client.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		algs := conn.Algorithms()
+		info.KeyExchange = algs.KeyExchange
+		info.HostKey = algs.HostKey
+		info.Cipher = algs.Read.Cipher
+		// AEAD ciphers need no MAC and negotiate none
+		info.MAC = algs.Read.MAC
+	}
+	return info
+}
+
+// RecordServerInfo remembers the server behind client, just connected to
+// host. Like the liveness cache it is best effort; write errors are
+// dropped.
+func RecordServerInfo(host *config.Host, client *ssh.Client) {
+	if client == nil {
+		return
+	}
+	info := serverInfoOf(client)
+	_ = state.Update(serverInfoFile, func(data []byte) ([]byte, error) {
+		infos := parseServerInfo(data)
+		infos[serverKey(host)] = info
+		return json.MarshalIndent(infos, "", "  ")
+	})
+}
+
+// KnownServer returns what was recorded about host's server, if anything.
+func KnownServer(host *config.Host) (*ServerInfo, bool) {
+	info, ok := loadServerInfo()[serverKey(host)]
+	if !ok {
+		return nil, false
+	}
+	return &info, true
+}
+
+// serverKey identifies host's server by address: unlike liveness, the
+// route taken to reach it doesn't change what it runs.
+func serverKey(host *config.Host) string {
+	return net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+}
+
+// serverInfoFile is where servers are recorded in the state directory.
+const serverInfoFile = "servers.json"
+
+// loadServerInfo reads the recorded servers, treating a missing or corrupt
+// file as empty.
+func loadServerInfo() map[string]ServerInfo {
+	path, err := state.Path(serverInfoFile)
+	if err != nil {
+		return make(map[string]ServerInfo)
+	}
+	data, _ := os.ReadFile(path)
+	return parseServerInfo(data)
+}
+
+func parseServerInfo(data []byte) map[string]ServerInfo {
+	infos := make(map[string]ServerInfo)
+	_ = json.Unmarshal(data, &infos)
+	return infos
+}
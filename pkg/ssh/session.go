@@ -1,23 +1,87 @@
 package ssh
 
 import (
+	"cmp"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"runtime"
+	"slices"
+	"strings"
 
+	"github.com/ai-help-me/sshm/pkg/config"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
+// Session is an interactive shell session on a remote host, as the session
+// runner and terminal.Manager drive it. WrapSession adapts a crypto/ssh
+// session; mock sessions in tests, and backends other than a direct SSH
+// connection, implement it themselves.
+type Session interface {
+	// RequestPty asks for a pseudo-terminal of the given type and size.
+	RequestPty(term string, height, width int, modes ssh.TerminalModes) error
+
+	// Setenv sets an environment variable for the shell to start with.
+	Setenv(name, value string) error
+
+	// StdinPipe returns the shell's input.
+	StdinPipe() (io.WriteCloser, error)
+
+	// SetOutput sets where the shell's output and errors are copied to.
+	// Call it before Shell.
+	SetOutput(stdout, stderr io.Writer)
+
+	// Shell starts the login shell.
+	Shell() error
+
+	// Wait waits for the shell to exit and its output to be copied.
+	Wait() error
+
+	// WindowChange tells the remote terminal its new size.
+	WindowChange(height, width int) error
+
+	// Close ends the session.
+	Close() error
+}
+
+// sshSession is a Session over a crypto/ssh session, which takes its
+// output writers as fields.
+type sshSession struct {
+	*ssh.Session
+}
+
+// WrapSession returns session as a Session.
+func WrapSession(session *ssh.Session) Session {
+	return sshSession{session}
+}
+
+func (s sshSession) SetOutput(stdout, stderr io.Writer) {
+	s.Stdout = stdout
+	s.Stderr = stderr
+}
+
 // SessionConfig contains PTY configuration.
 type SessionConfig struct {
 	Term   string
 	Height int
 	Width  int
 	Modes  ssh.TerminalModes
+	// Env is sent to the shell along with TERM. Servers only take the
+	// variables their AcceptEnv allows and drop the rest.
+	Env map[string]string
 }
 
+// defaultTerm is the terminal type asked for when neither the host nor
+// the local environment names one.
+const defaultTerm = "xterm-256color"
+
 // DefaultSessionConfig returns default PTY configuration with actual terminal size.
-func DefaultSessionConfig() *SessionConfig {
+// The terminal type is host's term if set (host may be nil), else the
+// local $TERM; the local locale (LANG, LC_*) is passed on, and the remote
+// line discipline told the input is UTF-8 when the locale says so.
+func DefaultSessionConfig(host *config.Host) *SessionConfig {
 	width, height := 80, 24
 
 	// Get actual terminal size
@@ -27,34 +91,71 @@ func DefaultSessionConfig() *SessionConfig {
 		}
 	}
 
+	termType := cmp.Or(os.Getenv("TERM"), defaultTerm)
+	if host != nil && host.Term != "" {
+		termType = host.Term
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,     // enable echo
+		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+	}
+	// Backspace over a multibyte character erases all of it
+	if utf8Locale() {
+		modes[ssh.IUTF8] = 1
+	}
+
 	return &SessionConfig{
-		Term:   "xterm-256color",
+		Term:   termType,
 		Height: height,
 		Width:  width,
-		Modes: ssh.TerminalModes{
-			ssh.ECHO:          1,     // enable echo
-			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
-			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
-		},
+		Modes:  modes,
+		Env:    localeEnv(),
+	}
+}
+
+// localeEnv returns the locale variables set locally, which OpenSSH
+// also sends by default (SendEnv LANG LC_*).
+func localeEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if (name == "LANG" || strings.HasPrefix(name, "LC_")) && value != "" {
+			env[name] = value
+		}
 	}
+	return env
+}
+
+// utf8Locale reports whether the local terminal speaks UTF-8: the first
+// of LC_ALL, LC_CTYPE and LANG set names a UTF-8 codeset. Go writes to
+// the Windows console in UTF-8 regardless.
+func utf8Locale() bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	locale := strings.ToLower(cmp.Or(os.Getenv("LC_ALL"), os.Getenv("LC_CTYPE"), os.Getenv("LANG")))
+	return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
 }
 
 // RequestPTY requests a pseudo-terminal for the session.
-func RequestPTY(session *ssh.Session, config *SessionConfig) error {
+func RequestPTY(session Session, config *SessionConfig) error {
 	if config == nil {
-		config = DefaultSessionConfig()
+		config = DefaultSessionConfig(nil)
 	}
 
 	if err := session.RequestPty(config.Term, config.Height, config.Width, config.Modes); err != nil {
 		return fmt.Errorf("request pty: %w", err)
 	}
 
-	// Set TERM environment variable to ensure compatibility.
-	// SSH protocol automatically forwards the local TERM to the remote server,
-	// which can cause issues with newer terminal types (e.g., xterm-ghostty)
-	// that may not have terminfo definitions on remote servers.
-	// We explicitly set it to a widely-supported terminal type.
+	// The pty request carries the terminal type, but some servers only
+	// set TERM from the environment; sending it as well makes the shell
+	// see the type asked for.
 	session.Setenv("TERM", config.Term)
+	for _, name := range slices.Sorted(maps.Keys(config.Env)) {
+		// Refused unless the server accepts it, which is fine
+		session.Setenv(name, config.Env[name])
+	}
 
 	return nil
 }
@@ -70,7 +171,7 @@ func SetupPipes(session *ssh.Session) {
 //
 // IMPORTANT: Caller must use terminal.Manager.EnterRaw() before calling this
 // and terminal.Manager.Restore() after the shell ends.
-func StartShell(session *ssh.Session) error {
+func StartShell(session Session) error {
 	if err := session.Shell(); err != nil {
 		return fmt.Errorf("start shell: %w", err)
 	}
@@ -78,6 +179,15 @@ func StartShell(session *ssh.Session) error {
 	return nil
 }
 
+// StartCommand starts a single command on the remote host without
+// waiting for it to finish. Use session.Wait() to collect its exit status.
+func StartCommand(session *ssh.Session, cmd string) error {
+	if err := session.Start(cmd); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+	return nil
+}
+
 // RunCommand executes a single command on the remote host.
 func RunCommand(session *ssh.Session, cmd string) error {
 	if err := session.Run(cmd); err != nil {
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"golang.org/x/crypto/ssh"
+)
+
+// Any Session can own the terminal.
+var _ terminal.Session = Session(nil)
+
+// fakeSession records what is asked of it.
+type fakeSession struct {
+	term          string
+	height, width int
+	env           map[string]string
+	started       bool
+	shellErr      error
+}
+
+func (f *fakeSession) RequestPty(term string, height, width int, _ ssh.TerminalModes) error {
+	f.term, f.height, f.width = term, height, width
+	return nil
+}
+
+func (f *fakeSession) Setenv(name, value string) error {
+	if f.env == nil {
+		f.env = make(map[string]string)
+	}
+	f.env[name] = value
+	return nil
+}
+
+func (f *fakeSession) Shell() error {
+	f.started = true
+	return f.shellErr
+}
+
+func (f *fakeSession) WindowChange(height, width int) error {
+	f.height, f.width = height, width
+	return nil
+}
+
+func (f *fakeSession) StdinPipe() (io.WriteCloser, error) { return nil, errors.New("no stdin") }
+func (f *fakeSession) SetOutput(stdout, stderr io.Writer) {}
+func (f *fakeSession) Wait() error                        { return nil }
+func (f *fakeSession) Close() error                       { return nil }
+
+func TestRequestPTY(t *testing.T) {
+	s := &fakeSession{}
+	cfg := &SessionConfig{Term: "xterm-256color", Height: 40, Width: 120, Env: map[string]string{"LANG": "de_DE.UTF-8"}}
+	if err := RequestPTY(s, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s.term != "xterm-256color" || s.height != 40 || s.width != 120 {
+		t.Errorf("pty = %s %dx%d, want xterm-256color 120x40", s.term, s.width, s.height)
+	}
+	// The remote TERM is the one asked for, not the local terminal's
+	if s.env["TERM"] != "xterm-256color" {
+		t.Errorf("TERM = %q, want xterm-256color", s.env["TERM"])
+	}
+	if s.env["LANG"] != "de_DE.UTF-8" {
+		t.Errorf("LANG = %q, want de_DE.UTF-8", s.env["LANG"])
+	}
+}
+
+func TestDefaultSessionConfig(t *testing.T) {
+	t.Setenv("TERM", "xterm-ghostty")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_CTYPE", "")
+	t.Setenv("LANG", "ja_JP.UTF-8")
+
+	cfg := DefaultSessionConfig(nil)
+	if cfg.Term != "xterm-ghostty" {
+		t.Errorf("term = %q, want the local $TERM", cfg.Term)
+	}
+	if cfg.Env["LANG"] != "ja_JP.UTF-8" {
+		t.Errorf("LANG = %q, want the local locale passed on", cfg.Env["LANG"])
+	}
+	if cfg.Modes[ssh.IUTF8] != 1 {
+		t.Error("IUTF8 not set for a UTF-8 locale")
+	}
+
+	if cfg := DefaultSessionConfig(&config.Host{Term: "xterm-256color"}); cfg.Term != "xterm-256color" {
+		t.Errorf("term = %q, want the host's", cfg.Term)
+	}
+
+	t.Setenv("TERM", "")
+	if cfg := DefaultSessionConfig(nil); cfg.Term != defaultTerm {
+		t.Errorf("term = %q without $TERM, want %s", cfg.Term, defaultTerm)
+	}
+}
+
+func TestStartShell(t *testing.T) {
+	s := &fakeSession{shellErr: errors.New("refused")}
+	err := StartShell(s)
+	if !s.started {
+		t.Fatal("shell not started")
+	}
+	if err == nil || !errors.Is(err, s.shellErr) {
+		t.Errorf("StartShell error = %v, want it to wrap %v", err, s.shellErr)
+	}
+}
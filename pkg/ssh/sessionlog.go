@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+// SessionLog records the terminal output of a session to a file, as raw
+// text like script(1) or as an asciinema v2 cast.
+//
+// Writes never fail: a log that can't be written must not cut the session
+// short. The first error is returned by Close instead.
+type SessionLog struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	format string
+	start  time.Time
+	carry  []byte // incomplete UTF-8 sequence held for the next event
+	err    error
+}
+
+// castHeader is the first line of an asciinema v2 cast.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewSessionLog starts a log in format (config.SessionLogText or
+// config.SessionLogAsciinema) on w, for a terminal of width by height
+// showing the session titled title. The log owns w.
+func NewSessionLog(w io.WriteCloser, format string, width, height int, title string) (*SessionLog, error) {
+	l := &SessionLog{w: w, format: format, start: time.Now()}
+
+	var header []byte
+	switch format {
+	case config.SessionLogText:
+		header = fmt.Appendf(nil, "Script started on %s [%s]\n", l.start.Format(time.RFC3339), title)
+	case config.SessionLogAsciinema:
+		var err error
+		header, err = json.Marshal(castHeader{
+			Version:   2,
+			Width:     width,
+			Height:    height,
+			Timestamp: l.start.Unix(),
+			Title:     title,
+			Env:       map[string]string{"TERM": os.Getenv("TERM")},
+		})
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, '\n')
+	default:
+		return nil, fmt.Errorf("unknown session log format %q", format)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write records p as output of the session.
+func (l *SessionLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return len(p), nil
+	}
+
+	if l.format == config.SessionLogText {
+		_, l.err = l.w.Write(p)
+		return len(p), nil
+	}
+
+	// Cast events are JSON strings, so a character split across writes
+	// waits for the rest of it
+	data := append(l.carry, p...)
+	l.carry = nil
+	if cut := incompleteUTF8(data); cut > 0 {
+		l.carry = append([]byte(nil), data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+	if len(data) > 0 {
+		l.event(data)
+	}
+	return len(p), nil
+}
+
+// event writes an output event to the cast. Callers hold mu.
+func (l *SessionLog) event(data []byte) {
+	line, err := json.Marshal([]any{time.Since(l.start).Seconds(), "o", string(data)})
+	if err != nil {
+		l.err = err
+		return
+	}
+	_, l.err = l.w.Write(append(line, '\n'))
+}
+
+// Close ends the log and closes its file. It returns the first error the
+// log ran into.
+func (l *SessionLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		switch {
+		case l.format == config.SessionLogText:
+			_, l.err = fmt.Fprintf(l.w, "\nScript done on %s\n", time.Now().Format(time.RFC3339))
+		case len(l.carry) > 0:
+			l.event(l.carry)
+		}
+	}
+	if err := l.w.Close(); l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// incompleteUTF8 returns how many bytes at the end of p start a UTF-8
+// sequence that continues past it.
+func incompleteUTF8(p []byte) int {
+	for n := 1; n <= utf8.UTFMax-1 && n <= len(p); n++ {
+		c := p[len(p)-n]
+		if c < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(p[len(p)-n:]) {
+				return n
+			}
+			return 0
+		}
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package ssh
+
+import (
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+// warmDial is a connection started ahead of time for the host under the
+// TUI cursor, so selecting it doesn't wait for the handshake.
+type warmDial struct {
+	host *config.Host
+	done chan struct{}
+
+	mu        sync.Mutex
+	client    *Client
+	chain     *JumpChain
+	err       error
+	cancelled bool
+}
+
+// warm holds the single pre-dial in progress.
+var warm struct {
+	sync.Mutex
+	current *warmDial
+}
+
+// Prewarm starts connecting to host in the background, replacing any
+// pre-dial for another host. Steps that would need to prompt (an unknown
+// host key) make the pre-dial fail quietly; the real connection then
+// prompts as usual. Hosts that were recently unreachable are skipped.
+func Prewarm(host *config.Host) {
+	warm.Lock()
+	defer warm.Unlock()
+
+	if warm.current != nil {
+		if warm.current.host == host {
+			return
+		}
+		warm.current.cancel()
+	}
+
+	// Don't wait out a timeout on a host known to be down
+	if _, ok := CachedUnreachable(host); ok {
+		return
+	}
+
+	w := &warmDial{host: host, done: make(chan struct{})}
+	warm.current = w
+	go w.dial()
+}
+
+// CancelPrewarm discards the pending pre-dial, closing its connection.
+func CancelPrewarm() {
+	warm.Lock()
+	defer warm.Unlock()
+
+	if warm.current != nil {
+		warm.current.cancel()
+		warm.current = nil
+	}
+}
+
+// TakeWarm hands over the pre-dialed connection for host, waiting for it
+// if the dial is still in flight. Exactly one of the results is non-nil
+// on success; both are nil when there is nothing usable.
+func TakeWarm(host *config.Host) (*Client, *JumpChain) {
+	warm.Lock()
+	w := warm.current
+	warm.current = nil
+	warm.Unlock()
+
+	if w == nil {
+		return nil, nil
+	}
+	if w.host != host {
+		w.cancel()
+		return nil, nil
+	}
+
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return nil, nil
+	}
+	// Reconnects from here on may prompt again
+	if w.client != nil {
+		w.client.warm = false
+	}
+	if w.chain != nil {
+		w.chain.warm = false
+	}
+	return w.client, w.chain
+}
+
+// dial connects without prompting.
+func (w *warmDial) dial() {
+	defer close(w.done)
+
+	var client *Client
+	var chain *JumpChain
+	var err error
+
+	if len(w.host.Jump) > 0 {
+		chain = NewJumpChainWithTarget(w.host)
+		chain.warm = true
+		_, err = chain.Connect()
+	} else if client, err = NewClient(w.host); err == nil {
+		client.warm = true
+		err = client.Dial()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err != nil {
+		w.err = err
+		return
+	}
+	if w.cancelled {
+		closeWarm(client, chain)
+		return
+	}
+	w.client, w.chain = client, chain
+}
+
+// cancel closes the connection, now or once the dial completes.
+func (w *warmDial) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.cancelled = true
+	closeWarm(w.client, w.chain)
+	w.client, w.chain = nil, nil
+}
+
+func closeWarm(client *Client, chain *JumpChain) {
+	if client != nil {
+		client.Close()
+	}
+	if chain != nil {
+		chain.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package ssh
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/scp"
+)
+
+// maxOSC bounds an OSC sequence kept for parsing; longer ones (clipboard
+// writes, images) can't be a directory and are skipped.
+const maxOSC = 4096
+
+// titleDir matches the window title most distributions' shell prompts set,
+// "user@host: dir".
+var titleDir = regexp.MustCompile(`^[^@\s]+@[^:\s]+: ((?:~|/).*)$`)
+
+// WorkDir follows the remote shell's working directory in the session
+// output, so a re-established session can return to it. Shells report it
+// with OSC 7 (file://host/dir), or as part of the window title.
+type WorkDir struct {
+	mu  sync.Mutex
+	dir string
+
+	// OSC parser state, only touched by the output writer
+	state int
+	osc   []byte
+}
+
+// OSC parser states
+const (
+	oscText = iota
+	oscEsc  // after ESC
+	oscBody // inside ESC ] ...
+	oscEnd  // ESC inside the body, possibly ST
+)
+
+// NewWorkDir creates a tracker that knows no directory yet.
+func NewWorkDir() *WorkDir {
+	return &WorkDir{}
+}
+
+// Watch returns w wrapped so the session output written to it is followed.
+func (d *WorkDir) Watch(w io.Writer) io.Writer {
+	return &workDirOutput{w: w, d: d}
+}
+
+// Dir returns the last directory the shell reported, "" if none.
+func (d *WorkDir) Dir() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dir
+}
+
+// Command returns the shell command that changes to Dir, or "" when no
+// directory is known.
+func (d *WorkDir) Command() string {
+	dir := d.Dir()
+	switch {
+	case dir == "":
+		return ""
+	case dir == "~":
+		return "cd"
+	case strings.HasPrefix(dir, "~/"):
+		return "cd ~/" + scp.Quote(dir[2:])
+	default:
+		return "cd " + scp.Quote(dir)
+	}
+}
+
+func (d *WorkDir) scan(p []byte) {
+	for _, b := range p {
+		switch d.state {
+		case oscText:
+			if b == esc {
+				d.state = oscEsc
+			}
+		case oscEsc:
+			switch b {
+			case ']':
+				d.state, d.osc = oscBody, d.osc[:0]
+			case esc:
+			default:
+				d.state = oscText
+			}
+		case oscBody:
+			switch {
+			case b == bel:
+				d.finish()
+				d.state = oscText
+			case b == esc:
+				d.state = oscEnd
+			case len(d.osc) >= maxOSC:
+				d.state = oscText
+			default:
+				d.osc = append(d.osc, b)
+			}
+		case oscEnd:
+			if b == '\\' {
+				d.finish()
+			}
+			d.state = oscText
+		}
+	}
+}
+
+// finish records the directory in a complete OSC sequence, if any.
+func (d *WorkDir) finish() {
+	body := string(d.osc)
+	var dir string
+	switch {
+	case strings.HasPrefix(body, "7;"):
+		u, err := url.Parse(body[2:])
+		if err != nil || u.Scheme != "file" || u.Path == "" {
+			return
+		}
+		dir = u.Path
+	case strings.HasPrefix(body, "0;"), strings.HasPrefix(body, "2;"):
+		m := titleDir.FindStringSubmatch(body[2:])
+		if m == nil {
+			return
+		}
+		dir = m[1]
+	default:
+		return
+	}
+
+	d.mu.Lock()
+	d.dir = dir
+	d.mu.Unlock()
+}
+
+// workDirOutput passes session output on after scanning it.
+type workDirOutput struct {
+	w io.Writer
+	d *WorkDir
+}
+
+func (o *workDirOutput) Write(p []byte) (int, error) {
+	o.d.scan(p)
+	return o.w.Write(p)
+}
@@ -0,0 +1,112 @@
+// Package state locates the directory where sshm keeps runtime state such
+// as the daemon socket and logs. Writers go through Update, which locks
+// the file against other sshm processes.
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+var (
+	resolveOnce sync.Once
+	dir         string
+	dirErr      error
+	warning     string
+)
+
+// Dir returns sshm's state directory, $XDG_STATE_HOME/sshm or
+// ~/.local/state/sshm, creating it if needed. When that can't be written
+// (a read-only or missing home, as in many containers) a private
+// directory under the system temp dir is used instead, and Warning says
+// so.
+func Dir() (string, error) {
+	resolveOnce.Do(resolve)
+	return dir, dirErr
+}
+
+// Path returns the path of name inside the state directory.
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Warning describes why state is kept in a temp directory, or returns ""
+// when the usual directory is in use.
+func Warning() string {
+	resolveOnce.Do(resolve)
+	return warning
+}
+
+func resolve() {
+	preferred, err := preferredDir()
+	if err == nil {
+		if err = ensureWritable(preferred); err == nil {
+			dir = preferred
+			return
+		}
+	}
+
+	// Per user, so sshm processes (and the daemon) agree on it
+	fallback := filepath.Join(os.TempDir(), fmt.Sprintf("sshm-%d", os.Getuid()))
+	if ferr := ensureWritable(fallback); ferr != nil {
+		dirErr = fmt.Errorf("state directory: %w", err)
+		return
+	}
+	if ferr := checkPrivate(fallback); ferr != nil {
+		dirErr = fmt.Errorf("state directory: %w", ferr)
+		return
+	}
+	dir = fallback
+	warning = fmt.Sprintf("state directory unavailable (%v); keeping state in %s", err, fallback)
+}
+
+// preferredDir returns $XDG_STATE_HOME/sshm or ~/.local/state/sshm.
+func preferredDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", fmt.Errorf("get home directory: %w", err)
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "sshm"), nil
+}
+
+// ensureWritable creates dir if needed and checks that files can be
+// created in it.
+func ensureWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	probe, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// checkPrivate refuses a shared temp directory that isn't ours alone: it
+// holds the daemon socket and cached host details.
+func checkPrivate(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	// Windows reports no meaningful permission bits; its temp dir is per user
+	if !info.IsDir() || (runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0) {
+		return fmt.Errorf("%s is not a private directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Update changes the state file name (a path inside the state directory)
+// while holding the lock every sshm process takes to write it, so changes
+// made by concurrent processes are merged rather than lost: change is
+// given what the file holds now (nil when it doesn't exist) and returns
+// the new content, which replaces the file atomically. A nil result
+// leaves the file as it is.
+func Update(name string, change func(data []byte) ([]byte, error)) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	data, err = change(data)
+	if err != nil || data == nil {
+		return err
+	}
+
+	// Replace atomically so readers, which don't lock, never see half a file
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// LockFile takes an exclusive lock for the file at path, waiting while
+// another process holds it, and returns the function that releases it.
+// The lock is held on a hidden file next to it, which is left in place.
+// A process that dies holding the lock releases it.
+func LockFile(path string) (unlock func(), err error) {
+	lockPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	if err := lockExclusive(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
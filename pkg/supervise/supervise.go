@@ -0,0 +1,51 @@
+// Package supervise runs goroutines that are stopped and waited for
+// together, so a session ends with none of its goroutines left behind:
+// each gets a context that Stop cancels, and Stop returns once all of
+// them have.
+package supervise
+
+import (
+	"context"
+	"sync"
+)
+
+// Group is a set of goroutines sharing a context. The zero value is not
+// usable; create one with New.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns an empty group whose context is derived from parent.
+func New(parent context.Context) *Group {
+	ctx, cancel := context.WithCancel(parent)
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs f in a goroutine of the group. f should return soon after ctx
+// is done.
+func (g *Group) Go(f func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f(g.ctx)
+	}()
+}
+
+// Context returns the context the group's goroutines get.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Wait waits for the group's goroutines to return on their own.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
+
+// Stop cancels the group's context and waits for its goroutines to
+// return. It may be called more than once.
+func (g *Group) Stop() {
+	g.cancel()
+	g.wg.Wait()
+}
@@ -0,0 +1,50 @@
+package supervise
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// No test may leave a goroutine running.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestStopCancelsAndWaits(t *testing.T) {
+	g := New(context.Background())
+	returned := make(chan struct{}, 3)
+	for range 3 {
+		g.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			returned <- struct{}{}
+		})
+	}
+
+	g.Stop()
+	if len(returned) != 3 {
+		t.Fatalf("Stop returned with %d of 3 goroutines done", len(returned))
+	}
+	g.Stop()
+}
+
+func TestWaitLeavesContext(t *testing.T) {
+	g := New(context.Background())
+	g.Go(func(context.Context) {})
+	g.Wait()
+	if err := g.Context().Err(); err != nil {
+		t.Fatalf("context done after Wait: %v", err)
+	}
+	g.Stop()
+}
+
+func TestParentCancels(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	g := New(parent)
+	g.Go(func(ctx context.Context) { <-ctx.Done() })
+	cancel()
+	g.Wait()
+}
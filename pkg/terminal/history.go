@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/state"
+)
+
+// History holds the lines a LineEditor has read, kept in a file so they
+// can be recalled in later sessions.
+type History struct {
+	path    string
+	max     int
+	entries []string // Oldest first
+}
+
+// LoadHistory reads the history kept in path, which need not exist yet,
+// keeping the max most recent lines. An empty path keeps history in
+// memory only.
+func LoadHistory(path string, max int) *History {
+	h := &History{path: path, max: max}
+	if path == "" {
+		return h
+	}
+
+	h.entries = readLines(path)
+
+	// Sessions only append, so the file is trimmed when it is read. Other
+	// sessions may be appending meanwhile, so it is read again under the
+	// lock they take
+	if len(h.entries) > max {
+		if unlock, err := state.LockFile(path); err == nil {
+			h.entries = readLines(path)
+			if len(h.entries) > max {
+				h.entries = append([]string(nil), h.entries[len(h.entries)-max:]...)
+				h.rewrite()
+			}
+			unlock()
+		}
+	}
+	return h
+}
+
+// readLines returns the lines of the file at path, none if it can't be
+// read.
+func readLines(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// Add records a line read, skipping blank lines and repeats of the
+// previous line. It implements term.History.
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	// History is a convenience; failing to save it must not get in the way
+	unlock, err := state.LockFile(h.path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	f.WriteString(line + "\n")
+	f.Close()
+}
+
+// Len returns the number of lines recorded. It implements term.History.
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// At returns a recorded line, 0 being the most recent. It implements
+// term.History.
+func (h *History) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// rewrite replaces the file with the lines held in memory. Callers hold
+// the file's lock.
+func (h *History) rewrite() {
+	tmp := h.path + ".tmp"
+	content := strings.Join(h.entries, "\n") + "\n"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+	}
+}
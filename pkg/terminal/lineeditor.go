@@ -0,0 +1,326 @@
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Completer returns the completions of the word that ends at pos in line:
+// the byte offset where the word starts and the words that may replace
+// it. Candidates naming a directory should end in "/".
+type Completer func(line string, pos int) (start int, candidates []string)
+
+// Keys term.Terminal leaves to handleKey. keyInterrupt stands in for
+// Ctrl+C, which term.Terminal would otherwise treat like Ctrl+D, and
+// keyErase for Backspace, which it would handle itself. keyEndSearch is
+// sent ahead of keys that end a reverse search.
+const (
+	keyCancel    = 0x07 // Ctrl+G
+	keySearch    = 0x12 // Ctrl+R
+	keyInterrupt = 0x1c
+	keyErase     = 0x1d
+	keyEndSearch = 0x1e
+)
+
+// LineEditor reads command lines with editing keys, history, reverse
+// search and tab completion. The terminal is in raw mode only while a line
+// is being read; commands run with it restored, so Ctrl+C interrupts them
+// as usual.
+type LineEditor struct {
+	m        *Manager
+	complete Completer
+	term     *term.Terminal
+	prompt   string
+	plain    *bufio.Reader // stdin when it is not a terminal
+	search   *reverseSearch
+}
+
+// reverseSearch is the state of a Ctrl+R search through history.
+type reverseSearch struct {
+	query  string
+	match  int    // History index of the line shown; -1 before a match
+	failed bool   // Nothing older matches query
+	line   string // What was typed before the search, restored on Ctrl+G
+	pos    int
+}
+
+// NewLineEditor creates a line editor reading stdin and echoing to stdout.
+// complete may be nil.
+func (m *Manager) NewLineEditor(complete Completer) *LineEditor {
+	e := &LineEditor{m: m, complete: complete}
+	e.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{&keyReader{r: os.Stdin}, os.Stdout}, "")
+	e.term.AutoCompleteCallback = e.handleKey
+	return e
+}
+
+// SetHistory makes up/down and Ctrl+R recall lines from h, and records the
+// lines read in it.
+func (e *LineEditor) SetHistory(h *History) {
+	e.term.History = h
+}
+
+// ReadLine shows prompt and returns the line typed. Ctrl+C discards the
+// line and starts a new one; Ctrl+D on an empty line returns io.EOF; Ctrl+R
+// searches history for the text typed next. When
+// stdin is not a terminal, plain lines are read without editing.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprint(os.Stdout, prompt)
+		if e.plain == nil {
+			e.plain = bufio.NewReader(os.Stdin)
+		}
+		line, err := e.plain.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		e.term.SetSize(width, height)
+	}
+	e.prompt = prompt
+	e.search = nil
+	e.term.SetPrompt(prompt)
+
+	if err := e.m.enterRawInput(); err != nil {
+		return "", err
+	}
+	line, err := e.term.ReadLine()
+	e.m.Restore()
+
+	switch err {
+	case term.ErrPasteIndicator:
+		err = nil
+	case io.EOF:
+		fmt.Fprintln(os.Stdout)
+	}
+	return line, err
+}
+
+// handleKey implements Ctrl+C, Backspace, Ctrl+R and Tab on top of
+// term.Terminal's editing keys.
+func (e *LineEditor) handleKey(line string, pos int, key rune) (string, int, bool) {
+	if e.search != nil {
+		return e.searchKey(line, pos, key)
+	}
+
+	switch key {
+	case keyInterrupt:
+		// Leave what was typed on screen, marked, like a shell does
+		e.term.Write([]byte(e.prompt + line + "^C\n"))
+		return "", 0, true
+	case keyErase:
+		if pos == 0 {
+			return line, pos, true
+		}
+		_, size := utf8.DecodeLastRuneInString(line[:pos])
+		return line[:pos-size] + line[pos:], pos - size, true
+	case keySearch:
+		e.search = &reverseSearch{match: -1, line: line, pos: pos}
+		e.showSearch()
+		return line, pos, true
+	case '\t':
+		return e.completeWord(line, pos)
+	}
+	return "", 0, false
+}
+
+// searchKey handles a key typed during a reverse search. Text narrows the
+// search, Ctrl+R moves on to an older match, Ctrl+G and Ctrl+C give up,
+// and any other key keeps the match and goes back to editing it.
+func (e *LineEditor) searchKey(line string, pos int, key rune) (string, int, bool) {
+	rs := e.search
+	switch key {
+	case keySearch:
+		return e.findMatch(rs.match+1, line, pos)
+	case keyErase:
+		if rs.query == "" {
+			return line, pos, true
+		}
+		_, size := utf8.DecodeLastRuneInString(rs.query)
+		rs.query = rs.query[:len(rs.query)-size]
+		rs.match = -1
+		return e.findMatch(0, line, pos)
+	case keyCancel, keyInterrupt:
+		e.endSearch()
+		return rs.line, rs.pos, true
+	case keyEndSearch:
+		e.endSearch()
+		return line, pos, true
+	}
+
+	if key < ' ' {
+		e.endSearch()
+		return e.handleKey(line, pos, key)
+	}
+	rs.query += string(key)
+	return e.findMatch(max(rs.match, 0), line, pos)
+}
+
+// findMatch shows the most recent history line from index from on that
+// contains the query, or marks the search failed and keeps line.
+func (e *LineEditor) findMatch(from int, line string, pos int) (string, int, bool) {
+	rs := e.search
+	history := e.term.History
+	for i := from; i < history.Len(); i++ {
+		entry := history.At(i)
+		// Ctrl+R skips older copies of the line already shown
+		if i != rs.match && entry == line && rs.match >= 0 {
+			continue
+		}
+		if at := strings.Index(entry, rs.query); at >= 0 {
+			rs.match, rs.failed = i, false
+			e.showSearch()
+			return entry, at, true
+		}
+	}
+	rs.failed = true
+	e.showSearch()
+	return line, pos, true
+}
+
+// showSearch replaces the prompt with the search's.
+func (e *LineEditor) showSearch() {
+	prompt := "(reverse-i-search)`" + e.search.query + "': "
+	if e.search.failed {
+		prompt = "(failed " + prompt[1:]
+	}
+	e.term.SetPrompt(prompt)
+	e.term.Write(nil)
+}
+
+// endSearch puts the shell's prompt back.
+func (e *LineEditor) endSearch() {
+	e.search = nil
+	e.term.SetPrompt(e.prompt)
+	e.term.Write(nil)
+}
+
+// completeWord extends the word before the cursor as far as all candidates
+// agree, or lists them when it cannot be extended.
+func (e *LineEditor) completeWord(line string, pos int) (string, int, bool) {
+	if e.complete == nil {
+		return line, pos, true
+	}
+	start, candidates := e.complete(line, pos)
+	if len(candidates) == 0 {
+		return line, pos, true
+	}
+
+	word := line[start:pos]
+	common := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(common, "/") {
+		common += " "
+	}
+	if len(common) > len(word) {
+		return line[:start] + common + line[pos:], start + len(common), true
+	}
+
+	// Show only the last path element of each choice
+	dir := word[:strings.LastIndex(word, "/")+1]
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = strings.TrimPrefix(c, dir)
+	}
+	width, _, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	e.term.Write([]byte(columns(names, width)))
+	return line, pos, true
+}
+
+// commonPrefix returns the longest prefix shared by words.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// Don't split a multi-byte character
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+// columns lays words out in columns that fit width, filled top to bottom
+// like ls.
+func columns(words []string, width int) string {
+	colWidth := 0
+	for _, w := range words {
+		colWidth = max(colWidth, len(w)+2)
+	}
+	cols := max(1, width/colWidth)
+	rows := (len(words) + cols - 1) / cols
+
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			i := c*rows + r
+			if i >= len(words) {
+				break
+			}
+			if c+1 < cols && i+rows < len(words) {
+				fmt.Fprintf(&b, "%-*s", colWidth, words[i])
+			} else {
+				b.WriteString(words[i])
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// keyReader passes Ctrl+C and Backspace to term.Terminal as keyInterrupt
+// and keyErase, and precedes Enter, escape sequences and the control keys
+// term.Terminal handles itself with keyEndSearch.
+type keyReader struct {
+	r       io.Reader
+	pending []byte
+	err     error
+}
+
+func (kr *keyReader) Read(p []byte) (int, error) {
+	if len(kr.pending) == 0 {
+		if kr.err != nil {
+			return 0, kr.err
+		}
+		buf := make([]byte, len(p))
+		n, err := kr.r.Read(buf)
+		kr.err = err
+		for _, b := range buf[:n] {
+			switch b {
+			case 0x03:
+				b = keyInterrupt
+			case 0x08, 0x7f:
+				b = keyErase
+			case keyCancel, keySearch, '\t':
+			default:
+				if b < ' ' {
+					kr.pending = append(kr.pending, keyEndSearch)
+				}
+			}
+			kr.pending = append(kr.pending, b)
+		}
+		if len(kr.pending) == 0 {
+			kr.err = nil
+			return 0, err
+		}
+	}
+	n := copy(p, kr.pending)
+	kr.pending = kr.pending[n:]
+	return n, nil
+}
@@ -1,11 +1,15 @@
 package terminal
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 
-	"golang.org/x/crypto/ssh"
+	"github.com/ai-help-me/sshm/pkg/supervise"
 	"golang.org/x/term"
 )
 
@@ -17,27 +21,34 @@ const (
 	StateRaw                         // Raw mode (SSH shell only)
 )
 
+// Session is the remote session that owns the terminal in raw mode, which
+// is told when the window is resized. ssh.Session, and the crypto/ssh
+// session it wraps, have this method.
+type Session interface {
+	WindowChange(height, width int) error
+}
+
 // Manager manages terminal lifecycle.
 //
 // CRITICAL: This is the ONLY place in the codebase allowed to call:
 // - term.MakeRaw()
 // - term.Restore()
 //
-// Raw mode is ONLY used during SSH interactive shell sessions.
-// TUI, SFTP shell, and all other interactions use cooked mode.
+// Raw mode is ONLY used during SSH interactive shell sessions, and by the
+// line editor while a command line is typed. TUI, SFTP commands, and all
+// other interactions use cooked mode.
 type Manager struct {
 	mu            sync.Mutex
 	originalState *term.State
 	inRawMode     bool
-	session       *ssh.Session
-	stopResize    chan struct{}
+	session       Session
+	tasks         *supervise.Group // resize handling, stopped by Restore
 }
 
 // New creates a new terminal manager and saves the original terminal state.
 func New() *Manager {
 	m := &Manager{
-		inRawMode:  false,
-		stopResize: make(chan struct{}),
+		inRawMode: false,
 	}
 
 	// Save original terminal state immediately when creating the manager
@@ -66,6 +77,9 @@ func (m *Manager) Cleanup() {
 // 2. Switches to raw mode
 // 3. Starts listening for window resize events
 //
+// When stdin is not a terminal (cron, CI) there is no mode to change, and
+// it does nothing.
+//
 // Usage:
 //
 //	session, _ := client.Session()
@@ -73,13 +87,16 @@ func (m *Manager) Cleanup() {
 //	    return err
 //	}
 //	defer termMgr.Restore()
-func (m *Manager) EnterRaw(session *ssh.Session) error {
+func (m *Manager) EnterRaw(session Session) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.inRawMode {
 		return fmt.Errorf("already in raw mode")
 	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
 
 	// Save original terminal state (if not already saved)
 	if m.originalState == nil {
@@ -101,26 +118,53 @@ func (m *Manager) EnterRaw(session *ssh.Session) error {
 
 	m.inRawMode = true
 	m.session = session
-	m.stopResize = make(chan struct{})
+	m.tasks = supervise.New(context.Background())
 
 	// Send initial window size to remote session
 	// Note: updateWindowSize has timeout protection, but session.WindowChange()
 	// may still hang due to SSH library bug (https://github.com/golang/go/issues/69484)
 	// We call it in a goroutine to avoid blocking EnterRaw()
-	go func() {
+	m.tasks.Go(func(context.Context) {
 		m.updateWindowSize()
-	}()
+	})
 
 	// Start window resize handler
-	go m.handleWinch()
+	m.tasks.Go(m.handleWinch)
+
+	return nil
+}
+
+// enterRawInput switches the terminal to raw mode for the line editor,
+// which reads keys one at a time. No session is attached; Restore returns
+// to cooked mode as after EnterRaw.
+func (m *Manager) enterRawInput() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inRawMode {
+		return fmt.Errorf("already in raw mode")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("stdin is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("make raw: %w", err)
+	}
+	if m.originalState == nil {
+		m.originalState = state
+	}
 
+	m.inRawMode = true
 	return nil
 }
 
 // Restore restores the terminal to cooked mode.
 //
 // Safe to call multiple times (idempotent).
-// Stops the window resize handler but doesn't wait for it to finish.
+// Stops the window resize handler and waits for it to finish.
 func (m *Manager) Restore() error {
 	m.mu.Lock()
 
@@ -133,12 +177,11 @@ func (m *Manager) Restore() error {
 	// This prevents updateWindowSize from trying to use the session
 	m.inRawMode = false
 
-	// Save reference to stop channel before clearing
-	stopCh := m.stopResize
+	// Take the resize handler; the next EnterRaw starts its own
+	tasks := m.tasks
 
-	// Clear session and create new channel for next EnterRaw
 	m.session = nil
-	m.stopResize = make(chan struct{})
+	m.tasks = nil
 
 	// Restore terminal using the original state (while holding lock)
 	fd := int(os.Stdin.Fd())
@@ -147,21 +190,58 @@ func (m *Manager) Restore() error {
 			m.mu.Unlock()
 			return fmt.Errorf("restore terminal: %w", err)
 		}
-	} else {
 	}
 
 	m.mu.Unlock()
 
-	// Close the stop channel AFTER unlocking to signal goroutine to exit
-	// This prevents deadlock because goroutine needs the lock to call updateWindowSize
-	close(stopCh)
-
-	// DON'T wait for goroutine - let it exit on its own in the next select iteration
-	// This prevents Restore() from blocking
+	// Stop the handler AFTER unlocking: it needs the lock to call
+	// updateWindowSize, which gives up on a hung session after a moment,
+	// so this doesn't block for long
+	if tasks != nil {
+		tasks.Stop()
+	}
 
 	return nil
 }
 
+// Suspend gives the terminal back to the shell sshm was started from and
+// stops sshm, like Ctrl+Z does to other programs. When sshm is continued
+// the terminal goes back to raw mode for the same session, which is sent
+// the window size in case it changed meanwhile.
+func (m *Manager) Suspend() error {
+	m.mu.Lock()
+	session, raw := m.session, m.inRawMode
+	m.mu.Unlock()
+	if !raw {
+		return errors.New("not in raw mode")
+	}
+
+	if err := m.Restore(); err != nil {
+		return err
+	}
+	stopErr := stopProcess()
+	if err := m.EnterRaw(session); err != nil {
+		return err
+	}
+	return stopErr
+}
+
+// SwitchSession makes session the one window size changes go to, for
+// another shell taking over the terminal, and returns the previous one.
+// The new session is sent the current size straight away.
+func (m *Manager) SwitchSession(session Session) Session {
+	m.mu.Lock()
+	prev := m.session
+	m.session = session
+	tasks := m.tasks
+	m.mu.Unlock()
+
+	if tasks != nil {
+		tasks.Go(func(context.Context) { m.updateWindowSize() })
+	}
+	return prev
+}
+
 // InRaw returns true if currently in raw mode.
 func (m *Manager) InRaw() bool {
 	m.mu.Lock()
@@ -178,3 +258,26 @@ func (m *Manager) State() TerminalState {
 	}
 	return StateCooked
 }
+
+// Prompt writes question to stderr and reads one line from stdin in cooked
+// mode, without echoing it when echo is false. It is meant for
+// authentication prompts before the shell starts; it refuses to run while
+// a session owns the terminal in raw mode.
+func (m *Manager) Prompt(question string, echo bool) (string, error) {
+	if m.InRaw() {
+		return "", errors.New("cannot prompt while the terminal is in raw mode")
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, question)
+	if !echo {
+		answer, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(answer), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
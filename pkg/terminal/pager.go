@@ -0,0 +1,131 @@
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Page writes text to stdout, a screenful at a time when it is taller
+// than the terminal. $PAGER shows it when set; otherwise the built-in
+// pager does: space or f for the next page, b for the previous one, j,
+// Enter or Down and k or Up to scroll a line, g and G for the top and
+// the end, q to quit. Text that fits, or stdout that is not a terminal,
+// is written as is.
+func (m *Manager) Page(text string) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	width, height, err := term.GetSize(out)
+	if err != nil || !term.IsTerminal(in) || height < 2 {
+		_, err := io.WriteString(os.Stdout, text)
+		return err
+	}
+
+	lines := wrapLines(strings.Split(strings.TrimSuffix(text, "\n"), "\n"), width)
+	if len(lines) < height {
+		_, err := io.WriteString(os.Stdout, text)
+		return err
+	}
+
+	if pager := os.Getenv("PAGER"); pager != "" {
+		// A pager that can't be run falls back to the built-in one
+		if err := runPager(pager, text); err == nil {
+			return nil
+		}
+	}
+	return m.page(lines, height-1)
+}
+
+// runPager pipes text through the pager command line.
+func runPager(pager, text string) error {
+	cmd := exec.Command("sh", "-c", pager)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", pager)
+	}
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// page is the built-in pager, showing rows lines at a time above a status
+// line on the alternate screen.
+func (m *Manager) page(lines []string, rows int) error {
+	if err := m.enterRawInput(); err != nil {
+		return err
+	}
+	defer m.Restore()
+	io.WriteString(os.Stdout, "\x1b[?1049h")
+	defer io.WriteString(os.Stdout, "\x1b[?1049l")
+
+	last := len(lines) - rows // Top line of the last page
+	top := 0
+	buf := make([]byte, 16)
+	for {
+		end := min(top+rows, len(lines))
+		fmt.Fprintf(os.Stdout, "\x1b[H\x1b[2J%s\r\n\x1b[7m lines %d-%d of %d (space, b, j, k, q) \x1b[0m",
+			strings.Join(lines[top:end], "\r\n"), top+1, end, len(lines))
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		switch key := string(buf[:n]); key {
+		case "q", "Q", "\x03", "\x1b":
+			return nil
+		case " ", "f", "\x1b[6~":
+			if top == last {
+				return nil
+			}
+			top += rows
+		case "b", "\x1b[5~":
+			top -= rows
+		case "j", "\r", "\x1b[B":
+			top++
+		case "k", "\x1b[A":
+			top--
+		case "g":
+			top = 0
+		case "G":
+			top = last
+		}
+		top = max(0, min(top, last))
+	}
+}
+
+// wrapLines splits lines longer than width, not counting color escape
+// sequences, so each is one row on screen.
+func wrapLines(lines []string, width int) []string {
+	if width < 1 {
+		return lines
+	}
+	var wrapped []string
+	for _, line := range lines {
+		start, cols := 0, 0
+		for i := 0; i < len(line); {
+			if line[i] == '\x1b' {
+				// Skip "ESC [ ... letter"
+				j := i + 1
+				for j < len(line) && (line[j] < '@' || line[j] > '~' || j == i+1) {
+					j++
+				}
+				i = j + 1
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(line[i:])
+			if cols == width {
+				wrapped = append(wrapped, line[start:i])
+				start, cols = i, 0
+			}
+			cols++
+			i += size
+		}
+		wrapped = append(wrapped, line[start:])
+	}
+	return wrapped
+}
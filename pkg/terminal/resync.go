@@ -0,0 +1,39 @@
+package terminal
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// resetModes undoes the modes a misbehaving program can leave set. The
+// scroll region reset moves the cursor, so it is saved around it.
+const resetModes = "\x1b[0m" + // Attributes and colors
+	"\x1b(B" + // ASCII character set
+	"\x1b7\x1b[r\x1b8" + // Whole-screen scroll region
+	"\x1b[?1l\x1b>" + // Normal cursor and keypad keys
+	"\x1b[?7h" + // Line wrapping
+	"\x1b[?1000l\x1b[?1002l\x1b[?1003l\x1b[?1006l" // Mouse reporting
+
+// sessionModes also leaves the alternate screen (clearing it, without
+// moving the cursor), and turns off bracketed paste and shows the cursor,
+// which a full-screen program that died may have left.
+const sessionModes = resetModes + "\x1b[?1047l\x1b[?2004l\x1b[?25h"
+
+// ResetModes writes the sequences that reset attributes, character set,
+// scroll region, keypad and mouse modes to w. It leaves the screen, the
+// cursor's visibility and bracketed paste alone, so the TUI can use it
+// while it owns the terminal.
+func ResetModes(w io.Writer) {
+	io.WriteString(w, resetModes)
+}
+
+// Resync puts the terminal back in a usable state after a remote program
+// had it, in case the program left it in an odd one. It does nothing when
+// stdout is not a terminal.
+func (m *Manager) Resync() {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		io.WriteString(os.Stdout, sessionModes)
+	}
+}
@@ -4,6 +4,7 @@
 package terminal
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,8 +15,9 @@ import (
 
 // handleWinch listens for SIGWINCH signals and forwards window size changes to the SSH session.
 //
-// This runs in a goroutine started by EnterRaw() and stopped by Restore().
-func (m *Manager) handleWinch() {
+// This runs in a goroutine started by EnterRaw() and stopped by Restore(),
+// which cancels ctx.
+func (m *Manager) handleWinch(ctx context.Context) {
 	sigWinch := make(chan os.Signal, 1)
 	signal.Notify(sigWinch, syscall.SIGWINCH)
 
@@ -23,7 +25,7 @@ func (m *Manager) handleWinch() {
 		select {
 		case <-sigWinch:
 			m.updateWindowSize()
-		case <-m.stopResize:
+		case <-ctx.Done():
 			signal.Stop(sigWinch)
 			return
 		}
@@ -49,7 +51,9 @@ func (m *Manager) updateWindowSize() {
 	}
 
 	// Send window change with timeout protection
-	// WindowChange can block if the session is closing
+	// WindowChange can block if the session is closing, so the call is
+	// left behind rather than waited for: it ends with the session
+	// (https://github.com/golang/go/issues/69484)
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
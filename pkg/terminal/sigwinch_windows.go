@@ -4,6 +4,7 @@
 package terminal
 
 import (
+	"context"
 	"os"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 // handleWinch is a no-op on Windows since SIGWINCH is not available.
 // Window resize handling on Windows would require different mechanisms
 // (like console API events), which are not implemented in this SSH client.
-func (m *Manager) handleWinch() {
+func (m *Manager) handleWinch(context.Context) {
 	// No-op on Windows
 }
 
@@ -37,7 +38,9 @@ func (m *Manager) updateWindowSize() {
 	}
 
 	// Send window change with timeout protection
-	// WindowChange can block if the session is closing
+	// WindowChange can block if the session is closing, so the call is
+	// left behind rather than waited for: it ends with the session
+	// (https://github.com/golang/go/issues/69484)
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package terminal
+
+import (
+	"os"
+	"syscall"
+)
+
+// stopProcess stops sshm as Ctrl+Z stops other programs, returning once
+// it is continued (fg or bg).
+func stopProcess() error {
+	return syscall.Kill(os.Getpid(), syscall.SIGTSTP)
+}
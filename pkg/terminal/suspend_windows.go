@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package terminal
+
+import "errors"
+
+// stopProcess fails on Windows, which has no job control.
+func stopProcess() error {
+	return errors.New("suspend is not supported on Windows")
+}
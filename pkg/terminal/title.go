@@ -0,0 +1,30 @@
+package terminal
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// PushTitle sets the window title to title, saving the one it replaces on
+// the terminal's title stack (XTWINOPS 22 and 23), and returns a function
+// that puts the saved title back. Terminals without the stack keep the new
+// title. It does nothing when stdout is not a terminal.
+func (m *Manager) PushTitle(title string) (pop func()) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return func() {}
+	}
+	// Control characters would end the sequence early
+	title = strings.Map(func(r rune) rune {
+		if r < ' ' || (r >= 0x7f && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, title)
+	io.WriteString(os.Stdout, "\x1b[22;0t\x1b]0;"+title+"\x07")
+	return func() {
+		io.WriteString(os.Stdout, "\x1b[23;0t")
+	}
+}
@@ -0,0 +1,123 @@
+// Package theme holds the color palettes shared by the TUI, the SFTP
+// shell and progress bars.
+package theme
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Theme is a palette. Colors are ANSI 256-color numbers, as lipgloss takes
+// them.
+type Theme struct {
+	Primary   string // Borders, titles, the cursor row and selections
+	Secondary string // Group names
+	Error     string
+	Dim       string // Help lines, addresses and other secondary text
+	Info      string // Host details
+	Text      string // Emphasized plain text
+	OnPrimary string // Text on the cursor row
+
+	Prompt  string // SFTP prompt and command names
+	Heading string // SFTP table headings
+
+	// Progress colors progress bars, by colorstring name ("cyan",
+	// "light_yellow"); empty leaves them uncolored.
+	Progress string
+}
+
+// Default is the palette sshm has always used.
+var Default = Theme{
+	Primary:   "86",
+	Secondary: "98",
+	Error:     "196",
+	Dim:       "241",
+	Info:      "242",
+	Text:      "white",
+	OnPrimary: "black",
+	Prompt:    "2",
+	Heading:   "8",
+}
+
+// themes are the palettes selectable with "theme:" in the config.
+var themes = map[string]Theme{
+	"default": Default,
+	// Blue and orange from the Okabe-Ito palette, which stay apart for
+	// red-green color blindness; errors are vermillion and bold
+	"deuteranopia": {
+		Primary:   "74",
+		Secondary: "214",
+		Error:     "166",
+		Dim:       "245",
+		Info:      "247",
+		Text:      "white",
+		OnPrimary: "black",
+		Prompt:    "74",
+		Heading:   "245",
+		Progress:  "light_blue",
+	},
+	// Bright colors only, and light grays instead of dark ones
+	"high-contrast": {
+		Primary:   "11",
+		Secondary: "14",
+		Error:     "9",
+		Dim:       "250",
+		Info:      "252",
+		Text:      "15",
+		OnPrimary: "0",
+		Prompt:    "11",
+		Heading:   "15",
+		Progress:  "light_yellow",
+	},
+}
+
+// current is the palette in use.
+var current = Default
+
+// Lookup returns the theme called name; empty means the default.
+func Lookup(name string) (Theme, bool) {
+	if name == "" {
+		return Default, true
+	}
+	t, ok := themes[name]
+	return t, ok
+}
+
+// Names returns the theme names, sorted.
+func Names() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set makes t the palette in use.
+func Set(t Theme) {
+	current = t
+}
+
+// Current returns the palette in use.
+func Current() Theme {
+	return current
+}
+
+// SGR returns the escape sequence that sets color as the foreground,
+// bold or not. Colors 0-15 use the basic codes, so they follow the
+// terminal's own palette.
+func SGR(color string, bold bool) string {
+	code := "38;5;" + color
+	if n, err := strconv.Atoi(color); err == nil {
+		switch {
+		case n < 8:
+			code = strconv.Itoa(30 + n)
+		case n < 16:
+			code = strconv.Itoa(90 + n - 8)
+		}
+	}
+	if bold {
+		code = "1;" + code
+	}
+	return "\033[" + code + "m"
+}
@@ -0,0 +1,254 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// broadcastActions are the actions offered for the marked hosts.
+var broadcastActions = []action{
+	{"exec", "Run a command on each"},
+	{"ssh", "SSH into each, one after another"},
+}
+
+// fieldCommand labels the command field of the broadcast form.
+const fieldCommand = "Command"
+
+// BroadcastResult is how the action chosen for the marked hosts went on
+// one of them.
+type BroadcastResult struct {
+	Path string
+	Err  error
+}
+
+// isMarked reports whether the host at path is marked.
+func (m Model) isMarked(path string) bool {
+	return slices.ContainsFunc(m.marked, func(ref config.HostRef) bool { return ref.Path == path })
+}
+
+// toggleMark marks the highlighted host, or every host in the highlighted
+// group, or unmarks them when they all are already.
+func (m *Model) toggleMark() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	var refs []config.HostRef
+	var collect func(h *config.Host, path string)
+	collect = func(h *config.Host, path string) {
+		if len(h.Children) == 0 {
+			refs = append(refs, config.HostRef{Path: path, Host: h})
+			return
+		}
+		for _, c := range h.Children {
+			collect(c, path+"/"+c.Name)
+		}
+	}
+	collect(m.hosts[i], m.entryPath(i))
+
+	all := true
+	for _, ref := range refs {
+		all = all && m.isMarked(ref.Path)
+	}
+	// Fresh slice: models are copied by value between updates
+	marked := slices.Clone(m.marked)
+	if all {
+		marked = slices.DeleteFunc(marked, func(ref config.HostRef) bool {
+			return slices.ContainsFunc(refs, func(r config.HostRef) bool { return r.Path == ref.Path })
+		})
+	} else {
+		for _, ref := range refs {
+			if !m.isMarked(ref.Path) {
+				marked = append(marked, ref)
+			}
+		}
+	}
+	m.marked = marked
+	m.notice = m.markedNotice()
+
+	// Marking goes down the list, as in a file manager
+	m.hostList.Down()
+}
+
+// clearMarks unmarks every host.
+func (m *Model) clearMarks() {
+	m.marked = nil
+	m.notice = m.markedNotice()
+}
+
+// markedNotice says how many hosts are marked and what to do with them.
+func (m Model) markedNotice() string {
+	if len(m.marked) == 0 {
+		return "No hosts marked"
+	}
+	return fmt.Sprintf("%d host(s) marked; %s on a host for actions, %s to unmark all",
+		len(m.marked), m.keys.Select, m.keys.Unmark)
+}
+
+// showBroadcastActions offers the actions for the marked hosts.
+func (m *Model) showBroadcastActions() {
+	m.mode = ModeSelectBroadcast
+	labels := make([]string, len(broadcastActions))
+	for i, a := range broadcastActions {
+		labels[i] = a.label
+	}
+	m.actionList.SetItems(labels)
+}
+
+// updateSelectBroadcast handles key messages in the menu of actions for
+// the marked hosts.
+func (m Model) updateSelectBroadcast(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up":
+		m.actionList.Up()
+
+	case "down":
+		m.actionList.Down()
+
+	case "enter":
+		i, ok := m.actionList.Selected()
+		if !ok {
+			return m, nil
+		}
+		if broadcastActions[i].mode == "exec" {
+			m.form = form{
+				title:  fmt.Sprintf("Run on %d host(s)", len(m.marked)),
+				fields: []formField{{label: fieldCommand}},
+			}
+			m.mode = ModeBroadcastCommand
+			return m, nil
+		}
+		return m.broadcast(broadcastActions[i].mode, "")
+
+	case "esc":
+		if m.actionList.Query() != "" {
+			m.actionList.SetQuery("")
+			return m, nil
+		}
+		m.mode = ModeHostList
+
+	default:
+		m.actionList.HandleFilterKey(msg)
+	}
+
+	return m, nil
+}
+
+// updateBroadcastCommand handles key messages in the form asking for the
+// command to run on the marked hosts.
+func (m Model) updateBroadcastCommand(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.form.Update(msg) {
+	case formCancel:
+		m.mode = ModeSelectBroadcast
+
+	case formSubmit:
+		command := m.form.Value(fieldCommand)
+		if command == "" {
+			m.form.err = "Enter a command to run"
+			return m, nil
+		}
+		return m.broadcast("exec", command)
+	}
+
+	return m, nil
+}
+
+// broadcast leaves the TUI to apply action to the marked hosts.
+func (m Model) broadcast(action, command string) (tea.Model, tea.Cmd) {
+	m.Broadcast = m.marked
+	m.Action = action
+	m.Command = command
+	return m, tea.Quit
+}
+
+// ReopenBroadcast returns the model ready to show the host list again
+// after the action chosen for the marked hosts, starting with how it went
+// on each of them. The marks are cleared.
+func (m Model) ReopenBroadcast(results []BroadcastResult) Model {
+	m = m.reopen()
+	m.marked = nil
+	m.Broadcast = nil
+	m.Command = ""
+	m.results = results
+	m.mode = ModeBroadcastResults
+	return m
+}
+
+// updateBroadcastResults handles key messages on the broadcast results:
+// any key goes back to the host list.
+func (m Model) updateBroadcastResults(tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.results = nil
+	m.mode = ModeHostList
+	return m, nil
+}
+
+// renderSelectBroadcast renders the menu of actions for the marked hosts.
+func (m Model) renderSelectBroadcast() string {
+	var b strings.Builder
+
+	paths := make([]string, len(m.marked))
+	for i, ref := range m.marked {
+		paths[i] = ref.Path
+	}
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("Marked: %d host(s)", len(m.marked))))
+	b.WriteString("\n")
+	b.WriteString(m.styles.HostItemDim.Render(strings.Join(paths, ", ")))
+	b.WriteString("\n")
+	b.WriteString(m.styles.ModePrompt.Render("Action:"))
+	b.WriteString("\n")
+
+	if q := m.actionList.Query(); q != "" {
+		b.WriteString(m.styles.SearchPrompt.Render("Filter: " + q + "_"))
+		b.WriteString("\n")
+	}
+	for row, idx := range m.actionList.Visible() {
+		cursor := " "
+		if row == m.actionList.Cursor() {
+			cursor = ">"
+		}
+		line := cursor + " " + broadcastActions[idx].label
+		if row == m.actionList.Cursor() {
+			b.WriteString(m.styles.HostItemCursor.Render(line))
+		} else {
+			b.WriteString(m.styles.HostItem.Render(line))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(m.styles.HostItemDim.Render("Press ESC to go back"))
+	return b.String()
+}
+
+// renderBroadcastResults renders how the action went on each marked host.
+func (m Model) renderBroadcastResults() string {
+	var b strings.Builder
+
+	failed := 0
+	for _, r := range m.results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	title := fmt.Sprintf("Done on %d host(s)", len(m.results))
+	if failed > 0 {
+		title = fmt.Sprintf("Failed on %d of %d host(s)", failed, len(m.results))
+	}
+	b.WriteString(m.styles.Title.Render(title))
+	b.WriteString("\n")
+
+	for _, r := range m.results {
+		if r.Err != nil {
+			b.WriteString(m.styles.Error.Render("✗ " + r.Path + ": " + r.Err.Error()))
+		} else {
+			b.WriteString(m.styles.HostItem.Render("✓ " + r.Path))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(m.styles.HostItemDim.Render("Press any key to go back"))
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// startBulkEdit opens the bulk edit form for the highlighted group.
+func (m *Model) startBulkEdit() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	group := m.hosts[i]
+	if len(group.Children) == 0 {
+		m.notice = "Bulk edit works on groups; select a group"
+		return
+	}
+
+	fields := make([]formField, len(config.BulkFields))
+	for i, key := range config.BulkFields {
+		fields[i] = formField{label: key, secret: key == "password"}
+	}
+
+	m.bulkGroup = strings.Join(append(append([]string{}, m.currentPath...), group.Name), "/")
+	m.form = form{
+		title:  "Edit all hosts in " + m.bulkGroup + " (blank fields are left unchanged)",
+		fields: fields,
+	}
+	m.mode = ModeBulkEdit
+}
+
+// updateBulkEdit handles key messages in the bulk edit form.
+func (m Model) updateBulkEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.form.Update(msg) {
+	case formCancel:
+		m.mode = ModeHostList
+
+	case formSubmit:
+		var sets [][2]string
+		for _, f := range m.form.fields {
+			if v := strings.TrimSpace(f.value); v != "" {
+				sets = append(sets, [2]string{f.label, v})
+			}
+		}
+		if len(sets) == 0 {
+			m.form.err = "Fill in at least one field"
+			return m, nil
+		}
+
+		leaves, err := m.config.GroupLeaves(m.bulkGroup)
+		if err == nil {
+			m.bulkChanges, err = config.PlanEdit(leaves, sets)
+		}
+		if err != nil {
+			m.form.err = err.Error()
+			return m, nil
+		}
+		if len(m.bulkChanges) == 0 {
+			m.form.err = "Nothing to change: every host already has these values"
+			return m, nil
+		}
+		m.form.err = ""
+		m.mode = ModeBulkPreview
+	}
+
+	return m, nil
+}
+
+// updateBulkPreview handles key messages on the bulk edit diff.
+func (m Model) updateBulkPreview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		// Back to the form to adjust values
+		m.mode = ModeBulkEdit
+
+	case "enter", "y":
+		m.mode = ModeHostList
+		n := len(m.bulkChanges)
+		err := config.ApplyEdit(m.bulkChanges)
+		if err == nil {
+			err = config.Save(m.config, "")
+		}
+		m.bulkChanges = nil
+
+		m.setHosts(m.config.GetHostsAtPath(m.currentPath))
+		if err != nil {
+			m.err = err
+		} else {
+			m.notice = fmt.Sprintf("Saved %d change(s) to %s", n, m.config.Path)
+		}
+	}
+
+	return m, nil
+}
+
+// renderBulkPreview renders the pending bulk changes as a diff.
+func (m Model) renderBulkPreview() string {
+	var b strings.Builder
+
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("%d change(s) in %s", len(m.bulkChanges), m.bulkGroup)))
+	b.WriteString("\n\n")
+
+	last := ""
+	for _, c := range m.bulkChanges {
+		if c.Path != last {
+			b.WriteString(m.styles.HostName.Render(c.Path))
+			b.WriteString("\n")
+			last = c.Path
+		}
+		b.WriteString(m.styles.HostItemDim.Render("  - " + c.Key + ": " + c.Old))
+		b.WriteString("\n")
+		b.WriteString(m.styles.HostItem.Render("  + " + c.Key + ": " + c.New))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+// startClone opens the edit form pre-filled with the highlighted host.
+func (m *Model) startClone() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	source := m.hosts[i]
+	if len(source.Children) > 0 {
+		m.notice = "Groups can't be cloned; select a host"
+		return
+	}
+	if i < len(m.paths) {
+		m.notice = m.shortcutNotice(i, "clone")
+		return
+	}
+
+	draft := source.Clone()
+	draft.Name = source.Name + "-copy"
+	m.cloneSource = source
+	m.form = newHostForm("Clone "+source.Name, draft)
+	m.mode = ModeEditHost
+}
+
+// saveClone builds the new host from the form, inserts it after its source
+// and writes the config.
+func (m *Model) saveClone() (*config.Host, error) {
+	host := m.cloneSource.Clone()
+	host.Shared = false // Clones of team hosts are personal entries
+	if err := applyHostForm(m.form, host); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkName(host.Name, nil); err != nil {
+		return nil, err
+	}
+
+	if !m.config.InsertAfter(m.cloneSource, host) {
+		return nil, fmt.Errorf("source host is no longer in the config")
+	}
+	// The clone stays in this session if the write fails
+	return host, m.save()
+}
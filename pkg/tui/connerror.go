@@ -0,0 +1,148 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// connectFailure is a connection the TUI handed to main that failed, shown
+// until it is retried or dismissed.
+type connectFailure struct {
+	host   *config.Host
+	path   string
+	action string
+	err    error
+}
+
+// ReopenFailed returns the model showing why connecting to the selected
+// host failed, with keys to retry, edit the host or go back to the list,
+// which is left where it was as after Reopen.
+func (m Model) ReopenFailed(err error) Model {
+	failure := &connectFailure{host: m.Selected, path: m.SelectedPath(), action: m.Action, err: err}
+	m = m.reopen()
+	m.failure = failure
+	m.mode = ModeConnectError
+	return m
+}
+
+// updateConnectError handles key messages on the connection error screen.
+func (m Model) updateConnectError(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "r", "enter":
+		// Connect again the same way
+		m.Selected = m.failure.host
+		m.Action = m.failure.action
+		m.failure = nil
+		return m, tea.Quit
+
+	case "e":
+		m.failure = nil
+		m.mode = ModeHostList
+		m.startEditHost()
+
+	case "esc", "b":
+		m.failure = nil
+		m.mode = ModeHostList
+	}
+	return m, nil
+}
+
+// renderConnectError renders why the connection failed: the host, the
+// error wrapped to the screen and what to check.
+func (m Model) renderConnectError() string {
+	var b strings.Builder
+	f, host := m.failure, m.failure.host
+	width := max(20, m.width-4) // Long errors wrap instead of running off screen
+
+	b.WriteString(m.styles.Title.Render(fmt.Sprintf("%s to %s failed", strings.ToUpper(f.action), host.Name)))
+	b.WriteString("\n\n")
+
+	for _, line := range connectDetails(f.path, host) {
+		b.WriteString(m.styles.HostItemDim.Width(width).Render(line))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString(m.styles.Error.PaddingLeft(1).Width(width).Render(f.err.Error()))
+	b.WriteString("\n")
+	if hint := suggestion(host, f.err); hint != "" {
+		b.WriteString("\n")
+		b.WriteString(m.styles.HostItem.Width(width).Render(hint))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// connectDetails describes how the host at path is reached, one line per
+// detail.
+func connectDetails(path string, host *config.Host) []string {
+	port := host.Port
+	if port == 0 {
+		port = 22
+	}
+	lines := []string{
+		"Host:    " + path,
+		fmt.Sprintf("Address: %s@%s:%d", host.User, host.Host, port),
+	}
+	if host.Resolve != "" {
+		lines = append(lines, "Dialed:  "+host.Resolve)
+	}
+	if len(host.Jump) > 0 {
+		hops := make([]string, len(host.Jump))
+		for i, hop := range host.Jump {
+			hops[i] = hop.Name
+			if hops[i] == "" {
+				hops[i] = hop.Host
+			}
+		}
+		lines = append(lines, "Via:     "+strings.Join(hops, " → "))
+	}
+	switch {
+	case host.ProxyCommand != "":
+		lines = append(lines, "Proxy:   "+ssh.ProxyProgram(host.ProxyCommand)+" (proxy-command)")
+	case host.Proxy != "":
+		lines = append(lines, "Proxy:   "+ssh.RedactProxy(host.Proxy))
+	}
+	return lines
+}
+
+// suggestion returns what to check for err connecting to host, or "" when
+// there is nothing more useful to say than the error itself.
+func suggestion(host *config.Host, err error) string {
+	var keyErr *ssh.HostKeyError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var lostErr *ssh.ConnectionLostError
+	var hopErr *ssh.HopError
+	switch {
+	case errors.As(err, &keyErr):
+		return "The server's host key could not be verified. If the server was reinstalled, " +
+			"remove its old entry from known_hosts and retry; otherwise do not connect."
+	case ssh.IsAuthError(err):
+		return "The server did not accept the credentials. Check the user, password and key file (e to edit the host)."
+	case errors.As(err, &hopErr):
+		return fmt.Sprintf("Jump host %s stopped responding. Retry once it is reachable again.", hopErr.Name)
+	case errors.As(err, &lostErr):
+		if host.AutoReconnect {
+			return "The connection dropped and could not be re-established. Retry when the network is back."
+		}
+		return "The connection dropped. Set auto-reconnect on the host to re-establish sessions on their own."
+	case errors.As(err, &dnsErr):
+		return "The host name could not be resolved. Check the address, or set resolve to the address to dial."
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "Nothing accepted the connection on that port. Check the port and that sshd is running."
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "The host did not answer in time. Check that it is up and that no firewall or VPN is in the way."
+	case ssh.IsNetworkError(err):
+		return "The host could not be reached. Check the address and the network, then retry."
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// detailMinWidth is the terminal width from which the host list has a
+// detail pane beside it.
+const detailMinWidth = 100
+
+// detailWidth is the width of the detail pane, border included.
+const detailWidth = 44
+
+// probeResultMsg carries the outcome of probing host.
+type probeResultMsg struct {
+	host  *config.Host
+	probe ssh.Probe
+}
+
+// startProbe checks in the background whether the highlighted host can be
+// reached and logged in to, and how long that takes.
+func (m *Model) startProbe() tea.Cmd {
+	i, ok := m.hostList.Selected()
+	if !ok || len(m.hosts[i].Children) > 0 {
+		return nil
+	}
+	host := m.hosts[i]
+	if m.probing[host] {
+		return nil
+	}
+	m.probing[host] = true
+	return func() tea.Msg {
+		return probeResultMsg{host: host, probe: ssh.ProbeHost(host)}
+	}
+}
+
+// handleProbeResult records a finished probe.
+func (m *Model) handleProbeResult(msg probeResultMsg) {
+	delete(m.probing, msg.host)
+	m.probes[msg.host] = msg.probe
+}
+
+// renderWithDetail lays out list, rendered at the given width, beside the
+// detail pane for the highlighted entry.
+func (m Model) renderWithDetail(render func(Model) string) string {
+	list := m
+	list.styles = m.styles.WithWidth(m.width - detailWidth)
+	return lipgloss.JoinHorizontal(lipgloss.Top, render(list), m.styles.DetailPane.Render(m.renderDetail()))
+}
+
+// renderDetail renders what is known about the highlighted entry.
+func (m Model) renderDetail() string {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return ""
+	}
+	host := m.hosts[i]
+	path := m.entryPath(i)
+
+	var b strings.Builder
+	b.WriteString(m.styles.Title.Render(path))
+	b.WriteString("\n")
+	line := func(label, value string) {
+		b.WriteString(m.styles.HostAddr.Render(fmt.Sprintf("%-10s", label)))
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+
+	if len(host.Children) > 0 {
+		line("Group", fmt.Sprintf("%d host(s)", len(leaves(host))))
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+
+	line("Address", hostAddress(host))
+	switch {
+	case host.KeyPath != "":
+		line("Key", host.KeyPath)
+	case host.Password != "":
+		line("Auth", "password")
+	default:
+		line("Auth", "ssh-agent / default keys")
+	}
+	if len(host.Jump) > 0 {
+		hops := make([]string, len(host.Jump))
+		for i, hop := range host.Jump {
+			hops[i] = hostAddress(hop)
+		}
+		line("Jump", strings.Join(hops, " → "))
+	}
+	if len(host.Tags) > 0 {
+		line("Tags", strings.Join(host.Tags, ", "))
+	}
+	if host.Shared {
+		line("Source", "shared config (read-only)")
+	}
+
+	last := "never"
+	for _, c := range m.history.Connections {
+		if c.Path == path {
+			last = fmt.Sprintf("%s ago (%s)", time.Since(c.At).Round(time.Minute), c.Mode)
+			break
+		}
+	}
+	line("Connected", last)
+
+	switch probe, ok := m.probes[host]; {
+	case m.probing[host]:
+		line("Probe", "checking...")
+	case !ok:
+		line("Probe", "press "+m.keys.Probe+" to check")
+	case probe.Err == nil:
+		line("Probe", fmt.Sprintf("ok, login in %s", probe.Elapsed.Round(time.Millisecond)))
+	case probe.Reachable:
+		line("Probe", fmt.Sprintf("reachable in %s, login failed", probe.Elapsed.Round(time.Millisecond)))
+	default:
+		line("Probe", m.styles.Error.Render("unreachable: "+probe.Err.Error()))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// hostAddress returns user@host:port.
+func hostAddress(h *config.Host) string {
+	port := h.Port
+	if port == 0 {
+		port = 22
+	}
+	return h.User + "@" + h.Host + ":" + strconv.Itoa(port)
+}
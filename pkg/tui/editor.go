@@ -0,0 +1,297 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fieldGroup labels the group name in the new group form.
+const fieldGroup = "Group"
+
+// editable returns the highlighted entry if it may be changed, setting a
+// notice and returning nil otherwise.
+func (m *Model) editable() *config.Host {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return nil
+	}
+	h := m.hosts[i]
+	if i < len(m.paths) {
+		m.notice = m.shortcutNotice(i, "change")
+		return nil
+	}
+	if h.Shared {
+		m.notice = h.Name + " comes from the shared config and is read-only"
+		return nil
+	}
+	return h
+}
+
+// anchor returns the entry new hosts and groups are added after: the
+// highlighted one, or the last of the level when the filter hides all or a
+// favorite or recent host is highlighted.
+// It is nil when the level is empty, which only the top level can be.
+func (m Model) anchor() *config.Host {
+	if i, ok := m.hostList.Selected(); ok && i >= len(m.paths) {
+		return m.hosts[i]
+	}
+	if len(m.hosts) == len(m.paths) {
+		return nil
+	}
+	return m.hosts[len(m.hosts)-1]
+}
+
+// startAddHost opens an empty host form for the current level.
+func (m *Model) startAddHost() {
+	m.addAnchor = m.anchor()
+	m.form = newHostForm("New host", &config.Host{})
+	m.mode = ModeEditHost
+}
+
+// startAddGroup opens the form for a new group at the current level. A
+// group without hosts would read back as a host, so the form asks for its
+// first host too.
+func (m *Model) startAddGroup() {
+	m.addAnchor = m.anchor()
+	m.addGroup = true
+	m.form = newHostForm("New group and its first host", &config.Host{})
+	m.form.fields = append([]formField{{label: fieldGroup}}, m.form.fields...)
+	m.mode = ModeEditHost
+}
+
+// startEditHost opens the form for the highlighted host, or the bulk edit
+// form when a group is highlighted.
+func (m *Model) startEditHost() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	if len(m.hosts[i].Children) > 0 {
+		m.startBulkEdit()
+		return
+	}
+	target := m.editable()
+	if target == nil {
+		return
+	}
+	m.editTarget = target
+	m.form = newHostForm("Edit "+target.Name, target)
+	m.mode = ModeEditHost
+}
+
+// startRename opens a form renaming the highlighted host or group.
+func (m *Model) startRename() {
+	target := m.editable()
+	if target == nil {
+		return
+	}
+	m.renaming = target
+	m.form = form{
+		title:  "Rename " + target.Name,
+		fields: []formField{{label: fieldName, value: target.Name}},
+	}
+	m.mode = ModeEditHost
+}
+
+// startDelete asks to confirm deleting the highlighted host or group.
+func (m *Model) startDelete() {
+	target := m.editable()
+	if target == nil {
+		return
+	}
+	if len(m.currentPath) > 0 && len(m.hosts) == 1 {
+		m.notice = target.Name + " is the last entry in " + m.currentPath[len(m.currentPath)-1] + "; delete the group instead"
+		return
+	}
+	m.deleting = target
+	m.mode = ModeConfirmDelete
+}
+
+// updateEditHost handles key messages in the host edit form.
+func (m Model) updateEditHost(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.form.Update(msg) {
+	case formCancel:
+		m.endEdit()
+
+	case formSubmit:
+		host, err := m.saveHostForm()
+		if host == nil {
+			// Invalid input: stay in the form
+			m.form.err = err.Error()
+			return m, nil
+		}
+		m.endEdit()
+
+		// Refresh the level and highlight the entry
+		m.showLevel()
+		m.selectHost(host)
+		if err != nil {
+			m.err = err
+		} else {
+			m.notice = "Saved " + host.Name + " to " + m.config.Path
+		}
+	}
+
+	return m, nil
+}
+
+// endEdit leaves the edit form for the host list.
+func (m *Model) endEdit() {
+	m.mode = ModeHostList
+	m.cloneSource = nil
+	m.editTarget = nil
+	m.renaming = nil
+	m.addAnchor = nil
+	m.addGroup = false
+}
+
+// saveHostForm applies the open form and writes the config. It returns
+// the entry to highlight, or nil with the error when the input is invalid;
+// a failed write returns both, the change staying for this session.
+func (m *Model) saveHostForm() (*config.Host, error) {
+	switch {
+	case m.cloneSource != nil:
+		return m.saveClone()
+	case m.editTarget != nil:
+		return m.saveEdit()
+	case m.renaming != nil:
+		return m.saveRename()
+	default:
+		return m.saveAdd()
+	}
+}
+
+// saveEdit copies the form into the host being edited.
+func (m *Model) saveEdit() (*config.Host, error) {
+	draft := m.editTarget.Clone()
+	if err := applyHostForm(m.form, draft); err != nil {
+		return nil, err
+	}
+	if err := m.checkName(draft.Name, m.editTarget); err != nil {
+		return nil, err
+	}
+
+	*m.editTarget = *draft
+	return m.editTarget, m.save()
+}
+
+// saveRename renames the host or group being renamed.
+func (m *Model) saveRename() (*config.Host, error) {
+	name := m.form.Value(fieldName)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := m.checkName(name, m.renaming); err != nil {
+		return nil, err
+	}
+
+	m.renaming.Name = name
+	return m.renaming, m.save()
+}
+
+// saveAdd inserts the new host, or new group holding it, after the anchor.
+func (m *Model) saveAdd() (*config.Host, error) {
+	host := &config.Host{}
+	if err := applyHostForm(m.form, host); err != nil {
+		return nil, err
+	}
+
+	entry := host
+	if m.addGroup {
+		name := m.form.Value(fieldGroup)
+		if name == "" {
+			return nil, fmt.Errorf("group name is required")
+		}
+		entry = &config.Host{Name: name, Children: []*config.Host{host}}
+	}
+	if err := m.checkName(entry.Name, nil); err != nil {
+		return nil, err
+	}
+
+	if m.addAnchor == nil {
+		m.config.Hosts = append(m.config.Hosts, entry)
+	} else if !m.config.InsertAfter(m.addAnchor, entry) {
+		return nil, fmt.Errorf("the list changed; try again")
+	}
+	return entry, m.save()
+}
+
+// checkName rejects a name already taken at the current level by an entry
+// other than self.
+func (m Model) checkName(name string, self *config.Host) error {
+	for _, h := range m.hosts[len(m.paths):] {
+		if h != self && h.Name == name {
+			return fmt.Errorf("a host named %q already exists here", name)
+		}
+	}
+	return nil
+}
+
+// save writes the config, wrapping the error for display.
+func (m *Model) save() error {
+	if err := config.Save(m.config, ""); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	return nil
+}
+
+// updateConfirmDelete handles key messages on the delete confirmation.
+func (m Model) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch strings.ToLower(msg.String()) {
+	case "y":
+		target := m.deleting
+		m.deleting = nil
+		m.mode = ModeHostList
+
+		i, _ := m.hostList.Selected()
+		if !m.config.Remove(target) {
+			m.err = fmt.Errorf("%s is no longer in the config", target.Name)
+			return m, nil
+		}
+		err := m.save()
+		m.showLevel()
+		m.hostList.Select(min(i, len(m.hosts)-1))
+		if err != nil {
+			m.err = err
+		} else {
+			m.notice = "Deleted " + target.Name + " from " + m.config.Path
+		}
+
+	case "n", "esc":
+		m.deleting = nil
+		m.mode = ModeHostList
+	}
+
+	return m, nil
+}
+
+// renderConfirmDelete renders the delete confirmation.
+func (m Model) renderConfirmDelete() string {
+	var b strings.Builder
+
+	question := "Delete " + m.deleting.Name + "?"
+	if len(m.deleting.Children) > 0 {
+		question = fmt.Sprintf("Delete group %s and the %d host(s) in it?", m.deleting.Name, len(leaves(m.deleting)))
+	}
+	b.WriteString(m.styles.Title.Render(question))
+	b.WriteString("\n")
+	b.WriteString(m.styles.HostItemDim.Render("The entry is removed from " + m.config.Path + " [y/N]"))
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// leaves returns the hosts below h, or h itself when it is a host.
+func leaves(h *config.Host) []*config.Host {
+	if len(h.Children) == 0 {
+		return []*config.Host{h}
+	}
+	var out []*config.Host
+	for _, c := range h.Children {
+		out = append(out, leaves(c)...)
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/history"
+)
+
+// maxRecent is how many recent hosts the top level lists.
+const maxRecent = 5
+
+// Sections of the entries listed above the top level.
+const (
+	sectionFavorites = "Favorites"
+	sectionRecent    = "Recent"
+)
+
+// showLevel lists the hosts at the current level. The top level starts
+// with the favorites and the most recent hosts, wherever they are in the
+// tree.
+func (m *Model) showLevel() {
+	level := m.config.GetHostsAtPath(m.currentPath)
+	if len(m.currentPath) > 0 {
+		m.setHosts(level)
+		return
+	}
+
+	var (
+		hosts    []*config.Host
+		paths    [][]string
+		sections []string
+	)
+	add := func(section, path string) bool {
+		host := m.config.FindHost(path)
+		if host == nil || len(host.Children) > 0 || slices.Contains(hosts, host) {
+			return false
+		}
+		parts := strings.Split(path, "/")
+		hosts = append(hosts, host)
+		paths = append(paths, parts[:len(parts)-1])
+		sections = append(sections, section)
+		return true
+	}
+	for _, path := range m.history.Favorites {
+		add(sectionFavorites, path)
+	}
+	recent := 0
+	for _, path := range m.history.Recent() {
+		if recent == maxRecent {
+			break
+		}
+		if add(sectionRecent, path) {
+			recent++
+		}
+	}
+
+	m.setHosts(append(hosts, level...))
+	m.paths = paths
+	m.sections = sections
+}
+
+// entryPath returns the config path of entry i, e.g. "prod/web1".
+func (m Model) entryPath(i int) string {
+	if i < len(m.paths) {
+		return m.resultName(i)
+	}
+	return strings.Join(append(slices.Clip(m.currentPath), m.hosts[i].Name), "/")
+}
+
+// shortcutNotice explains that entry i, a favorite or recent host, is to
+// be changed where it lives in the tree.
+func (m Model) shortcutNotice(i int, verb string) string {
+	where := "the top level"
+	if len(m.paths[i]) > 0 {
+		where = strings.Join(m.paths[i], "/")
+	}
+	return fmt.Sprintf("%s is a shortcut; %s it in %s", m.hosts[i].Name, verb, where)
+}
+
+// toggleFavorite stars or unstars the highlighted host.
+func (m *Model) toggleFavorite() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	if len(m.hosts[i].Children) > 0 {
+		m.notice = "Only hosts can be favorites"
+		return
+	}
+	host := m.hosts[i]
+	path := m.entryPath(i)
+
+	// Change the history on disk so connections recorded since, also by
+	// other sshm processes, aren't lost
+	var h *history.History
+	var starred bool
+	err := history.Update(func(current *history.History) {
+		h = current
+		starred = h.ToggleFavorite(path)
+	})
+	if err != nil {
+		m.err = fmt.Errorf("save favorites: %w", err)
+		return
+	}
+	m.history = h
+	m.showLevel()
+	m.selectHost(host)
+	if starred {
+		m.notice = "Added " + path + " to favorites"
+	} else {
+		m.notice = "Removed " + path + " from favorites"
+	}
+}
+
+// selectHost moves the cursor to host among the entries of the current
+// level, rather than to its favorite or recent shortcut.
+func (m *Model) selectHost(host *config.Host) {
+	for i := len(m.paths); i < len(m.hosts); i++ {
+		if m.hosts[i] == host {
+			m.hostList.Select(i)
+			return
+		}
+	}
+}
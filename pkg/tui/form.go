@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// formField is a single line text input in a form.
+type formField struct {
+	label  string
+	value  string
+	secret bool // render the value masked
+}
+
+// form is a minimal multi-field text form.
+type form struct {
+	title  string
+	fields []formField
+	focus  int
+	err    string // validation error shown under the fields
+}
+
+// formResult is what a key press did to the form.
+type formResult int
+
+const (
+	formEditing formResult = iota
+	formSubmit
+	formCancel
+)
+
+// Update applies a key press to the form.
+func (f *form) Update(msg tea.KeyMsg) formResult {
+	switch msg.String() {
+	case "esc":
+		return formCancel
+
+	case "ctrl+s":
+		return formSubmit
+
+	case "enter":
+		// Enter on the last field submits, elsewhere it moves on
+		if f.focus == len(f.fields)-1 {
+			return formSubmit
+		}
+		f.focus++
+
+	case "tab", "down":
+		f.focus = (f.focus + 1) % len(f.fields)
+
+	case "shift+tab", "up":
+		f.focus = (f.focus - 1 + len(f.fields)) % len(f.fields)
+
+	default:
+		field := &f.fields[f.focus]
+		switch msg.Type {
+		case tea.KeyRunes, tea.KeySpace:
+			field.value += string(msg.Runes)
+		case tea.KeyBackspace:
+			if field.value != "" {
+				runes := []rune(field.value)
+				field.value = string(runes[:len(runes)-1])
+			}
+		case tea.KeyCtrlU:
+			field.value = ""
+		}
+	}
+
+	return formEditing
+}
+
+// Value returns the trimmed value of the field with the given label.
+func (f form) Value(label string) string {
+	for _, field := range f.fields {
+		if field.label == label {
+			return strings.TrimSpace(field.value)
+		}
+	}
+	return ""
+}
+
+// View renders the form.
+func (f form) View(styles Styles) string {
+	var b strings.Builder
+
+	b.WriteString(styles.Title.Render(f.title))
+	b.WriteString("\n\n")
+
+	width := 0
+	for _, field := range f.fields {
+		if len(field.label) > width {
+			width = len(field.label)
+		}
+	}
+
+	for i, field := range f.fields {
+		value := field.value
+		if field.secret {
+			value = strings.Repeat("*", len([]rune(value)))
+		}
+
+		line := fmt.Sprintf("%-*s  %s", width, field.label, value)
+		if i == f.focus {
+			b.WriteString(styles.HostItemCursor.Render("> " + line + "_"))
+		} else {
+			b.WriteString(styles.HostItem.Render("  " + line))
+		}
+		b.WriteString("\n")
+	}
+
+	if f.err != "" {
+		b.WriteString("\n")
+		b.WriteString(styles.Error.Render(f.err))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Host form field labels.
+const (
+	fieldName     = "Name"
+	fieldHost     = "Host"
+	fieldUser     = "User"
+	fieldPort     = "Port"
+	fieldKeyPath  = "Key path"
+	fieldPassword = "Password"
+)
+
+// newHostForm creates a form pre-filled with the values of h.
+func newHostForm(title string, h *config.Host) form {
+	port := ""
+	if h.Port != 0 {
+		port = strconv.Itoa(h.Port)
+	}
+
+	return form{
+		title: title,
+		fields: []formField{
+			{label: fieldName, value: h.Name},
+			{label: fieldHost, value: h.Host},
+			{label: fieldUser, value: h.User},
+			{label: fieldPort, value: port},
+			{label: fieldKeyPath, value: h.KeyPath},
+			{label: fieldPassword, value: h.Password, secret: true},
+		},
+	}
+}
+
+// applyHostForm validates the form and copies its values into h.
+func applyHostForm(f form, h *config.Host) error {
+	port := 22
+	if v := f.Value(fieldPort); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("port must be a number between 1 and 65535")
+		}
+		port = p
+	}
+
+	h.Name = f.Value(fieldName)
+	h.Host = f.Value(fieldHost)
+	h.User = f.Value(fieldUser)
+	h.Port = port
+	h.KeyPath = f.Value(fieldKeyPath)
+	h.Password = f.Value(fieldPassword)
+
+	return h.Validate()
+}
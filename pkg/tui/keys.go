@@ -2,14 +2,26 @@ package tui
 
 // KeyBindings defines key help strings for the TUI.
 type KeyBindings struct {
-	Quit       string
-	Up         string
-	Down       string
-	Select     string
-	Search     string
-	Cancel     string
-	SSHMode    string
-	SFTPMode   string
+	Quit     string
+	Up       string
+	Down     string
+	Page     string
+	Select   string
+	Search   string
+	Cancel   string
+	SSHMode  string
+	SFTPMode string
+	Clone    string
+	BulkEdit string
+	Add      string
+	AddGroup string
+	Edit     string
+	Rename   string
+	Delete   string
+	Favorite string
+	Probe    string
+	Mark     string
+	Unmark   string
 }
 
 // DefaultKeyBindings returns the default key help strings.
@@ -18,10 +30,22 @@ func DefaultKeyBindings() KeyBindings {
 		Quit:     "q",
 		Up:       "↑/k",
 		Down:     "↓/j",
+		Page:     "pgup/pgdn",
 		Select:   "enter",
 		Search:   "/",
 		Cancel:   "esc",
 		SSHMode:  "s",
 		SFTPMode: "f",
+		Clone:    "c",
+		BulkEdit: "e",
+		Add:      "a",
+		AddGroup: "g",
+		Edit:     "e",
+		Rename:   "r",
+		Delete:   "d",
+		Favorite: "*",
+		Probe:    "p",
+		Mark:     "space",
+		Unmark:   "u",
 	}
 }
@@ -0,0 +1,179 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// selectList holds the cursor and filter state shared by every selection
+// screen (host list, action menu, ...).
+//
+// It only tracks indices; the owning screen keeps the actual items and
+// renders them. values[i] is the text matched against the filter query.
+type selectList struct {
+	values  []string
+	visible []int // indices into values matching the query
+	cursor  int   // position within visible
+	offset  int   // First row shown when not all of visible fits
+	query   string
+	fuzzy   bool // Match the query fuzzily, best matches first
+}
+
+// newSelectList creates a list over the given filter values.
+func newSelectList(values []string) selectList {
+	l := selectList{}
+	l.SetItems(values)
+	return l
+}
+
+// SetItems replaces the items and clears the filter.
+func (l *selectList) SetItems(values []string) {
+	l.values = values
+	l.query = ""
+	l.refilter()
+}
+
+// SetQuery filters the items by a case-insensitive substring match, or a
+// fuzzy one for a fuzzy list.
+func (l *selectList) SetQuery(query string) {
+	l.query = query
+	l.refilter()
+}
+
+// Query returns the current filter text.
+func (l selectList) Query() string {
+	return l.query
+}
+
+// Visible returns the indices of the items that match the filter.
+func (l selectList) Visible() []int {
+	return l.visible
+}
+
+// Cursor returns the cursor position within Visible().
+func (l selectList) Cursor() int {
+	return l.cursor
+}
+
+// Selected returns the item index under the cursor.
+func (l selectList) Selected() (int, bool) {
+	if len(l.visible) == 0 {
+		return 0, false
+	}
+	return l.visible[l.cursor], true
+}
+
+// Select moves the cursor to item index i if it is visible.
+func (l *selectList) Select(i int) {
+	for row, idx := range l.visible {
+		if idx == i {
+			l.cursor = row
+			return
+		}
+	}
+}
+
+// Window returns the rows [start, end) of Visible() to show in height
+// rows: from where the last window started, moved just enough to keep the
+// cursor in view.
+func (l selectList) Window(height int) (start, end int) {
+	height = max(1, height)
+	start = min(l.offset, max(0, len(l.visible)-height))
+	if l.cursor < start {
+		start = l.cursor
+	} else if l.cursor >= start+height {
+		start = l.cursor - height + 1
+	}
+	return start, min(start+height, len(l.visible))
+}
+
+// Follow scrolls the window of height rows to keep the cursor in view.
+func (l *selectList) Follow(height int) {
+	l.offset, _ = l.Window(height)
+}
+
+// Up moves the cursor up one row.
+func (l *selectList) Up() {
+	if l.cursor > 0 {
+		l.cursor--
+	}
+}
+
+// Down moves the cursor down one row.
+func (l *selectList) Down() {
+	if l.cursor < len(l.visible)-1 {
+		l.cursor++
+	}
+}
+
+// PageUp moves the cursor up by height rows, or to the first.
+func (l *selectList) PageUp(height int) {
+	l.cursor = max(0, l.cursor-max(1, height))
+}
+
+// PageDown moves the cursor down by height rows, or to the last.
+func (l *selectList) PageDown(height int) {
+	l.cursor = max(0, min(len(l.visible)-1, l.cursor+max(1, height)))
+}
+
+// Home moves the cursor to the first row.
+func (l *selectList) Home() {
+	l.cursor = 0
+}
+
+// End moves the cursor to the last row.
+func (l *selectList) End() {
+	l.cursor = max(0, len(l.visible)-1)
+}
+
+// HandleFilterKey applies typing and backspace to the filter query.
+// Returns true if the key was consumed.
+func (l *selectList) HandleFilterKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		l.SetQuery(l.query + string(msg.Runes))
+		return true
+	case tea.KeyBackspace:
+		if l.query != "" {
+			runes := []rune(l.query)
+			l.SetQuery(string(runes[:len(runes)-1]))
+		}
+		return true
+	}
+	return false
+}
+
+// refilter recomputes visible items and resets the cursor.
+func (l *selectList) refilter() {
+	// Fresh slice: models are copied by value between updates
+	visible := make([]int, 0, len(l.values))
+	if l.fuzzy && l.query != "" {
+		scores := make(map[int]int, len(l.values))
+		for i, v := range l.values {
+			if score, ok := fuzzyScore(v, l.query); ok {
+				visible = append(visible, i)
+				scores[i] = score
+			}
+		}
+		// Ties keep the items' order
+		sort.SliceStable(visible, func(a, b int) bool {
+			return scores[visible[a]] > scores[visible[b]]
+		})
+		l.visible = visible
+		l.cursor = 0
+		l.offset = 0
+		return
+	}
+
+	query := strings.ToLower(l.query)
+	for i, v := range l.values {
+		if query == "" || strings.Contains(strings.ToLower(v), query) {
+			visible = append(visible, i)
+		}
+	}
+	l.visible = visible
+	l.cursor = 0
+	l.offset = 0
+}
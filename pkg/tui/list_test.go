@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSelectListSetItems(t *testing.T) {
+	l := newSelectList([]string{"web1", "web2", "db1"})
+	l.SetQuery("web")
+	l.Down()
+
+	l.SetItems([]string{"a", "b"})
+	if l.Query() != "" {
+		t.Errorf("query = %q after SetItems, want it cleared", l.Query())
+	}
+	if want := []int{0, 1}; !slices.Equal(l.Visible(), want) {
+		t.Errorf("visible = %v, want %v", l.Visible(), want)
+	}
+	if l.Cursor() != 0 {
+		t.Errorf("cursor = %d, want 0", l.Cursor())
+	}
+
+	l.SetItems(nil)
+	if _, ok := l.Selected(); ok {
+		t.Error("empty list has a selection")
+	}
+}
+
+func TestSelectListSetQuery(t *testing.T) {
+	values := []string{"web1 10.0.0.1", "DB1 10.0.0.2", "web2 10.0.0.3"}
+	tests := []struct {
+		query string
+		fuzzy bool
+		want  []int
+	}{
+		{"", false, []int{0, 1, 2}},
+		{"web", false, []int{0, 2}},
+		{"db", false, []int{1}},  // Case-insensitive
+		{"w2", false, []int{}},   // Substring only
+		{"w2", true, []int{2}},   // Subsequence
+		{"10 3", true, []int{2}}, // Every term must match
+		{"web 1", true, []int{0, 2}},
+		{"xyz", true, []int{}},
+	}
+	for _, tt := range tests {
+		l := newSelectList(values)
+		l.fuzzy = tt.fuzzy
+		l.Down()
+		l.SetQuery(tt.query)
+		if !slices.Equal(l.Visible(), tt.want) {
+			t.Errorf("SetQuery(%q) fuzzy=%v visible = %v, want %v", tt.query, tt.fuzzy, l.Visible(), tt.want)
+		}
+		if l.Cursor() != 0 {
+			t.Errorf("SetQuery(%q) cursor = %d, want 0", tt.query, l.Cursor())
+		}
+	}
+}
+
+func TestSelectListFuzzyOrder(t *testing.T) {
+	l := newSelectList([]string{"xweb1", "prod/web1", "w1eb"})
+	l.fuzzy = true
+	l.SetQuery("web1")
+	// A match at the start of a word ranks first
+	if want := []int{1, 0}; !slices.Equal(l.Visible(), want) {
+		t.Errorf("visible = %v, want %v", l.Visible(), want)
+	}
+}
+
+func TestSelectListWindow(t *testing.T) {
+	l := newSelectList(make([]string, 10))
+
+	start, end := l.Window(4)
+	if start != 0 || end != 4 {
+		t.Errorf("window = [%d, %d), want [0, 4)", start, end)
+	}
+
+	// Moving down scrolls just enough to keep the cursor in view
+	for range 5 {
+		l.Down()
+		l.Follow(4)
+	}
+	if start, end := l.Window(4); start != 2 || end != 6 {
+		t.Errorf("cursor 5: window = [%d, %d), want [2, 6)", start, end)
+	}
+
+	// Moving back up within the window doesn't scroll
+	l.Up()
+	l.Follow(4)
+	if start, _ := l.Window(4); start != 2 {
+		t.Errorf("cursor 4: window starts at %d, want 2", start)
+	}
+
+	// A taller window shows as much as fits
+	if start, end := l.Window(20); start != 0 || end != 10 {
+		t.Errorf("height 20: window = [%d, %d), want [0, 10)", start, end)
+	}
+	if start, end := l.Window(0); end-start != 1 {
+		t.Errorf("height 0: window = [%d, %d), want one row", start, end)
+	}
+}
+
+func TestSelectListPageHomeEnd(t *testing.T) {
+	l := newSelectList(make([]string, 10))
+	steps := []struct {
+		name string
+		move func()
+		want int
+	}{
+		{"PageDown", func() { l.PageDown(4) }, 4},
+		{"PageDown", func() { l.PageDown(4) }, 8},
+		{"PageDown at end", func() { l.PageDown(4) }, 9},
+		{"PageUp", func() { l.PageUp(4) }, 5},
+		{"Home", l.Home, 0},
+		{"Up at top", l.Up, 0},
+		{"PageUp at top", func() { l.PageUp(4) }, 0},
+		{"End", l.End, 9},
+		{"Down at bottom", l.Down, 9},
+		{"PageDown height 0", func() { l.Home(); l.PageDown(0) }, 1},
+	}
+	for _, s := range steps {
+		s.move()
+		if l.Cursor() != s.want {
+			t.Errorf("%s: cursor = %d, want %d", s.name, l.Cursor(), s.want)
+		}
+	}
+
+	empty := newSelectList(nil)
+	empty.End()
+	empty.PageDown(4)
+	if empty.Cursor() != 0 {
+		t.Errorf("empty list cursor = %d, want 0", empty.Cursor())
+	}
+}
@@ -1,11 +1,20 @@
 package tui
 
 import (
+	"fmt"
+	"os"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/history"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	"github.com/ai-help-me/sshm/pkg/theme"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 // ViewMode represents the current TUI view mode.
@@ -15,6 +24,16 @@ const (
 	ModeHostList ViewMode = iota
 	ModeSearching
 	ModeSelectAction
+	ModeEditHost
+	ModeBulkEdit
+	ModeBulkPreview
+	ModeSelectTunnel
+	ModeConfirmPassword
+	ModeConfirmDelete
+	ModeSelectBroadcast
+	ModeBroadcastCommand
+	ModeBroadcastResults
+	ModeConnectError
 )
 
 // HostSelectedMsg is sent when a host is selected.
@@ -23,39 +42,78 @@ type HostSelectedMsg struct {
 	Mode string // "ssh" or "sftp"
 }
 
+// action is an entry of the menu shown after selecting a host.
+type action struct {
+	mode  string
+	label string
+}
+
+// actions are the connection modes offered after selecting a host.
+// "tunnel" is only offered for hosts with tunnels and is handled inside
+// the TUI.
+var actions = []action{
+	{"ssh", "SSH"},
+	{"sftp", "SFTP"},
+	{"tunnel", "Tunnel"},
+}
+
 // Model is the main Bubbletea model.
 type Model struct {
-	config       *config.Config
-	hosts        []*config.Host
-	filtered     []*config.Host
-	cursor       int
-	actionCursor int // For action selection mode (0=ssh, 1=sftp)
-	Selected     *config.Host
-	searching    bool
-	query        string
-	err          error
-	Quitted      bool
-	mode         ViewMode
-	Action       string // "ssh" or "sftp"
-	styles       Styles
-	keys         KeyBindings
-	currentPath  []string // Current navigation path (empty = root level)
-	width        int      // Terminal width
-	height       int      // Terminal height
+	config      *config.Config
+	hosts       []*config.Host
+	hostList    selectList // Cursor and search filter over hosts
+	actionList  selectList // Cursor and filter over hostActions()
+	tunnelList  selectList // Cursor and filter over the selected host's tunnels
+	Selected    *config.Host
+	server      *ssh.ServerInfo // What the selected host's server was last seen running
+	searching   bool
+	paths       [][]string           // Group paths of the leading entries of hosts, which live elsewhere in the tree
+	sections    []string             // Section of each entry in paths; none for search results
+	history     *history.History     // Recent hosts and favorites listed at the top level
+	searchFrom  int                  // Entry highlighted when the search started
+	form        form                 // Active edit form (host editor or bulk edit)
+	cloneSource *config.Host         // Host being duplicated by the form
+	editTarget  *config.Host         // Host being edited by the form
+	renaming    *config.Host         // Host or group being renamed by the form
+	addAnchor   *config.Host         // Entry a host or group added by the form goes after
+	addGroup    bool                 // The add form creates a group around the host
+	deleting    *config.Host         // Host or group awaiting delete confirmation
+	bulkGroup   string               // Group path being bulk edited
+	bulkChanges []config.FieldChange // Pending bulk edits awaiting confirmation
+	notice      string               // One-line status shown under the list
+	err         error
+	Quitted     bool
+	mode        ViewMode
+	Action      string            // "ssh" or "sftp", or "exec" for Broadcast
+	marked      []config.HostRef  // Hosts marked for a broadcast action, in the order marked
+	Broadcast   []config.HostRef  // Marked hosts Action applies to
+	Command     string            // Command to run on Broadcast for "exec"
+	results     []BroadcastResult // How the last broadcast action went
+	failure     *connectFailure   // Connection shown on the error screen
+	styles      Styles
+	keys        KeyBindings
+	currentPath []string         // Current navigation path (empty = root level)
+	width       int              // Terminal width
+	height      int              // Terminal height
+	prewarmSeq  int              // Bumped whenever the highlighted host changes
+	tunnels     []forward.Status // Tunnels running in the daemon
+
+	// Probes of hosts shown in the detail pane, finished and running
+	probes  map[*config.Host]ssh.Probe
+	probing map[*config.Host]bool
 }
 
 // NewModel creates a new TUI model.
 func NewModel(cfg *config.Config) Model {
 	keys := DefaultKeyBindings()
-	styles := DefaultStyles()
+	styles := NewStyles(theme.Current())
 
-	// Start at root level
-	hosts := cfg.GetHostsAtPath([]string{})
-
-	return Model{
+	m := Model{
+		notice:      strings.Join(cfg.Warnings, "; "),
 		config:      cfg,
-		hosts:       hosts,
-		filtered:    hosts,
+		history:     history.Load(),
+		probes:      make(map[*config.Host]ssh.Probe),
+		probing:     make(map[*config.Host]bool),
 		mode:        ModeHostList,
 		styles:      styles,
 		keys:        keys,
@@ -63,19 +121,93 @@ func NewModel(cfg *config.Config) Model {
 		width:       80, // Default width, will be updated by WindowSizeMsg
 		height:      24, // Default height, will be updated by WindowSizeMsg
 	}
+
+	// Start at root level
+	m.showLevel()
+	return m
+}
+
+// Reopen returns the model ready to show the host list again after a
+// session ended, at the same level of the tree with the cursor on the host
+// just used. A session error, if any, is shown under the list.
+func (m Model) Reopen(err error) Model {
+	if err != nil {
+		err = fmt.Errorf("%s: %w", m.Selected.Name, err)
+	}
+	m = m.reopen()
+	m.err = err
+	return m
+}
+
+// reopen resets the model to the host list at the level it was left.
+func (m Model) reopen() Model {
+	// The sessions just ended are now the most recent
+	m.history = history.Load()
+	m.showLevel()
+	if m.Selected != nil {
+		m.selectHost(m.Selected)
+	}
+	m.mode = ModeHostList
+	m.searching = false
+	m.Selected = nil
+	m.server = nil
+	m.Action = ""
+	m.Quitted = false
+	m.notice = ""
+	m.err = nil
+	return m
+}
+
+// hostFilterValues returns the text each host is searched by.
+func hostFilterValues(hosts []*config.Host) []string {
+	values := make([]string, len(hosts))
+	for i, h := range hosts {
+		values[i] = h.Name + " " + h.Host + " " + h.User
+	}
+	return values
+}
+
+// setHosts switches the list to a new level of the host tree.
+func (m *Model) setHosts(hosts []*config.Host) {
+	m.hosts = hosts
+	m.paths = nil
+	m.sections = nil
+	m.hostList = newSelectList(hostFilterValues(hosts))
 }
 
 // Init initializes the model.
 func (m Model) Init() tea.Cmd {
 	// Request initial window size
-	return tea.WindowSize()
+	return tea.Batch(tea.WindowSize(), m.prewarmAfterDelay(m.highlighted()), pollTunnels)
 }
 
 // Update handles messages (Elm architecture).
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		return m.handleKeyMsg(msg)
+		before := m.highlighted()
+		next, cmd := m.handleKeyMsg(msg)
+		nm := next.(Model)
+		nm.hostList.Follow(nm.listHeight())
+		return nm, tea.Batch(cmd, nm.trackPrewarm(before))
+
+	case tunnelStatusMsg:
+		m.tunnels = msg.tunnels
+		return m, tea.Tick(tunnelPollInterval, func(time.Time) tea.Msg { return pollTunnels() })
+
+	case tunnelStartedMsg:
+		m.handleTunnelStarted(msg)
+		return m, nil
+
+	case probeResultMsg:
+		m.handleProbeResult(msg)
+		return m, nil
+
+	case prewarmMsg:
+		if msg.seq == m.prewarmSeq {
+			ssh.Prewarm(msg.host)
+		}
+		return m, nil
 
 	case tea.WindowSizeMsg:
 		// Update terminal dimensions
@@ -83,6 +215,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		// Update styles with new width
 		m.styles = m.styles.WithWidth(m.width)
+		m.hostList.Follow(m.listHeight())
 		return m, nil
 
 	default:
@@ -90,13 +223,27 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// repaint resets terminal modes and redraws the whole screen, for when
+// something has scribbled over the TUI.
+func repaint() tea.Cmd {
+	reset := func() tea.Msg {
+		terminal.ResetModes(os.Stdout)
+		return nil
+	}
+	return tea.Sequence(reset, tea.ClearScreen)
+}
+
 // handleKeyMsg processes keyboard input.
 func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// Handle quit
-	if msg.String() == "q" || msg.String() == "ctrl+c" {
+	// Handle quit. "q" is text while a filter is being typed.
+	typing := m.mode != ModeHostList
+	if msg.String() == "ctrl+c" || (msg.String() == "q" && !typing) {
 		m.Quitted = true
 		return m, tea.Quit
 	}
+	if msg.String() == "ctrl+l" {
+		return m, repaint()
+	}
 
 	// Handle different modes
 	switch m.mode {
@@ -108,6 +255,36 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case ModeSelectAction:
 		return m.updateSelectAction(msg)
+
+	case ModeEditHost:
+		return m.updateEditHost(msg)
+
+	case ModeBulkEdit:
+		return m.updateBulkEdit(msg)
+
+	case ModeBulkPreview:
+		return m.updateBulkPreview(msg)
+
+	case ModeSelectTunnel:
+		return m.updateSelectTunnel(msg)
+
+	case ModeConfirmPassword:
+		return m.updateConfirmPassword(msg)
+
+	case ModeConfirmDelete:
+		return m.updateConfirmDelete(msg)
+
+	case ModeSelectBroadcast:
+		return m.updateSelectBroadcast(msg)
+
+	case ModeBroadcastCommand:
+		return m.updateBroadcastCommand(msg)
+
+	case ModeBroadcastResults:
+		return m.updateBroadcastResults(msg)
+
+	case ModeConnectError:
+		return m.updateConnectError(msg)
 	}
 
 	return m, nil
@@ -115,161 +292,301 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // updateHostList handles key messages in host list mode.
 func (m Model) updateHostList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.notice = ""
+	m.err = nil
+
 	switch msg.String() {
 	case "up", "k":
-		if m.cursor > 0 {
-			m.cursor--
-		}
+		m.hostList.Up()
 
 	case "down", "j":
-		if m.cursor < len(m.filtered)-1 {
-			m.cursor++
-		}
+		m.hostList.Down()
+
+	case "pgup":
+		m.hostList.PageUp(m.listHeight())
+
+	case "pgdown":
+		m.hostList.PageDown(m.listHeight())
+
+	case "home":
+		m.hostList.Home()
+
+	case "end":
+		m.hostList.End()
 
 	case "enter":
-		if len(m.filtered) > 0 {
-			selected := m.filtered[m.cursor]
-			// Check if it's a group (has children) or a leaf node
-			if len(selected.Children) > 0 {
-				// It's a group, enter it
-				m.currentPath = append(m.currentPath, selected.Name)
-				m.hosts = selected.Children
-				m.filtered = selected.Children
-				m.cursor = 0
-			} else {
-				// It's a leaf node, select it for connection
-				m.Selected = selected
-				m.mode = ModeSelectAction
-			}
-		}
+		m.openSelectedHost()
 
 	case "esc":
 		// Go back to parent level
 		if len(m.currentPath) > 0 {
 			// Pop last path segment
 			m.currentPath = m.currentPath[:len(m.currentPath)-1]
-			m.hosts = m.config.GetHostsAtPath(m.currentPath)
-			m.filtered = m.hosts
-			m.cursor = 0
+			m.showLevel()
 		}
 
 	case "/":
-		m.mode = ModeSearching
-		m.searching = true
-		m.query = ""
+		m.startSearch()
+
+	case "c":
+		m.startClone()
+
+	case "e":
+		m.startEditHost()
+
+	case "a":
+		m.startAddHost()
+
+	case "g":
+		m.startAddGroup()
+
+	case "r":
+		m.startRename()
+
+	case "d":
+		m.startDelete()
+
+	case "*":
+		m.toggleFavorite()
+
+	case " ":
+		m.toggleMark()
+
+	case "u":
+		m.clearMarks()
+
+	case "p":
+		return m, m.startProbe()
 	}
 
 	return m, nil
 }
 
+// openSelectedHost enters the highlighted group or selects the highlighted
+// host for connection.
+func (m *Model) openSelectedHost() {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return
+	}
+	// Favorites, recent hosts and search results open where they are
+	if i < len(m.paths) {
+		m.jumpTo(i)
+		i, _ = m.hostList.Selected()
+	}
+	selected := m.hosts[i]
+
+	// With hosts marked, a host offers the actions for all of them
+	if len(m.marked) > 0 && len(selected.Children) == 0 {
+		m.showBroadcastActions()
+		return
+	}
+
+	// Check if it's a group (has children) or a leaf node
+	if len(selected.Children) > 0 {
+		// It's a group, enter it
+		m.currentPath = append(m.currentPath, selected.Name)
+		m.setHosts(selected.Children)
+		return
+	}
+
+	// It's a leaf node, select it for connection. Hosts flagged by the
+	// password policy ask first
+	m.Selected = selected
+	if m.passwordFlagged(selected) {
+		m.mode = ModeConfirmPassword
+		return
+	}
+	m.showActions()
+}
+
+// showActions offers the actions for the selected host.
+func (m *Model) showActions() {
+	m.mode = ModeSelectAction
+	m.server, _ = ssh.KnownServer(m.Selected)
+	labels := make([]string, 0, len(actions))
+	for _, a := range m.hostActions() {
+		labels = append(labels, a.label)
+	}
+	m.actionList.SetItems(labels)
+}
+
+// hostActions returns the actions offered for the selected host.
+func (m Model) hostActions() []action {
+	var offered []action
+	for _, a := range actions {
+		if a.mode == "tunnel" && len(m.Selected.Tunnels) == 0 {
+			continue
+		}
+		offered = append(offered, a)
+	}
+	return offered
+}
+
 // updateSearching handles key messages in search mode.
 func (m Model) updateSearching(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "esc":
-		// Exit search mode
-		m.mode = ModeHostList
-		m.searching = false
-		m.query = ""
-		m.filtered = m.hosts
-		m.cursor = 0
+		m.endSearch()
 
 	case "enter":
-		// Select first result if any
-		if len(m.filtered) > 0 {
-			m.Selected = m.filtered[0]
-			m.mode = ModeSelectAction
+		// Select highlighted result if any
+		if _, ok := m.hostList.Selected(); !ok {
+			m.endSearch()
+			break
 		}
+		m.openSelectedHost()
 
-	case "backspace":
-		// Remove last character
-		if len(m.query) > 0 {
-			m.query = m.query[:len(m.query)-1]
-			m.filterHosts()
-		}
+	case "up":
+		m.hostList.Up()
+
+	case "down":
+		m.hostList.Down()
+
+	case "pgup":
+		m.hostList.PageUp(m.listHeight())
+
+	case "pgdown":
+		m.hostList.PageDown(m.listHeight())
 
 	default:
-		// Handle character input
-		if msg.Type == tea.KeyRunes {
-			m.query += string(msg.Runes)
-			m.filterHosts()
-		}
+		m.hostList.HandleFilterKey(msg)
 	}
 
 	return m, nil
 }
 
 // updateSelectAction handles key messages in action selection mode.
+// Typing filters the actions; arrows move the cursor, and so do j and k
+// until a filter is typed, as in the host list.
 func (m Model) updateSelectAction(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "up", "k":
-		if m.actionCursor > 0 {
-			m.actionCursor--
+	key := msg.String()
+	if m.actionList.Query() == "" {
+		switch key {
+		case "k":
+			key = "up"
+		case "j":
+			key = "down"
 		}
+	}
 
-	case "down", "j":
-		if m.actionCursor < 1 {
-			m.actionCursor++
-		}
+	switch key {
+	case "up":
+		m.actionList.Up()
+
+	case "down":
+		m.actionList.Down()
 
 	case "enter":
-		// Select based on cursor position
-		if m.actionCursor == 0 {
-			m.Action = "ssh"
-		} else {
-			m.Action = "sftp"
+		i, ok := m.actionList.Selected()
+		if !ok {
+			return m, nil
 		}
+		a := m.hostActions()[i]
+		if a.mode == "tunnel" {
+			return m.chooseTunnel()
+		}
+		m.Action = a.mode
 		return m, tea.Quit
 
 	case "esc":
-		// Return to host list
+		// Clear the filter first, then return to host list
+		if m.actionList.Query() != "" {
+			m.actionList.SetQuery("")
+			return m, nil
+		}
 		m.mode = ModeHostList
 		m.Selected = nil
-		m.actionCursor = 0
+
+	default:
+		m.actionList.HandleFilterKey(msg)
 	}
 
 	return m, nil
 }
 
-// filterHosts filters the host list based on search query.
-func (m *Model) filterHosts() {
-	if m.query == "" {
-		m.filtered = m.hosts
-		m.cursor = 0
-		return
+// View renders the UI.
+func (m Model) View() string {
+	if m.Quitted {
+		return ""
 	}
 
-	query := strings.ToLower(m.query)
-	m.filtered = nil
+	var b strings.Builder
+	b.WriteString(m.renderHeader())
 
-	for _, host := range m.hosts {
-		if strings.Contains(strings.ToLower(host.Name), query) ||
-			strings.Contains(strings.ToLower(host.Host), query) ||
-			strings.Contains(strings.ToLower(host.User), query) {
-			m.filtered = append(m.filtered, host)
+	switch m.mode {
+	case ModeHostList, ModeSearching:
+		// Wide terminals show the highlighted host's details beside the list
+		if m.width >= detailMinWidth {
+			b.WriteString(m.renderWithDetail(Model.renderHostList))
+		} else {
+			b.WriteString(m.renderHostList())
 		}
-	}
 
-	m.cursor = 0
-}
+	case ModeSelectAction:
+		b.WriteString(m.renderActionSelect())
 
-// View renders the UI.
-func (m Model) View() string {
-	if m.Quitted {
-		return ""
+	case ModeEditHost, ModeBulkEdit:
+		b.WriteString(m.form.View(m.styles))
+
+	case ModeBulkPreview:
+		b.WriteString(m.renderBulkPreview())
+
+	case ModeSelectTunnel:
+		b.WriteString(m.renderTunnelSelect())
+
+	case ModeConfirmPassword:
+		b.WriteString(m.renderConfirmPassword())
+
+	case ModeConfirmDelete:
+		b.WriteString(m.renderConfirmDelete())
+
+	case ModeSelectBroadcast:
+		b.WriteString(m.renderSelectBroadcast())
+
+	case ModeBroadcastCommand:
+		b.WriteString(m.form.View(m.styles))
+
+	case ModeBroadcastResults:
+		b.WriteString(m.renderBroadcastResults())
+
+	case ModeConnectError:
+		b.WriteString(m.renderConnectError())
 	}
 
+	b.WriteString(m.renderFooter())
+	return b.String()
+}
+
+// renderHeader renders what every screen starts with: the banner and any
+// stale shared inventories.
+func (m Model) renderHeader() string {
 	var b strings.Builder
 
 	// Banner
 	b.WriteString(m.renderBanner())
 	b.WriteString("\n")
 
-	switch m.mode {
-	case ModeHostList, ModeSearching:
-		b.WriteString(m.renderHostList())
+	// Stale shared inventories stay flagged for the whole session
+	for _, src := range m.config.Sources {
+		if src.Stale {
+			b.WriteString(m.styles.Error.Render("! " + src.String()))
+			b.WriteString("\n")
+		}
+	}
 
-	case ModeSelectAction:
-		b.WriteString(m.renderActionSelect())
+	return b.String()
+}
+
+// renderFooter renders what every screen ends with: the running tunnels
+// and the help line.
+func (m Model) renderFooter() string {
+	var b strings.Builder
+
+	// Active forwards stay visible on every screen
+	if line := m.renderTunnelStatus(); line != "" {
+		b.WriteString("\n")
+		b.WriteString(line)
 	}
 
 	// Help
@@ -279,6 +596,26 @@ func (m Model) View() string {
 	return b.String()
 }
 
+// listHeight returns how many entries of the host list fit on the screen
+// between the header, the footer and the list's own lines around them.
+func (m Model) listHeight() int {
+	used := strings.Count(m.renderHeader(), "\n") + lipgloss.Height(m.renderFooter())
+	if len(m.currentPath) > 0 {
+		used++ // Breadcrumb
+	}
+	if m.mode == ModeSearching {
+		used++ // Search prompt
+	}
+	if m.mode == ModeHostList && len(m.sections) > 0 {
+		used += 3 // Favorites, Recent and All hosts headings
+	}
+	if m.err != nil || m.notice != "" {
+		used += 2
+	}
+	used++ // Scroll position
+	return max(1, m.height-used)
+}
+
 // renderHostList renders the host list.
 func (m Model) renderHostList() string {
 	var b strings.Builder
@@ -291,18 +628,32 @@ func (m Model) renderHostList() string {
 	}
 
 	if m.mode == ModeSearching {
-		b.WriteString(m.styles.SearchPrompt.Render("Search: " + m.query + "_"))
+		b.WriteString(m.styles.SearchPrompt.Render("Search: " + m.hostList.Query() + "_"))
 		b.WriteString("\n")
 	}
 
-	if len(m.filtered) == 0 {
+	visible := m.hostList.Visible()
+	if len(visible) == 0 {
 		b.WriteString(m.styles.HostItemDim.Render("No hosts found"))
 		return b.String()
 	}
 
-	for i, host := range m.filtered {
+	// Long lists scroll to keep the cursor on screen
+	start, end := m.hostList.Window(m.listHeight())
+	for row := start; row < end; row++ {
+		idx := visible[row]
+
+		// Head the favorites and recent hosts, and the level below them
+		if m.mode == ModeHostList && len(m.sections) > 0 {
+			if heading := m.heading(visible, row, start); heading != "" {
+				b.WriteString(m.styles.HostItemDim.Render(heading))
+				b.WriteString("\n")
+			}
+		}
+
+		host := m.hosts[idx]
 		cursor := " "
-		isSelected := i == m.cursor
+		isSelected := row == m.hostList.Cursor()
 		if isSelected {
 			cursor = ">"
 		}
@@ -312,22 +663,34 @@ func (m Model) renderHostList() string {
 		var name, addr string
 		isGroup := len(host.Children) > 0
 
+		// Entries from elsewhere in the tree show where they are
+		title := host.Name
+		if idx < len(m.paths) {
+			title = m.resultName(idx)
+		}
+		if !isGroup && m.history.IsFavorite(m.entryPath(idx)) {
+			title = "* " + title
+		}
+		if !isGroup && m.isMarked(m.entryPath(idx)) {
+			title = "✓ " + title
+		}
+
 		if isSelected {
 			// For selected row, use plain text so cursor style (black fg, cyan bg) works
 			if isGroup {
-				name = "+ " + host.Name
+				name = "+ " + title
 				addr = "" // Groups don't show address
 			} else {
-				name = host.Name
+				name = title
 				addr = host.User + "@" + host.Host
 			}
 		} else {
 			// For non-selected rows, apply individual styles
 			if isGroup {
-				name = m.styles.HostName.Render("+ " + host.Name)
+				name = m.styles.HostName.Render("+ " + title)
 				addr = "" // Groups don't show address
 			} else {
-				name = m.styles.HostName.Render(host.Name)
+				name = m.styles.HostName.Render(title)
 				addr = m.styles.HostAddr.Render(
 					host.User + "@" + host.Host,
 				)
@@ -338,6 +701,13 @@ func (m Model) renderHostList() string {
 		if addr != "" {
 			line += " - " + addr
 		}
+		if m.passwordFlagged(host) {
+			if isSelected {
+				line += "  ! password only"
+			} else {
+				line += "  " + m.styles.Error.Render("! password only")
+			}
+		}
 
 		if isSelected {
 			b.WriteString(m.styles.HostItemCursor.Render(line))
@@ -347,45 +717,82 @@ func (m Model) renderHostList() string {
 
 		b.WriteString("\n")
 	}
+	if start > 0 || end < len(visible) {
+		b.WriteString(m.styles.HostItemDim.Render(fmt.Sprintf("%d-%d of %d", start+1, end, len(visible))))
+		b.WriteString("\n")
+	}
+
+	if m.err != nil {
+		b.WriteString("\n")
+		b.WriteString(m.styles.Error.Render(m.err.Error()))
+		b.WriteString("\n")
+	} else if m.notice != "" {
+		b.WriteString("\n")
+		b.WriteString(m.styles.HostItemDim.Render(m.notice))
+		b.WriteString("\n")
+	}
 
 	return b.String()
 }
 
+// heading returns the section title to show above the entry at row, or ""
+// when it continues the section of the row above. The first row shown,
+// start, is always headed.
+func (m Model) heading(visible []int, row, start int) string {
+	section := func(row int) string {
+		if idx := visible[row]; idx < len(m.sections) {
+			return m.sections[idx]
+		}
+		return "All hosts"
+	}
+	if row > start && section(row-1) == section(row) {
+		return ""
+	}
+	return section(row)
+}
+
 // renderActionSelect renders the action selection prompt.
 func (m Model) renderActionSelect() string {
 	var b strings.Builder
 
 	b.WriteString(m.styles.Title.Render("Selected: " + m.Selected.Name))
 	b.WriteString("\n")
+	if info := m.server; info != nil {
+		b.WriteString(m.styles.HostItemDim.Render(fmt.Sprintf("Server: %s (seen %s ago)",
+			info.Software(), time.Since(info.At).Round(time.Minute))))
+		b.WriteString("\n")
+		if algs := info.Algorithms(); algs != "" {
+			b.WriteString(m.styles.HostItemDim.Render(algs))
+			b.WriteString("\n")
+		}
+	}
 	b.WriteString(m.styles.ModePrompt.Render("Connect via:"))
 	b.WriteString("\n")
 
-	// SSH option
-	cursor := " "
-	if m.actionCursor == 0 {
-		cursor = ">"
-	}
-	line := cursor + " SSH"
-	if m.actionCursor == 0 {
-		b.WriteString(m.styles.HostItemCursor.Render(line))
-	} else {
-		b.WriteString(m.styles.HostItem.Render(line))
+	if q := m.actionList.Query(); q != "" {
+		b.WriteString(m.styles.SearchPrompt.Render("Filter: " + q + "_"))
+		b.WriteString("\n")
 	}
-	b.WriteString("\n")
 
-	// SFTP option
-	cursor = " "
-	if m.actionCursor == 1 {
-		cursor = ">"
+	visible := m.actionList.Visible()
+	if len(visible) == 0 {
+		b.WriteString(m.styles.HostItemDim.Render("No matching actions"))
+		b.WriteString("\n")
 	}
-	line = cursor + " SFTP"
-	if m.actionCursor == 1 {
-		b.WriteString(m.styles.HostItemCursor.Render(line))
-	} else {
-		b.WriteString(m.styles.HostItem.Render(line))
+	for row, idx := range visible {
+		cursor := " "
+		if row == m.actionList.Cursor() {
+			cursor = ">"
+		}
+		line := cursor + " " + m.hostActions()[idx].label
+		if row == m.actionList.Cursor() {
+			b.WriteString(m.styles.HostItemCursor.Render(line))
+		} else {
+			b.WriteString(m.styles.HostItem.Render(line))
+		}
+		b.WriteString("\n")
 	}
 
-	b.WriteString("\n")
 	b.WriteString(m.styles.HostItemDim.Render("Press ESC to go back"))
 
 	return b.String()
@@ -429,24 +836,61 @@ func (m Model) renderHelp() string {
 	case ModeHostList:
 		if len(m.currentPath) > 0 {
 			help = []string{
-				m.keys.Up + " up", m.keys.Down + " down", m.keys.Select + " select",
-				"esc back", m.keys.Search + " search", m.keys.Quit + " quit",
+				m.keys.Up + " up", m.keys.Down + " down", m.keys.Page + " page", m.keys.Select + " select",
+				"esc back", m.keys.Search + " search", m.keys.Add + " add", m.keys.AddGroup + " add group",
+				m.keys.Edit + " edit", m.keys.Rename + " rename", m.keys.Delete + " delete", m.keys.Clone + " clone", m.keys.Favorite + " favorite", m.keys.Mark + " mark", m.keys.Probe + " probe", m.keys.Quit + " quit",
 			}
 		} else {
 			help = []string{
-				m.keys.Up + " up", m.keys.Down + " down", m.keys.Select + " select",
-				m.keys.Search + " search", m.keys.Quit + " quit",
+				m.keys.Up + " up", m.keys.Down + " down", m.keys.Page + " page", m.keys.Select + " select",
+				m.keys.Search + " search", m.keys.Add + " add", m.keys.AddGroup + " add group",
+				m.keys.Edit + " edit", m.keys.Rename + " rename", m.keys.Delete + " delete", m.keys.Clone + " clone", m.keys.Favorite + " favorite", m.keys.Mark + " mark", m.keys.Probe + " probe", m.keys.Quit + " quit",
 			}
 		}
 
 	case ModeSearching:
 		help = []string{
-			"type to search", "enter select", "esc cancel",
+			"type to search", "↑/↓ move", "enter select", "esc cancel",
 		}
 
 	case ModeSelectAction:
 		help = []string{
-			m.keys.Up + " up", m.keys.Down + " down", m.keys.Select + " select", "esc back",
+			m.keys.Up + " up", m.keys.Down + " down", "type to filter", m.keys.Select + " select", "esc back",
+		}
+
+	case ModeSelectTunnel, ModeSelectBroadcast:
+		help = []string{
+			"↑/↓ move", "type to filter", m.keys.Select + " select", "esc back",
+		}
+
+	case ModeEditHost, ModeBulkEdit, ModeBroadcastCommand:
+		help = []string{
+			"tab/↑/↓ move", "enter next", "ctrl+s save", "ctrl+u clear", "esc cancel",
+		}
+
+	case ModeBulkPreview:
+		help = []string{
+			"enter/y save", "esc back to form",
+		}
+
+	case ModeConfirmPassword:
+		help = []string{
+			"y connect", "n/esc back",
+		}
+
+	case ModeConfirmDelete:
+		help = []string{
+			"y delete", "n/esc back",
+		}
+
+	case ModeBroadcastResults:
+		help = []string{
+			"any key back",
+		}
+
+	case ModeConnectError:
+		help = []string{
+			"r/enter retry", m.keys.Edit + " edit host", "esc back", "ctrl+c quit",
 		}
 	}
 
@@ -0,0 +1,310 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestMain(m *testing.M) {
+	// History and server records come from the state directory
+	dir, err := os.MkdirTemp("", "sshm-tui")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_STATE_HOME", dir)
+	// Golden views are compared without colors
+	lipgloss.SetColorProfile(termenv.Ascii)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testConfig is a small tree: a group of two hosts and a host.
+func testConfig() *config.Config {
+	return &config.Config{Hosts: []*config.Host{
+		{Name: "prod", Children: []*config.Host{
+			{Name: "web1", Host: "10.0.0.1", User: "app", Port: 22},
+			{Name: "web2", Host: "10.0.0.2", User: "app", Port: 22},
+		}},
+		{Name: "dev", Host: "10.0.1.1", User: "me", Port: 22},
+	}}
+}
+
+// key returns the message for a key as bubbletea names it.
+func key(name string) tea.KeyMsg {
+	types := map[string]tea.KeyType{
+		"enter": tea.KeyEnter, "esc": tea.KeyEscape, "backspace": tea.KeyBackspace,
+		"up": tea.KeyUp, "down": tea.KeyDown, "pgup": tea.KeyPgUp, "pgdown": tea.KeyPgDown,
+		"home": tea.KeyHome, "end": tea.KeyEnd,
+	}
+	if t, ok := types[name]; ok {
+		return tea.KeyMsg{Type: t}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(name)}
+}
+
+// press sends each key to m in turn and returns the model and the last
+// command.
+func press(t *testing.T, m Model, keys ...string) (Model, tea.Cmd) {
+	t.Helper()
+	var cmd tea.Cmd
+	for _, k := range keys {
+		var next tea.Model
+		next, cmd = m.Update(key(k))
+		m = next.(Model)
+	}
+	return m, cmd
+}
+
+// typeText sends text one key at a time.
+func typeText(t *testing.T, m Model, text string) Model {
+	t.Helper()
+	for _, r := range text {
+		m, _ = press(t, m, string(r))
+	}
+	return m
+}
+
+// highlightedName returns the name of the entry under the host cursor.
+func highlightedName(m Model) string {
+	i, ok := m.hostList.Selected()
+	if !ok {
+		return ""
+	}
+	return m.hosts[i].Name
+}
+
+func TestModelDrillDown(t *testing.T) {
+	m := NewModel(testConfig())
+	if got := highlightedName(m); got != "prod" {
+		t.Fatalf("highlighted = %q, want prod", got)
+	}
+
+	m, _ = press(t, m, "enter")
+	if !slices.Equal(m.currentPath, []string{"prod"}) {
+		t.Fatalf("path = %v after entering the group, want [prod]", m.currentPath)
+	}
+	if got := highlightedName(m); got != "web1" {
+		t.Errorf("highlighted = %q, want web1", got)
+	}
+	if !strings.Contains(m.View(), "Path: prod") {
+		t.Error("view has no breadcrumb inside the group")
+	}
+
+	m, _ = press(t, m, "j", "enter")
+	if m.mode != ModeSelectAction || m.Selected == nil || m.Selected.Name != "web2" {
+		t.Fatalf("mode = %v, selected = %v after selecting web2", m.mode, m.Selected)
+	}
+
+	// Back out to the list, then to the top level
+	m, _ = press(t, m, "esc")
+	if m.mode != ModeHostList || m.Selected != nil {
+		t.Errorf("mode = %v, selected = %v after esc, want the host list", m.mode, m.Selected)
+	}
+	m, _ = press(t, m, "esc")
+	if len(m.currentPath) != 0 {
+		t.Errorf("path = %v after esc, want the top level", m.currentPath)
+	}
+	if got := highlightedName(m); got != "prod" {
+		t.Errorf("highlighted = %q at the top level, want prod", got)
+	}
+}
+
+func TestModelSearch(t *testing.T) {
+	m := NewModel(testConfig())
+	m, _ = press(t, m, "/")
+	if m.mode != ModeSearching {
+		t.Fatalf("mode = %v after /, want searching", m.mode)
+	}
+	// The search lists every host, not groups
+	if got := len(m.hostList.Visible()); got != 3 {
+		t.Errorf("search lists %d hosts, want 3", got)
+	}
+
+	// "q" is search text, not quit
+	m = typeText(t, m, "qweb2")
+	if m.Quitted || len(m.hostList.Visible()) != 0 {
+		t.Errorf("quitted = %v, %d results for qweb2", m.Quitted, len(m.hostList.Visible()))
+	}
+	m, _ = press(t, m, "backspace")
+	if m.hostList.Query() != "qweb" {
+		t.Fatalf("query = %q after backspace, want qweb", m.hostList.Query())
+	}
+	m, _ = press(t, m, "backspace", "backspace", "backspace", "backspace")
+	m = typeText(t, m, "web2")
+	if got := highlightedName(m); got != "web2" {
+		t.Fatalf("best result = %q, want web2", got)
+	}
+	if !strings.Contains(m.View(), "prod/web2") {
+		t.Error("search result does not show where the host is")
+	}
+
+	// Selecting a result goes to its level
+	m, _ = press(t, m, "enter")
+	if m.mode != ModeSelectAction || m.Selected.Name != "web2" {
+		t.Fatalf("mode = %v, selected = %v after enter", m.mode, m.Selected)
+	}
+	if !slices.Equal(m.currentPath, []string{"prod"}) {
+		t.Errorf("path = %v, want [prod]", m.currentPath)
+	}
+
+	// Esc ends a search where it started
+	m = NewModel(testConfig())
+	m, _ = press(t, m, "j", "/")
+	m = typeText(t, m, "web")
+	m, _ = press(t, m, "esc")
+	if m.mode != ModeHostList || highlightedName(m) != "dev" {
+		t.Errorf("mode = %v, highlighted = %q after esc, want the list on dev", m.mode, highlightedName(m))
+	}
+}
+
+func TestModelSelectAction(t *testing.T) {
+	m := NewModel(testConfig())
+	m, _ = press(t, m, "j", "enter")
+	if m.mode != ModeSelectAction {
+		t.Fatalf("mode = %v, want action select", m.mode)
+	}
+	// Hosts without tunnels are offered SSH and SFTP
+	if got := len(m.actionList.Visible()); got != 2 {
+		t.Errorf("%d actions offered, want 2", got)
+	}
+
+	m, cmd := press(t, m, "down", "enter")
+	if m.Action != "sftp" || cmd == nil {
+		t.Errorf("action = %q, cmd = %v, want sftp and quit", m.Action, cmd)
+	}
+
+	// Typing filters; esc clears the filter before going back
+	m = NewModel(testConfig())
+	m, _ = press(t, m, "j", "enter")
+	m = typeText(t, m, "ssh")
+	if got := len(m.actionList.Visible()); got != 1 {
+		t.Errorf("%d actions match ssh, want 1", got)
+	}
+	m, _ = press(t, m, "esc")
+	if m.mode != ModeSelectAction || m.actionList.Query() != "" {
+		t.Errorf("mode = %v, query = %q after esc, want the filter cleared", m.mode, m.actionList.Query())
+	}
+	m, cmd = press(t, m, "enter")
+	if m.Action != "ssh" || cmd == nil {
+		t.Errorf("action = %q, want ssh", m.Action)
+	}
+}
+
+func TestModelSelectActionVimKeys(t *testing.T) {
+	m := NewModel(testConfig())
+	m, _ = press(t, m, "j", "enter")
+
+	m, _ = press(t, m, "j")
+	if m.actionList.Cursor() != 1 || m.actionList.Query() != "" {
+		t.Errorf("cursor = %d, query = %q after j, want the cursor moved", m.actionList.Cursor(), m.actionList.Query())
+	}
+	m, _ = press(t, m, "k")
+	if m.actionList.Cursor() != 0 {
+		t.Errorf("cursor = %d after k, want 0", m.actionList.Cursor())
+	}
+
+	// Once a filter is typed they are text
+	m = typeText(t, m, "sk")
+	if m.actionList.Query() != "sk" {
+		t.Errorf("query = %q, want sk", m.actionList.Query())
+	}
+}
+
+func TestModelWindowSize(t *testing.T) {
+	m := NewModel(testConfig())
+	next, cmd := m.Update(tea.WindowSizeMsg{Width: 132, Height: 50})
+	m = next.(Model)
+	if cmd != nil {
+		t.Error("resize returned a command")
+	}
+	if m.width != 132 || m.height != 50 {
+		t.Errorf("size = %dx%d, want 132x50", m.width, m.height)
+	}
+	tall := m.listHeight()
+
+	next, _ = m.Update(tea.WindowSizeMsg{Width: 60, Height: 30})
+	m = next.(Model)
+	if short := m.listHeight(); short != tall-20 {
+		t.Errorf("list height = %d at 30 rows, want %d", short, tall-20)
+	}
+	// Host rows are padded to the new width
+	for _, line := range strings.Split(m.View(), "\n") {
+		if line = stripANSI(line); strings.Contains(line, "dev - ") {
+			if w := len([]rune(line)); w != 60 {
+				t.Errorf("host row %q is %d wide on a 60 column screen", line, w)
+			}
+		}
+	}
+}
+
+func TestModelScroll(t *testing.T) {
+	cfg := &config.Config{}
+	for i := range 40 {
+		cfg.Hosts = append(cfg.Hosts, &config.Host{Name: fmt.Sprintf("host%02d", i), Host: "10.0.0.1", User: "u", Port: 22})
+	}
+	m := NewModel(cfg)
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 60, Height: 30})
+	m = next.(Model)
+	height := m.listHeight()
+	if height >= 40 {
+		t.Fatalf("list height = %d, want fewer rows than hosts", height)
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "host00") || strings.Contains(view, "host39") {
+		t.Error("first screen does not start at the top")
+	}
+	if !strings.Contains(view, fmt.Sprintf("1-%d of 40", height)) {
+		t.Errorf("view has no scroll position 1-%d of 40", height)
+	}
+
+	m, _ = press(t, m, "end")
+	view = m.View()
+	if !strings.Contains(view, "host39") || strings.Contains(view, "host00") {
+		t.Error("end does not scroll to the last host")
+	}
+	if !strings.Contains(view, fmt.Sprintf("%d-40 of 40", 41-height)) {
+		t.Errorf("view has no scroll position %d-40 of 40", 41-height)
+	}
+
+	// Moving up inside the window keeps it still
+	m, _ = press(t, m, "k")
+	if start, _ := m.hostList.Window(height); start != 40-height {
+		t.Errorf("window starts at %d after k, want %d", start, 40-height)
+	}
+	m, _ = press(t, m, "pgup")
+	if got, want := m.hostList.Cursor(), 38-height; got != want {
+		t.Errorf("cursor = %d after pgup, want %d", got, want)
+	}
+	if start, _ := m.hostList.Window(height); start != m.hostList.Cursor() {
+		t.Errorf("window starts at %d, want the cursor row %d", start, m.hostList.Cursor())
+	}
+	m, _ = press(t, m, "home")
+	if !strings.Contains(m.View(), "host00") {
+		t.Error("home does not scroll back to the top")
+	}
+}
+
+// stripANSI removes terminal escape sequences from s.
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b {
+			for i++; i < len(s) && (s[i] < '@' || s[i] > '~' || s[i] == '['); i++ {
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package tui
+
+import (
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// passwordFlagged reports whether the warn-password-auth policy flags
+// host: a leaf logging in with a plaintext password and no key.
+func (m Model) passwordFlagged(host *config.Host) bool {
+	return m.config.WarnPasswordAuth && len(host.Children) == 0 && host.PlaintextPasswordOnly()
+}
+
+// updateConfirmPassword handles key messages on the question asked
+// before connecting to a flagged host.
+func (m Model) updateConfirmPassword(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		m.showActions()
+
+	case "n", "N", "esc", "enter":
+		m.mode = ModeHostList
+		m.Selected = nil
+	}
+
+	return m, nil
+}
+
+// renderConfirmPassword renders the question asked before connecting to a
+// flagged host.
+func (m Model) renderConfirmPassword() string {
+	return m.styles.Title.Render("Selected: "+m.Selected.Name) + "\n" +
+		m.styles.Error.Render("! "+m.Selected.Name+" logs in with a plaintext password and no key.") + "\n" +
+		m.styles.HostItemDim.Render("Consider keypath, or at least \"sshm config encrypt\".") + "\n" +
+		m.styles.ModePrompt.Render("Connect anyway? [y/N]") + "\n"
+}
@@ -0,0 +1,64 @@
+package tui
+
+import (
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// prewarmDelay is how long the cursor must rest on a host before it is
+// dialed in the background.
+const prewarmDelay = 500 * time.Millisecond
+
+// prewarmMsg fires once the cursor has rested on host. It is ignored if
+// the cursor moved since (seq no longer matches).
+type prewarmMsg struct {
+	host *config.Host
+	seq  int
+}
+
+// highlighted returns the host that would be connected to next: the host
+// under the cursor, or the one whose actions are shown. Groups don't count,
+// nor do hosts the password policy asks about until they are confirmed.
+func (m Model) highlighted() *config.Host {
+	switch m.mode {
+	case ModeSelectAction:
+		return m.Selected
+	case ModeHostList, ModeSearching:
+		i, ok := m.hostList.Selected()
+		if !ok || len(m.hosts[i].Children) > 0 || m.passwordFlagged(m.hosts[i]) {
+			return nil
+		}
+		return m.hosts[i]
+	}
+	return nil
+}
+
+// trackPrewarm restarts the warm-up timer when the highlighted host is no
+// longer before, cancelling the pre-dial for the old one.
+func (m *Model) trackPrewarm(before *config.Host) tea.Cmd {
+	if !m.config.Prewarm || m.Quitted {
+		return nil
+	}
+	host := m.highlighted()
+	if host == before {
+		return nil
+	}
+
+	m.prewarmSeq++
+	ssh.CancelPrewarm()
+	return m.prewarmAfterDelay(host)
+}
+
+// prewarmAfterDelay schedules the pre-dial of host for the current seq.
+func (m Model) prewarmAfterDelay(host *config.Host) tea.Cmd {
+	if !m.config.Prewarm || host == nil {
+		return nil
+	}
+	seq := m.prewarmSeq
+	return tea.Tick(prewarmDelay, func(time.Time) tea.Msg {
+		return prewarmMsg{host: host, seq: seq}
+	})
+}
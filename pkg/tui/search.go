@@ -0,0 +1,145 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+)
+
+// startSearch lists every host of the tree, whatever the level, for the
+// search query to narrow down.
+func (m *Model) startSearch() {
+	m.searchFrom, _ = m.hostList.Selected()
+	var (
+		hosts []*config.Host
+		paths [][]string
+	)
+	var walk func(level []*config.Host, path []string)
+	walk = func(level []*config.Host, path []string) {
+		for _, h := range level {
+			if len(h.Children) > 0 {
+				walk(h.Children, append(slices.Clip(path), h.Name))
+				continue
+			}
+			hosts = append(hosts, h)
+			paths = append(paths, path)
+		}
+	}
+	walk(m.config.Hosts, nil)
+
+	m.setHosts(hosts)
+	m.paths = paths
+	values := make([]string, len(hosts))
+	for i, h := range hosts {
+		values[i] = strings.Join(append([]string{m.resultName(i), h.Host, h.User}, h.Tags...), " ")
+	}
+	m.hostList = newSelectList(values)
+	m.hostList.fuzzy = true
+	m.mode = ModeSearching
+	m.searching = true
+}
+
+// resultName returns the full path of entry i, which lives elsewhere in
+// the tree, e.g. "prod/eu/web1".
+func (m Model) resultName(i int) string {
+	return strings.Join(append(slices.Clip(m.paths[i]), m.hosts[i].Name), "/")
+}
+
+// endSearch returns to the level the search started from.
+func (m *Model) endSearch() {
+	m.mode = ModeHostList
+	m.searching = false
+	m.showLevel()
+	m.hostList.Select(m.searchFrom)
+}
+
+// jumpTo moves to the level of entry i, which lives elsewhere in the tree,
+// with the cursor on it.
+func (m *Model) jumpTo(i int) {
+	host := m.hosts[i]
+	m.currentPath = slices.Clone(m.paths[i])
+	m.mode = ModeHostList
+	m.searching = false
+	m.showLevel()
+	m.selectHost(host)
+}
+
+// Scores of a fuzzy match, after fzf: every matched character scores,
+// more so at the start of a word and right after the previous match, and
+// gaps between matches cost.
+const (
+	scoreMatch       = 16
+	bonusBoundary    = 8 // Match at the start of the text or a word
+	bonusConsecutive = 4 // Match right after the previous one
+	penaltyGapStart  = 3
+	penaltyGapExtend = 1
+)
+
+// fuzzyScore matches query against text. Each space separated term of
+// query must occur in text as a subsequence, ignoring case; the score is
+// the sum of each term's best placement.
+func fuzzyScore(text, query string) (int, bool) {
+	runes := []rune(strings.ToLower(text))
+	total := 0
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		score, ok := termScore(runes, []rune(term))
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// termScore returns the best score of term as a subsequence of text.
+func termScore(text, term []rune) (int, bool) {
+	const none = -1 << 31
+	// best[i] is the best score of the term so far with its last matched
+	// character at text[i]
+	best := make([]int, len(text))
+	for i, r := range text {
+		best[i] = none
+		if r == term[0] {
+			best[i] = scoreMatch + 2*boundary(text, i)
+		}
+	}
+
+	for _, r := range term[1:] {
+		next := make([]int, len(text))
+		for i := range text {
+			next[i] = none
+			if text[i] != r {
+				continue
+			}
+			for k := 0; k < i; k++ {
+				if best[k] == none {
+					continue
+				}
+				score := best[k] + scoreMatch + boundary(text, i)
+				if k == i-1 {
+					score += bonusConsecutive
+				} else {
+					score -= penaltyGapStart + penaltyGapExtend*(i-k-2)
+				}
+				next[i] = max(next[i], score)
+			}
+		}
+		best = next
+	}
+
+	score := none
+	for _, s := range best {
+		score = max(score, s)
+	}
+	return score, score != none
+}
+
+// boundary returns the bonus for a match at text[i].
+func boundary(text []rune, i int) int {
+	if i == 0 || !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]) {
+		return bonusBoundary
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"github.com/ai-help-me/sshm/pkg/theme"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -24,6 +25,9 @@ type Styles struct {
 	HostAddr lipgloss.Style
 	HostInfo lipgloss.Style
 
+	// DetailPane frames the host details beside the list
+	DetailPane lipgloss.Style
+
 	// Mode selector
 	ModePrompt   lipgloss.Style
 	ModeOption   lipgloss.Style
@@ -37,13 +41,18 @@ type Styles struct {
 
 // DefaultStyles returns the default styling.
 func DefaultStyles() Styles {
+	return NewStyles(theme.Default)
+}
+
+// NewStyles returns the styling for a palette.
+func NewStyles(t theme.Theme) Styles {
 	var styles Styles
 
 	// Color palette
-	primaryColor := lipgloss.Color("86")   // Cyan
-	secondaryColor := lipgloss.Color("98") // Purple
-	errorColor := lipgloss.Color("196")    // Red
-	dimColor := lipgloss.Color("241")      // Gray
+	primaryColor := lipgloss.Color(t.Primary)
+	secondaryColor := lipgloss.Color(t.Secondary)
+	errorColor := lipgloss.Color(t.Error)
+	dimColor := lipgloss.Color(t.Dim)
 
 	// Main containers
 	styles.App = lipgloss.NewStyle().
@@ -77,7 +86,7 @@ func DefaultStyles() Styles {
 
 	styles.HostItemCursor = lipgloss.NewStyle().
 		PaddingLeft(1).
-		Foreground(lipgloss.Color("black")).
+		Foreground(lipgloss.Color(t.OnPrimary)).
 		Background(primaryColor).
 		Bold(true)
 
@@ -94,7 +103,13 @@ func DefaultStyles() Styles {
 		Foreground(dimColor)
 
 	styles.HostInfo = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("242"))
+		Foreground(lipgloss.Color(t.Info))
+
+	styles.DetailPane = lipgloss.NewStyle().
+		Width(detailWidth-1).
+		PaddingLeft(1).
+		Border(lipgloss.NormalBorder(), false, false, false, true).
+		BorderForeground(dimColor)
 
 	// Mode selector
 	styles.ModePrompt = lipgloss.NewStyle().
@@ -118,7 +133,7 @@ func DefaultStyles() Styles {
 		Bold(true)
 
 	styles.BannerDesc = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("white")).
+		Foreground(lipgloss.Color(t.Text)).
 		Bold(true)
 
 	styles.BannerVersion = lipgloss.NewStyle().
@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/daemon"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/sftp"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tunnelPollInterval is how often the status line asks the daemon for
+// tunnel statistics.
+const tunnelPollInterval = 2 * time.Second
+
+// tunnelStatusMsg carries the tunnels running in the daemon (none if it
+// isn't running).
+type tunnelStatusMsg struct {
+	tunnels []forward.Status
+}
+
+// tunnelStartedMsg reports the outcome of starting a tunnel.
+type tunnelStartedMsg struct {
+	spec    forward.Spec
+	tunnels []forward.Status
+	err     error
+}
+
+// pollTunnels asks the daemon for the running tunnels.
+func pollTunnels() tea.Msg {
+	resp, err := daemon.Call(daemon.Request{Op: daemon.OpStatus})
+	if err != nil {
+		return tunnelStatusMsg{}
+	}
+	return tunnelStatusMsg{tunnels: resp.Tunnels}
+}
+
+// startTunnel hands spec to the daemon, spawning it if needed.
+func startTunnel(spec forward.Spec) tea.Cmd {
+	return func() tea.Msg {
+		if err := daemon.Ensure(); err != nil {
+			return tunnelStartedMsg{spec: spec, err: err}
+		}
+		resp, err := daemon.Call(daemon.Request{Op: daemon.OpAdd, Spec: spec})
+		if err != nil {
+			return tunnelStartedMsg{spec: spec, err: err}
+		}
+		return tunnelStartedMsg{spec: spec, tunnels: resp.Tunnels}
+	}
+}
+
+// SelectedPath returns the config path of the selected host, e.g.
+// "prod/web1".
+func (m Model) SelectedPath() string {
+	return strings.Join(append(append([]string{}, m.currentPath...), m.Selected.Name), "/")
+}
+
+// selectedTunnels returns the tunnels declared on the selected host.
+func (m Model) selectedTunnels() []forward.Spec {
+	path := m.SelectedPath()
+	specs := make([]forward.Spec, len(m.Selected.Tunnels))
+	for i, t := range m.Selected.Tunnels {
+		specs[i] = forward.FromConfig(path, t)
+	}
+	return specs
+}
+
+// chooseTunnel starts the selected host's only tunnel, or lets the user
+// pick one.
+func (m Model) chooseTunnel() (tea.Model, tea.Cmd) {
+	specs := m.selectedTunnels()
+	if len(specs) == 1 {
+		return m.launchTunnel(specs[0])
+	}
+
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
+	}
+	m.tunnelList.SetItems(names)
+	m.mode = ModeSelectTunnel
+	return m, nil
+}
+
+// launchTunnel starts spec in the background and returns to the host list.
+func (m Model) launchTunnel(spec forward.Spec) (tea.Model, tea.Cmd) {
+	m.mode = ModeHostList
+	m.Selected = nil
+	m.err = nil
+	m.notice = "Starting tunnel " + spec.Name + "..."
+	return m, startTunnel(spec)
+}
+
+// handleTunnelStarted reports a started tunnel under the host list.
+func (m *Model) handleTunnelStarted(msg tunnelStartedMsg) {
+	if msg.err != nil {
+		m.notice = ""
+		m.err = fmt.Errorf("tunnel %s: %w", msg.spec.Name, msg.err)
+		return
+	}
+	m.tunnels = msg.tunnels
+	m.notice = fmt.Sprintf("Tunnel %s: %s via %s", msg.spec.Name, msg.spec, msg.spec.Host)
+}
+
+// updateSelectTunnel handles key messages in tunnel selection mode.
+func (m Model) updateSelectTunnel(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up":
+		m.tunnelList.Up()
+
+	case "down":
+		m.tunnelList.Down()
+
+	case "enter":
+		i, ok := m.tunnelList.Selected()
+		if !ok {
+			return m, nil
+		}
+		return m.launchTunnel(m.selectedTunnels()[i])
+
+	case "esc":
+		// Clear the filter first, then return to the actions
+		if m.tunnelList.Query() != "" {
+			m.tunnelList.SetQuery("")
+			return m, nil
+		}
+		m.mode = ModeSelectAction
+
+	default:
+		m.tunnelList.HandleFilterKey(msg)
+	}
+
+	return m, nil
+}
+
+// renderTunnelSelect renders the selected host's tunnels.
+func (m Model) renderTunnelSelect() string {
+	var b strings.Builder
+
+	b.WriteString(m.styles.Title.Render("Selected: " + m.Selected.Name))
+	b.WriteString("\n")
+	b.WriteString(m.styles.ModePrompt.Render("Start tunnel:"))
+	b.WriteString("\n")
+
+	if q := m.tunnelList.Query(); q != "" {
+		b.WriteString(m.styles.SearchPrompt.Render("Filter: " + q + "_"))
+		b.WriteString("\n")
+	}
+
+	specs := m.selectedTunnels()
+	visible := m.tunnelList.Visible()
+	if len(visible) == 0 {
+		b.WriteString(m.styles.HostItemDim.Render("No matching tunnels"))
+		b.WriteString("\n")
+	}
+	for row, idx := range visible {
+		spec := specs[idx]
+		if row == m.tunnelList.Cursor() {
+			b.WriteString(m.styles.HostItemCursor.Render("> " + spec.Name + " - " + spec.String()))
+		} else {
+			b.WriteString(m.styles.HostItem.Render("  " + m.styles.HostName.Render(spec.Name) +
+				" - " + m.styles.HostAddr.Render(spec.String())))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(m.styles.HostItemDim.Render("Press ESC to go back"))
+
+	return b.String()
+}
+
+// renderTunnelStatus summarizes the running tunnels in one line, or
+// returns "" when there are none.
+func (m Model) renderTunnelStatus() string {
+	if len(m.tunnels) == 0 {
+		return ""
+	}
+
+	states := make(map[forward.State]int)
+	var conns, in, out int64
+	for _, st := range m.tunnels {
+		states[st.State]++
+		conns += st.Conns
+		in += st.BytesIn
+		out += st.BytesOut
+	}
+
+	line := fmt.Sprintf("Tunnels: %d up", states[forward.StateUp])
+	for _, state := range []forward.State{forward.StateConnecting, forward.StateRetrying} {
+		if states[state] > 0 {
+			line += fmt.Sprintf(", %d %s", states[state], state)
+		}
+	}
+	line += fmt.Sprintf(" • %d conns • in %s • out %s", conns, sftp.FormatBytes(in), sftp.FormatBytes(out))
+	return m.styles.HostItemDim.Render(line)
+}
@@ -0,0 +1,53 @@
+package tui
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/teatest"
+)
+
+// Run with -update to rewrite the golden files in testdata/ after an
+// intended change to the screens.
+
+// runView drives a model built on cfg through teatest on a width×height
+// terminal: it types each of keys, waits for wait to be on screen and
+// returns the model's final view.
+func runView(t *testing.T, cfg *config.Config, width, height int, wait string, keys ...tea.KeyMsg) string {
+	t.Helper()
+	tm := teatest.NewTestModel(t, NewModel(cfg), teatest.WithInitialTermSize(width, height))
+	for _, k := range keys {
+		tm.Send(k)
+	}
+	teatest.WaitFor(t, tm.Output(), func(out []byte) bool {
+		return bytes.Contains(out, []byte(wait))
+	}, teatest.WithDuration(3*time.Second))
+	if err := tm.Quit(); err != nil {
+		t.Fatal(err)
+	}
+	return tm.FinalModel(t, teatest.WithFinalTimeout(3*time.Second)).View()
+}
+
+func TestViewHostList(t *testing.T) {
+	view := runView(t, testConfig(), 80, 24, "dev", key("j"))
+	teatest.RequireEqualOutput(t, []byte(view))
+}
+
+func TestViewFilter(t *testing.T) {
+	view := runView(t, testConfig(), 80, 24, "Search: web2_",
+		key("/"), key("w"), key("e"), key("b"), key("2"))
+	teatest.RequireEqualOutput(t, []byte(view))
+}
+
+func TestViewDetail(t *testing.T) {
+	cfg := testConfig()
+	web1 := cfg.Hosts[0].Children[0]
+	web1.KeyPath = "~/.ssh/prod"
+	web1.Tags = []string{"web", "eu"}
+	web1.Jump = []*config.Host{{Host: "bastion", User: "jump", Port: 2222}}
+	view := runView(t, cfg, 120, 30, "press p to check", key("enter"))
+	teatest.RequireEqualOutput(t, []byte(view))
+}
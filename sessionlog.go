@@ -0,0 +1,94 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/state"
+	"golang.org/x/term"
+)
+
+// openSessionLog starts recording the output of a session on host when
+// --log or the host's session-log asks for it, and returns nil otherwise.
+// A log that can't be created is reported and the session goes on
+// without it.
+func openSessionLog(host *config.Host) *ssh.SessionLog {
+	format := cmp.Or(logFormat, host.SessionLog)
+	if format == "" {
+		return nil
+	}
+
+	f, err := createSessionLog(host.Name, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session log: %v\n", err)
+		return nil
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	log, err := ssh.NewSessionLog(f, format, width, height, host.User+"@"+host.Host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session log: %v\n", err)
+		return nil
+	}
+	infof("Recording session to %s\n", f.Name())
+	return log
+}
+
+// closeSessionLog ends a session's log, reporting what went wrong with it.
+func closeSessionLog(log *ssh.SessionLog) {
+	if err := log.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session log: %v\n", err)
+	}
+}
+
+// createSessionLog creates the file a session on the host named name is
+// recorded to: logs/<name>/<start time> in the state directory, readable
+// only by the user since sessions show secrets.
+func createSessionLog(name, format string) (*os.File, error) {
+	dir, err := state.Path(filepath.Join("logs", logDirName(name)))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ext := ".log"
+	if format == config.SessionLogAsciinema {
+		ext = ".cast"
+	}
+	stamp := time.Now().Format("2006-01-02T15-04-05")
+	for i := 1; ; i++ {
+		file := stamp + ext
+		if i > 1 {
+			file = fmt.Sprintf("%s-%d%s", stamp, i, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, file), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// logDirName makes a host name safe to use as a directory name.
+func logDirName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "_" + name
+	}
+	return name
+}
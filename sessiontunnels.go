@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/daemon"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sessionTunnels are a host's tunnels brought up on the connection of an
+// interactive SSH session, for as long as the session lasts.
+type sessionTunnels struct {
+	host    *config.Host
+	tunnels []*forward.Tunnel
+}
+
+// startSessionTunnels starts the tunnels declared on ref over the session
+// connection current returns, skipping those the daemon already runs.
+// Tunnels that can't listen locally are reported and left out.
+func startSessionTunnels(ref config.HostRef, current func() *gossh.Client) *sessionTunnels {
+	st := &sessionTunnels{host: ref.Host}
+	specs := hostTunnels(ref)
+	if len(specs) == 0 {
+		return st
+	}
+
+	running := make(map[string]bool)
+	if resp, err := daemon.Call(daemon.Request{Op: daemon.OpStatus}); err == nil {
+		for _, t := range resp.Tunnels {
+			running[t.Name] = true
+		}
+	}
+
+	dial := sessionDialer(current)
+	for _, spec := range specs {
+		if running[spec.Name] {
+			continue
+		}
+		t, err := forward.Start(spec, dial, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: tunnel %s: %v\n", spec.Name, err)
+			continue
+		}
+		st.tunnels = append(st.tunnels, t)
+		infof("Tunnel %s: %s (for this session)\n", spec.Name, spec)
+	}
+	return st
+}
+
+// stop ends the tunnels and lists how they did. With keep-tunnels set,
+// the daemon takes them over on a connection of its own.
+func (st *sessionTunnels) stop() {
+	if len(st.tunnels) == 0 {
+		return
+	}
+
+	rows := [][]string{{"TUNNEL", "FORWARD", "STATE", "IN", "OUT"}}
+	var specs []forward.Spec
+	for _, t := range st.tunnels {
+		status := t.Status()
+		t.Stop()
+		state := string(status.State)
+		if status.Err != "" && status.State != forward.StateUp {
+			state += ": " + status.Err
+		}
+		rows = append(rows, []string{
+			status.Name, status.Spec.String(), state,
+			sftp.FormatBytes(status.BytesIn), sftp.FormatBytes(status.BytesOut),
+		})
+		specs = append(specs, status.Spec)
+	}
+	if !quiet {
+		printTable(rows)
+	}
+
+	if !st.host.KeepTunnels {
+		infof("Stopped %d session tunnels\n", len(specs))
+		return
+	}
+	if err := daemon.Ensure(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: keep tunnels: %v\n", err)
+		return
+	}
+	for _, spec := range specs {
+		if _, err := daemon.Call(daemon.Request{Op: daemon.OpAdd, Spec: spec}); err != nil {
+			fmt.Fprintf(os.Stderr, "Tunnel %s: %v\n", spec.Name, err)
+			continue
+		}
+		infof("Tunnel %s: kept by the daemon\n", spec.Name)
+	}
+}
+
+// sessionConn lends the session's connection to its tunnels. Closing it
+// does nothing: the connection belongs to the session.
+type sessionConn struct{ *gossh.Client }
+
+func (sessionConn) Close() error { return nil }
+
+// sessionDialer returns the tunnels' DialFunc, which hands out the
+// session's connection. Once that is lost, dialing fails until a new one
+// (a reconnected jump chain) replaces it.
+func sessionDialer(current func() *gossh.Client) forward.DialFunc {
+	var (
+		mu   sync.Mutex
+		last *gossh.Client
+		lost bool
+	)
+	return func() (forward.Conn, error) {
+		client := current()
+		mu.Lock()
+		defer mu.Unlock()
+		if client == nil || (client == last && lost) {
+			return nil, errors.New("session connection lost")
+		}
+		if client != last {
+			last, lost = client, false
+			go func() {
+				client.Wait()
+				mu.Lock()
+				lost = lost || last == client
+				mu.Unlock()
+			}()
+		}
+		return sessionConn{client}, nil
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+	"github.com/ai-help-me/sshm/pkg/terminal"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// heldOutputLimit bounds the first shell's output kept while another shell
+// has the terminal; older output is dropped past it.
+const heldOutputLimit = 1 << 20
+
+// shellSwitch lets ~N open a second shell on a session's connection,
+// without another handshake, for when the first one is busy. The second
+// shell takes over the terminal until it exits; meanwhile the first
+// shell's output is held back and shown when it has the terminal again.
+type shellSwitch struct {
+	client  *gossh.Client
+	termMgr *terminal.Manager
+	host    *config.Host
+
+	mu      sync.Mutex
+	primary io.Writer   // The first shell's input
+	second  io.Writer   // The second shell's input, while it runs
+	session ssh.Session // The second shell
+	outputs []*heldWriter
+}
+
+func newShellSwitch(client *gossh.Client, termMgr *terminal.Manager, host *config.Host) *shellSwitch {
+	return &shellSwitch{client: client, termMgr: termMgr, host: host}
+}
+
+// route returns the writer keystrokes go through: to primary, the first
+// shell's input, or to the second shell while it runs.
+func (s *shellSwitch) route(primary io.Writer) io.Writer {
+	s.primary = primary
+	return writerFunc(func(p []byte) (int, error) {
+		s.mu.Lock()
+		w := s.primary
+		if s.second != nil {
+			w = s.second
+		}
+		s.mu.Unlock()
+		return w.Write(p)
+	})
+}
+
+// hold returns w for the first shell's output, holding output back while
+// the second shell has the terminal.
+func (s *shellSwitch) hold(w io.Writer) io.Writer {
+	h := &heldWriter{s: s, w: w}
+	s.outputs = append(s.outputs, h)
+	return h
+}
+
+// heldWriter is one of the first shell's outputs.
+type heldWriter struct {
+	s       *shellSwitch
+	w       io.Writer
+	held    []byte
+	dropped int
+}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if h.s.second == nil {
+		return h.w.Write(p)
+	}
+	h.held = append(h.held, p...)
+	if over := len(h.held) - heldOutputLimit; over > 0 {
+		h.held = h.held[over:]
+		h.dropped += over
+	}
+	return len(p), nil
+}
+
+// open starts the second shell and hands it the terminal. It returns once
+// the shell has started; the first shell gets the terminal back when the
+// second exits.
+func (s *shellSwitch) open(escape *ssh.EscapeWriter) {
+	s.mu.Lock()
+	running := s.session != nil
+	s.mu.Unlock()
+	if running {
+		escape.Printf("a second shell is already open")
+		return
+	}
+
+	conn, err := s.client.NewSession()
+	if err != nil {
+		escape.Printf("open shell: %v", err)
+		return
+	}
+	if s.host.AgentForwarding {
+		if err := forward.Agent(s.client, conn); err != nil {
+			escape.Printf("agent forwarding: %v", err)
+		}
+	}
+	session := ssh.WrapSession(conn)
+	if err := ssh.RequestPTY(session, ssh.DefaultSessionConfig(s.host)); err != nil {
+		session.Close()
+		escape.Printf("open shell: %v", err)
+		return
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		escape.Printf("open shell: %v", err)
+		return
+	}
+	session.SetOutput(sessionOutput(os.Stdout, s.host), os.Stderr)
+
+	escape.Printf("second shell on this connection; the first shell's output is held until it exits")
+	s.mu.Lock()
+	s.second, s.session = stdin, session
+	s.mu.Unlock()
+	if err := ssh.StartShell(session); err != nil {
+		s.done()
+		escape.Printf("open shell: %v", err)
+		return
+	}
+	first := s.termMgr.SwitchSession(session)
+
+	go func() {
+		session.Wait()
+		s.termMgr.SwitchSession(first)
+		// The second shell may have left modes set that the first
+		// does not expect
+		terminal.ResetModes(os.Stdout)
+		escape.Printf("back to the first shell")
+		s.done()
+	}()
+}
+
+// done gives the terminal back to the first shell, showing the output it
+// wrote in the meantime.
+func (s *shellSwitch) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session.Close()
+	s.second, s.session = nil, nil
+
+	for _, h := range s.outputs {
+		if h.dropped > 0 {
+			fmt.Fprintf(os.Stderr, "[sshm] %d bytes of earlier output dropped\r\n", h.dropped)
+		}
+		h.w.Write(h.held)
+		h.held, h.dropped = nil, 0
+	}
+}
+
+// close ends the second shell, if any, with the first.
+func (s *shellSwitch) close() {
+	s.mu.Lock()
+	session := s.session
+	s.mu.Unlock()
+	if session != nil {
+		session.Close()
+	}
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ai-help-me/sshm/pkg/config"
+	"github.com/ai-help-me/sshm/pkg/daemon"
+	"github.com/ai-help-me/sshm/pkg/forward"
+	"github.com/ai-help-me/sshm/pkg/sftp"
+	"github.com/ai-help-me/sshm/pkg/ssh"
+)
+
+const (
+	tunnelUsage = "tunnel add <host> [-L|-R [bind:]port:host:hostport | -D [bind:]port] [--name <name>] [--no-launch] | tunnel list | tunnel stop <name>|--all"
+	daemonUsage = "daemon"
+	statusUsage = "status"
+)
+
+// runTunnel implements "sshm tunnel": manage port forwards kept up by the
+// daemon.
+func runTunnel(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("usage: sshm %s", tunnelUsage)
+	}
+	switch args[0] {
+	case "add":
+		return runTunnelAdd(args[1:])
+	case "list", "ls":
+		return runTunnelList(args[1:])
+	case "stop":
+		return runTunnelStop(args[1:])
+	}
+	return usageErrorf("unknown tunnel command %q (want add, list or stop)", args[0])
+}
+
+// runTunnelAdd starts an ad-hoc forward (-L, -R or -D) or the tunnels
+// declared on the host. A single declared tunnel with launch set runs its
+// client once the tunnel is up.
+func runTunnelAdd(args []string) error {
+	fs := flag.NewFlagSet("tunnel add", flag.ContinueOnError)
+	local := fs.String("L", "", "forward local `[bind:]port:host:hostport` through the host (either side may be a socket path)")
+	remote := fs.String("R", "", "forward the host's `[bind:]port` to local host:hostport (either side may be a socket path)")
+	dynamic := fs.String("D", "", "run a SOCKS5 proxy on `[bind:]port` dialing from the host")
+	name := fs.String("name", "", "tunnel name (with -L, -R or -D), or the configured tunnel to start")
+	noLaunch := fs.Bool("no-launch", false, "only start the tunnel, without running its launch command")
+
+	// Flags may come before or after the host
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if fs.NArg() == 0 {
+		return usageErrorf("usage: sshm %s", tunnelUsage)
+	}
+	hostName := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+	ref, err := resolveHost(cfg, hostName)
+	if err != nil {
+		return err
+	}
+
+	adhoc := 0
+	for _, arg := range []string{*local, *remote, *dynamic} {
+		if arg != "" {
+			adhoc++
+		}
+	}
+	if adhoc > 1 {
+		return usageErrorf("use only one of -L, -R and -D")
+	}
+
+	var specs []forward.Spec
+	var launch *config.Tunnel
+	if adhoc == 1 {
+		spec := forward.Spec{Name: *name, Host: ref.Path}
+		var err error
+		var port string
+		switch {
+		case *local != "":
+			spec.Local, spec.Remote, err = forward.ParseLocal(*local)
+			port = addrLabel(spec.Local)
+		case *remote != "":
+			spec.Kind = forward.KindRemote
+			spec.Local, spec.Remote, err = forward.ParseRemote(*remote)
+			port = "R" + addrLabel(spec.Remote)
+		default:
+			spec.Kind = forward.KindDynamic
+			spec.Local, err = forward.ParseDynamic(*dynamic)
+			port = "D" + addrLabel(spec.Local)
+		}
+		if err != nil {
+			return withCode(exitUsage, err)
+		}
+		if spec.Name == "" {
+			spec.Name = ref.Host.Name + "-" + port
+		}
+		specs = append(specs, spec)
+	} else {
+		for i, spec := range hostTunnels(ref) {
+			if *name == "" || spec.Name == *name {
+				specs = append(specs, spec)
+				launch = &ref.Host.Tunnels[i]
+			}
+		}
+		switch {
+		case len(specs) == 0 && *name != "":
+			return usageErrorf("%s has no tunnel named %q", ref.Path, *name)
+		case len(specs) == 0:
+			return usageErrorf("%s has no tunnels configured; use -L, -R or -D to add one", ref.Path)
+		}
+	}
+
+	if len(specs) == 1 && launch != nil && launch.Launch != "" && !*noLaunch {
+		return launchTunnel(*launch, specs[0])
+	}
+
+	if err := daemon.Ensure(); err != nil {
+		return err
+	}
+
+	if len(specs) == 1 {
+		if _, err := daemon.Call(daemon.Request{Op: daemon.OpAdd, Spec: specs[0]}); err != nil {
+			return err
+		}
+		infof("Tunnel %s: %s via %s\n", specs[0].Name, specs[0], specs[0].Host)
+		return nil
+	}
+
+	failed := 0
+	for _, spec := range specs {
+		if _, err := daemon.Call(daemon.Request{Op: daemon.OpAdd, Spec: spec}); err != nil {
+			fmt.Fprintf(os.Stderr, "Tunnel %s: %v\n", spec.Name, err)
+			failed++
+			continue
+		}
+		infof("Tunnel %s: %s via %s\n", spec.Name, spec, spec.Host)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tunnels failed to start", failed, len(specs))
+	}
+	return nil
+}
+
+// launchTunnel starts spec, unless it is already running, and runs the
+// tunnel's launch command against it. A typed tunnel's client is pointed
+// at the local end. A tunnel started here stops when the command exits.
+func launchTunnel(t config.Tunnel, spec forward.Spec) error {
+	args := strings.Fields(t.Launch)
+	if preset, ok := config.TunnelPresets[t.Type]; ok && !forward.IsSocket(spec.Local) {
+		host, port, err := net.SplitHostPort(spec.Local)
+		if err != nil {
+			return withCode(exitConfig, fmt.Errorf("tunnel %s: %w", spec.Name, err))
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		args = append(append([]string{args[0]}, preset.ClientArgs(host, port)...), args[1:]...)
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return withCode(exitConfig, fmt.Errorf("tunnel %s: %w", spec.Name, err))
+	}
+
+	if err := daemon.Ensure(); err != nil {
+		return err
+	}
+	running := false
+	if resp, err := daemon.Call(daemon.Request{Op: daemon.OpStatus}); err == nil {
+		for _, st := range resp.Tunnels {
+			running = running || st.Name == spec.Name
+		}
+	}
+	if !running {
+		if _, err := daemon.Call(daemon.Request{Op: daemon.OpAdd, Spec: spec}); err != nil {
+			return err
+		}
+		infof("Tunnel %s: %s via %s\n", spec.Name, spec, spec.Host)
+		defer func() {
+			if _, err := daemon.Call(daemon.Request{Op: daemon.OpStop, Name: spec.Name}); err == nil {
+				infof("Stopped %s\n", spec.Name)
+			}
+		}()
+	}
+
+	// Ctrl+C belongs to the client; sshm must live on to stop the tunnel
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+// runTunnelList shows the running tunnels and the configured ones that
+// are not running.
+func runTunnelList(args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("usage: sshm tunnel list")
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return withCode(exitConfig, err)
+	}
+
+	var running []forward.Status
+	if resp, err := daemon.Call(daemon.Request{Op: daemon.OpStatus}); err == nil {
+		running = resp.Tunnels
+	}
+
+	rows := [][]string{{"NAME", "HOST", "FORWARD", "STATE"}}
+	seen := make(map[string]bool)
+	for _, st := range running {
+		seen[st.Name] = true
+		rows = append(rows, []string{st.Name, st.Host, st.Spec.String(), string(st.State)})
+	}
+	for _, ref := range allLeaves(cfg.Hosts, "") {
+		for i, spec := range hostTunnels(ref) {
+			if seen[spec.Name] {
+				continue
+			}
+			state := string(forward.StateStopped)
+			if ref.Host.Tunnels[i].Autostart {
+				state += " (autostart)"
+			}
+			rows = append(rows, []string{spec.Name, spec.Host, spec.String(), state})
+		}
+	}
+
+	if len(rows) == 1 {
+		infof("No tunnels\n")
+		return nil
+	}
+	printTable(rows)
+	return nil
+}
+
+// runTunnelStop stops one tunnel, or all of them with --all.
+func runTunnelStop(args []string) error {
+	fs := flag.NewFlagSet("tunnel stop", flag.ContinueOnError)
+	all := fs.Bool("all", false, "stop every tunnel and the daemon")
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+
+	name := fs.Arg(0)
+	if (name == "") == !*all || fs.NArg() > 1 {
+		return usageErrorf("usage: sshm tunnel stop <name>|--all")
+	}
+	if !daemon.Running() {
+		return fmt.Errorf("no tunnels are running")
+	}
+
+	if _, err := daemon.Call(daemon.Request{Op: daemon.OpStop, Name: name}); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if *all {
+		infof("Stopped all tunnels\n")
+	} else {
+		infof("Stopped %s\n", name)
+	}
+	return nil
+}
+
+// runDaemon implements "sshm daemon": run the tunnel daemon in the
+// foreground, starting the autostart tunnels. "sshm tunnel add" spawns it
+// in the background when needed.
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return withCode(exitUsage, err)
+	}
+	if daemon.Running() {
+		return fmt.Errorf("daemon already running")
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	srv := daemon.NewServer(dialerFor, logger)
+
+	if cfg, err := config.Load(""); err != nil {
+		logger.Printf("load config: %v", err)
+	} else {
+		for _, spec := range autostartTunnels(cfg) {
+			if err := srv.Add(spec); err != nil {
+				logger.Printf("tunnel %s: %v", spec.Name, err)
+			}
+		}
+	}
+
+	return srv.Serve()
+}
+
+// runStatus implements "sshm status".
+func runStatus(args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("usage: sshm status")
+	}
+
+	resp, err := daemon.Call(daemon.Request{Op: daemon.OpStatus})
+	if err != nil {
+		fmt.Println("Daemon: not running")
+		return nil
+	}
+
+	fmt.Printf("Daemon: running (pid %d, up %s)\n", resp.PID, time.Since(resp.Started).Round(time.Second))
+	if len(resp.Tunnels) == 0 {
+		fmt.Println("No tunnels")
+		printPool(resp.Masters)
+		return nil
+	}
+
+	fmt.Println()
+	rows := [][]string{{"NAME", "FORWARD", "HOST", "STATE", "CONNS", "IN", "OUT"}}
+	for _, st := range resp.Tunnels {
+		state := fmt.Sprintf("%s %s", st.State, time.Since(st.Since).Round(time.Second))
+		if st.Retries > 0 {
+			state += fmt.Sprintf(", %d retries", st.Retries)
+		}
+		rows = append(rows, []string{
+			st.Name, st.Spec.String(), st.Host, state,
+			fmt.Sprint(st.Conns), sftp.FormatBytes(st.BytesIn), sftp.FormatBytes(st.BytesOut),
+		})
+	}
+	printTable(rows)
+
+	for _, st := range resp.Tunnels {
+		if st.Err != "" && st.State != forward.StateUp {
+			fmt.Printf("%s: %s\n", st.Name, st.Err)
+		}
+	}
+	printPool(resp.Masters)
+	return nil
+}
+
+// printPool lists the connections the daemon keeps for control-persist.
+func printPool(masters []daemon.MasterStatus) {
+	if len(masters) == 0 {
+		return
+	}
+	fmt.Println()
+	rows := [][]string{{"POOLED", "UP", "USERS", "IDLE"}}
+	for _, m := range masters {
+		idle := "-"
+		if m.Clients == 0 {
+			idle = fmt.Sprintf("%s of %s", time.Since(m.IdleSince).Round(time.Second), m.Persist)
+		}
+		rows = append(rows, []string{
+			m.Host, time.Since(m.Since).Round(time.Second).String(), fmt.Sprint(m.Clients), idle,
+		})
+	}
+	printTable(rows)
+}
+
+// startAutostartTunnels spawns the daemon when the config declares
+// autostart tunnels and it isn't running yet. Failures are reported but
+// not fatal.
+func startAutostartTunnels(cfg *config.Config) {
+	if len(autostartTunnels(cfg)) == 0 || daemon.Running() {
+		return
+	}
+	if err := daemon.Spawn(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: autostart tunnels: %v\n", err)
+	}
+}
+
+// dialerFor resolves a host path for the daemon. The config is reloaded
+// so tunnels pick up edits made since the daemon started.
+func dialerFor(path string) (forward.DialFunc, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := resolveHost(cfg, path)
+	if err != nil {
+		return nil, err
+	}
+	host := ref.Host
+	return func() (forward.Conn, error) {
+		if len(host.Jump) > 0 {
+			jumpChain := ssh.NewJumpChainWithTarget(host)
+			if _, err := jumpChain.Connect(); err != nil {
+				return nil, fmt.Errorf("jump chain: %w", err)
+			}
+			return jumpChain, nil
+		}
+		// Closing the client releases the connection
+		client, _, err := dialHost(host)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}, nil
+}
+
+// addrLabel names a forward after its listening end: the port, or the
+// socket's file name.
+func addrLabel(addr string) string {
+	if forward.IsSocket(addr) {
+		return filepath.Base(addr)
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
+
+// hostTunnels returns the tunnels declared on a host.
+func hostTunnels(ref config.HostRef) []forward.Spec {
+	specs := make([]forward.Spec, len(ref.Host.Tunnels))
+	for i, t := range ref.Host.Tunnels {
+		specs[i] = forward.FromConfig(ref.Path, t)
+	}
+	return specs
+}
+
+// autostartTunnels returns every tunnel declared with autostart: true.
+func autostartTunnels(cfg *config.Config) []forward.Spec {
+	var specs []forward.Spec
+	for _, ref := range allLeaves(cfg.Hosts, "") {
+		for i, spec := range hostTunnels(ref) {
+			if ref.Host.Tunnels[i].Autostart {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs
+}
+
+// printTable prints rows with aligned columns.
+func printTable(rows [][]string) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			fmt.Fprintf(&b, "%-*s  ", widths[i], cell)
+		}
+		fmt.Println(b.String())
+	}
+}